@@ -0,0 +1,76 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/community"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// RequireVerified sets whether posting to a community requires a verified email.
+func RequireVerified(log *log.Logger, cfg database.Config, name string, value string) error {
+	var require bool
+	switch value {
+	case "on":
+		require = true
+	case "off":
+		require = false
+	default:
+		fmt.Println("help: require-verified <community> <on|off>")
+		return ErrHelp
+	}
+	if name == "" {
+		fmt.Println("help: require-verified <community> <on|off>")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := community.New(log, db).SetRequireVerifiedEmail(ctx, name, require, time.Now()); err != nil {
+		return errors.Wrapf(err, "updating community %q", name)
+	}
+
+	fmt.Printf("verified email requirement for %s: %s\n", name, value)
+	return nil
+}
+
+// SetOwner makes a user the owner of a community.
+func SetOwner(log *log.Logger, cfg database.Config, name string, userName string) error {
+	if name == "" || userName == "" {
+		fmt.Println("help: set-owner <community> <user>")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	usr, err := user.New(log, db).Lookup(ctx, userName)
+	if err != nil {
+		return errors.Wrapf(err, "looking up user %q", userName)
+	}
+
+	if err := community.New(log, db).SetOwner(ctx, name, usr.ID, time.Now()); err != nil {
+		return errors.Wrapf(err, "updating community %q", name)
+	}
+
+	fmt.Printf("owner of %s: %s\n", name, usr.Name)
+	return nil
+}
@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/export"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// ExportUser writes the archive a user gets from a data export to a file,
+// <name>.zip unless given.
+func ExportUser(log *log.Logger, cfg database.Config, name string, file string) error {
+	if name == "" {
+		fmt.Println("help: export-user <name> [file]")
+		return ErrHelp
+	}
+	if file == "" {
+		file = name + ".zip"
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	usr, err := user.New(log, db).Lookup(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "looking up user %q", name)
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return errors.Wrap(err, "creating archive")
+	}
+	defer f.Close()
+
+	if err := export.New(log, db, nil).Write(ctx, f, usr.ID, time.Now()); err != nil {
+		return errors.Wrap(err, "writing archive")
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrap(err, "closing archive")
+	}
+
+	fmt.Printf("data of %s written to %s\n", usr.Name, file)
+	return nil
+}
@@ -0,0 +1,87 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/lockout"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// Lockouts lists usernames and client addresses which are currently locked
+// out. The store has to be the one the api is configured with.
+func Lockouts(log *log.Logger, cfg database.Config, store string) error {
+	if err := checkLockoutStore(store); err != nil {
+		return err
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	locks, err := lockout.NewPostgres(log, db, lockout.Policy{}).Locked(ctx, now)
+	if err != nil {
+		return errors.Wrap(err, "listing lockouts")
+	}
+
+	for _, l := range locks {
+		fmt.Printf("%s\tfailures: %d\tlocked for: %s\n", l.Key, l.Failures, l.LockedUntil.Sub(now).Round(time.Second))
+	}
+	fmt.Printf("%d locked\n", len(locks))
+	return nil
+}
+
+// Unlock forgets failed login attempts of a username or, when prefixed with
+// "ip:", of a client address.
+func Unlock(log *log.Logger, cfg database.Config, store string, key string) error {
+	if key == "" {
+		fmt.Println("help: unlock <name|ip:address>")
+		return ErrHelp
+	}
+	if err := checkLockoutStore(store); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(key, "ip:") {
+		key = lockout.UserKey(key)
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := lockout.NewPostgres(log, db, lockout.Policy{}).Reset(ctx, key); err != nil {
+		return errors.Wrapf(err, "unlocking %s", key)
+	}
+
+	fmt.Printf("%s unlocked\n", key)
+	return nil
+}
+
+// checkLockoutStore makes sure lockouts are kept where this program can see
+// them. The memory store lives inside the api process, which lists them on
+// its debug host and forgets all failed attempts when it restarts.
+func checkLockoutStore(store string) error {
+	switch store {
+	case "postgres":
+		return nil
+	case "memory":
+		return errors.New("lockouts of the memory store are only known to the api, list them at /debug/lockouts on its debug host or restart it to clear them")
+	default:
+		return errors.Errorf("unknown lockout store %q", store)
+	}
+}
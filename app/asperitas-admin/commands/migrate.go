@@ -1,8 +1,11 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"log"
 
+	"github.com/cravtos/asperitas-backend/business/data/post"
 	"github.com/cravtos/asperitas-backend/business/data/schema"
 	"github.com/cravtos/asperitas-backend/foundation/database"
 	"github.com/pkg/errors"
@@ -11,8 +14,10 @@ import (
 // ErrHelp provides context that help was given.
 var ErrHelp = errors.New("provided help")
 
-// Migrate creates the schema in the database.
-func Migrate(cfg database.Config) error {
+// Migrate creates the schema in the database. Data which has to be migrated
+// in Go rather than SQL, like the canonical URLs of link posts, is updated
+// afterwards.
+func Migrate(log *log.Logger, cfg database.Config) error {
 	db, err := database.Open(cfg)
 	if err != nil {
 		return errors.Wrap(err, "connect database")
@@ -23,6 +28,12 @@ func Migrate(cfg database.Config) error {
 		return errors.Wrap(err, "migrate database")
 	}
 
-	fmt.Println("migrations complete")
+	// Canonicalizing links neither publishes events nor shows images.
+	n, err := post.New(log, db, nil, nil).CanonicalizeLinks(context.Background())
+	if err != nil {
+		return errors.Wrap(err, "canonicalize link posts")
+	}
+
+	fmt.Printf("migrations complete, canonicalized %d links\n", n)
 	return nil
 }
@@ -0,0 +1,33 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// PurgeDeleted deletes the accounts whose grace period is over without
+// waiting for the API to do it.
+func PurgeDeleted(log *log.Logger, cfg database.Config) error {
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n, err := user.New(log, db).Purge(ctx, time.Now())
+	if err != nil {
+		return errors.Wrapf(err, "purged %d accounts before failing", n)
+	}
+
+	fmt.Printf("purged %d accounts\n", n)
+	return nil
+}
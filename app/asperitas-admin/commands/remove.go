@@ -0,0 +1,96 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// RemovePost deletes a post as a moderator. Its author is notified with the
+// reason and clients following the post are told through the event bus the
+// api is configured with.
+func RemovePost(log *log.Logger, cfg database.Config, bus string, channel string, postID string, reason string) error {
+	if postID == "" {
+		fmt.Println("help: remove-post <post_id> [reason]")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	events, err := newBus(log, db, cfg, bus, channel)
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Removed posts are not shown, so their images do not have to be found.
+	if err := post.New(log, db, events, nil).Remove(ctx, postID, reason, time.Now()); err != nil {
+		return errors.Wrap(err, "remove post")
+	}
+
+	fmt.Printf("removed post %s\n", postID)
+	return nil
+}
+
+// RemoveComment deletes a comment as a moderator. Its author is notified
+// with the reason and clients following the post are told like RemovePost
+// does.
+func RemoveComment(log *log.Logger, cfg database.Config, bus string, channel string, commentID string, reason string) error {
+	if commentID == "" {
+		fmt.Println("help: remove-comment <comment_id> [reason]")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	events, err := newBus(log, db, cfg, bus, channel)
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := post.New(log, db, events, nil).RemoveComment(ctx, commentID, reason, time.Now()); err != nil {
+		return errors.Wrap(err, "remove comment")
+	}
+
+	fmt.Printf("removed comment %s\n", commentID)
+	return nil
+}
+
+// newBus constructs the event bus the api is configured with. Events on the
+// memory bus never leave this program, so nobody hears of them.
+func newBus(log *log.Logger, db *sqlx.DB, cfg database.Config, bus string, channel string) (pubsub.Bus, error) {
+	switch bus {
+	case "memory":
+		return pubsub.New(), nil
+	case "postgres":
+		pg, err := pubsub.NewPostgres(log, db, cfg, channel)
+		if err != nil {
+			return nil, errors.Wrap(err, "listening for events")
+		}
+		return pg, nil
+	default:
+		return nil, errors.Errorf("unknown event bus %q", bus)
+	}
+}
@@ -0,0 +1,43 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/twofactor"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// ResetTwoFactor turns off two-factor authentication for a user who lost
+// access to both their authenticator and recovery codes.
+func ResetTwoFactor(log *log.Logger, cfg database.Config, name string) error {
+	if name == "" {
+		fmt.Println("help: reset-2fa <name>")
+		return ErrHelp
+	}
+
+	db, err := database.Open(cfg)
+	if err != nil {
+		return errors.Wrap(err, "connect database")
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	usr, err := user.New(log, db).Lookup(ctx, name)
+	if err != nil {
+		return errors.Wrapf(err, "looking up user %q", name)
+	}
+
+	if err := twofactor.New(log, db).Reset(ctx, usr.ID); err != nil {
+		return errors.Wrap(err, "resetting two-factor")
+	}
+
+	fmt.Printf("two-factor authentication reset for %s\n", usr.Name)
+	return nil
+}
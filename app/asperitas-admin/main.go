@@ -42,6 +42,13 @@ func run(log *log.Logger) error {
 			Name       string `conf:"default:postgres"`
 			DisableTLS bool   `conf:"default:true"`
 		}
+		Lockout struct {
+			Store string `conf:"default:memory,help:where the api tracks failed logins: memory or postgres"`
+		}
+		Events struct {
+			Bus     string `conf:"default:memory,help:how the api shares live events: memory or postgres"`
+			Channel string `conf:"default:asperitas_events"`
+		}
 	}
 	cfg.Version.SVN = build
 	cfg.Version.Desc = "copyright free"
@@ -86,7 +93,7 @@ func run(log *log.Logger) error {
 
 	switch cfg.Args.Num(0) {
 	case "migrate":
-		if err := commands.Migrate(dbConfig); err != nil {
+		if err := commands.Migrate(log, dbConfig); err != nil {
 			return errors.Wrap(err, "migrating database")
 		}
 
@@ -100,10 +107,64 @@ func run(log *log.Logger) error {
 			return errors.Wrap(err, "key generation")
 		}
 
+	case "lockouts":
+		if err := commands.Lockouts(log, dbConfig, cfg.Lockout.Store); err != nil {
+			return errors.Wrap(err, "listing lockouts")
+		}
+
+	case "unlock":
+		if err := commands.Unlock(log, dbConfig, cfg.Lockout.Store, cfg.Args.Num(1)); err != nil {
+			return errors.Wrap(err, "unlocking")
+		}
+
+	case "reset-2fa":
+		if err := commands.ResetTwoFactor(log, dbConfig, cfg.Args.Num(1)); err != nil {
+			return errors.Wrap(err, "resetting two-factor")
+		}
+
+	case "require-verified":
+		if err := commands.RequireVerified(log, dbConfig, cfg.Args.Num(1), cfg.Args.Num(2)); err != nil {
+			return errors.Wrap(err, "updating community")
+		}
+
+	case "set-owner":
+		if err := commands.SetOwner(log, dbConfig, cfg.Args.Num(1), cfg.Args.Num(2)); err != nil {
+			return errors.Wrap(err, "updating community")
+		}
+
+	case "purge-deleted":
+		if err := commands.PurgeDeleted(log, dbConfig); err != nil {
+			return errors.Wrap(err, "purging deleted accounts")
+		}
+
+	case "export-user":
+		if err := commands.ExportUser(log, dbConfig, cfg.Args.Num(1), cfg.Args.Num(2)); err != nil {
+			return errors.Wrap(err, "exporting user")
+		}
+
+	case "remove-post":
+		if err := commands.RemovePost(log, dbConfig, cfg.Events.Bus, cfg.Events.Channel, cfg.Args.Num(1), cfg.Args.Num(2)); err != nil {
+			return errors.Wrap(err, "removing post")
+		}
+
+	case "remove-comment":
+		if err := commands.RemoveComment(log, dbConfig, cfg.Events.Bus, cfg.Events.Channel, cfg.Args.Num(1), cfg.Args.Num(2)); err != nil {
+			return errors.Wrap(err, "removing comment")
+		}
+
 	default:
 		fmt.Println("migrate: create the schema in the database")
 		fmt.Println("seed: add data to the database")
 		fmt.Println("genkey: generate a set of private/public key files")
+		fmt.Println("reset-2fa: turn off two-factor authentication for a user")
+		fmt.Println("lockouts: list locked out users and addresses")
+		fmt.Println("unlock: clear failed login attempts of a user or address")
+		fmt.Println("require-verified: require a verified email to post in a community")
+		fmt.Println("set-owner: make a user the owner of a community who manages its webhooks")
+		fmt.Println("purge-deleted: delete accounts whose grace period is over")
+		fmt.Println("export-user: write all data of a user to a zip file")
+		fmt.Println("remove-post: delete a post and tell its author why")
+		fmt.Println("remove-comment: delete a comment and tell its author why")
 		fmt.Println("provide a command to get more help.")
 		return commands.ErrHelp
 	}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// Page sizes of listings.
+const (
+	defaultPageRows = 25
+	maxPageRows     = 100
+)
+
+// pageQuery reads ?page=, ?limit= and ?sort= of a listing request.
+func pageQuery(r *http.Request) (post.PageQuery, error) {
+	q := r.URL.Query()
+	pq := post.PageQuery{
+		Page: 1,
+		Rows: defaultPageRows,
+		Sort: post.SortNew,
+	}
+
+	if s := q.Get("page"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return post.PageQuery{}, web.NewRequestError(errors.New("page must be a positive number"), http.StatusBadRequest)
+		}
+		pq.Page = n
+	}
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxPageRows {
+			err := errors.Errorf("limit must be between 1 and %d", maxPageRows)
+			return post.PageQuery{}, web.NewRequestError(err, http.StatusBadRequest)
+		}
+		pq.Rows = n
+	}
+	if s := q.Get("sort"); s != "" {
+		pq.Sort = s
+	}
+
+	return pq, nil
+}
+
+func (pg postGroup) queryUserComments(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, _ := ctx.Value(auth.Key).(auth.Claims)
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	name := web.Params(r)["user"]
+	comments, err := pg.post.QueryCommentsByUser(ctx, claims, name, pq)
+	if err != nil {
+		switch err {
+		case post.ErrInvalidSort:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case post.ErrUserNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying comments of user with name %s", name)
+		}
+	}
+
+	return web.Respond(ctx, w, comments, http.StatusOK)
+}
+
+func (pg postGroup) queryOverview(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, _ := ctx.Value(auth.Key).(auth.Claims)
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	name := web.Params(r)["user"]
+	activity, err := pg.post.QueryOverview(ctx, claims, name, pq)
+	if err != nil {
+		switch err {
+		case post.ErrInvalidSort:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case post.ErrUserNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying activity of user with name %s", name)
+		}
+	}
+
+	return web.Respond(ctx, w, activity, http.StatusOK)
+}
+
+// queryVoted returns a handler listing posts the user gave the vote to.
+func (pg postGroup) queryVoted(vote int) web.Handler {
+	return func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		claims, ok := ctx.Value(auth.Key).(auth.Claims)
+		if !ok {
+			return errors.New("claims missing from context")
+		}
+
+		pq, err := pageQuery(r)
+		if err != nil {
+			return err
+		}
+
+		posts, err := pg.post.QueryVoted(ctx, claims, vote, pq)
+		if err != nil {
+			switch err {
+			case post.ErrInvalidSort:
+				return web.NewRequestError(err, http.StatusBadRequest)
+			default:
+				return errors.Wrapf(err, "querying posts voted %d by user with ID: %s", vote, claims.User.ID)
+			}
+		}
+
+		return web.Respond(ctx, w, posts, http.StatusOK)
+	}
+}
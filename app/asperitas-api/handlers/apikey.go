@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type apiKeyGroup struct {
+	apiKey apikey.APIKey
+}
+
+func (kg apiKeyGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nk apikey.NewKey
+	if err := web.Decode(r, &nk); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	key, err := kg.apiKey.Create(ctx, claims, nk, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case apikey.ErrInvalidScope, apikey.ErrInvalidExpiry, apikey.ErrInvalidRateLimit:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "creating key %q", nk.Name)
+		}
+	}
+
+	return web.Respond(ctx, w, key, http.StatusCreated)
+}
+
+func (kg apiKeyGroup) query(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	keys, err := kg.apiKey.Query(ctx, claims)
+	if err != nil {
+		return errors.Wrapf(err, "querying keys of user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, keys, http.StatusOK)
+}
+
+func (kg apiKeyGroup) revoke(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	keyID := web.Params(r)["key_id"]
+	if err := kg.apiKey.Revoke(ctx, claims, keyID, v.Now); err != nil {
+		switch err {
+		case apikey.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case apikey.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "revoking key %s", keyID)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
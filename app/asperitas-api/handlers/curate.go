@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+func (pg postGroup) hide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	postID := web.Params(r)["post_id"]
+	if err := pg.post.Hide(ctx, claims, postID, v.Now); err != nil {
+		switch err {
+		case post.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case post.ErrPostNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "hiding post with ID: %s", postID)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg postGroup) unhide(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	postID := web.Params(r)["post_id"]
+	if err := pg.post.Unhide(ctx, claims, postID); err != nil {
+		switch err {
+		case post.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "unhiding post with ID: %s", postID)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (pg postGroup) queryHidden(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	posts, err := pg.post.QueryHidden(ctx, claims, pq)
+	if err != nil {
+		return errors.Wrapf(err, "querying hidden posts of user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, posts, http.StatusOK)
+}
+
+func (ug userGroup) block(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	name := web.Params(r)["user"]
+	if err := ug.user.Block(ctx, claims, name, v.Now); err != nil {
+		switch err {
+		case user.ErrBlockSelf:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "blocking user with name %s", name)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (ug userGroup) unblock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	name := web.Params(r)["user"]
+	if err := ug.user.Unblock(ctx, claims, name); err != nil {
+		switch err {
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "unblocking user with name %s", name)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (ug userGroup) queryBlocked(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	blocked, err := ug.user.QueryBlocked(ctx, claims)
+	if err != nil {
+		return errors.Wrapf(err, "querying users blocked by user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, blocked, http.StatusOK)
+}
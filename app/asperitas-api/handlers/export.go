@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/export"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type exportGroup struct {
+	export export.Export
+}
+
+func (eg exportGroup) request(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	ex, err := eg.export.Request(ctx, claims, v.Now)
+	if err != nil {
+		switch err {
+		case export.ErrInProgress:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "requesting export for user with ID: %s", claims.User.ID)
+		}
+	}
+
+	return web.Respond(ctx, w, ex, http.StatusAccepted)
+}
+
+func (eg exportGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	exportID := web.Params(r)["export_id"]
+	ex, err := eg.export.QueryByID(ctx, claims, exportID)
+	if err != nil {
+		switch err {
+		case export.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case export.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying export with ID: %s", exportID)
+		}
+	}
+
+	return web.Respond(ctx, w, ex, http.StatusOK)
+}
+
+func (eg exportGroup) download(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	exportID := web.Params(r)["export_id"]
+	q := r.URL.Query()
+	archive, err := eg.export.Download(ctx, exportID, q.Get("expires"), q.Get("signature"), v.Now)
+	if err != nil {
+		switch err {
+		case export.ErrInvalidLink:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "downloading export with ID: %s", exportID)
+		}
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "asperitas-"+exportID+".zip"))
+	w.Header().Set("Cache-Control", "no-store")
+	return web.RespondRaw(ctx, w, archive, "application/zip", http.StatusOK)
+}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/foundation/feed"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// maxFeedItems is how many of the newest posts a feed lists.
+const maxFeedItems = 50
+
+// feedFormats maps the extensions feeds are requested with to how they are
+// rendered.
+var feedFormats = map[string]struct {
+	render      func(feed.Feed) ([]byte, error)
+	contentType string
+}{
+	".rss":  {feed.RSS, feed.ContentTypeRSS},
+	".atom": {feed.Atom, feed.ContentTypeAtom},
+	".json": {feed.JSON, feed.ContentTypeJSON},
+}
+
+// feedFormat splits a path segment like "music.rss" into the name and the
+// extension of a feed format. The extension is empty when the segment does
+// not ask for a feed.
+func feedFormat(segment string) (string, string) {
+	i := strings.LastIndex(segment, ".")
+	if i <= 0 {
+		return segment, ""
+	}
+	if _, ok := feedFormats[segment[i:]]; !ok {
+		return segment, ""
+	}
+	return segment[:i], segment[i:]
+}
+
+func (pg postGroup) categoryFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, category string, format string) error {
+	// Feeds are the same for everyone so readers and proxies can cache them.
+	posts, err := pg.post.QueryByCat(ctx, auth.Claims{}, category)
+	if err != nil && err != post.ErrPostNotFound {
+		return errors.Wrapf(err, "querying feed of community: %s", category)
+	}
+
+	f := feed.Feed{
+		Title:       "a/" + category,
+		Description: "Newest posts in a/" + category,
+		Link:        pg.publicURL + "/a/" + url.PathEscape(category),
+		Self:        selfURL(r),
+		Items:       pg.feedItems(posts),
+	}
+	return respondFeed(ctx, w, r, f, format)
+}
+
+func (pg postGroup) userFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, name string, format string) error {
+	posts, err := pg.post.QueryByUser(ctx, auth.Claims{}, name)
+	if err != nil {
+		switch err {
+		case post.ErrPostNotFound:
+		case post.ErrUserNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying feed of user: %s", name)
+		}
+	}
+
+	f := feed.Feed{
+		Title:       "u/" + name,
+		Description: "Newest posts by u/" + name,
+		Link:        pg.publicURL + "/u/" + url.PathEscape(name),
+		Self:        selfURL(r),
+		Items:       pg.feedItems(posts),
+	}
+	return respondFeed(ctx, w, r, f, format)
+}
+
+// feedItems turns the newest posts into feed items. Link posts point at the
+// page they share and are described by its preview, image posts point at the
+// image and text posts point at themselves.
+func (pg postGroup) feedItems(posts []post.Info) []feed.Item {
+	var items []feed.Item
+	for _, pi := range posts {
+		switch p := pi.(type) {
+		case post.InfoText:
+			link := pg.postURL(p.Category, p.ID)
+			items = append(items, feed.Item{
+				ID:        "urn:uuid:" + p.ID,
+				Title:     p.Title,
+				Link:      link,
+				Author:    p.Author.Username,
+				Content:   p.Payload,
+				Published: p.DateCreated,
+			})
+		case post.InfoLink:
+			var content string
+			var updated time.Time
+			if p.Preview != nil {
+				if p.Preview.Description != nil {
+					content = *p.Preview.Description
+				}
+				if p.Preview.DateFetched != nil {
+					updated = *p.Preview.DateFetched
+				}
+			}
+			items = append(items, feed.Item{
+				ID:        "urn:uuid:" + p.ID,
+				Title:     p.Title,
+				Link:      p.Payload,
+				Comments:  pg.postURL(p.Category, p.ID),
+				Author:    p.Author.Username,
+				Content:   content,
+				Published: p.DateCreated,
+				Updated:   updated,
+			})
+		case post.InfoImage:
+			items = append(items, feed.Item{
+				ID:        "urn:uuid:" + p.ID,
+				Title:     p.Title,
+				Link:      p.Image.URL,
+				Comments:  pg.postURL(p.Category, p.ID),
+				Author:    p.Author.Username,
+				Published: p.DateCreated,
+			})
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Published.After(items[j].Published)
+	})
+	if len(items) > maxFeedItems {
+		items = items[:maxFeedItems]
+	}
+	return items
+}
+
+// postURL returns where users read the post on the frontend.
+func (pg postGroup) postURL(category string, postID string) string {
+	return pg.publicURL + "/a/" + url.PathEscape(category) + "/" + postID
+}
+
+// selfURL returns the address the request was made to.
+func selfURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+// respondFeed renders the feed in the format. Clients which already have the
+// same document are told so instead of getting it again.
+func respondFeed(ctx context.Context, w http.ResponseWriter, r *http.Request, f feed.Feed, format string) error {
+	ff := feedFormats[format]
+	data, err := ff.render(f)
+	if err != nil {
+		return errors.Wrap(err, "rendering feed")
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	modified := f.LastModified().UTC().Truncate(time.Second)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+
+	if notModified(r, etag, modified) {
+		return web.RespondRaw(ctx, w, nil, ff.contentType, http.StatusNotModified)
+	}
+	return web.RespondRaw(ctx, w, data, ff.contentType, http.StatusOK)
+}
+
+// notModified tells if the client already has the document with the etag
+// which last changed at modified. If-None-Match wins over If-Modified-Since
+// as RFC 7232 asks.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == etag || tag == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || modified.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	return !modified.After(t)
+}
@@ -6,20 +6,84 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/business/data/export"
+	"github.com/cravtos/asperitas-backend/business/data/identity"
+	"github.com/cravtos/asperitas-backend/business/data/media"
+	"github.com/cravtos/asperitas-backend/business/data/message"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/oauth"
 	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/business/data/twofactor"
 	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/data/webhook"
+	"github.com/cravtos/asperitas-backend/business/lockout"
 	"github.com/cravtos/asperitas-backend/business/mid"
+	"github.com/cravtos/asperitas-backend/business/oidc"
+	"github.com/cravtos/asperitas-backend/foundation/blob"
+	"github.com/cravtos/asperitas-backend/foundation/imaging"
+	"github.com/cravtos/asperitas-backend/foundation/mail"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/cravtos/asperitas-backend/foundation/ratelimit"
 	"github.com/cravtos/asperitas-backend/foundation/web"
 	"github.com/jmoiron/sqlx"
 )
 
+// APIConfig contains all the mandatory systems required by handlers.
+type APIConfig struct {
+	Build    string
+	Shutdown chan os.Signal
+	Log      *log.Logger
+	Auth     *auth.Auth
+	DB       *sqlx.DB
+	Lockout  lockout.Tracker
+	Policy   user.Policy
+	Mailer   mail.Mailer
+
+	// PublicURL is where users reach the frontend. Links sent by mail
+	// point there.
+	PublicURL string
+
+	// Providers are the identity providers users can log in with, by name.
+	Providers map[string]*oidc.Provider
+
+	// DeletionGrace is how long deleted accounts are kept before they are
+	// purged.
+	DeletionGrace time.Duration
+
+	// ExportKey signs the links data exports are downloaded from.
+	ExportKey []byte
+
+	// Events carries changes to posts and new notifications to the clients
+	// streaming them.
+	Events pubsub.Bus
+
+	// Media keeps the images users upload for image posts.
+	Media blob.BlobStore
+
+	// Images limits the images users upload and sets how big their
+	// thumbnails are.
+	Images imaging.Config
+
+	// MaxUpload is the size in bytes of the largest file users may upload.
+	MaxUpload int64
+
+	// Background counts work which goes on after the response was sent,
+	// so shutdown can wait for it.
+	Background *sync.WaitGroup
+}
+
 // API constructs an http.Handler with all application routes defined.
-func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, db *sqlx.DB) http.Handler {
+func API(cfg APIConfig) http.Handler {
+	build, log, a, db := cfg.Build, cfg.Log, cfg.Auth, cfg.DB
 
 	// Construct the web.App which holds all routes as well as common Middleware.
-	app := web.NewApp(shutdown, mid.Logger(log), mid.Errors(log), mid.Panics(log))
+	app := web.NewApp(cfg.Shutdown, mid.Logger(log), mid.Errors(log), mid.Panics(log))
 
 	// Register debug check endpoints.
 	cg := checkGroup{
@@ -29,31 +93,219 @@ func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, d
 	app.HandleDebug(http.MethodGet, "/readiness", cg.readiness)
 	app.HandleDebug(http.MethodGet, "/liveness", cg.liveness)
 
+	// Lockouts are listed from the running tracker, which is the only place
+	// lockouts of the memory store are known.
+	lkg := lockoutGroup{
+		lockout: cfg.Lockout,
+	}
+	app.HandleDebug(http.MethodGet, "/lockouts", lkg.locked)
+
+	// Every token has to belong to an active session. Routes which clients
+	// and API keys may call on behalf of users name the scopes they require,
+	// all the other ones are only for users themselves.
+	sess := session.New(log, db)
+	keys := apikey.New(log, db, ratelimit.New(time.Minute))
+	authenticate := mid.Authenticate(a, sess, keys)
+	scoped := func(scopes ...string) web.Middleware {
+		return mid.Authenticate(a, sess, keys, scopes...)
+	}
+	optional := mid.OptionalAuthenticate(a, sess, keys, auth.ScopeRead)
+
 	// Register user endpoints
 	ug := userGroup{
-		user: user.New(log, db),
-		auth: a,
+		log:       log,
+		user:      user.New(log, db),
+		twoFactor: twofactor.New(log, db),
+		session:   sess,
+		auth:      a,
+		lockout:   cfg.Lockout,
+		policy:    cfg.Policy,
+		mailer:    cfg.Mailer,
+		publicURL: cfg.PublicURL,
+		apiKey:    keys,
+
+		resets:     ratelimit.New(time.Hour),
+		background: cfg.Background,
+
+		deletionGrace: cfg.DeletionGrace,
 	}
 
 	app.Handle(http.MethodPost, "/api/register", ug.register)
 	app.Handle(http.MethodPost, "/api/login", ug.login)
+	app.Handle(http.MethodPost, "/api/login/2fa", ug.loginTwoFactor)
+	app.Handle(http.MethodGet, "/api/me", ug.me, scoped(auth.ScopeIdentity))
+	app.Handle(http.MethodDelete, "/api/me", ug.deleteAccount, authenticate)
+	app.Handle(http.MethodPatch, "/api/me/profile", ug.updateProfile, authenticate)
+	app.Handle(http.MethodGet, "/api/profile/:user", ug.profile)
+	app.Handle(http.MethodPost, "/api/me/password", ug.changePassword, authenticate)
+	app.Handle(http.MethodPost, "/api/password/forgot", ug.forgotPassword)
+	app.Handle(http.MethodPost, "/api/password/reset", ug.resetPassword)
+	app.Handle(http.MethodPut, "/api/me/email", ug.updateEmail, authenticate)
+	app.Handle(http.MethodPost, "/api/me/email/verify", ug.resendVerification, authenticate)
+	app.Handle(http.MethodPost, "/api/email/verify", ug.verifyEmail)
+	app.Handle(http.MethodPost, "/api/user/:user/block", ug.block, authenticate)
+	app.Handle(http.MethodDelete, "/api/user/:user/block", ug.unblock, authenticate)
+	app.Handle(http.MethodGet, "/api/me/blocked", ug.queryBlocked, authenticate)
+
+	// Register external identity provider endpoints
+	og := oidcGroup{
+		providers: cfg.Providers,
+		identity:  identity.New(log, db, cfg.Policy),
+		users:     ug,
+	}
+
+	app.Handle(http.MethodGet, "/api/oidc", og.list)
+	app.Handle(http.MethodGet, "/api/oidc/:provider/login", og.login)
+	app.Handle(http.MethodGet, "/api/oidc/:provider/callback", og.callback)
+
+	// Register OAuth2 authorization server endpoints
+	oag := oauthGroup{
+		oauth:   oauth.New(log, db),
+		user:    user.New(log, db),
+		session: sess,
+		auth:    a,
+	}
+
+	app.Handle(http.MethodPost, "/api/me/clients", oag.register, authenticate)
+	app.Handle(http.MethodGet, "/api/me/clients", oag.queryMine, authenticate)
+	app.Handle(http.MethodDelete, "/api/me/clients/:client_id", oag.delete, authenticate)
+	app.Handle(http.MethodGet, "/api/oauth/clients/:client_id", oag.queryByID)
+	app.Handle(http.MethodPost, "/api/oauth/authorize", oag.authorize, authenticate)
+	app.Handle(http.MethodPost, "/api/oauth/token", oag.token)
+
+	// Register API key endpoints
+	kg := apiKeyGroup{
+		apiKey: keys,
+	}
+
+	app.Handle(http.MethodPost, "/api/me/keys", kg.create, authenticate)
+	app.Handle(http.MethodGet, "/api/me/keys", kg.query, authenticate)
+	app.Handle(http.MethodDelete, "/api/me/keys/:key_id", kg.revoke, authenticate)
+
+	// Register data export endpoints
+	eg := exportGroup{
+		export: export.New(log, db, cfg.ExportKey),
+	}
+
+	app.Handle(http.MethodPost, "/api/me/export", eg.request, authenticate)
+	app.Handle(http.MethodGet, "/api/me/export/:export_id", eg.queryByID, authenticate)
+	app.Handle(http.MethodGet, "/api/export/:export_id", eg.download)
+
+	// Register session endpoints
+	sg := sessionGroup{
+		session: sess,
+	}
+
+	app.Handle(http.MethodGet, "/api/me/sessions", sg.query, authenticate)
+	app.Handle(http.MethodDelete, "/api/me/sessions/:session_id", sg.revoke, authenticate)
+
+	// Register two-factor authentication endpoints
+	tg := twoFactorGroup{
+		twoFactor: twofactor.New(log, db),
+	}
+
+	app.Handle(http.MethodPost, "/api/me/2fa", tg.enroll, authenticate)
+	app.Handle(http.MethodPost, "/api/me/2fa/confirm", tg.confirm, authenticate)
+	app.Handle(http.MethodDelete, "/api/me/2fa", tg.disable, authenticate)
 
 	// Register post endpoints
 	pg := postGroup{
-		post: post.New(log, db),
+		post:      post.New(log, db, cfg.Events, cfg.Media),
+		publicURL: cfg.PublicURL,
+	}
+
+	app.Handle(http.MethodGet, "/api/posts/", pg.query, optional)
+	app.Handle(http.MethodGet, "/api/posts/:category", pg.queryByCat, optional)
+	app.Handle(http.MethodGet, "/api/post/:post_id", pg.queryByID, optional)
+	app.Handle(http.MethodGet, "/api/duplicates", pg.queryDuplicates, optional)
+	app.Handle(http.MethodGet, "/api/user/:user", pg.queryByUser, optional)
+	app.Handle(http.MethodGet, "/api/user/:user/comments", pg.queryUserComments, optional)
+	app.Handle(http.MethodGet, "/api/user/:user/overview", pg.queryOverview, optional)
+	app.Handle(http.MethodGet, "/api/me/upvoted", pg.queryVoted(1), scoped(auth.ScopeRead))
+	app.Handle(http.MethodGet, "/api/me/downvoted", pg.queryVoted(-1), scoped(auth.ScopeRead))
+	app.Handle(http.MethodGet, "/api/me/saved", pg.querySaved, scoped(auth.ScopeRead))
+	app.Handle(http.MethodGet, "/api/me/hidden", pg.queryHidden, authenticate)
+	app.Handle(http.MethodPost, "/api/posts", pg.create, scoped(auth.ScopeSubmit))
+	app.Handle(http.MethodDelete, "/api/post/:post_id", pg.delete, scoped(auth.ScopeModPosts))
+	app.Handle(http.MethodPost, "/api/post/:post_id", pg.createComment, scoped(auth.ScopeSubmit))
+	app.Handle(http.MethodDelete, "/api/post/:post_id/:comment_id", pg.deleteComment, scoped(auth.ScopeModPosts))
+	app.Handle(http.MethodPost, "/api/post/:post_id/hide", pg.hide, authenticate)
+	app.Handle(http.MethodDelete, "/api/post/:post_id/hide", pg.unhide, authenticate)
+	app.Handle(http.MethodPost, "/api/post/:post_id/save", pg.save, authenticate)
+	app.Handle(http.MethodDelete, "/api/post/:post_id/save", pg.unsave, authenticate)
+	app.Handle(http.MethodPost, "/api/post/:post_id/:comment_id/save", pg.saveComment, authenticate)
+	app.Handle(http.MethodDelete, "/api/post/:post_id/:comment_id/save", pg.unsaveComment, authenticate)
+	app.Handle(http.MethodGet, "/api/post/:post_id/upvote", pg.upvote, scoped(auth.ScopeVote))
+	app.Handle(http.MethodGet, "/api/post/:post_id/downvote", pg.downvote, scoped(auth.ScopeVote))
+	app.Handle(http.MethodGet, "/api/post/:post_id/unvote", pg.unvote, scoped(auth.ScopeVote))
+
+	// Register media endpoints
+	mdg := mediaGroup{
+		media:    media.New(log, db, cfg.Media, cfg.Images),
+		store:    cfg.Media,
+		maxBytes: cfg.MaxUpload,
+	}
+
+	app.Handle(http.MethodPost, "/api/media", mdg.upload, scoped(auth.ScopeSubmit))
+	app.Handle(http.MethodGet, "/api/media/*key", mdg.serve)
+
+	// Register private message endpoints
+	mg := messageGroup{
+		message: message.New(log, db, cfg.Events),
+	}
+
+	app.Handle(http.MethodPost, "/api/me/conversations", mg.start, authenticate)
+	app.Handle(http.MethodGet, "/api/me/conversations", mg.queryConversations, authenticate)
+	app.Handle(http.MethodGet, "/api/me/conversations/:conversation_id", mg.queryThread, authenticate)
+	app.Handle(http.MethodPost, "/api/me/conversations/:conversation_id", mg.send, authenticate)
+	app.Handle(http.MethodDelete, "/api/me/conversations/:conversation_id", mg.delete, authenticate)
+	app.Handle(http.MethodPost, "/api/me/conversations/:conversation_id/read", mg.markRead, authenticate)
+
+	// Register notification endpoints
+	ng := notificationGroup{
+		notification: notification.New(log, db, cfg.Events),
+		message:      mg.message,
+	}
+
+	app.Handle(http.MethodGet, "/api/me/notifications", ng.query, scoped(auth.ScopeRead))
+	app.Handle(http.MethodGet, "/api/me/notifications/unread", ng.countUnread, scoped(auth.ScopeRead))
+	app.Handle(http.MethodPost, "/api/me/notifications/read", ng.markAllRead, authenticate)
+	app.Handle(http.MethodPost, "/api/me/notifications/:notification_id/read", ng.markRead, authenticate)
+
+	// Register community webhook endpoints
+	wg := webhookGroup{
+		webhook: webhook.New(log, db),
+	}
+
+	app.Handle(http.MethodPost, "/api/communities/:community/webhooks", wg.create, authenticate)
+	app.Handle(http.MethodGet, "/api/communities/:community/webhooks", wg.query, authenticate)
+	app.Handle(http.MethodDelete, "/api/communities/:community/webhooks/:webhook_id", wg.delete, authenticate)
+	app.Handle(http.MethodPost, "/api/communities/:community/webhooks/:webhook_id/enable", wg.enable, authenticate)
+	app.Handle(http.MethodGet, "/api/communities/:community/webhooks/:webhook_id/deliveries", wg.queryDeliveries, authenticate)
+
+	// Register real-time update endpoints
+	stg := streamGroup{
+		post:    pg.post,
+		events:  cfg.Events,
+		session: sess,
+		apiKey:  keys,
+	}
+
+	app.Handle(http.MethodGet, "/api/post/:post_id/events", stg.postEvents)
+	app.Handle(http.MethodGet, "/api/posts/:category/events", stg.communityEvents)
+	app.Handle(http.MethodGet, "/api/me/events", stg.myEvents, scoped(auth.ScopeRead))
+
+	// Register live connection endpoints
+	lg := liveGroup{
+		log:     log,
+		post:    pg.post,
+		events:  cfg.Events,
+		session: sess,
+		apiKey:  keys,
+		limiter: ratelimit.New(time.Minute),
 	}
 
-	app.Handle(http.MethodGet, "/api/posts/", pg.query)
-	app.Handle(http.MethodGet, "/api/posts/:category", pg.queryByCat)
-	app.Handle(http.MethodGet, "/api/post/:post_id", pg.queryByID)
-	app.Handle(http.MethodGet, "/api/user/:user", pg.queryByUser)
-	app.Handle(http.MethodPost, "/api/posts", pg.create, mid.Authenticate(a))
-	app.Handle(http.MethodDelete, "/api/post/:post_id", pg.delete, mid.Authenticate(a))
-	app.Handle(http.MethodPost, "/api/post/:post_id", pg.createComment, mid.Authenticate(a))
-	app.Handle(http.MethodDelete, "/api/post/:post_id/:comment_id", pg.deleteComment, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/api/post/:post_id/upvote", pg.upvote, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/api/post/:post_id/downvote", pg.downvote, mid.Authenticate(a))
-	app.Handle(http.MethodGet, "/api/post/:post_id/unvote", pg.unvote, mid.Authenticate(a))
+	app.Handle(http.MethodGet, "/api/live", lg.connect, scoped(auth.ScopeRead))
 
 	// Register endpoints for CORS
 	cog := corsGroup{
@@ -62,9 +314,59 @@ func API(build string, shutdown chan os.Signal, log *log.Logger, a *auth.Auth, d
 
 	app.Handle(http.MethodOptions, "/api/register", cog.allow("POST"))
 	app.Handle(http.MethodOptions, "/api/login", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/login/2fa", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/me/2fa", cog.allow("POST", "DELETE"))
+	app.Handle(http.MethodOptions, "/api/me/2fa/confirm", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/me/password", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/password/forgot", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/password/reset", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/me/email", cog.allow("PUT"))
+	app.Handle(http.MethodOptions, "/api/me/email/verify", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/email/verify", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/oidc", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/oidc/:provider/callback", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me", cog.allow("GET", "DELETE"))
+	app.Handle(http.MethodOptions, "/api/me/clients", cog.allow("GET", "POST"))
+	app.Handle(http.MethodOptions, "/api/me/clients/:client_id", cog.allow("DELETE"))
+	app.Handle(http.MethodOptions, "/api/oauth/clients/:client_id", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/oauth/authorize", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/oauth/token", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/me/profile", cog.allow("PATCH"))
+	app.Handle(http.MethodOptions, "/api/me/upvoted", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/downvoted", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/saved", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/hidden", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/blocked", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/user/:user/block", cog.allow("POST", "DELETE"))
+	app.Handle(http.MethodOptions, "/api/post/:post_id/hide", cog.allow("POST", "DELETE"))
+	app.Handle(http.MethodOptions, "/api/me/conversations", cog.allow("GET", "POST"))
+	app.Handle(http.MethodOptions, "/api/me/conversations/:conversation_id", cog.allow("GET", "POST", "DELETE"))
+	app.Handle(http.MethodOptions, "/api/me/conversations/:conversation_id/read", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/me/notifications", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/notifications/unread", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/notifications/read", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/me/notifications/:notification_id/read", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/communities/:community/webhooks", cog.allow("GET", "POST"))
+	app.Handle(http.MethodOptions, "/api/communities/:community/webhooks/:webhook_id", cog.allow("DELETE"))
+	app.Handle(http.MethodOptions, "/api/communities/:community/webhooks/:webhook_id/enable", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/communities/:community/webhooks/:webhook_id/deliveries", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/post/:post_id/events", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/posts/:category/events", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/events", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/keys", cog.allow("GET", "POST"))
+	app.Handle(http.MethodOptions, "/api/me/keys/:key_id", cog.allow("DELETE"))
+	app.Handle(http.MethodOptions, "/api/me/export", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/me/export/:export_id", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/export/:export_id", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/sessions", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/me/sessions/:session_id", cog.allow("DELETE"))
 	app.Handle(http.MethodOptions, "/api/posts", cog.allow("POST"))
+	app.Handle(http.MethodOptions, "/api/duplicates", cog.allow("GET"))
+	app.Handle(http.MethodOptions, "/api/media", cog.allow("POST"))
 	app.Handle(http.MethodOptions, "/api/post/:post_id", cog.allow("POST", "DELETE"))
 	app.Handle(http.MethodOptions, "/api/post/:post_id/:comment_id", cog.allow("DELETE"))
+	app.Handle(http.MethodOptions, "/api/post/:post_id/save", cog.allow("POST", "DELETE"))
+	app.Handle(http.MethodOptions, "/api/post/:post_id/:comment_id/save", cog.allow("POST", "DELETE"))
 	app.Handle(http.MethodOptions, "/api/post/:post_id/upvote", cog.allow("GET"))
 	app.Handle(http.MethodOptions, "/api/post/:post_id/downvote", cog.allow("GET"))
 	app.Handle(http.MethodOptions, "/api/post/:post_id/unvote", cog.allow("GET"))
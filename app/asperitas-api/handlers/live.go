@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/cravtos/asperitas-backend/foundation/ratelimit"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/cravtos/asperitas-backend/foundation/websocket"
+	"github.com/pkg/errors"
+)
+
+// Settings of live connections.
+const (
+	// liveWriteWait is how long a message may take to be written.
+	liveWriteWait = 10 * time.Second
+
+	// livePongWait is how long the client may stay silent, pongs included.
+	livePongWait = 60 * time.Second
+
+	// livePingInterval is how often the client is pinged. It has to be
+	// shorter than livePongWait.
+	livePingInterval = livePongWait * 9 / 10
+
+	// liveMaxMessage is how big messages from the client may be.
+	liveMaxMessage = 16 << 10
+
+	// liveQueue is how many messages wait to be written before the client is
+	// considered too slow and disconnected.
+	liveQueue = 64
+
+	// liveMaxSubscriptions is how many posts and communities one connection
+	// may follow.
+	liveMaxSubscriptions = 50
+
+	// liveCommandsPerMinute is how many votes and comments a user may send
+	// over all of their connections.
+	liveCommandsPerMinute = 60
+)
+
+// Types of messages sent to live clients.
+const (
+	liveOK    = "ok"
+	liveError = "error"
+	liveEvent = "event"
+)
+
+// liveRequest is a message sent by live clients. Type is subscribe,
+// unsubscribe, vote or comment. ID is echoed in the reply.
+type liveRequest struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Post      string `json:"post"`
+	Community string `json:"community"`
+	Vote      int    `json:"vote"`
+	Comment   string `json:"comment"`
+}
+
+// liveMessage is a message sent to live clients: a reply to a request or an
+// event published on a topic the client subscribed to.
+type liveMessage struct {
+	ID    string      `json:"id,omitempty"`
+	Type  string      `json:"type"`
+	Topic string      `json:"topic,omitempty"`
+	Event string      `json:"event,omitempty"`
+	Error string      `json:"error,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+type liveGroup struct {
+	log     *log.Logger
+	post    post.Post
+	events  pubsub.Bus
+	session session.Session
+	apiKey  apikey.APIKey
+	limiter *ratelimit.Limiter
+}
+
+// live is the state of one live connection.
+type live struct {
+	conn   *websocket.Conn
+	claims auth.Claims
+	send   chan liveMessage
+	subs   map[string]*pubsub.Subscription
+
+	// slow is closed when the client does not keep up with its messages.
+	slow     chan struct{}
+	slowOnce sync.Once
+}
+
+// queue hands a message to the writer. Clients which fall too far behind
+// are disconnected rather than slowing everyone else down.
+func (l *live) queue(msg liveMessage) {
+	select {
+	case l.send <- msg:
+	default:
+		l.slowOnce.Do(func() { close(l.slow) })
+	}
+}
+
+func (lg liveGroup) connect(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		if err == websocket.ErrBadHandshake {
+			return web.NewRequestError(err, http.StatusBadRequest)
+		}
+		return errors.Wrap(err, "upgrading connection")
+	}
+	defer conn.Close()
+	v.StatusCode = http.StatusSwitchingProtocols
+
+	l := live{
+		conn:   conn,
+		claims: claims,
+		send:   make(chan liveMessage, liveQueue),
+		subs:   make(map[string]*pubsub.Subscription),
+		slow:   make(chan struct{}),
+	}
+	defer func() {
+		for _, sub := range l.subs {
+			sub.Close()
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go lg.write(ctx, &l, done)
+
+	conn.SetReadLimit(liveMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(livePongWait))
+	conn.SetPongHandler(func() {
+		conn.SetReadDeadline(time.Now().Add(livePongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return nil
+		}
+		conn.SetReadDeadline(time.Now().Add(livePongWait))
+
+		var req liveRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			l.queue(liveMessage{Type: liveError, Error: "message is not valid JSON"})
+			continue
+		}
+		l.queue(lg.handle(ctx, &l, req))
+	}
+}
+
+// write sends queued messages and pings to the client until done. It closes
+// the connection when the client is too slow, the token expires or is
+// revoked, or the server shuts down, which also ends the reading loop.
+func (lg liveGroup) write(ctx context.Context, l *live, done <-chan struct{}) {
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+
+	// A subscription to no topics is only closed with the broker.
+	closing := lg.events.Subscribe()
+	defer closing.Close()
+
+	var expired <-chan time.Time
+	if until := expiry(l.claims); !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	closeWith := func(code int, reason string) {
+		l.conn.WriteClose(code, reason, time.Now().Add(liveWriteWait))
+		l.conn.Close()
+	}
+
+	for {
+		select {
+		case msg := <-l.send:
+			data, err := json.Marshal(msg)
+			if err != nil {
+				lg.log.Printf("live: marshaling message : %v", err)
+				continue
+			}
+			if err := l.conn.WriteMessage(websocket.TextMessage, data, time.Now().Add(liveWriteWait)); err != nil {
+				l.conn.Close()
+				return
+			}
+		case <-ping.C:
+			if err := l.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteWait)); err != nil {
+				l.conn.Close()
+				return
+			}
+
+			// Revocation is checked along with the ping.
+			if err := checkActive(ctx, lg.session, lg.apiKey, l.claims, time.Now()); err != nil {
+				if err != session.ErrRevoked && err != apikey.ErrInvalidKey {
+					lg.log.Printf("live: checking credentials of user with ID %s : %v", l.claims.User.ID, err)
+				}
+				closeWith(websocket.ClosePolicyViolation, "token revoked")
+				return
+			}
+		case <-l.slow:
+			closeWith(websocket.CloseTryAgainLater, "client is too slow")
+			return
+		case <-expired:
+			closeWith(websocket.ClosePolicyViolation, "token expired")
+			return
+		case <-closing.C:
+			closeWith(websocket.CloseGoingAway, "server is shutting down")
+			return
+		case <-done:
+			return
+		}
+	}
+}
+
+// handle runs a request of the client and returns the reply.
+func (lg liveGroup) handle(ctx context.Context, l *live, req liveRequest) liveMessage {
+	reply := func(data interface{}, err error) liveMessage {
+		if err != nil {
+			return liveMessage{ID: req.ID, Type: liveError, Error: lg.liveError(err)}
+		}
+		return liveMessage{ID: req.ID, Type: liveOK, Data: data}
+	}
+
+	switch req.Type {
+	case "subscribe":
+		return reply(nil, lg.subscribe(ctx, l, req))
+
+	case "unsubscribe":
+		topic := liveTopic(req)
+		if sub, ok := l.subs[topic]; ok {
+			sub.Close()
+			delete(l.subs, topic)
+		}
+		return reply(nil, nil)
+
+	case "vote":
+		if err := lg.command(l, auth.ScopeVote); err != nil {
+			return reply(nil, err)
+		}
+		if req.Vote == 0 {
+			return reply(lg.post.Unvote(ctx, l.claims, req.Post, time.Now()))
+		}
+		if req.Vote != 1 && req.Vote != -1 {
+			return reply(nil, web.NewRequestError(errors.New("vote must be 1, -1 or 0"), http.StatusBadRequest))
+		}
+		return reply(lg.post.Vote(ctx, l.claims, req.Post, req.Vote, time.Now()))
+
+	case "comment":
+		if err := lg.command(l, auth.ScopeSubmit); err != nil {
+			return reply(nil, err)
+		}
+		if req.Comment == "" {
+			return reply(nil, web.NewRequestError(errors.New("comment is a required field"), http.StatusBadRequest))
+		}
+		nc := post.NewComment{Text: req.Comment}
+		return reply(lg.post.CreateComment(ctx, l.claims, nc, req.Post, time.Now()))
+	}
+
+	return reply(nil, web.NewRequestError(errors.Errorf("unknown type %q", req.Type), http.StatusBadRequest))
+}
+
+// subscribe starts forwarding the events of the post or community of the
+// request to the client.
+func (lg liveGroup) subscribe(ctx context.Context, l *live, req liveRequest) error {
+	topic := liveTopic(req)
+	if topic == "" {
+		return web.NewRequestError(errors.New("post or community is required"), http.StatusBadRequest)
+	}
+	if _, ok := l.subs[topic]; ok {
+		return nil
+	}
+	if len(l.subs) >= liveMaxSubscriptions {
+		return web.NewRequestError(errors.Errorf("at most %d subscriptions are allowed", liveMaxSubscriptions), http.StatusBadRequest)
+	}
+	if req.Post != "" {
+		if _, err := lg.post.QueryByID(ctx, auth.Claims{}, req.Post); err != nil {
+			return err
+		}
+	}
+
+	sub := lg.events.Subscribe(topic)
+	l.subs[topic] = sub
+
+	go func() {
+		for ev := range sub.C {
+			l.queue(liveMessage{Type: liveEvent, Topic: ev.Topic, Event: ev.Type, Data: ev.Data})
+		}
+	}()
+	return nil
+}
+
+// command checks the client may send a command needing scope.
+func (lg liveGroup) command(l *live, scope string) error {
+	if l.claims.Delegated() && !l.claims.HasScopes(scope) {
+		return auth.ErrInsufficientScope
+	}
+	if ok, _ := lg.limiter.Allow(l.claims.User.ID, liveCommandsPerMinute, time.Now()); !ok {
+		return web.NewRequestError(errors.New("too many commands, slow down"), http.StatusTooManyRequests)
+	}
+	return nil
+}
+
+// liveError returns what the client is told about err. Unexpected errors
+// are logged and not disclosed.
+func (lg liveGroup) liveError(err error) string {
+	switch err {
+	case post.ErrInvalidID, post.ErrPostNotFound, post.ErrBlocked, auth.ErrInsufficientScope:
+		return err.Error()
+	}
+	if webErr, ok := errors.Cause(err).(*web.Error); ok {
+		return webErr.Err.Error()
+	}
+
+	lg.log.Printf("live: %v", err)
+	return http.StatusText(http.StatusInternalServerError)
+}
+
+// liveTopic returns the topic the request is about.
+func liveTopic(req liveRequest) string {
+	switch {
+	case req.Post != "":
+		return post.TopicPost(req.Post)
+	case req.Community != "":
+		return post.TopicCommunity(req.Community)
+	}
+	return ""
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/lockout"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type lockoutGroup struct {
+	lockout lockout.Tracker
+}
+
+// locked lists the keys the running tracker holds locked out. It is only
+// served on the debug host, so operators can see lockouts of the memory store
+// which the admin tool can not read.
+func (lg lockoutGroup) locked(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	locks, err := lg.lockout.Locked(ctx, v.Now)
+	if err != nil {
+		return errors.Wrap(err, "listing lockouts")
+	}
+	if locks == nil {
+		locks = []lockout.Lock{}
+	}
+
+	return web.Respond(ctx, w, locks, http.StatusOK)
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/media"
+	"github.com/cravtos/asperitas-backend/foundation/blob"
+	"github.com/cravtos/asperitas-backend/foundation/imaging"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// multipartOverhead is how much bigger than the file an upload may be to
+// make room for the multipart envelope.
+const multipartOverhead = 64 << 10
+
+type mediaGroup struct {
+	media    media.Media
+	store    blob.BlobStore
+	maxBytes int64
+}
+
+// upload stores the image sent as the "file" field of a multipart form. The
+// name and content type the client gives the file are ignored.
+func (mg mediaGroup) upload(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	tooLarge := web.NewRequestError(fmt.Errorf("file must be at most %d bytes", mg.maxBytes), http.StatusRequestEntityTooLarge)
+	if r.ContentLength > mg.maxBytes+multipartOverhead {
+		return tooLarge
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, mg.maxBytes+multipartOverhead)
+
+	data, err := mg.readFile(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) > mg.maxBytes {
+		return tooLarge
+	}
+
+	info, err := mg.media.Upload(ctx, claims, data, v.Now)
+	if err != nil {
+		switch err {
+		case imaging.ErrUnsupportedType:
+			return web.NewRequestError(err, http.StatusUnsupportedMediaType)
+		case imaging.ErrInvalidImage:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case imaging.ErrTooLarge:
+			return web.NewRequestError(err, http.StatusRequestEntityTooLarge)
+		default:
+			return errors.Wrap(err, "uploading image")
+		}
+	}
+
+	return web.Respond(ctx, w, info, http.StatusCreated)
+}
+
+// readFile returns the "file" field of the multipart form, up to one byte
+// more than allowed so callers can tell it is too large.
+func (mg mediaGroup) readFile(r *http.Request) ([]byte, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, web.NewRequestError(errors.New("upload must be a multipart form"), http.StatusBadRequest)
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, web.NewRequestError(errors.New("form has no file field"), http.StatusBadRequest)
+		}
+		if err != nil {
+			return nil, web.NewRequestError(errors.Wrap(err, "reading form"), http.StatusBadRequest)
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+
+		data, err := ioutil.ReadAll(io.LimitReader(part, mg.maxBytes+1))
+		if err != nil {
+			return nil, web.NewRequestError(errors.Wrap(err, "reading file"), http.StatusBadRequest)
+		}
+		return data, nil
+	}
+}
+
+// serve sends a stored image or thumbnail. Keys name a blob only once, so
+// clients may keep them for good.
+func (mg mediaGroup) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	key := web.Params(r)["key"]
+
+	rc, contentType, err := mg.store.Get(ctx, key)
+	if err != nil {
+		switch err {
+		case blob.ErrNotFound, blob.ErrInvalidKey:
+			return web.NewRequestError(blob.ErrNotFound, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "getting blob %s", key)
+		}
+	}
+	defer rc.Close()
+
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return errors.Wrapf(err, "reading blob %s", key)
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	return web.RespondRaw(ctx, w, data, contentType, http.StatusOK)
+}
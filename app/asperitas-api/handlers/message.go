@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/message"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type messageGroup struct {
+	message message.Message
+}
+
+// messageError maps errors of private messages to responses.
+func messageError(err error, format string, id string) error {
+	switch err {
+	case message.ErrInvalidID, message.ErrNoRecipients, message.ErrTooManyMembers:
+		return web.NewRequestError(err, http.StatusBadRequest)
+	case message.ErrBlocked:
+		return web.NewRequestError(err, http.StatusForbidden)
+	case message.ErrNotFound, message.ErrUserNotFound:
+		return web.NewRequestError(err, http.StatusNotFound)
+	default:
+		return errors.Wrapf(err, format, id)
+	}
+}
+
+func (mg messageGroup) start(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nc message.NewConversation
+	if err := web.Decode(r, &nc); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	c, err := mg.message.Start(ctx, claims, nc, v.Now)
+	if err != nil {
+		return messageError(err, "starting conversation for user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, c, http.StatusCreated)
+}
+
+func (mg messageGroup) queryConversations(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	conversations, err := mg.message.QueryConversations(ctx, claims, pq.Page, pq.Rows)
+	if err != nil {
+		return errors.Wrapf(err, "querying conversations of user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, conversations, http.StatusOK)
+}
+
+func (mg messageGroup) queryThread(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	conversationID := web.Params(r)["conversation_id"]
+	messages, err := mg.message.QueryThread(ctx, claims, conversationID, pq.Page, pq.Rows)
+	if err != nil {
+		return messageError(err, "querying conversation with ID: %s", conversationID)
+	}
+
+	return web.Respond(ctx, w, messages, http.StatusOK)
+}
+
+func (mg messageGroup) send(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nm message.NewMessage
+	if err := web.Decode(r, &nm); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	conversationID := web.Params(r)["conversation_id"]
+	msg, err := mg.message.Send(ctx, claims, conversationID, nm, v.Now)
+	if err != nil {
+		return messageError(err, "sending message to conversation with ID: %s", conversationID)
+	}
+
+	return web.Respond(ctx, w, msg, http.StatusCreated)
+}
+
+func (mg messageGroup) markRead(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	conversationID := web.Params(r)["conversation_id"]
+	if err := mg.message.MarkRead(ctx, claims, conversationID, v.Now); err != nil {
+		return messageError(err, "marking conversation with ID: %s read", conversationID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (mg messageGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	conversationID := web.Params(r)["conversation_id"]
+	if err := mg.message.Delete(ctx, claims, conversationID, v.Now); err != nil {
+		return messageError(err, "deleting conversation with ID: %s", conversationID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/message"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type notificationGroup struct {
+	notification notification.Notification
+	message      message.Message
+}
+
+func (ng notificationGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, err := ng.notification.Query(ctx, claims, unreadOnly, pq.Page, pq.Rows)
+	if err != nil {
+		return errors.Wrapf(err, "querying notifications of user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, notifications, http.StatusOK)
+}
+
+func (ng notificationGroup) countUnread(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	notifications, err := ng.notification.CountUnread(ctx, claims)
+	if err != nil {
+		return errors.Wrapf(err, "counting notifications of user with ID: %s", claims.User.ID)
+	}
+
+	messages, err := ng.message.CountUnread(ctx, claims)
+	if err != nil {
+		return errors.Wrapf(err, "counting messages of user with ID: %s", claims.User.ID)
+	}
+
+	resp := struct {
+		Count         int `json:"count"`
+		Notifications int `json:"notifications"`
+		Messages      int `json:"messages"`
+	}{
+		Count:         notifications + messages,
+		Notifications: notifications,
+		Messages:      messages,
+	}
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+func (ng notificationGroup) markRead(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	notificationID := web.Params(r)["notification_id"]
+	if err := ng.notification.MarkRead(ctx, claims, notificationID, v.Now); err != nil {
+		switch err {
+		case notification.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case notification.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "marking notification with ID: %s read", notificationID)
+		}
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (ng notificationGroup) markAllRead(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := ng.notification.MarkAllRead(ctx, claims, v.Now); err != nil {
+		return errors.Wrapf(err, "marking notifications of user with ID: %s read", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
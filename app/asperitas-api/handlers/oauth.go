@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/oauth"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// accessTokenTTL is how long tokens issued to clients are valid.
+const accessTokenTTL = time.Hour
+
+type oauthGroup struct {
+	oauth   oauth.OAuth
+	user    user.User
+	session session.Session
+	auth    *auth.Auth
+}
+
+func (og oauthGroup) register(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nc oauth.NewClient
+	if err := web.Decode(r, &nc); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	reg, err := og.oauth.Register(ctx, claims, nc, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case oauth.ErrInvalidScope, oauth.ErrInvalidRequest:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "registering client %q", nc.Name)
+		}
+	}
+
+	return web.Respond(ctx, w, reg, http.StatusCreated)
+}
+
+func (og oauthGroup) queryMine(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	clients, err := og.oauth.QueryByOwner(ctx, claims)
+	if err != nil {
+		return errors.Wrapf(err, "querying clients of user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, clients, http.StatusOK)
+}
+
+func (og oauthGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	clientID := web.Params(r)["client_id"]
+	if err := og.oauth.Delete(ctx, claims, clientID); err != nil {
+		switch err {
+		case oauth.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		case oauth.ErrForbidden:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "deleting client %s", clientID)
+		}
+	}
+
+	// Tokens already handed out to the client die with it.
+	if err := og.session.RevokeClient(ctx, clientID, v.Now); err != nil {
+		return errors.Wrapf(err, "revoking sessions of client %s", clientID)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+// queryByID shows what the consent page needs to know about a client.
+func (og oauthGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	clientID := web.Params(r)["client_id"]
+
+	cl, err := og.oauth.QueryByID(ctx, clientID)
+	if err != nil {
+		switch err {
+		case oauth.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying client %s", clientID)
+		}
+	}
+
+	return web.Respond(ctx, w, cl, http.StatusOK)
+}
+
+// authorize is called by the frontend once the user consented to the
+// request of a client. It answers with where to send the user back to.
+func (og oauthGroup) authorize(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var az oauth.Authorize
+	if err := web.Decode(r, &az); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	code, err := og.oauth.Authorize(ctx, claims, az, v.Now)
+	if err != nil {
+		switch errors.Cause(err) {
+		case oauth.ErrInvalidClient, oauth.ErrInvalidScope, oauth.ErrInvalidRequest:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "authorizing client %s", az.ClientID)
+		}
+	}
+
+	redirect, err := oauth.RedirectURL(az.RedirectURI, code, az.State)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	resp := struct {
+		Redirect string `json:"redirect"`
+	}{
+		Redirect: redirect,
+	}
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// token is the token endpoint of RFC 6749. It takes form encoded requests
+// and answers errors in the format the RFC defines.
+func (og oauthGroup) token(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := r.ParseForm(); err != nil {
+		return og.tokenError(ctx, w, oauth.ErrInvalidRequest)
+	}
+
+	clientID, secret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	var grant oauth.Grant
+	var err error
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		grant, err = og.oauth.ExchangeCode(ctx, clientID, secret, r.PostForm.Get("code"),
+			r.PostForm.Get("redirect_uri"), r.PostForm.Get("code_verifier"), v.Now)
+	case "client_credentials":
+		grant, err = og.oauth.ClientCredentials(ctx, clientID, secret, r.PostForm.Get("scope"))
+	default:
+		return og.tokenError(ctx, w, errors.New("unsupported_grant_type"))
+	}
+	if err != nil {
+		switch errors.Cause(err) {
+		case oauth.ErrInvalidClient, oauth.ErrInvalidGrant, oauth.ErrInvalidScope,
+			oauth.ErrInvalidRequest, oauth.ErrUnauthorizedClient:
+			return og.tokenError(ctx, w, errors.Cause(err))
+		default:
+			return errors.Wrapf(err, "granting token to client %s", clientID)
+		}
+	}
+
+	usr, err := og.user.LookupID(ctx, grant.UserID)
+	if err != nil {
+		return errors.Wrapf(err, "looking up user %s", grant.UserID)
+	}
+
+	claims := user.NewClaims(usr, v.Now)
+	claims.ExpiresAt = v.Now.Add(accessTokenTTL).Unix()
+	claims.Scope = grant.Scope
+	claims.ClientID = grant.ClientID
+
+	ns := session.NewSession{
+		UserID:      usr.ID,
+		UserAgent:   grant.ClientName,
+		IP:          clientIP(r),
+		DateExpires: time.Unix(claims.ExpiresAt, 0),
+		ClientID:    grant.ClientID,
+	}
+	ses, err := og.session.Create(ctx, ns, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "starting session of client %s", grant.ClientID)
+	}
+	claims.Id = ses.ID
+
+	tkn := struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+		Scope       string `json:"scope"`
+	}{
+		TokenType: "Bearer",
+		ExpiresIn: int(accessTokenTTL / time.Second),
+		Scope:     grant.Scope,
+	}
+	tkn.AccessToken, err = og.auth.GenerateToken(og.auth.GetKID(), claims)
+	if err != nil {
+		return errors.Wrapf(err, "generating token")
+	}
+
+	return web.Respond(ctx, w, tkn, http.StatusOK)
+}
+
+// tokenError answers a failed token request as RFC 6749 section 5.2 wants.
+func (og oauthGroup) tokenError(ctx context.Context, w http.ResponseWriter, err error) error {
+	status := http.StatusBadRequest
+	if err == oauth.ErrInvalidClient {
+		w.Header().Set("WWW-Authenticate", `Basic realm="asperitas"`)
+		status = http.StatusUnauthorized
+	}
+
+	resp := struct {
+		Error string `json:"error"`
+	}{
+		Error: err.Error(),
+	}
+	return web.Respond(ctx, w, resp, status)
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"github.com/cravtos/asperitas-backend/business/data/identity"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/oidc"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// errUnknownProvider is returned when no provider with the requested name is
+// configured.
+var errUnknownProvider = errors.New("unknown identity provider")
+
+type oidcGroup struct {
+	providers map[string]*oidc.Provider
+	identity  identity.Identity
+	users     userGroup
+}
+
+func (og oidcGroup) list(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	names := make([]string, 0, len(og.providers))
+	for name := range og.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return web.Respond(ctx, w, names, http.StatusOK)
+}
+
+func (og oidcGroup) login(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	p, ok := og.providers[web.Params(r)["provider"]]
+	if !ok {
+		return web.NewRequestError(errUnknownProvider, http.StatusNotFound)
+	}
+
+	lgn, err := og.identity.StartLogin(ctx, p.Name(), v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "starting login at %s", p.Name())
+	}
+
+	return web.Redirect(ctx, w, r, p.AuthCodeURL(lgn.State, lgn.Nonce, lgn.Verifier), http.StatusFound)
+}
+
+func (og oidcGroup) callback(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	p, ok := og.providers[web.Params(r)["provider"]]
+	if !ok {
+		return web.NewRequestError(errUnknownProvider, http.StatusNotFound)
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return web.NewRequestError(errors.Errorf("%s: %s", e, q.Get("error_description")), http.StatusUnauthorized)
+	}
+
+	lgn, err := og.identity.FinishLogin(ctx, p.Name(), q.Get("state"), v.Now)
+	if err != nil {
+		switch err {
+		case identity.ErrInvalidState:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "finishing login at %s", p.Name())
+		}
+	}
+
+	ext, err := p.Exchange(ctx, q.Get("code"), lgn.Verifier, lgn.Nonce, v.Now)
+	if err != nil {
+		og.users.log.Printf("login at %s failed: %v", p.Name(), err)
+		return web.NewRequestError(user.ErrAuthenticationFailure, http.StatusUnauthorized)
+	}
+
+	usr, err := og.identity.SignIn(ctx, p.Name(), ext, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "signing in %s at %s", ext.Subject, p.Name())
+	}
+
+	return og.users.respondLogin(ctx, w, r, user.NewClaims(usr, v.Now))
+}
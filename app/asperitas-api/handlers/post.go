@@ -10,11 +10,15 @@ import (
 )
 
 type postGroup struct {
-	post post.Post
+	post      post.Post
+	publicURL string
 }
 
 func (pg postGroup) query(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
-	posts, err := pg.post.Query(ctx)
+	// Claims are only there when the caller is logged in.
+	claims, _ := ctx.Value(auth.Key).(auth.Claims)
+
+	posts, err := pg.post.Query(ctx, claims)
 	if err != nil {
 		return err
 	}
@@ -23,8 +27,11 @@ func (pg postGroup) query(ctx context.Context, w http.ResponseWriter, _ *http.Re
 }
 
 func (pg postGroup) queryByID(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	// Claims are only there when the caller is logged in.
+	claims, _ := ctx.Value(auth.Key).(auth.Claims)
+
 	params := web.Params(r)
-	pst, err := pg.post.QueryByID(ctx, params["post_id"])
+	pst, err := pg.post.QueryByID(ctx, claims, params["post_id"])
 	if err != nil {
 		switch err {
 		case post.ErrInvalidID:
@@ -58,8 +65,12 @@ func (pg postGroup) create(ctx context.Context, w http.ResponseWriter, r *http.R
 	pst, err := pg.post.Create(ctx, claims, np, v.Now)
 	if err != nil {
 		switch err {
-		case post.ErrWrongPostType:
+		case post.ErrWrongPostType, post.ErrInvalidURL, post.ErrInvalidMedia:
 			return web.NewRequestError(err, http.StatusBadRequest)
+		case post.ErrEmailNotVerified:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case post.ErrDuplicate:
+			return web.NewRequestError(err, http.StatusConflict)
 		default:
 			return errors.Wrapf(err, "creating new post: %+v", np)
 		}
@@ -69,13 +80,18 @@ func (pg postGroup) create(ctx context.Context, w http.ResponseWriter, r *http.R
 }
 
 func (pg postGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
 	claims, ok := ctx.Value(auth.Key).(auth.Claims)
 	if !ok {
 		return errors.New("claims missing from context")
 	}
 
 	params := web.Params(r)
-	if err := pg.post.Delete(ctx, claims, params["post_id"]); err != nil {
+	if err := pg.post.Delete(ctx, claims, params["post_id"], v.Now); err != nil {
 		switch err {
 		case post.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
@@ -89,8 +105,15 @@ func (pg postGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.R
 }
 
 func (pg postGroup) queryByCat(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	// Claims are only there when the caller is logged in.
+	claims, _ := ctx.Value(auth.Key).(auth.Claims)
+
 	params := web.Params(r)
-	pst, err := pg.post.QueryByCat(ctx, params["category"])
+	if category, format := feedFormat(params["category"]); format != "" {
+		return pg.categoryFeed(ctx, w, r, category, format)
+	}
+
+	pst, err := pg.post.QueryByCat(ctx, claims, params["category"])
 	if err != nil {
 		switch err {
 		case post.ErrPostNotFound:
@@ -104,13 +127,20 @@ func (pg postGroup) queryByCat(ctx context.Context, w http.ResponseWriter, r *ht
 }
 
 func (pg postGroup) queryByUser(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	// Claims are only there when the caller is logged in.
+	claims, _ := ctx.Value(auth.Key).(auth.Claims)
+
 	params := web.Params(r)
-	pst, err := pg.post.QueryByUser(ctx, params["user"])
+	if name, format := feedFormat(params["user"]); format != "" {
+		return pg.userFeed(ctx, w, r, name, format)
+	}
+
+	pst, err := pg.post.QueryByUser(ctx, claims, params["user"])
 	if err != nil {
 		switch err {
 		case post.ErrInvalidID:
 			return web.NewRequestError(err, http.StatusBadRequest)
-		case post.ErrPostNotFound:
+		case post.ErrPostNotFound, post.ErrUserNotFound:
 			return web.NewRequestError(err, http.StatusNotFound)
 		default:
 			return errors.Wrapf(err, "ID: %s", params["user"])
@@ -120,14 +150,37 @@ func (pg postGroup) queryByUser(ctx context.Context, w http.ResponseWriter, r *h
 	return web.Respond(ctx, w, pst, http.StatusOK)
 }
 
+func (pg postGroup) queryDuplicates(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	// Claims are only there when the caller is logged in.
+	claims, _ := ctx.Value(auth.Key).(auth.Claims)
+
+	link := r.URL.Query().Get("url")
+	pst, err := pg.post.QueryDuplicates(ctx, claims, link)
+	if err != nil {
+		switch err {
+		case post.ErrInvalidURL:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "URL: %s", link)
+		}
+	}
+
+	return web.Respond(ctx, w, pst, http.StatusOK)
+}
+
 func (pg postGroup) upvote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
 	claims, ok := ctx.Value(auth.Key).(auth.Claims)
 	if !ok {
 		return errors.New("claims missing from context")
 	}
 
 	params := web.Params(r)
-	pst, err := pg.post.Vote(ctx, claims, params["post_id"], 1)
+	pst, err := pg.post.Vote(ctx, claims, params["post_id"], 1, v.Now)
 	if err != nil {
 		switch err {
 		case post.ErrPostNotFound:
@@ -141,13 +194,18 @@ func (pg postGroup) upvote(ctx context.Context, w http.ResponseWriter, r *http.R
 }
 
 func (pg postGroup) downvote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
 	claims, ok := ctx.Value(auth.Key).(auth.Claims)
 	if !ok {
 		return errors.New("claims missing from context")
 	}
 
 	params := web.Params(r)
-	pst, err := pg.post.Vote(ctx, claims, params["post_id"], -1)
+	pst, err := pg.post.Vote(ctx, claims, params["post_id"], -1, v.Now)
 	if err != nil {
 		switch err {
 		case post.ErrPostNotFound:
@@ -161,13 +219,18 @@ func (pg postGroup) downvote(ctx context.Context, w http.ResponseWriter, r *http
 }
 
 func (pg postGroup) unvote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
 	claims, ok := ctx.Value(auth.Key).(auth.Claims)
 	if !ok {
 		return errors.New("claims missing from context")
 	}
 
 	params := web.Params(r)
-	pst, err := pg.post.Unvote(ctx, claims, params["post_id"])
+	pst, err := pg.post.Unvote(ctx, claims, params["post_id"], v.Now)
 	if err != nil {
 		switch err {
 		case post.ErrPostNotFound:
@@ -203,6 +266,8 @@ func (pg postGroup) createComment(ctx context.Context, w http.ResponseWriter, r
 		switch err {
 		case post.ErrPostNotFound:
 			return web.NewRequestError(post.ErrPostNotFound, http.StatusBadRequest)
+		case post.ErrBlocked:
+			return web.NewRequestError(err, http.StatusForbidden)
 		default:
 			return errors.Wrapf(err, "creating new comment: %+v", nc)
 		}
@@ -212,13 +277,18 @@ func (pg postGroup) createComment(ctx context.Context, w http.ResponseWriter, r
 }
 
 func (pg postGroup) deleteComment(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
 	claims, ok := ctx.Value(auth.Key).(auth.Claims)
 	if !ok {
 		return errors.New("claims missing from context")
 	}
 
 	params := web.Params(r)
-	pst, err := pg.post.DeleteComment(ctx, claims, params["post_id"], params["comment_id"])
+	pst, err := pg.post.DeleteComment(ctx, claims, params["post_id"], params["comment_id"], v.Now)
 	if err != nil {
 		switch err {
 		case post.ErrCommentNotFound:
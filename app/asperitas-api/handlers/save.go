@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+func (pg postGroup) save(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	postID := web.Params(r)["post_id"]
+	pst, err := pg.post.Save(ctx, claims, postID, v.Now)
+	if err != nil {
+		return saveError(err, "saving post with ID: %s", postID)
+	}
+
+	return web.Respond(ctx, w, pst, http.StatusOK)
+}
+
+func (pg postGroup) unsave(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	postID := web.Params(r)["post_id"]
+	pst, err := pg.post.Unsave(ctx, claims, postID)
+	if err != nil {
+		return saveError(err, "unsaving post with ID: %s", postID)
+	}
+
+	return web.Respond(ctx, w, pst, http.StatusOK)
+}
+
+func (pg postGroup) saveComment(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	pst, err := pg.post.SaveComment(ctx, claims, params["post_id"], params["comment_id"], v.Now)
+	if err != nil {
+		return saveError(err, "saving comment with ID: %s", params["comment_id"])
+	}
+
+	return web.Respond(ctx, w, pst, http.StatusOK)
+}
+
+func (pg postGroup) unsaveComment(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	pst, err := pg.post.UnsaveComment(ctx, claims, params["post_id"], params["comment_id"])
+	if err != nil {
+		return saveError(err, "unsaving comment with ID: %s", params["comment_id"])
+	}
+
+	return web.Respond(ctx, w, pst, http.StatusOK)
+}
+
+func (pg postGroup) querySaved(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	saved, err := pg.post.QuerySaved(ctx, claims, r.URL.Query().Get("community"), pq)
+	if err != nil {
+		switch err {
+		case post.ErrInvalidSort:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrapf(err, "querying saved items of user with ID: %s", claims.User.ID)
+		}
+	}
+
+	return web.Respond(ctx, w, saved, http.StatusOK)
+}
+
+// saveError maps errors of saving and unsaving to responses.
+func saveError(err error, format string, id string) error {
+	switch err {
+	case post.ErrInvalidID:
+		return web.NewRequestError(err, http.StatusBadRequest)
+	case post.ErrPostNotFound, post.ErrCommentNotFound:
+		return web.NewRequestError(err, http.StatusNotFound)
+	default:
+		return errors.Wrapf(err, format, id)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type sessionGroup struct {
+	session session.Session
+}
+
+func (sg sessionGroup) query(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	sessions, err := sg.session.Query(ctx, claims, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "querying sessions of user with ID: %s", claims.User.ID)
+	}
+
+	return web.Respond(ctx, w, sessions, http.StatusOK)
+}
+
+func (sg sessionGroup) revoke(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := sg.session.Revoke(ctx, claims, params["session_id"], v.Now); err != nil {
+		switch err {
+		case session.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case session.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "ID: %s", params["session_id"])
+		}
+	}
+
+	success := web.MessageResponse{Msg: "success"}
+	return web.Respond(ctx, w, success, http.StatusOK)
+}
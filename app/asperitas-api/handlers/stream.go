@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// pingInterval is how often idle streams are written to, so proxies do not
+// close them.
+const pingInterval = 15 * time.Second
+
+type streamGroup struct {
+	post    post.Post
+	events  pubsub.Bus
+	session session.Session
+	apiKey  apikey.APIKey
+}
+
+func (stg streamGroup) postEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	postID := web.Params(r)["post_id"]
+	if _, err := stg.post.QueryByID(ctx, auth.Claims{}, postID); err != nil {
+		switch err {
+		case post.ErrInvalidID:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case post.ErrPostNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying post with ID: %s", postID)
+		}
+	}
+
+	return stg.stream(ctx, w, auth.Claims{}, post.TopicPost(postID))
+}
+
+func (stg streamGroup) communityEvents(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	category := web.Params(r)["category"]
+	return stg.stream(ctx, w, auth.Claims{}, post.TopicCommunity(category))
+}
+
+func (stg streamGroup) myEvents(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	return stg.stream(ctx, w, claims, notification.Topic(claims.User.ID))
+}
+
+// expiry returns when the credentials the claims came from expire. API keys
+// do not expire on their own, so it is zero for them.
+func expiry(claims auth.Claims) time.Time {
+	if claims.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.ExpiresAt, 0)
+}
+
+// checkActive returns an error once the session or API key the claims came
+// from is revoked or expired.
+func checkActive(ctx context.Context, s session.Session, k apikey.APIKey, claims auth.Claims, now time.Time) error {
+	if strings.HasPrefix(claims.ClientID, apikey.ClientPrefix) {
+		return k.Check(ctx, claims.Id, now)
+	}
+	return s.Check(ctx, claims.Id, now)
+}
+
+// stream sends the events published on topics to the client until it goes
+// away or the server shuts down. Streams opened with credentials, which are
+// the ones with claims of a user, also end once the credentials expire or
+// are revoked.
+func (stg streamGroup) stream(ctx context.Context, w http.ResponseWriter, claims auth.Claims, topics ...string) error {
+	sub := stg.events.Subscribe(topics...)
+	defer sub.Close()
+
+	s, err := web.NewStream(ctx, w)
+	if err != nil {
+		return err
+	}
+
+	var expired <-chan time.Time
+	if until := expiry(claims); !until.IsZero() {
+		timer := time.NewTimer(time.Until(until))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+
+	// Once the response started there is no way to report errors, and
+	// failing to write means the client is gone.
+	for {
+		select {
+		case ev, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if err := s.Send(ev.Type, ev.Data); err != nil {
+				return nil
+			}
+		case <-ping.C:
+			if err := s.Ping(); err != nil {
+				return nil
+			}
+
+			// Revocation is checked along with the ping. The client has to
+			// reconnect on errors too, which reports them.
+			if claims.User.ID != "" {
+				if err := checkActive(ctx, stg.session, stg.apiKey, claims, time.Now()); err != nil {
+					return nil
+				}
+			}
+		case <-expired:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/twofactor"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type twoFactorGroup struct {
+	twoFactor twofactor.TwoFactor
+}
+
+func (tg twoFactorGroup) enroll(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	enr, err := tg.twoFactor.Enroll(ctx, claims, v.Now)
+	if err != nil {
+		switch err {
+		case twofactor.ErrAlreadyEnabled:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "enrolling user with ID: %s", claims.User.ID)
+		}
+	}
+
+	return web.Respond(ctx, w, enr, http.StatusOK)
+}
+
+func (tg twoFactorGroup) confirm(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var c twofactor.Code
+	if err := web.Decode(r, &c); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	codes, err := tg.twoFactor.Confirm(ctx, claims, c.Code, v.Now)
+	if err != nil {
+		switch err {
+		case twofactor.ErrNotEnrolled:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case twofactor.ErrAlreadyEnabled:
+			return web.NewRequestError(err, http.StatusConflict)
+		case twofactor.ErrInvalidCode:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "confirming two-factor of user with ID: %s", claims.User.ID)
+		}
+	}
+
+	return web.Respond(ctx, w, codes, http.StatusOK)
+}
+
+func (tg twoFactorGroup) disable(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var c twofactor.Code
+	if err := web.Decode(r, &c); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	if err := tg.twoFactor.Disable(ctx, claims, c.Code, v.Now); err != nil {
+		switch err {
+		case twofactor.ErrNotEnrolled:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case twofactor.ErrInvalidCode:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "disabling two-factor of user with ID: %s", claims.User.ID)
+		}
+	}
+
+	success := web.MessageResponse{Msg: "success"}
+	return web.Respond(ctx, w, success, http.StatusOK)
+}
@@ -2,16 +2,63 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/business/data/twofactor"
 	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/lockout"
+	"github.com/cravtos/asperitas-backend/foundation/mail"
+	"github.com/cravtos/asperitas-backend/foundation/ratelimit"
 	"github.com/cravtos/asperitas-backend/foundation/web"
 	"github.com/pkg/errors"
+	"log"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// challengeTTL is how long user has to enter their second factor after
+// entering a correct password.
+const challengeTTL = 5 * time.Minute
+
+// resetTimeout is how long creating and mailing a password reset token may
+// take once the request was answered.
+const resetTimeout = 30 * time.Second
+
+// Password resets are limited per hour, so nobody can flood the inbox of a
+// user or keep the mailer busy.
+const (
+	resetsPerUser = 3
+	resetsPerIP   = 10
 )
 
 type userGroup struct {
-	user user.User
-	auth *auth.Auth
+	log       *log.Logger
+	user      user.User
+	twoFactor twofactor.TwoFactor
+	session   session.Session
+	auth      *auth.Auth
+	lockout   lockout.Tracker
+	policy    user.Policy
+	mailer    mail.Mailer
+	publicURL string
+	apiKey    apikey.APIKey
+
+	// resets limits password reset requests by user and by IP.
+	resets *ratelimit.Limiter
+
+	// background tracks the mails sent after the request was answered.
+	background *sync.WaitGroup
+
+	// deletionGrace is how long deleted accounts can still be restored by
+	// logging in.
+	deletionGrace time.Duration
 }
 
 func (ug userGroup) register(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -25,9 +72,27 @@ func (ug userGroup) register(ctx context.Context, w http.ResponseWriter, r *http
 		return errors.Wrapf(err, "unable to decode payload")
 	}
 
-	_, err := ug.user.Create(ctx, nu, v.Now)
+	if err := ug.policy.Validate(nu); err != nil {
+		if pe, ok := err.(*user.PolicyError); ok {
+			return &web.Error{Err: err, Status: http.StatusBadRequest, Fields: pe.Fields}
+		}
+		return errors.Wrapf(err, "validating user with name %s", nu.Name)
+	}
+
+	usr, err := ug.user.Create(ctx, nu, v.Now)
 	if err != nil {
-		return errors.Wrapf(err, "unable to create user with name %s", nu.Name)
+		switch err {
+		case user.ErrDuplicateName, user.ErrDuplicateEmail:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "unable to create user with name %s", nu.Name)
+		}
+	}
+
+	if usr.Email != "" {
+		if err := ug.sendVerification(ctx, usr.ID, v.Now); err != nil {
+			ug.log.Printf("ERROR: sending verification email to user with name %s: %v", usr.Name, err)
+		}
 	}
 
 	claims, err := ug.user.Authenticate(ctx, nu.Name, nu.Password, v.Now)
@@ -40,17 +105,7 @@ func (ug userGroup) register(ctx context.Context, w http.ResponseWriter, r *http
 		}
 	}
 
-	var tkn struct {
-		Token string `json:"token"`
-	}
-	// todo: consider HS256
-	kid := ug.auth.GetKID()
-	tkn.Token, err = ug.auth.GenerateToken(kid, claims)
-	if err != nil {
-		return errors.Wrapf(err, "generating token")
-	}
-
-	return web.Respond(ctx, w, tkn, http.StatusOK)
+	return ug.respondToken(ctx, w, r, claims)
 }
 
 func (ug userGroup) login(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
@@ -68,19 +123,157 @@ func (ug userGroup) login(ctx context.Context, w http.ResponseWriter, r *http.Re
 		return errors.Wrapf(err, "unable to decode payload")
 	}
 
+	keys := []string{lockout.UserKey(u.Username), lockout.IPKey(clientIP(r))}
+	if err := ug.checkLockout(ctx, w, keys, v.Now); err != nil {
+		return err
+	}
+
 	claims, err := ug.user.Authenticate(ctx, u.Username, u.Password, v.Now)
 	if err != nil {
 		switch err {
 		case user.ErrAuthenticationFailure:
+			if err := ug.recordFailure(ctx, keys, v.Now); err != nil {
+				return err
+			}
 			return web.NewRequestError(err, http.StatusForbidden)
 		default:
 			return errors.Wrapf(err, "unable to authenticate user with name %s", u.Username)
 		}
 	}
 
+	return ug.respondLogin(ctx, w, r, claims)
+}
+
+// respondLogin finishes a login whose first factor was verified. Users with
+// two-factor authentication get a challenge, everyone else gets a token.
+func (ug userGroup) respondLogin(ctx context.Context, w http.ResponseWriter, r *http.Request, claims auth.Claims) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	enabled, err := ug.twoFactor.Enabled(ctx, claims.User.ID)
+	if err != nil {
+		return errors.Wrapf(err, "checking two-factor of user with name %s", claims.User.Username)
+	}
+	if !enabled {
+		if err := ug.lockout.Reset(ctx, lockout.UserKey(claims.User.Username)); err != nil {
+			return errors.Wrapf(err, "resetting failed attempts of user with name %s", claims.User.Username)
+		}
+		return ug.respondToken(ctx, w, r, claims)
+	}
+
+	// The first factor is correct but user still has to prove the second one.
+	// Hand out a short-lived challenge which can only be exchanged for a real
+	// token at /api/login/2fa, and only once.
+	challengeID, err := ug.twoFactor.NewChallenge(ctx, claims.User.ID)
+	if err != nil {
+		return errors.Wrapf(err, "creating challenge for user with name %s", claims.User.Username)
+	}
+	claims.Id = challengeID
+	claims.Audience = auth.ChallengeAudience
+	claims.ExpiresAt = v.Now.Add(challengeTTL).Unix()
+
+	var chl struct {
+		TwoFactor bool   `json:"twoFactor"`
+		Challenge string `json:"challenge"`
+	}
+	chl.TwoFactor = true
+	chl.Challenge, err = ug.auth.GenerateToken(ug.auth.GetKID(), claims)
+	if err != nil {
+		return errors.Wrapf(err, "generating challenge")
+	}
+
+	return web.Respond(ctx, w, chl, http.StatusOK)
+}
+
+func (ug userGroup) loginTwoFactor(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	var tc struct {
+		Challenge string `json:"challenge" validate:"required"`
+		Code      string `json:"code" validate:"required"`
+	}
+	if err := web.Decode(r, &tc); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	claims, err := ug.auth.ValidateChallenge(tc.Challenge)
+	if err != nil {
+		return web.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	// A locked out user keeps their challenge, so they can try again once
+	// the lockout is over.
+	keys := []string{lockout.UserKey(claims.User.Username), lockout.IPKey(clientIP(r))}
+	if err := ug.checkLockout(ctx, w, keys, v.Now); err != nil {
+		return err
+	}
+
+	if err := ug.twoFactor.UseChallenge(ctx, claims.User.ID, claims.Id); err != nil {
+		switch err {
+		case twofactor.ErrInvalidChallenge:
+			return web.NewRequestError(err, http.StatusUnauthorized)
+		default:
+			return errors.Wrapf(err, "using challenge of user with name %s", claims.User.Username)
+		}
+	}
+
+	if err := ug.twoFactor.Verify(ctx, claims.User.ID, tc.Code, v.Now); err != nil {
+		switch err {
+		case twofactor.ErrInvalidCode, twofactor.ErrNotEnrolled:
+			if err := ug.recordFailure(ctx, keys, v.Now); err != nil {
+				return err
+			}
+			return web.NewRequestError(user.ErrAuthenticationFailure, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "verifying two-factor of user with name %s", claims.User.Username)
+		}
+	}
+
+	if err := ug.lockout.Reset(ctx, keys[0]); err != nil {
+		return errors.Wrapf(err, "resetting failed attempts of user with name %s", claims.User.Username)
+	}
+
+	claims.Audience = ""
+	claims.IssuedAt = v.Now.Unix()
+	claims.ExpiresAt = v.Now.Add(time.Hour).Unix()
+
+	return ug.respondToken(ctx, w, r, claims)
+}
+
+// respondToken starts a new session for claims, signs them and sends the
+// token to user.
+func (ug userGroup) respondToken(ctx context.Context, w http.ResponseWriter, r *http.Request, claims auth.Claims) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	ns := session.NewSession{
+		UserID:      claims.User.ID,
+		UserAgent:   r.UserAgent(),
+		IP:          clientIP(r),
+		DateExpires: time.Unix(claims.ExpiresAt, 0),
+	}
+	// Logging in is how users take back the deletion of their account.
+	if _, err := ug.user.CancelDeletion(ctx, claims.User.ID, v.Now); err != nil {
+		return errors.Wrapf(err, "cancelling deletion of user with name %s", claims.User.Username)
+	}
+
+	ses, err := ug.session.Create(ctx, ns, v.Now)
+	if err != nil {
+		return errors.Wrapf(err, "starting session of user with name %s", claims.User.Username)
+	}
+	claims.Id = ses.ID
+
 	var tkn struct {
 		Token string `json:"token"`
 	}
+	// todo: consider HS256
 	kid := ug.auth.GetKID()
 	tkn.Token, err = ug.auth.GenerateToken(kid, claims)
 	if err != nil {
@@ -89,3 +282,392 @@ func (ug userGroup) login(ctx context.Context, w http.ResponseWriter, r *http.Re
 
 	return web.Respond(ctx, w, tkn, http.StatusOK)
 }
+
+func (ug userGroup) me(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	usr, err := ug.user.QueryByID(ctx, claims, claims.User.ID)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying user with ID: %s", claims.User.ID)
+		}
+	}
+
+	return web.Respond(ctx, w, usr, http.StatusOK)
+}
+
+func (ug userGroup) profile(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	name := web.Params(r)["user"]
+	pr, err := ug.user.QueryProfile(ctx, name, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "querying profile of user with name %s", name)
+		}
+	}
+
+	return web.Respond(ctx, w, pr, http.StatusOK)
+}
+
+func (ug userGroup) updateProfile(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var up user.UpdateProfile
+	if err := web.Decode(r, &up); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	usr, err := ug.user.UpdateProfile(ctx, claims, up)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidAvatar:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "updating profile of user with name %s", claims.User.Username)
+		}
+	}
+
+	return web.Respond(ctx, w, usr, http.StatusOK)
+}
+
+func (ug userGroup) changePassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var cp user.ChangePassword
+	if err := web.Decode(r, &cp); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	if err := ug.user.ChangePassword(ctx, claims, ug.policy, cp, v.Now); err != nil {
+		if pe, ok := err.(*user.PolicyError); ok {
+			return &web.Error{Err: err, Status: http.StatusBadRequest, Fields: pe.Fields}
+		}
+		switch err {
+		case user.ErrAuthenticationFailure:
+			return web.NewRequestError(err, http.StatusForbidden)
+		default:
+			return errors.Wrapf(err, "changing password of user with name %s", claims.User.Username)
+		}
+	}
+
+	// Everybody who knew the old password might still be logged in. Keep
+	// only the session which changed the password.
+	if err := ug.session.RevokeAll(ctx, claims.User.ID, claims.Id, v.Now); err != nil {
+		return errors.Wrapf(err, "revoking sessions of user with name %s", claims.User.Username)
+	}
+
+	success := web.MessageResponse{Msg: "success"}
+	return web.Respond(ctx, w, success, http.StatusOK)
+}
+
+func (ug userGroup) deleteAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var da user.DeleteAccount
+	if err := web.Decode(r, &da); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	deletion, err := ug.user.ScheduleDeletion(ctx, claims, da, ug.deletionGrace, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrAuthenticationFailure:
+			return web.NewRequestError(err, http.StatusForbidden)
+		case user.ErrNotFound:
+			return web.NewRequestError(err, http.StatusNotFound)
+		default:
+			return errors.Wrapf(err, "deleting user with name %s", claims.User.Username)
+		}
+	}
+
+	// The account must not be usable until the user logs in again.
+	if err := ug.session.RevokeAll(ctx, claims.User.ID, "", v.Now); err != nil {
+		return errors.Wrapf(err, "revoking sessions of user with name %s", claims.User.Username)
+	}
+	if err := ug.apiKey.RevokeAll(ctx, claims.User.ID, v.Now); err != nil {
+		return errors.Wrapf(err, "revoking keys of user with name %s", claims.User.Username)
+	}
+
+	resp := struct {
+		DeleteAfter time.Time `json:"deleteAfter"`
+	}{
+		DeleteAfter: deletion,
+	}
+	return web.Respond(ctx, w, resp, http.StatusAccepted)
+}
+
+func (ug userGroup) forgotPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	var fp user.ForgotPassword
+	if err := web.Decode(r, &fp); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	limits := []struct {
+		key   string
+		limit int
+	}{
+		{lockout.UserKey(fp.Name), resetsPerUser},
+		{lockout.IPKey(clientIP(r)), resetsPerIP},
+	}
+	for _, l := range limits {
+		if ok, wait := ug.resets.Allow(l.key, l.limit, v.Now); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return web.NewRequestError(errors.New("too many password reset requests, try again later"), http.StatusTooManyRequests)
+		}
+	}
+
+	// Respond the same way and equally fast whether the user exists or not, so
+	// the endpoint can not be used to find out which names are registered.
+	// The token is created and mailed after the response is sent.
+	ug.background.Add(1)
+	go func() {
+		defer ug.background.Done()
+		ug.sendReset(fp.Name, v.Now)
+	}()
+
+	accepted := web.MessageResponse{Msg: "if the account exists, a reset link was sent to its email"}
+	return web.Respond(ctx, w, accepted, http.StatusAccepted)
+}
+
+// sendReset creates a reset token for the user with given name and mails it
+// to them. Nobody waits for the outcome, so errors are only logged.
+func (ug userGroup) sendReset(name string, now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), resetTimeout)
+	defer cancel()
+
+	token, usr, err := ug.user.RequestReset(ctx, name, now)
+	if err != nil {
+		if err != user.ErrNotFound {
+			ug.log.Printf("ERROR: requesting reset for user with name %s: %v", name, err)
+		}
+		return
+	}
+
+	link := ug.publicURL + "/reset-password?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Reset your asperitas password",
+		Body: fmt.Sprintf("Hi %s,\n\nsomebody asked to reset the password of your account. "+
+			"Follow the link below within an hour to choose a new one:\n\n%s\n\n"+
+			"If it was not you, just ignore this email.\n", usr.Name, link),
+	}
+	if err := ug.mailer.Send(ctx, msg); err != nil {
+		ug.log.Printf("ERROR: sending reset email to user with name %s: %v", usr.Name, err)
+	}
+}
+
+func (ug userGroup) resetPassword(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	var rp user.ResetPassword
+	if err := web.Decode(r, &rp); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	usr, err := ug.user.ResetPassword(ctx, ug.policy, rp, v.Now)
+	if err != nil {
+		if pe, ok := err.(*user.PolicyError); ok {
+			return &web.Error{Err: err, Status: http.StatusBadRequest, Fields: pe.Fields}
+		}
+		switch err {
+		case user.ErrInvalidToken:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "resetting password")
+		}
+	}
+
+	if err := ug.session.RevokeAll(ctx, usr.ID, "", v.Now); err != nil {
+		return errors.Wrapf(err, "revoking sessions of user with name %s", usr.Name)
+	}
+	if err := ug.lockout.Reset(ctx, lockout.UserKey(usr.Name)); err != nil {
+		return errors.Wrapf(err, "resetting failed attempts of user with name %s", usr.Name)
+	}
+
+	success := web.MessageResponse{Msg: "success"}
+	return web.Respond(ctx, w, success, http.StatusOK)
+}
+
+func (ug userGroup) updateEmail(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var ue user.UpdateEmail
+	if err := web.Decode(r, &ue); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	usr, err := ug.user.UpdateEmail(ctx, claims, ue)
+	if err != nil {
+		switch err {
+		case user.ErrDuplicateEmail:
+			return web.NewRequestError(err, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "updating email of user with name %s", claims.User.Username)
+		}
+	}
+
+	// The email is already changed, so a failed mail must not fail the
+	// request. The user can ask for another one.
+	if err := ug.sendVerification(ctx, usr.ID, v.Now); err != nil {
+		ug.log.Printf("ERROR: sending verification email to user with name %s: %v", usr.Name, err)
+	}
+
+	return web.Respond(ctx, w, usr, http.StatusOK)
+}
+
+func (ug userGroup) resendVerification(ctx context.Context, w http.ResponseWriter, _ *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	if err := ug.sendVerification(ctx, claims.User.ID, v.Now); err != nil {
+		switch errors.Cause(err) {
+		case user.ErrNoEmail:
+			return web.NewRequestError(user.ErrNoEmail, http.StatusBadRequest)
+		case user.ErrAlreadyVerified:
+			return web.NewRequestError(user.ErrAlreadyVerified, http.StatusConflict)
+		default:
+			return errors.Wrapf(err, "sending verification to user with name %s", claims.User.Username)
+		}
+	}
+
+	accepted := web.MessageResponse{Msg: "verification email sent"}
+	return web.Respond(ctx, w, accepted, http.StatusAccepted)
+}
+
+func (ug userGroup) verifyEmail(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return errors.New("web values missing from context")
+	}
+
+	var ve user.VerifyEmail
+	if err := web.Decode(r, &ve); err != nil {
+		return errors.Wrapf(err, "unable to decode payload")
+	}
+
+	usr, err := ug.user.VerifyEmail(ctx, ve, v.Now)
+	if err != nil {
+		switch err {
+		case user.ErrInvalidToken:
+			return web.NewRequestError(err, http.StatusBadRequest)
+		default:
+			return errors.Wrap(err, "verifying email")
+		}
+	}
+
+	return web.Respond(ctx, w, usr, http.StatusOK)
+}
+
+// sendVerification mails a link which verifies the current email of a user.
+func (ug userGroup) sendVerification(ctx context.Context, userID string, now time.Time) error {
+	token, usr, err := ug.user.RequestVerification(ctx, userID, now)
+	if err != nil {
+		return err
+	}
+
+	link := ug.publicURL + "/verify-email?token=" + url.QueryEscape(token)
+	msg := mail.Message{
+		To:      usr.Email,
+		Subject: "Verify your email for asperitas",
+		Body: fmt.Sprintf("Hi %s,\n\nplease confirm this is your email by following the link below "+
+			"within two days:\n\n%s\n\nIf you did not sign up, just ignore this email.\n", usr.Name, link),
+	}
+	return ug.mailer.Send(ctx, msg)
+}
+
+// checkLockout fails with 429 Too Many Requests when any of the keys is
+// locked out. The Retry-After header tells the client when to try again.
+func (ug userGroup) checkLockout(ctx context.Context, w http.ResponseWriter, keys []string, now time.Time) error {
+	var wait time.Duration
+	for _, key := range keys {
+		d, err := ug.lockout.Check(ctx, key, now)
+		if err != nil {
+			return errors.Wrapf(err, "checking lockout of %s", key)
+		}
+		if d > wait {
+			wait = d
+		}
+	}
+	if wait == 0 {
+		return nil
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return web.NewRequestError(lockout.ErrLocked, http.StatusTooManyRequests)
+}
+
+// recordFailure records a failed login attempt for every key.
+func (ug userGroup) recordFailure(ctx context.Context, keys []string, now time.Time) error {
+	for _, key := range keys {
+		if _, err := ug.lockout.Fail(ctx, key, now); err != nil {
+			return errors.Wrapf(err, "recording failed attempt of %s", key)
+		}
+	}
+	return nil
+}
+
+// clientIP returns the address of the client without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/webhook"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+type webhookGroup struct {
+	webhook webhook.Webhook
+}
+
+// webhookError maps errors of webhooks to responses.
+func webhookError(err error, format string, id string) error {
+	switch errors.Cause(err) {
+	case webhook.ErrInvalidID, webhook.ErrInvalidEvent:
+		return web.NewRequestError(err, http.StatusBadRequest)
+	case webhook.ErrForbidden:
+		return web.NewRequestError(err, http.StatusForbidden)
+	case webhook.ErrNotFound:
+		return web.NewRequestError(err, http.StatusNotFound)
+	default:
+		return errors.Wrapf(err, format, id)
+	}
+}
+
+func (wg webhookGroup) create(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, ok := ctx.Value(web.KeyValues).(*web.Values)
+	if !ok {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	var nw webhook.NewWebhook
+	if err := web.Decode(r, &nw); err != nil {
+		return errors.Wrap(err, "unable to decode payload")
+	}
+
+	name := web.Params(r)["community"]
+	wh, err := wg.webhook.Create(ctx, claims, name, nw, v.Now)
+	if err != nil {
+		return webhookError(err, "creating webhook for community: %s", name)
+	}
+
+	return web.Respond(ctx, w, wh, http.StatusCreated)
+}
+
+func (wg webhookGroup) query(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	name := web.Params(r)["community"]
+	webhooks, err := wg.webhook.Query(ctx, claims, name)
+	if err != nil {
+		return webhookError(err, "querying webhooks of community: %s", name)
+	}
+
+	return web.Respond(ctx, w, webhooks, http.StatusOK)
+}
+
+func (wg webhookGroup) delete(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	if err := wg.webhook.Delete(ctx, claims, params["community"], params["webhook_id"]); err != nil {
+		return webhookError(err, "deleting webhook with ID: %s", params["webhook_id"])
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusNoContent)
+}
+
+func (wg webhookGroup) enable(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	params := web.Params(r)
+	wh, err := wg.webhook.Enable(ctx, claims, params["community"], params["webhook_id"])
+	if err != nil {
+		return webhookError(err, "enabling webhook with ID: %s", params["webhook_id"])
+	}
+
+	return web.Respond(ctx, w, wh, http.StatusOK)
+}
+
+func (wg webhookGroup) queryDeliveries(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	claims, ok := ctx.Value(auth.Key).(auth.Claims)
+	if !ok {
+		return errors.New("claims missing from context")
+	}
+
+	pq, err := pageQuery(r)
+	if err != nil {
+		return err
+	}
+
+	params := web.Params(r)
+	deliveries, err := wg.webhook.QueryDeliveries(ctx, claims, params["community"], params["webhook_id"], pq.Page, pq.Rows)
+	if err != nil {
+		return webhookError(err, "querying deliveries of webhook with ID: %s", params["webhook_id"])
+	}
+
+	return web.Respond(ctx, w, deliveries, http.StatusOK)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
 	"fmt"
 	"io/ioutil"
@@ -9,6 +10,8 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,7 +21,19 @@ import (
 
 	"github.com/cravtos/asperitas-backend/app/asperitas-api/handlers"
 	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/export"
+	"github.com/cravtos/asperitas-backend/business/data/preview"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/data/webhook"
+	"github.com/cravtos/asperitas-backend/business/lockout"
+	"github.com/cravtos/asperitas-backend/business/oidc"
+	"github.com/cravtos/asperitas-backend/foundation/blob"
 	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/imaging"
+	"github.com/cravtos/asperitas-backend/foundation/mail"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/cravtos/asperitas-backend/foundation/unfurl"
+	"github.com/cravtos/asperitas-backend/foundation/web"
 )
 
 // build is the git version of this program. It is set using build flags in the makefile.
@@ -46,12 +61,79 @@ func run(log *log.Logger) error {
 			ReadTimeout     time.Duration `conf:"default:5s"`
 			WriteTimeout    time.Duration `conf:"default:5s"`
 			ShutdownTimeout time.Duration `conf:"default:5s"`
+			PublicURL       string        `conf:"default:http://localhost:3000"`
 		}
 		Auth struct {
 			KeyID          string `conf:"default:54bb2165-71e1-41a6-af3e-7da4a0e1e2c1"`
 			PrivateKeyFile string `conf:"default:./private.pem"`
 			Algorithm      string `conf:"default:RS256"`
 		}
+		Users struct {
+			MinNameLength     int `conf:"default:3"`
+			MaxNameLength     int `conf:"default:20"`
+			MinPasswordLength int `conf:"default:8"`
+			ReservedNames     []string
+			BreachedPasswords string        `conf:"help:file with one breached password per line"`
+			DeletionGrace     time.Duration `conf:"default:720h,help:how long deleted accounts can be restored by logging in"`
+			PurgeInterval     time.Duration `conf:"default:1h,help:how often accounts past their grace period are purged"`
+		}
+		Lockout struct {
+			Store         string        `conf:"default:memory,help:where failed logins are tracked: memory or postgres"`
+			UserThreshold int           `conf:"default:5"`
+			IPThreshold   int           `conf:"default:20"`
+			BaseDelay     time.Duration `conf:"default:1s"`
+			MaxDelay      time.Duration `conf:"default:15m"`
+			Window        time.Duration `conf:"default:1h"`
+		}
+		Mail struct {
+			Mailer       string `conf:"default:log,help:how mail is delivered: log or file or smtp"`
+			Dir          string `conf:"default:./mail"`
+			From         string `conf:"default:asperitas <noreply@localhost>"`
+			SMTPHost     string `conf:"default:localhost:25"`
+			SMTPUser     string
+			SMTPPassword string `conf:"noprint"`
+		}
+		OIDC struct {
+			Providers     []string      `conf:"help:names of identity providers separated by ;"`
+			Issuers       []string      `conf:"help:issuer of each provider"`
+			ClientIDs     []string      `conf:"help:client ID at each provider"`
+			ClientSecrets []string      `conf:"noprint"`
+			RedirectURL   string        `conf:"default:http://localhost:3000/oidc/{provider}/callback"`
+			Timeout       time.Duration `conf:"default:10s"`
+		}
+		Events struct {
+			Bus     string `conf:"default:memory,help:how live events reach clients: memory or postgres to share them between instances"`
+			Channel string `conf:"default:asperitas_events"`
+		}
+		Export struct {
+			SigningKey   string        `conf:"noprint,help:signs download links and is random on every start when not set"`
+			TTL          time.Duration `conf:"default:72h,help:how long finished exports can be downloaded"`
+			PollInterval time.Duration `conf:"default:5s"`
+		}
+		Webhooks struct {
+			PollInterval time.Duration `conf:"default:5s"`
+			Timeout      time.Duration `conf:"default:10s,help:how long receivers may take to respond"`
+		}
+		Previews struct {
+			PollInterval time.Duration `conf:"default:5s"`
+			Timeout      time.Duration `conf:"default:5s,help:how long fetching a linked page may take"`
+			MaxBytes     int64         `conf:"default:524288,help:how much of a linked page is read"`
+		}
+		Media struct {
+			Store         string `conf:"default:local,help:where uploaded images are kept: local or s3"`
+			Dir           string `conf:"default:./media"`
+			URL           string `conf:"default:http://localhost:8080/api/media,help:where clients download images kept locally"`
+			S3Endpoint    string `conf:"default:http://localhost:9000"`
+			S3Region      string `conf:"default:us-east-1"`
+			S3Bucket      string `conf:"default:asperitas"`
+			S3AccessKey   string
+			S3SecretKey   string `conf:"noprint"`
+			S3PathStyle   bool   `conf:"default:true,help:address the bucket as a path as MinIO expects"`
+			S3PublicURL   string `conf:"help:where clients download images kept in s3 (the bucket itself when not set)"`
+			MaxBytes      int64  `conf:"default:10485760,help:size of the largest image users may upload"`
+			MaxPixels     int    `conf:"default:40000000"`
+			ThumbnailSize int    `conf:"default:320"`
+		}
 		DB struct {
 			User       string `conf:"default:postgres"`
 			Password   string `conf:"default:postgres,noprint"`
@@ -129,13 +211,15 @@ func run(log *log.Logger) error {
 
 	log.Println("main: Initializing database support")
 
-	db, err := database.Open(database.Config{
+	dbConfig := database.Config{
 		User:       cfg.DB.User,
 		Password:   cfg.DB.Password,
 		Host:       cfg.DB.Host,
 		Name:       cfg.DB.Name,
 		DisableTLS: cfg.DB.DisableTLS,
-	})
+	}
+
+	db, err := database.Open(dbConfig)
 	if err != nil {
 		return errors.Wrap(err, "connecting to db")
 	}
@@ -144,6 +228,242 @@ func run(log *log.Logger) error {
 		db.Close()
 	}()
 
+	// =========================================================================
+	// Initialize login lockout support
+
+	log.Printf("main: Initializing login lockout support : %s", cfg.Lockout.Store)
+
+	policy := lockout.Policy{
+		UserThreshold: cfg.Lockout.UserThreshold,
+		IPThreshold:   cfg.Lockout.IPThreshold,
+		BaseDelay:     cfg.Lockout.BaseDelay,
+		MaxDelay:      cfg.Lockout.MaxDelay,
+		Window:        cfg.Lockout.Window,
+	}
+
+	var tracker lockout.Tracker
+	switch cfg.Lockout.Store {
+	case "memory":
+		tracker = lockout.NewMemory(policy)
+	case "postgres":
+		tracker = lockout.NewPostgres(log, db, policy)
+	default:
+		return errors.Errorf("unknown lockout store %q", cfg.Lockout.Store)
+	}
+
+	// =========================================================================
+	// Initialize event bus
+
+	log.Printf("main: Initializing event bus : %s", cfg.Events.Bus)
+
+	// Changes to posts and new notifications are streamed to clients. Closing
+	// the bus on shutdown ends the streams.
+	var events pubsub.Bus
+	switch cfg.Events.Bus {
+	case "memory":
+		events = pubsub.New()
+	case "postgres":
+		pg, err := pubsub.NewPostgres(log, db, dbConfig, cfg.Events.Channel)
+		if err != nil {
+			return errors.Wrap(err, "listening for events")
+		}
+		events = pg
+	default:
+		return errors.Errorf("unknown event bus %q", cfg.Events.Bus)
+	}
+
+	// =========================================================================
+	// Initialize media storage
+
+	log.Printf("main: Initializing media storage : %s", cfg.Media.Store)
+
+	var store blob.BlobStore
+	switch cfg.Media.Store {
+	case "local":
+		local, err := blob.NewLocal(cfg.Media.Dir, cfg.Media.URL)
+		if err != nil {
+			return errors.Wrap(err, "opening media directory")
+		}
+		store = local
+	case "s3":
+		s3, err := blob.NewS3(blob.S3Config{
+			Endpoint:  cfg.Media.S3Endpoint,
+			Region:    cfg.Media.S3Region,
+			Bucket:    cfg.Media.S3Bucket,
+			AccessKey: cfg.Media.S3AccessKey,
+			SecretKey: cfg.Media.S3SecretKey,
+			PathStyle: cfg.Media.S3PathStyle,
+			PublicURL: cfg.Media.S3PublicURL,
+		})
+		if err != nil {
+			return errors.Wrap(err, "configuring s3 media storage")
+		}
+		store = s3
+	default:
+		return errors.Errorf("unknown media store %q", cfg.Media.Store)
+	}
+
+	// =========================================================================
+	// Initialize registration policy
+
+	log.Println("main: Initializing registration policy")
+
+	userPolicy := user.DefaultPolicy()
+	userPolicy.MinNameLength = cfg.Users.MinNameLength
+	userPolicy.MaxNameLength = cfg.Users.MaxNameLength
+	userPolicy.MinPasswordLength = cfg.Users.MinPasswordLength
+	if len(cfg.Users.ReservedNames) > 0 {
+		userPolicy.Reserved = cfg.Users.ReservedNames
+	}
+	if cfg.Users.BreachedPasswords != "" {
+		userPolicy.Breached, err = user.LoadBreached(cfg.Users.BreachedPasswords)
+		if err != nil {
+			return errors.Wrap(err, "loading breached passwords")
+		}
+	}
+
+	// =========================================================================
+	// Initialize mail support
+
+	log.Printf("main: Initializing mail support : %s", cfg.Mail.Mailer)
+
+	var mailer mail.Mailer
+	switch cfg.Mail.Mailer {
+	case "log":
+		mailer = mail.NewLog(log)
+	case "file":
+		mailer, err = mail.NewFile(cfg.Mail.Dir, cfg.Mail.From)
+		if err != nil {
+			return errors.Wrap(err, "constructing file mailer")
+		}
+	case "smtp":
+		mailer = mail.NewSMTP(mail.SMTPConfig{
+			Host:     cfg.Mail.SMTPHost,
+			Username: cfg.Mail.SMTPUser,
+			Password: cfg.Mail.SMTPPassword,
+			From:     cfg.Mail.From,
+		})
+	default:
+		return errors.Errorf("unknown mailer %q", cfg.Mail.Mailer)
+	}
+
+	// =========================================================================
+	// Initialize external identity providers
+
+	log.Printf("main: Initializing identity providers : %v", cfg.OIDC.Providers)
+
+	n := len(cfg.OIDC.Providers)
+	if len(cfg.OIDC.Issuers) != n || len(cfg.OIDC.ClientIDs) != n || len(cfg.OIDC.ClientSecrets) != n {
+		return errors.New("every identity provider needs an issuer, client ID and client secret")
+	}
+
+	providers := make(map[string]*oidc.Provider, n)
+	for i, name := range cfg.OIDC.Providers {
+		pcfg := oidc.Config{
+			Name:         name,
+			Issuer:       cfg.OIDC.Issuers[i],
+			ClientID:     cfg.OIDC.ClientIDs[i],
+			ClientSecret: cfg.OIDC.ClientSecrets[i],
+			RedirectURL:  strings.ReplaceAll(cfg.OIDC.RedirectURL, "{provider}", name),
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.OIDC.Timeout)
+		p, err := oidc.NewProvider(ctx, pcfg, &http.Client{Timeout: cfg.OIDC.Timeout})
+		cancel()
+		if err != nil {
+			return errors.Wrapf(err, "initializing identity provider %s", name)
+		}
+		providers[name] = p
+	}
+
+	// =========================================================================
+	// Start Account Purging
+	//
+	// Not concerned with shutting this down when the application is shutdown,
+	// every purge runs in its own transaction.
+
+	log.Printf("main: Initializing account purging : every %v", cfg.Users.PurgeInterval)
+
+	go func() {
+		users := user.New(log, db)
+		ticker := time.NewTicker(cfg.Users.PurgeInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := users.Purge(context.Background(), time.Now())
+			if err != nil {
+				log.Printf("main: Purging accounts : %v", err)
+			}
+			if n > 0 {
+				log.Printf("main: Purged %d accounts", n)
+			}
+		}
+	}()
+
+	// =========================================================================
+	// Start Data Exports
+	//
+	// Links to exports stay valid across restarts only when the signing key
+	// is configured.
+
+	log.Printf("main: Initializing data exports : every %v", cfg.Export.PollInterval)
+
+	exportKey := []byte(cfg.Export.SigningKey)
+	if len(exportKey) == 0 {
+		log.Printf("main: WARNING: no export signing key is configured, download links of exports stop working whenever the service restarts and differ between instances : set ASPERITAS_EXPORT_SIGNING_KEY")
+		exportKey = make([]byte, 32)
+		if _, err := rand.Read(exportKey); err != nil {
+			return errors.Wrap(err, "generating export signing key")
+		}
+	}
+
+	go func() {
+		exports := export.New(log, db, exportKey)
+		ticker := time.NewTicker(cfg.Export.PollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := exports.RunPending(context.Background(), cfg.Export.TTL, time.Now()); err != nil {
+				log.Printf("main: Running exports : %v", err)
+			}
+		}
+	}()
+
+	// =========================================================================
+	// Start Webhook Deliveries
+
+	log.Printf("main: Initializing webhook deliveries : every %v", cfg.Webhooks.PollInterval)
+
+	go func() {
+		webhooks := webhook.New(log, db)
+		client := webhook.NewClient(cfg.Webhooks.Timeout, false)
+		ticker := time.NewTicker(cfg.Webhooks.PollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := webhooks.RunPending(context.Background(), client, time.Now()); err != nil {
+				log.Printf("main: Running webhook deliveries : %v", err)
+			}
+		}
+	}()
+
+	// =========================================================================
+	// Start Link Previews
+
+	log.Printf("main: Initializing link previews : every %v", cfg.Previews.PollInterval)
+
+	go func() {
+		previews := preview.New(log, db)
+		fetcher := unfurl.New(unfurl.Config{
+			Timeout:  cfg.Previews.Timeout,
+			MaxBytes: cfg.Previews.MaxBytes,
+		})
+		ticker := time.NewTicker(cfg.Previews.PollInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := previews.RunPending(context.Background(), fetcher, time.Now()); err != nil {
+				log.Printf("main: Running link previews : %v", err)
+			}
+		}
+	}()
+
 	// =========================================================================
 	// Start Debug Service
 	//
@@ -171,12 +491,44 @@ func run(log *log.Logger) error {
 	shutdown := make(chan os.Signal, 1)
 	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
 
+	// Password reset mails are sent after the request was answered. Shutdown
+	// waits for them like for outstanding requests.
+	var background sync.WaitGroup
+
+	mux := handlers.API(handlers.APIConfig{
+		Build:    build,
+		Shutdown: shutdown,
+		Log:      log,
+		Auth:     auth,
+		DB:       db,
+		Lockout:  tracker,
+		Policy:   userPolicy,
+		Mailer:   mailer,
+
+		PublicURL: cfg.Web.PublicURL,
+		Providers: providers,
+
+		DeletionGrace: cfg.Users.DeletionGrace,
+		ExportKey:     exportKey,
+		Events:        events,
+
+		Media: store,
+		Images: imaging.Config{
+			MaxPixels:     cfg.Media.MaxPixels,
+			ThumbnailSize: cfg.Media.ThumbnailSize,
+		},
+		MaxUpload:  cfg.Media.MaxBytes,
+		Background: &background,
+	})
+
 	api := http.Server{
 		Addr:         cfg.Web.APIHost,
-		Handler:      handlers.API(build, shutdown, log, auth, db),
+		Handler:      mux,
 		ReadTimeout:  cfg.Web.ReadTimeout,
 		WriteTimeout: cfg.Web.WriteTimeout,
+		ConnContext:  web.ConnContext,
 	}
+	api.RegisterOnShutdown(events.Close)
 
 	// Make a channel to listen for errors coming from the listener. Use a
 	// buffered channel so the goroutine can exit if we don't collect this error.
@@ -208,6 +560,18 @@ func run(log *log.Logger) error {
 			api.Close()
 			return errors.Wrap(err, "could not stop server gracefully")
 		}
+
+		// Let mails still being sent finish within the same deadline.
+		done := make(chan struct{})
+		go func() {
+			background.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return errors.New("could not finish sending mails before shutdown")
+		}
 	}
 
 	return nil
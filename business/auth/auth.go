@@ -9,9 +9,11 @@ import (
 	"github.com/pkg/errors"
 )
 
+// User represents the user a token was issued to.
 type User struct {
 	Username string `json:"username"`
 	ID       string `json:"id"`
+	Verified bool   `json:"verified,omitempty"`
 }
 
 // ctxKey represents the type of value for the context key.
@@ -20,10 +22,20 @@ type ctxKey int
 // Key is used to store/retrieve a Claims value from a context.Context.
 const Key ctxKey = 1
 
+// ChallengeAudience is the audience of tokens which only prove that the
+// password step of a two-factor login succeeded. They are rejected by
+// ValidateToken and can only be exchanged for a real token.
+const ChallengeAudience = "2fa-challenge"
+
 // Claims represents the authorization claims transmitted via a JWT.
 type Claims struct {
 	jwt.StandardClaims
 	User User `json:"user"`
+
+	// Scope and ClientID are set on tokens issued to third-party clients.
+	// Scope is a space separated list.
+	Scope    string `json:"scope,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
 }
 
 // Keys represents an in memory store of keys.
@@ -150,5 +162,30 @@ func (a *Auth) ValidateToken(tokenStr string) (Claims, error) {
 		return Claims{}, errors.New("invalid token")
 	}
 
+	if claims.Audience == ChallengeAudience {
+		return Claims{}, errors.New("token requires two-factor verification")
+	}
+
+	return claims, nil
+}
+
+// ValidateChallenge recreates the Claims of a two-factor challenge token. It
+// verifies that the token was signed using our key and was issued as a
+// challenge.
+func (a *Auth) ValidateChallenge(tokenStr string) (Claims, error) {
+	var claims Claims
+	token, err := a.parser.ParseWithClaims(tokenStr, &claims, a.keyFunc)
+	if err != nil {
+		return Claims{}, errors.Wrap(err, "parsing token")
+	}
+
+	if !token.Valid {
+		return Claims{}, errors.New("invalid token")
+	}
+
+	if claims.Audience != ChallengeAudience {
+		return Claims{}, errors.New("token is not a two-factor challenge")
+	}
+
 	return claims, nil
 }
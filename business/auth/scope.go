@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Scopes which can be granted to third-party clients.
+const (
+	ScopeRead     = "read"
+	ScopeIdentity = "identity"
+	ScopeSubmit   = "submit"
+	ScopeVote     = "vote"
+	ScopeModPosts = "modposts"
+)
+
+// Scopes lists every scope a client can request.
+var Scopes = []string{ScopeRead, ScopeIdentity, ScopeSubmit, ScopeVote, ScopeModPosts}
+
+// ErrInsufficientScope occurs when a delegated token lacks a scope required
+// by the route.
+var ErrInsufficientScope = errors.New("token does not grant the required scope")
+
+// ValidScope reports whether s is a known scope.
+func ValidScope(s string) bool {
+	for _, scope := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Delegated reports whether the token was issued to a third-party client.
+// Such tokens are limited to the scopes they were granted, which may be
+// none at all, while tokens issued to users themselves are not limited.
+func (c Claims) Delegated() bool {
+	return c.ClientID != ""
+}
+
+// HasScopes reports whether the token grants every one of the scopes.
+// Tokens which are not delegated have all of them.
+func (c Claims) HasScopes(scopes ...string) bool {
+	if !c.Delegated() {
+		return true
+	}
+
+	granted := strings.Fields(c.Scope)
+	for _, want := range scopes {
+		found := false
+		for _, g := range granted {
+			if g == want {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
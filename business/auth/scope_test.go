@@ -0,0 +1,44 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+)
+
+func TestScopes(t *testing.T) {
+	t.Log("Given the need to limit what third-party clients can do.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen checking the scopes of a token.", testID)
+		{
+			var own auth.Claims
+			if own.Delegated() || !own.HasScopes(auth.ScopeSubmit, auth.ScopeModPosts) {
+				t.Fatalf("\t%s\tTest %d:\tShould not limit tokens of users themselves.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not limit tokens of users themselves.", success, testID)
+
+			client := auth.Claims{Scope: "read  vote", ClientID: "client"}
+			if !client.Delegated() || !client.HasScopes(auth.ScopeVote) || !client.HasScopes(auth.ScopeRead, auth.ScopeVote) {
+				t.Fatalf("\t%s\tTest %d:\tShould allow scopes which were granted.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow scopes which were granted.", success, testID)
+
+			if client.HasScopes(auth.ScopeVote, auth.ScopeSubmit) {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse scopes which were not granted.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse scopes which were not granted.", success, testID)
+
+			unscoped := auth.Claims{ClientID: "client"}
+			if !unscoped.Delegated() || unscoped.HasScopes(auth.ScopeRead) {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse everything to clients granted no scopes.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse everything to clients granted no scopes.", success, testID)
+
+			if auth.ValidScope("admin") || !auth.ValidScope(auth.ScopeModPosts) {
+				t.Fatalf("\t%s\tTest %d:\tShould know which scopes exist.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould know which scopes exist.", success, testID)
+		}
+	}
+}
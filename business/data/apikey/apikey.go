@@ -0,0 +1,291 @@
+// Package apikey contains personal API keys which let bots and scripts act
+// on behalf of users.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/ratelimit"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a specific key is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrInvalidKey occurs when a key is unknown, revoked or expired.
+	ErrInvalidKey = errors.New("API key is invalid or expired")
+
+	// ErrInvalidScope occurs when a key is created with an unknown scope.
+	ErrInvalidScope = errors.New("unknown scope")
+
+	// ErrInvalidExpiry occurs when a key is created already expired.
+	ErrInvalidExpiry = errors.New("expiry must be in the future")
+
+	// ErrInvalidRateLimit occurs when a key is created with a rate limit
+	// which would refuse every request.
+	ErrInvalidRateLimit = errors.New("rate limit must be positive")
+)
+
+// LimitError occurs when a key made more requests than its rate limit.
+type LimitError struct {
+	RetryAfter time.Duration
+}
+
+// Error implements the error interface.
+func (le *LimitError) Error() string {
+	return "API key rate limit exceeded"
+}
+
+const (
+	// keyPrefix starts every key so leaked keys are easy to search for.
+	keyPrefix = "asp_"
+
+	// ClientPrefix starts the client ID of claims which came from a key.
+	ClientPrefix = "apikey:"
+
+	// DefaultRateLimit is the number of requests per minute allowed for keys
+	// which do not set their own limit.
+	DefaultRateLimit = 60
+)
+
+// APIKey manages the set of API's for personal API keys.
+type APIKey struct {
+	log     *log.Logger
+	db      *sqlx.DB
+	limiter *ratelimit.Limiter
+}
+
+// New constructs an APIKey for api access. Requests made with keys are
+// counted by limiter, which has to use a one minute period.
+func New(log *log.Logger, db *sqlx.DB, limiter *ratelimit.Limiter) APIKey {
+	return APIKey{
+		log:     log,
+		db:      db,
+		limiter: limiter,
+	}
+}
+
+// Create adds a key for the user.
+func (k APIKey) Create(ctx context.Context, claims auth.Claims, nk NewKey, now time.Time) (Created, error) {
+	for _, s := range nk.Scopes {
+		if !auth.ValidScope(s) {
+			return Created{}, errors.Wrapf(ErrInvalidScope, "%q", s)
+		}
+	}
+	if nk.Expires != nil && !nk.Expires.After(now) {
+		return Created{}, ErrInvalidExpiry
+	}
+	rateLimit := DefaultRateLimit
+	if nk.RateLimit != nil {
+		if *nk.RateLimit <= 0 {
+			return Created{}, ErrInvalidRateLimit
+		}
+		rateLimit = *nk.RateLimit
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return Created{}, errors.Wrap(err, "reading random bytes")
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	c := Created{
+		Info: Info{
+			ID:          uuid.New().String(),
+			UserID:      claims.User.ID,
+			Name:        nk.Name,
+			Prefix:      key[:len(keyPrefix)+6],
+			KeyHash:     hashKey(key),
+			Scopes:      nk.Scopes,
+			RateLimit:   rateLimit,
+			DateCreated: now,
+			DateExpires: nk.Expires,
+		},
+		Key: key,
+	}
+
+	const q = `
+	INSERT INTO api_keys
+		(key_id, user_id, name, prefix, key_hash, scopes, rate_limit, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	k.log.Printf("%s: %s", "apikey.Create",
+		database.Log(q, c.ID, c.UserID, c.Name, c.Prefix, "***", c.Scopes, c.RateLimit, c.DateCreated, c.DateExpires),
+	)
+
+	if _, err := k.db.ExecContext(ctx, q, c.ID, c.UserID, c.Name, c.Prefix, c.KeyHash,
+		c.Scopes, c.RateLimit, c.DateCreated, c.DateExpires); err != nil {
+		return Created{}, errors.Wrap(err, "inserting key")
+	}
+
+	return c, nil
+}
+
+// Query retrieves the keys of the user, including revoked ones.
+func (k APIKey) Query(ctx context.Context, claims auth.Claims) ([]Info, error) {
+	const q = `SELECT * FROM api_keys WHERE user_id = $1 ORDER BY date_created DESC`
+
+	k.log.Printf("%s: %s", "apikey.Query", database.Log(q, claims.User.ID))
+
+	keys := []Info{}
+	if err := k.db.SelectContext(ctx, &keys, q, claims.User.ID); err != nil {
+		return nil, errors.Wrap(err, "selecting keys")
+	}
+	return keys, nil
+}
+
+// Revoke disables a key of the user.
+func (k APIKey) Revoke(ctx context.Context, claims auth.Claims, keyID string, now time.Time) error {
+	if _, err := uuid.Parse(keyID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `
+	UPDATE
+		api_keys
+	SET
+		date_revoked = $3
+	WHERE
+		key_id = $1 AND user_id = $2 AND date_revoked IS NULL`
+
+	k.log.Printf("%s: %s", "apikey.Revoke", database.Log(q, keyID, claims.User.ID, now))
+
+	res, err := k.db.ExecContext(ctx, q, keyID, claims.User.ID, now)
+	if err != nil {
+		return errors.Wrapf(err, "revoking key %s", keyID)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAll disables every key of the user.
+func (k APIKey) RevokeAll(ctx context.Context, userID string, now time.Time) error {
+	const q = `
+	UPDATE
+		api_keys
+	SET
+		date_revoked = $2
+	WHERE
+		user_id = $1 AND date_revoked IS NULL`
+
+	k.log.Printf("%s: %s", "apikey.RevokeAll", database.Log(q, userID, now))
+
+	if _, err := k.db.ExecContext(ctx, q, userID, now); err != nil {
+		return errors.Wrapf(err, "revoking keys of %s", userID)
+	}
+	return nil
+}
+
+// Authenticate finds the key and returns claims of the user it belongs to,
+// limited to the scopes of the key. It fails with a *LimitError when the key
+// is over its rate limit.
+func (k APIKey) Authenticate(ctx context.Context, key string, now time.Time) (auth.Claims, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return auth.Claims{}, ErrInvalidKey
+	}
+
+	const q = `
+	UPDATE
+		api_keys
+	SET
+		date_last_used = $2
+	WHERE
+		key_hash = $1 AND date_revoked IS NULL AND (date_expires IS NULL OR date_expires > $2)
+	RETURNING *`
+
+	k.log.Printf("%s: %s", "apikey.Authenticate", database.Log(q, "***", now))
+
+	var ki Info
+	if err := k.db.GetContext(ctx, &ki, q, hashKey(key), now); err != nil {
+		if err == sql.ErrNoRows {
+			return auth.Claims{}, ErrInvalidKey
+		}
+		return auth.Claims{}, errors.Wrap(err, "selecting key")
+	}
+
+	if ok, retry := k.limiter.Allow(ki.ID, ki.RateLimit, now); !ok {
+		return auth.Claims{}, &LimitError{RetryAfter: retry}
+	}
+
+	const qUser = `SELECT name, email <> '' AND email_verified AS verified FROM users WHERE user_id = $1`
+
+	k.log.Printf("%s: %s", "apikey.Authenticate", database.Log(qUser, ki.UserID))
+
+	var usr struct {
+		Name     string `db:"name"`
+		Verified bool   `db:"verified"`
+	}
+	if err := k.db.GetContext(ctx, &usr, qUser, ki.UserID); err != nil {
+		return auth.Claims{}, errors.Wrapf(err, "selecting owner of key %s", ki.ID)
+	}
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:       ki.ID,
+			IssuedAt: now.Unix(),
+		},
+		User: auth.User{
+			Username: usr.Name,
+			ID:       ki.UserID,
+			Verified: usr.Verified,
+		},
+		Scope:    strings.Join(ki.Scopes, " "),
+		ClientID: ClientPrefix + ki.ID,
+	}
+	return claims, nil
+}
+
+// Check returns ErrInvalidKey unless the key with the ID is known, not
+// revoked and not expired.
+func (k APIKey) Check(ctx context.Context, keyID string, now time.Time) error {
+	if _, err := uuid.Parse(keyID); err != nil {
+		return ErrInvalidKey
+	}
+
+	const q = `
+	SELECT
+		COUNT(*)
+	FROM
+		api_keys
+	WHERE
+		key_id = $1 AND date_revoked IS NULL AND (date_expires IS NULL OR date_expires > $2)`
+
+	k.log.Printf("%s: %s", "apikey.Check", database.Log(q, keyID, now))
+
+	var active int
+	if err := k.db.GetContext(ctx, &active, q, keyID, now); err != nil {
+		return errors.Wrap(err, "checking key")
+	}
+
+	if active == 0 {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// hashKey returns the hex encoded SHA-256 hash of a key. Keys carry enough
+// entropy to not need a slow hash.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,139 @@
+package apikey_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/ratelimit"
+)
+
+func TestAPIKey(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	k := apikey.New(log, db, ratelimit.New(time.Minute))
+
+	t.Log("Given the need to let users script their account with personal keys.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user creates and uses a key.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			usr, err := user.New(log, db).Create(ctx, user.NewUser{Name: "scripter", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			claims := auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}
+
+			for _, limit := range []int{0, -1} {
+				limit := limit
+				nk := apikey.NewKey{Name: "broken", Scopes: []string{auth.ScopeRead}, RateLimit: &limit}
+				if _, err := k.Create(ctx, claims, nk, now); err != apikey.ErrInvalidRateLimit {
+					t.Fatalf("\t%s\tTest %d:\tShould refuse a rate limit of %d : %v.", tests.Failed, testID, limit, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse rate limits which are not positive.", tests.Success, testID)
+
+			nk := apikey.NewKey{Name: "bot", Scopes: []string{auth.ScopeRead, auth.ScopeVote}}
+			created, err := k.Create(ctx, claims, nk, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a key : %s.", tests.Failed, testID, err)
+			}
+			if created.RateLimit != apikey.DefaultRateLimit || !strings.HasPrefix(created.Key, created.Prefix) {
+				t.Fatalf("\t%s\tTest %d:\tShould get the key with its prefix and the default limit : %+v.", tests.Failed, testID, created.Info)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the key with its prefix and the default limit.", tests.Success, testID)
+
+			keys, err := k.Query(ctx, claims)
+			if err != nil || len(keys) != 1 || keys[0].KeyHash == "" || strings.Contains(keys[0].KeyHash, created.Key) {
+				t.Fatalf("\t%s\tTest %d:\tShould only store a hash of the key : %+v %v.", tests.Failed, testID, keys, err)
+			}
+			if keys[0].DateLastUsed != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not have used the key yet : %v.", tests.Failed, testID, keys[0].DateLastUsed)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only store a hash of the key.", tests.Success, testID)
+
+			used := now.Add(time.Minute)
+			got, err := k.Authenticate(ctx, created.Key, used)
+			if err != nil || got.User.ID != usr.ID || got.Scope != "read vote" || !got.Delegated() {
+				t.Fatalf("\t%s\tTest %d:\tShould authenticate as the user with the scopes of the key : %+v %v.", tests.Failed, testID, got, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould authenticate as the user with the scopes of the key.", tests.Success, testID)
+
+			keys, err = k.Query(ctx, claims)
+			if err != nil || keys[0].DateLastUsed == nil || !keys[0].DateLastUsed.Equal(used) {
+				t.Fatalf("\t%s\tTest %d:\tShould record when the key was last used : %+v %v.", tests.Failed, testID, keys, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record when the key was last used.", tests.Success, testID)
+
+			for _, key := range []string{"asp_unknown", "unknown", created.Key[:len(created.Key)-1]} {
+				if _, err := k.Authenticate(ctx, key, used); err != apikey.ErrInvalidKey {
+					t.Fatalf("\t%s\tTest %d:\tShould refuse the unknown key %q : %v.", tests.Failed, testID, key, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse unknown keys.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a key is revoked or expires.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			usr, err := user.New(log, db).Create(ctx, user.NewUser{Name: "revoker", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			claims := auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}
+
+			past := now.Add(-time.Minute)
+			nk := apikey.NewKey{Name: "expired", Scopes: []string{auth.ScopeRead}, Expires: &past}
+			if _, err := k.Create(ctx, claims, nk, now); err != apikey.ErrInvalidExpiry {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to create an expired key : %v.", tests.Failed, testID, err)
+			}
+
+			expires := now.Add(time.Hour)
+			nk.Expires = &expires
+			expiring, err := k.Create(ctx, claims, nk, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a key : %s.", tests.Failed, testID, err)
+			}
+			if err := k.Check(ctx, expiring.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould report the key active before it expires : %v.", tests.Failed, testID, err)
+			}
+			if _, err := k.Authenticate(ctx, expiring.Key, expires); err != apikey.ErrInvalidKey {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse an expired key : %v.", tests.Failed, testID, err)
+			}
+			if err := k.Check(ctx, expiring.ID, expires); err != apikey.ErrInvalidKey {
+				t.Fatalf("\t%s\tTest %d:\tShould report an expired key : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse expired keys.", tests.Success, testID)
+
+			revoked, err := k.Create(ctx, claims, apikey.NewKey{Name: "revoked", Scopes: []string{auth.ScopeRead}}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a key : %s.", tests.Failed, testID, err)
+			}
+			if err := k.Revoke(ctx, claims, revoked.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the key : %s.", tests.Failed, testID, err)
+			}
+			if _, err := k.Authenticate(ctx, revoked.Key, now); err != apikey.ErrInvalidKey {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a revoked key : %v.", tests.Failed, testID, err)
+			}
+			if err := k.Check(ctx, revoked.ID, now); err != apikey.ErrInvalidKey {
+				t.Fatalf("\t%s\tTest %d:\tShould report a revoked key : %v.", tests.Failed, testID, err)
+			}
+			if err := k.Revoke(ctx, claims, revoked.ID, now); err != apikey.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not revoke a key twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse revoked keys.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package apikey
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Info represents a personal API key. The key itself is never stored, only
+// its hash and a prefix to tell keys apart.
+type Info struct {
+	ID           string         `db:"key_id" json:"id"`
+	UserID       string         `db:"user_id" json:"-"`
+	Name         string         `db:"name" json:"name"`
+	Prefix       string         `db:"prefix" json:"prefix"`
+	KeyHash      string         `db:"key_hash" json:"-"`
+	Scopes       pq.StringArray `db:"scopes" json:"scopes"`
+	RateLimit    int            `db:"rate_limit" json:"rateLimit"`
+	DateCreated  time.Time      `db:"date_created" json:"created"`
+	DateExpires  *time.Time     `db:"date_expires" json:"expires,omitempty"`
+	DateLastUsed *time.Time     `db:"date_last_used" json:"lastUsed,omitempty"`
+	DateRevoked  *time.Time     `db:"date_revoked" json:"revoked,omitempty"`
+}
+
+// NewKey contains information needed to create a key. RateLimit is the
+// number of requests per minute, nil means the default.
+type NewKey struct {
+	Name      string     `json:"name" validate:"required,max=64"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	RateLimit *int       `json:"rateLimit" validate:"omitempty,min=1,max=600"`
+	Expires   *time.Time `json:"expires"`
+}
+
+// Created is a newly created key. The key is shown only once.
+type Created struct {
+	Info
+	Key string `json:"key"`
+}
@@ -0,0 +1,82 @@
+// Package community contains per-community settings functionality.
+package community
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Community manages the set of API's for community access.
+type Community struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Community for api access.
+func New(log *log.Logger, db *sqlx.DB) Community {
+	return Community{
+		log: log,
+		db:  db,
+	}
+}
+
+// QueryByName gets settings of the specified community. Communities which
+// were never configured get the default settings.
+func (c Community) QueryByName(ctx context.Context, name string) (Info, error) {
+	const q = `SELECT * FROM communities WHERE name = $1`
+
+	c.log.Printf("%s: %s", "community.QueryByName", database.Log(q, name))
+
+	var com Info
+	if err := c.db.GetContext(ctx, &com, q, name); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{Name: name}, nil
+		}
+		return Info{}, errors.Wrapf(err, "selecting community %q", name)
+	}
+	return com, nil
+}
+
+// SetRequireVerifiedEmail changes whether users need a verified email to
+// post to the community.
+func (c Community) SetRequireVerifiedEmail(ctx context.Context, name string, require bool, now time.Time) error {
+	const q = `
+	INSERT INTO communities
+		(name, require_verified_email, date_created)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT (name) DO UPDATE SET
+		require_verified_email = EXCLUDED.require_verified_email`
+
+	c.log.Printf("%s: %s", "community.SetRequireVerifiedEmail", database.Log(q, name, require, now))
+
+	if _, err := c.db.ExecContext(ctx, q, name, require, now); err != nil {
+		return errors.Wrapf(err, "updating community %q", name)
+	}
+	return nil
+}
+
+// SetOwner makes the user with given ID the owner of the community, who
+// manages its webhooks. An empty ID leaves the community without an owner.
+func (c Community) SetOwner(ctx context.Context, name string, userID string, now time.Time) error {
+	const q = `
+	INSERT INTO communities
+		(name, owner_id, date_created)
+	VALUES
+		($1, NULLIF($2, '')::uuid, $3)
+	ON CONFLICT (name) DO UPDATE SET
+		owner_id = EXCLUDED.owner_id`
+
+	c.log.Printf("%s: %s", "community.SetOwner", database.Log(q, name, userID, now))
+
+	if _, err := c.db.ExecContext(ctx, q, name, userID, now); err != nil {
+		return errors.Wrapf(err, "updating owner of community %q", name)
+	}
+	return nil
+}
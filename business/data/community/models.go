@@ -0,0 +1,14 @@
+package community
+
+import (
+	"time"
+)
+
+// Info represents settings of a single community. Communities are known by
+// the category posts are submitted to; one without a row uses the defaults.
+type Info struct {
+	Name                 string    `db:"name" json:"name"`
+	RequireVerifiedEmail bool      `db:"require_verified_email" json:"requireVerifiedEmail"`
+	DateCreated          time.Time `db:"date_created" json:"created"`
+	OwnerID              *string   `db:"owner_id" json:"ownerId,omitempty"`
+}
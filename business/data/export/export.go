@@ -0,0 +1,368 @@
+// Package export builds archives with everything we store about a user.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/media"
+	"github.com/cravtos/asperitas-backend/business/data/message"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a specific export is requested but does not exist.
+	ErrNotFound = errors.New("export not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrInProgress occurs when a user requests an export while another one
+	// is still being built.
+	ErrInProgress = errors.New("an export is already in progress")
+
+	// ErrInvalidLink occurs when a download link is tampered with, expired
+	// or points to an archive which is gone.
+	ErrInvalidLink = errors.New("link is invalid or expired")
+)
+
+// pendingIndex is the unique index which allows one unfinished export per user.
+const pendingIndex = "exports_user_pending_idx"
+
+// jobTimeout is how long an export may be running before another worker
+// takes it over, e.g. after the first one crashed.
+const jobTimeout = 10 * time.Minute
+
+// Export manages the set of API's for data exports.
+type Export struct {
+	log *log.Logger
+	db  *sqlx.DB
+	key []byte
+}
+
+// New constructs an Export for api access. Download links are signed with key.
+func New(log *log.Logger, db *sqlx.DB, key []byte) Export {
+	return Export{
+		log: log,
+		db:  db,
+		key: key,
+	}
+}
+
+// Request queues a new export of the data of the user the claims belong to.
+func (e Export) Request(ctx context.Context, claims auth.Claims, now time.Time) (Info, error) {
+	ex := Info{
+		ID:          uuid.New().String(),
+		UserID:      claims.User.ID,
+		Status:      StatusPending,
+		DateCreated: now,
+	}
+
+	const q = `
+	INSERT INTO exports
+		(export_id, user_id, status, date_created)
+	VALUES
+		($1, $2, $3, $4)`
+
+	e.log.Printf("%s: %s", "export.Request", database.Log(q, ex.ID, ex.UserID, ex.Status, ex.DateCreated))
+
+	if _, err := e.db.ExecContext(ctx, q, ex.ID, ex.UserID, ex.Status, ex.DateCreated); err != nil {
+		if constraint, ok := database.UniqueViolation(err); ok && constraint == pendingIndex {
+			return Info{}, ErrInProgress
+		}
+		return Info{}, errors.Wrap(err, "inserting export")
+	}
+
+	return ex, nil
+}
+
+// QueryByID gets an export of the user the claims belong to. Ready exports
+// come with a link to download them.
+func (e Export) QueryByID(ctx context.Context, claims auth.Claims, exportID string) (Info, error) {
+	if _, err := uuid.Parse(exportID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		export_id, user_id, status, date_created, date_ready, date_expires
+	FROM
+		exports
+	WHERE
+		export_id = $1 AND user_id = $2`
+
+	e.log.Printf("%s: %s", "export.QueryByID", database.Log(q, exportID, claims.User.ID))
+
+	var ex Info
+	if err := e.db.GetContext(ctx, &ex, q, exportID, claims.User.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting export %s", exportID)
+	}
+
+	if ex.Status == StatusReady && ex.DateExpires != nil {
+		ex.URL = e.link(ex.ID, *ex.DateExpires)
+	}
+	return ex, nil
+}
+
+// Download returns the archive the signed link points to.
+func (e Export) Download(ctx context.Context, exportID, expires, signature string, now time.Time) ([]byte, error) {
+	if _, err := uuid.Parse(exportID); err != nil {
+		return nil, ErrInvalidLink
+	}
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidLink
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, e.sign(exportID, exp)) || !now.Before(time.Unix(exp, 0)) {
+		return nil, ErrInvalidLink
+	}
+
+	const q = `
+	SELECT
+		archive
+	FROM
+		exports
+	WHERE
+		export_id = $1 AND status = $2 AND date_expires > $3`
+
+	e.log.Printf("%s: %s", "export.Download", database.Log(q, exportID, StatusReady, now))
+
+	var archive []byte
+	if err := e.db.GetContext(ctx, &archive, q, exportID, StatusReady, now); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidLink
+		}
+		return nil, errors.Wrapf(err, "selecting archive %s", exportID)
+	}
+	return archive, nil
+}
+
+// RunPending builds every queued export and drops the expired ones. Ready
+// archives are kept for ttl. It returns how many exports were built.
+func (e Export) RunPending(ctx context.Context, ttl time.Duration, now time.Time) (int, error) {
+	const qExpired = `DELETE FROM exports WHERE date_expires <= $1`
+
+	e.log.Printf("%s: %s", "export.RunPending", database.Log(qExpired, now))
+
+	if _, err := e.db.ExecContext(ctx, qExpired, now); err != nil {
+		return 0, errors.Wrap(err, "deleting expired exports")
+	}
+
+	var n int
+	for {
+		ex, err := e.claim(ctx, now)
+		if err != nil {
+			if err == ErrNotFound {
+				return n, nil
+			}
+			return n, err
+		}
+
+		if err := e.run(ctx, ex, ttl, now); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// claim takes the oldest queued export so no other worker builds it.
+func (e Export) claim(ctx context.Context, now time.Time) (Info, error) {
+	const q = `
+	UPDATE
+		exports
+	SET
+		status = $1, date_started = $2
+	WHERE
+		export_id = (
+			SELECT export_id FROM exports
+			WHERE status = $3 OR (status = $1 AND date_started < $4)
+			ORDER BY date_created
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+	RETURNING
+		export_id, user_id, status, date_created, date_ready, date_expires`
+
+	stale := now.Add(-jobTimeout)
+	e.log.Printf("%s: %s", "export.claim", database.Log(q, StatusRunning, now, StatusPending, stale))
+
+	var ex Info
+	if err := e.db.GetContext(ctx, &ex, q, StatusRunning, now, StatusPending, stale); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrap(err, "claiming export")
+	}
+	return ex, nil
+}
+
+// run builds the archive of a claimed export and stores it. An archive
+// which cannot be built marks the export as failed.
+func (e Export) run(ctx context.Context, ex Info, ttl time.Duration, now time.Time) error {
+	var buf bytes.Buffer
+	if err := e.Write(ctx, &buf, ex.UserID, now); err != nil {
+		e.log.Printf("%s: building export %s : %v", "export.run", ex.ID, err)
+
+		const q = `UPDATE exports SET status = $2 WHERE export_id = $1`
+
+		e.log.Printf("%s: %s", "export.run", database.Log(q, ex.ID, StatusFailed))
+
+		if _, err := e.db.ExecContext(ctx, q, ex.ID, StatusFailed); err != nil {
+			return errors.Wrapf(err, "failing export %s", ex.ID)
+		}
+		return nil
+	}
+
+	const q = `
+	UPDATE
+		exports
+	SET
+		status = $2, archive = $3, date_ready = $4, date_expires = $5
+	WHERE
+		export_id = $1`
+
+	expires := now.Add(ttl)
+	e.log.Printf("%s: %s", "export.run", database.Log(q, ex.ID, StatusReady, "<archive>", now, expires))
+
+	if _, err := e.db.ExecContext(ctx, q, ex.ID, StatusReady, buf.Bytes(), now, expires); err != nil {
+		return errors.Wrapf(err, "storing export %s", ex.ID)
+	}
+	return nil
+}
+
+// Write builds a ZIP archive with a JSON file for every kind of data we
+// store about the user.
+func (e Export) Write(ctx context.Context, w io.Writer, userID string, now time.Time) error {
+	usr, err := user.New(e.log, e.db).LookupID(ctx, userID)
+	if err != nil {
+		return errors.Wrapf(err, "looking up user %s", userID)
+	}
+
+	posts := []Post{}
+	if err := e.selectAll(ctx, &posts, `SELECT post_id, type, title, payload, category, views, date_created FROM posts WHERE user_id = $1 ORDER BY date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting posts")
+	}
+
+	comments := []Comment{}
+	if err := e.selectAll(ctx, &comments, `SELECT comment_id, post_id, body, date_created FROM comments WHERE user_id = $1 ORDER BY date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting comments")
+	}
+
+	votes := []Vote{}
+	if err := e.selectAll(ctx, &votes, `SELECT post_id, vote FROM votes WHERE user_id = $1`, userID); err != nil {
+		return errors.Wrap(err, "selecting votes")
+	}
+
+	saved := []Saved{}
+	if err := e.selectAll(ctx, &saved, `SELECT post_id, comment_id, date_created FROM saves WHERE user_id = $1 ORDER BY date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting saved items")
+	}
+
+	hidden := []Hidden{}
+	if err := e.selectAll(ctx, &hidden, `SELECT post_id, date_created FROM hidden_posts WHERE user_id = $1 ORDER BY date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting hidden posts")
+	}
+
+	blocked := []user.Blocked{}
+	if err := e.selectAll(ctx, &blocked, `SELECT u.name, b.date_created FROM blocks AS b JOIN users AS u ON u.user_id = b.blocked_id WHERE b.user_id = $1 ORDER BY b.date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting blocked users")
+	}
+
+	messages := []message.Info{}
+	if err := e.selectAll(ctx, &messages, `SELECT msg.message_id, msg.conversation_id, u.name AS author, msg.body, msg.date_created FROM messages AS msg JOIN users AS u ON u.user_id = msg.user_id WHERE msg.user_id = $1 ORDER BY msg.date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting messages")
+	}
+
+	notifications := []notification.Info{}
+	if err := e.selectAll(ctx, &notifications, `SELECT notification_id, user_id, kind, NULL AS actor, post_id, comment_id, body, date_created, date_read FROM notifications WHERE user_id = $1 ORDER BY date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting notifications")
+	}
+
+	images := []media.Info{}
+	if err := e.selectAll(ctx, &images, `SELECT * FROM media WHERE user_id = $1 ORDER BY date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting images")
+	}
+
+	sessions := []session.Info{}
+	if err := e.selectAll(ctx, &sessions, `SELECT * FROM sessions WHERE user_id = $1 ORDER BY date_created`, userID); err != nil {
+		return errors.Wrap(err, "selecting sessions")
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", usr},
+		{"posts.json", posts},
+		{"comments.json", comments},
+		{"votes.json", votes},
+		{"saved.json", saved},
+		{"hidden.json", hidden},
+		{"blocked.json", blocked},
+		{"messages.json", messages},
+		{"notifications.json", notifications},
+		{"sessions.json", sessions},
+		{"images.json", images},
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return errors.Wrapf(err, "adding %s", f.name)
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return errors.Wrapf(err, "writing %s", f.name)
+		}
+	}
+	return zw.Close()
+}
+
+// selectAll runs a query of Write filtered by the user. Empty slices passed
+// as dest stay empty rather than nil, so they show up as [] in the archive.
+func (e Export) selectAll(ctx context.Context, dest interface{}, q string, userID string) error {
+	e.log.Printf("%s: %s", "export.Write", database.Log(q, userID))
+
+	return e.db.SelectContext(ctx, dest, q, userID)
+}
+
+// link returns the path the archive can be downloaded from until expires.
+func (e Export) link(exportID string, expires time.Time) string {
+	exp := expires.Unix()
+	v := url.Values{}
+	v.Set("expires", strconv.FormatInt(exp, 10))
+	v.Set("signature", hex.EncodeToString(e.sign(exportID, exp)))
+	return fmt.Sprintf("/api/export/%s?%s", exportID, v.Encode())
+}
+
+// sign computes the signature of a download link.
+func (e Export) sign(exportID string, expires int64) []byte {
+	mac := hmac.New(sha256.New, e.key)
+	fmt.Fprintf(mac, "%s:%d", exportID, expires)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,95 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/url"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/export"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+)
+
+func TestExport(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	key := []byte("0123456789abcdef0123456789abcdef")
+	e := export.New(log, db, key)
+
+	t.Log("Given the need to give users a copy of their data.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user requests an export.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			ttl := 72 * time.Hour
+
+			usr, err := user.New(log, db).Create(ctx, user.NewUser{Name: "exporter", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			claims := auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}
+
+			ex, err := e.Request(ctx, claims, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to request an export : %s.", tests.Failed, testID, err)
+			}
+			if _, err := e.Request(ctx, claims, now); err != export.ErrInProgress {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a second export while the first is pending : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a second export while the first is pending.", tests.Success, testID)
+
+			if n, err := e.RunPending(ctx, ttl, now); err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould build the export : %d %v.", tests.Failed, testID, n, err)
+			}
+			ex, err = e.QueryByID(ctx, claims, ex.ID)
+			if err != nil || ex.Status != export.StatusReady || ex.URL == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get a link to the ready export : %+v %v.", tests.Failed, testID, ex, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get a link to the ready export.", tests.Success, testID)
+
+			link, err := url.Parse(ex.URL)
+			if err != nil || path.Base(link.Path) != ex.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould get a link to the export : %q %v.", tests.Failed, testID, ex.URL, err)
+			}
+			expires := link.Query().Get("expires")
+			signature := link.Query().Get("signature")
+
+			archive, err := e.Download(ctx, ex.ID, expires, signature, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to download the archive : %s.", tests.Failed, testID, err)
+			}
+			zr, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+			if err != nil || len(zr.File) == 0 || zr.File[0].Name != "profile.json" {
+				t.Fatalf("\t%s\tTest %d:\tShould get an archive with the profile : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to download the archive.", tests.Success, testID)
+
+			tampered := []byte(signature)
+			tampered[0] ^= 1
+			invalid := []struct {
+				name      string
+				e         export.Export
+				signature string
+				now       time.Time
+			}{
+				{"a tampered signature", e, string(tampered), now},
+				{"an expired link", e, signature, now.Add(ttl)},
+				{"a link signed with another key", export.New(log, db, []byte("another key")), signature, now},
+			}
+			for _, tt := range invalid {
+				if _, err := tt.e.Download(ctx, ex.ID, expires, tt.signature, tt.now); err != export.ErrInvalidLink {
+					t.Fatalf("\t%s\tTest %d:\tShould refuse %s : %v.", tests.Failed, testID, tt.name, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse links which are tampered with, expired or signed with another key.", tests.Success, testID)
+		}
+	}
+}
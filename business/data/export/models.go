@@ -0,0 +1,64 @@
+package export
+
+import (
+	"time"
+)
+
+// Statuses an export goes through.
+const (
+	StatusPending = "pending"
+	StatusRunning = "running"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+// Info represents a request of a user for a copy of their data.
+type Info struct {
+	ID          string     `db:"export_id" json:"id"`
+	UserID      string     `db:"user_id" json:"-"`
+	Status      string     `db:"status" json:"status"`
+	DateCreated time.Time  `db:"date_created" json:"created"`
+	DateReady   *time.Time `db:"date_ready" json:"ready,omitempty"`
+	DateExpires *time.Time `db:"date_expires" json:"expires,omitempty"`
+
+	// URL is the signed link the archive is downloaded from once it is ready.
+	URL string `db:"-" json:"url,omitempty"`
+}
+
+// Post is a post as it is written to an archive.
+type Post struct {
+	ID          string    `db:"post_id" json:"id"`
+	Type        string    `db:"type" json:"type"`
+	Title       string    `db:"title" json:"title"`
+	Payload     string    `db:"payload" json:"payload"`
+	Category    string    `db:"category" json:"category"`
+	Views       int       `db:"views" json:"views"`
+	DateCreated time.Time `db:"date_created" json:"created"`
+}
+
+// Comment is a comment as it is written to an archive.
+type Comment struct {
+	ID          string    `db:"comment_id" json:"id"`
+	PostID      string    `db:"post_id" json:"postId"`
+	Body        string    `db:"body" json:"body"`
+	DateCreated time.Time `db:"date_created" json:"created"`
+}
+
+// Vote is a vote as it is written to an archive.
+type Vote struct {
+	PostID string `db:"post_id" json:"postId"`
+	Vote   int    `db:"vote" json:"vote"`
+}
+
+// Saved is a saved post or comment as it is written to an archive.
+type Saved struct {
+	PostID      string    `db:"post_id" json:"postId"`
+	CommentID   *string   `db:"comment_id" json:"commentId,omitempty"`
+	DateCreated time.Time `db:"date_created" json:"saved"`
+}
+
+// Hidden is a hidden post as it is written to an archive.
+type Hidden struct {
+	PostID      string    `db:"post_id" json:"postId"`
+	DateCreated time.Time `db:"date_created" json:"hidden"`
+}
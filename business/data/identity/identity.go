@@ -0,0 +1,239 @@
+// Package identity links identities at external OpenID Connect providers to
+// users.
+package identity
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/oidc"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when an identity is not linked to any user.
+	ErrNotFound = errors.New("not found")
+
+	// ErrInvalidState occurs when the state of a login is unknown or expired.
+	ErrInvalidState = errors.New("login state is invalid or expired")
+)
+
+const (
+	// loginTTL is how long user has to come back from the provider.
+	loginTTL = 10 * time.Minute
+
+	// nameAttempts limits how many numbered variants of a name are tried.
+	nameAttempts = 20
+)
+
+// nameStrip matches characters which are not allowed in usernames.
+var nameStrip = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Identity manages the set of API's for external identities.
+type Identity struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	user   user.User
+	policy user.Policy
+}
+
+// New constructs an Identity for api access. Users created on first login
+// get names accepted by policy.
+func New(log *log.Logger, db *sqlx.DB, policy user.Policy) Identity {
+	return Identity{
+		log:    log,
+		db:     db,
+		user:   user.New(log, db),
+		policy: policy,
+	}
+}
+
+// StartLogin remembers a new login at the provider. The returned state,
+// nonce and verifier are to be sent along the authorization request.
+func (i Identity) StartLogin(ctx context.Context, provider string, now time.Time) (Login, error) {
+	var lgn Login
+	var err error
+	if lgn.State, err = oidc.RandomString(24); err != nil {
+		return Login{}, err
+	}
+	if lgn.Nonce, err = oidc.RandomString(24); err != nil {
+		return Login{}, err
+	}
+	if lgn.Verifier, err = oidc.RandomString(32); err != nil {
+		return Login{}, err
+	}
+	lgn.Provider = provider
+	lgn.DateExpires = now.Add(loginTTL)
+
+	const q = `
+	INSERT INTO oidc_logins
+		(state, provider, nonce, verifier, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5)`
+
+	i.log.Printf("%s: %s", "identity.StartLogin", database.Log(q, lgn.State, provider, "***", "***", lgn.DateExpires))
+
+	if _, err := i.db.ExecContext(ctx, q, lgn.State, provider, lgn.Nonce, lgn.Verifier, lgn.DateExpires); err != nil {
+		return Login{}, errors.Wrap(err, "inserting login")
+	}
+
+	return lgn, nil
+}
+
+// FinishLogin consumes the login with given state. A state can be used only
+// once.
+func (i Identity) FinishLogin(ctx context.Context, provider, state string, now time.Time) (Login, error) {
+	const q = `
+	DELETE FROM
+		oidc_logins
+	WHERE
+		state = $1 AND provider = $2
+	RETURNING *`
+
+	i.log.Printf("%s: %s", "identity.FinishLogin", database.Log(q, state, provider))
+
+	var lgn Login
+	if err := i.db.GetContext(ctx, &lgn, q, state, provider); err != nil {
+		if err == sql.ErrNoRows {
+			return Login{}, ErrInvalidState
+		}
+		return Login{}, errors.Wrap(err, "deleting login")
+	}
+
+	if !now.Before(lgn.DateExpires) {
+		return Login{}, ErrInvalidState
+	}
+
+	return lgn, nil
+}
+
+// QueryBySubject gets the identity with given subject at the provider.
+func (i Identity) QueryBySubject(ctx context.Context, provider, subject string) (Info, error) {
+	const q = `SELECT * FROM identities WHERE provider = $1 AND subject = $2`
+
+	i.log.Printf("%s: %s", "identity.QueryBySubject", database.Log(q, provider, subject))
+
+	var idn Info
+	if err := i.db.GetContext(ctx, &idn, q, provider, subject); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting identity %s at %s", subject, provider)
+	}
+	return idn, nil
+}
+
+// SignIn returns the user linked to the external identity. On the first
+// login a new user is registered and linked. Existing users are never linked
+// automatically by email, since a provider could assert an email it does not
+// own.
+func (i Identity) SignIn(ctx context.Context, provider string, ext oidc.Identity, now time.Time) (user.Info, error) {
+	idn, err := i.QueryBySubject(ctx, provider, ext.Subject)
+	switch err {
+	case nil:
+		return i.user.LookupID(ctx, idn.UserID)
+	case ErrNotFound:
+	default:
+		return user.Info{}, err
+	}
+
+	usr, err := i.register(ctx, ext, now)
+	if err != nil {
+		return user.Info{}, err
+	}
+
+	const q = `
+	INSERT INTO identities
+		(provider, subject, user_id, email, date_created)
+	VALUES
+		($1, $2, $3, $4, $5)`
+
+	i.log.Printf("%s: %s", "identity.SignIn", database.Log(q, provider, ext.Subject, usr.ID, ext.Email, now))
+
+	if _, err := i.db.ExecContext(ctx, q, provider, ext.Subject, usr.ID, ext.Email, now); err != nil {
+		return user.Info{}, errors.Wrapf(err, "linking identity %s at %s", ext.Subject, provider)
+	}
+
+	return usr, nil
+}
+
+// register creates a user for an external identity. The name is derived
+// from what the provider told us and numbered when taken.
+func (i Identity) register(ctx context.Context, ext oidc.Identity, now time.Time) (user.Info, error) {
+	password, err := oidc.RandomString(32)
+	if err != nil {
+		return user.Info{}, err
+	}
+
+	nu := user.NewUser{
+		Password: password,
+	}
+	if ext.EmailVerified {
+		nu.Email = ext.Email
+		nu.Verified = true
+	}
+
+	base := i.baseName(ext)
+	for n := 1; n <= nameAttempts; n++ {
+		nu.Name = base
+		if n > 1 {
+			suffix := fmt.Sprint(n)
+			nu.Name = truncate(base, i.policy.MaxNameLength-len(suffix)) + suffix
+		}
+		if err := i.policy.Validate(nu); err != nil {
+			continue
+		}
+
+		usr, err := i.user.Create(ctx, nu, now)
+		if err == user.ErrDuplicateEmail {
+
+			// The email belongs to someone else. Register without it.
+			nu.Email, nu.Verified = "", false
+			usr, err = i.user.Create(ctx, nu, now)
+		}
+		switch err {
+		case nil:
+			return usr, nil
+		case user.ErrDuplicateName:
+			continue
+		default:
+			return user.Info{}, err
+		}
+	}
+
+	return user.Info{}, errors.Errorf("no free username for %q", base)
+}
+
+// baseName picks the first usable name among the claims of the identity.
+func (i Identity) baseName(ext oidc.Identity) string {
+	local := ext.Email
+	if at := strings.LastIndex(local, "@"); at >= 0 {
+		local = local[:at]
+	}
+
+	for _, name := range []string{ext.PreferredUsername, local, ext.Name} {
+		name = nameStrip.ReplaceAllString(name, "_")
+		name = strings.Trim(name, "_")
+		name = truncate(name, i.policy.MaxNameLength)
+		if len(name) >= i.policy.MinNameLength {
+			return name
+		}
+	}
+	return "user"
+}
+
+// truncate cuts s to at most n bytes. Names are ASCII at this point.
+func truncate(s string, n int) string {
+	if n > 0 && len(s) > n {
+		return s[:n]
+	}
+	return s
+}
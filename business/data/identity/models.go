@@ -0,0 +1,23 @@
+package identity
+
+import (
+	"time"
+)
+
+// Info represents an external identity linked to a user.
+type Info struct {
+	Provider    string    `db:"provider" json:"provider"`
+	Subject     string    `db:"subject" json:"-"`
+	UserID      string    `db:"user_id" json:"-"`
+	Email       string    `db:"email" json:"email,omitempty"`
+	DateCreated time.Time `db:"date_created" json:"date_created"`
+}
+
+// Login is a login started at a provider which is not finished yet.
+type Login struct {
+	State       string    `db:"state"`
+	Provider    string    `db:"provider"`
+	Nonce       string    `db:"nonce"`
+	Verifier    string    `db:"verifier"`
+	DateExpires time.Time `db:"date_expires"`
+}
@@ -0,0 +1,131 @@
+// Package media keeps the images users upload for their posts.
+package media
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/blob"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/imaging"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a specific image is requested but does not exist.
+	ErrNotFound = errors.New("media not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+)
+
+// Media manages the set of API's for uploaded image access. Images are kept
+// in the BlobStore, the database knows who uploaded them and how big they
+// are.
+type Media struct {
+	log   *log.Logger
+	db    *sqlx.DB
+	store blob.BlobStore
+	cfg   imaging.Config
+}
+
+// New constructs a Media for api access. Uploads are checked against the
+// limits of cfg.
+func New(log *log.Logger, db *sqlx.DB, store blob.BlobStore, cfg imaging.Config) Media {
+	return Media{
+		log:   log,
+		db:    db,
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Upload stores an image uploaded by the user the claims belong to along
+// with its thumbnail. Metadata of the image is stripped before it is stored.
+// Errors of the imaging package tell why an upload is refused.
+func (m Media) Upload(ctx context.Context, claims auth.Claims, data []byte, now time.Time) (Info, error) {
+	img, err := imaging.Process(data, m.cfg)
+	if err != nil {
+		return Info{}, err
+	}
+
+	id := uuid.New().String()
+	info := Info{
+		ID:           id,
+		UserID:       claims.User.ID,
+		Key:          "images/" + id + imaging.Extensions[img.ContentType],
+		ThumbnailKey: "thumbnails/" + id + ".jpg",
+		ContentType:  img.ContentType,
+		Width:        img.Width,
+		Height:       img.Height,
+		Size:         len(img.Data),
+		DateCreated:  now,
+	}
+
+	if err := m.store.Put(ctx, info.Key, img.Data, img.ContentType); err != nil {
+		return Info{}, errors.Wrapf(err, "storing image %s", id)
+	}
+	if err := m.store.Put(ctx, info.ThumbnailKey, img.Thumbnail, imaging.JPEG); err != nil {
+		m.remove(ctx, info)
+		return Info{}, errors.Wrapf(err, "storing thumbnail of %s", id)
+	}
+
+	const q = `
+	INSERT INTO media
+		(media_id, user_id, key, thumbnail_key, content_type, width, height, size, date_created)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	m.log.Printf("%s: %s", "media.Upload",
+		database.Log(q, info.ID, info.UserID, info.Key, info.ThumbnailKey, info.ContentType, info.Width, info.Height, info.Size, info.DateCreated),
+	)
+
+	if _, err := m.db.ExecContext(ctx, q, info.ID, info.UserID, info.Key, info.ThumbnailKey, info.ContentType, info.Width, info.Height, info.Size, info.DateCreated); err != nil {
+		m.remove(ctx, info)
+		return Info{}, errors.Wrapf(err, "inserting image %s", id)
+	}
+
+	return m.withURLs(info), nil
+}
+
+// QueryByID gets the specified image from the database.
+func (m Media) QueryByID(ctx context.Context, mediaID string) (Info, error) {
+	if _, err := uuid.Parse(mediaID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q = `SELECT * FROM media WHERE media_id = $1`
+
+	m.log.Printf("%s: %s", "media.QueryByID", database.Log(q, mediaID))
+
+	var info Info
+	if err := m.db.GetContext(ctx, &info, q, mediaID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting image %s", mediaID)
+	}
+	return m.withURLs(info), nil
+}
+
+// withURLs tells where the image and its thumbnail are downloaded.
+func (m Media) withURLs(info Info) Info {
+	info.URL = m.store.URL(info.Key)
+	info.ThumbnailURL = m.store.URL(info.ThumbnailKey)
+	return info
+}
+
+// remove deletes the blobs of an image which could not be stored
+// completely. Failing to do so only leaves files behind, so it is logged.
+func (m Media) remove(ctx context.Context, info Info) {
+	for _, key := range []string{info.Key, info.ThumbnailKey} {
+		if err := m.store.Delete(ctx, key); err != nil {
+			m.log.Printf("%s: %v", "media.remove", err)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package media
+
+import (
+	"time"
+)
+
+// Info is an image uploaded by a user. The URLs are where clients download
+// the image and its thumbnail, they depend on the BlobStore it is kept in.
+type Info struct {
+	ID           string    `db:"media_id" json:"id"`
+	UserID       string    `db:"user_id" json:"-"`
+	Key          string    `db:"key" json:"-"`
+	ThumbnailKey string    `db:"thumbnail_key" json:"-"`
+	ContentType  string    `db:"content_type" json:"contentType"`
+	Width        int       `db:"width" json:"width"`
+	Height       int       `db:"height" json:"height"`
+	Size         int       `db:"size" json:"size"`
+	DateCreated  time.Time `db:"date_created" json:"created"`
+	URL          string    `db:"-" json:"url,omitempty"`
+	ThumbnailURL string    `db:"-" json:"thumbnailUrl,omitempty"`
+}
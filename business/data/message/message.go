@@ -0,0 +1,521 @@
+// Package message contains private messages between users.
+package message
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a conversation is requested which does not
+	// exist or the user is not a member of.
+	ErrNotFound = errors.New("conversation not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrUserNotFound occurs when a conversation is started with a user who
+	// does not exist.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrNoRecipients occurs when a conversation is started with nobody but
+	// the user themselves.
+	ErrNoRecipients = errors.New("conversation needs another member")
+
+	// ErrTooManyMembers occurs when a conversation is started with more than
+	// MaxMembers users.
+	ErrTooManyMembers = errors.New("conversation has too many members")
+
+	// ErrBlocked occurs when a member of the conversation blocked the user or
+	// the other way around.
+	ErrBlocked = errors.New("a member of the conversation is blocked")
+)
+
+// MaxMembers is how many users, the one starting it included, a
+// conversation may have.
+const MaxMembers = 10
+
+// EventCreated is published to the other members when a message is sent.
+const EventCreated = "message"
+
+// authorName is the name of the author of a message aliased as msg, or
+// DeletedName once they are deleted.
+const authorName = `(SELECT CASE WHEN u.date_deletion IS NULL THEN u.name ELSE '` + user.DeletedName + `' END
+	FROM users AS u WHERE u.user_id = msg.user_id) AS author`
+
+// visible keeps the messages aliased as msg which the member aliased as cm
+// did not delete and whose authors they did not block.
+const visible = `msg.date_created > COALESCE(cm.date_deleted, '-infinity')
+	AND NOT EXISTS (SELECT 1 FROM blocks AS b WHERE b.user_id = cm.user_id AND b.blocked_id = msg.user_id)`
+
+// unread keeps the visible messages aliased as msg which were sent to the
+// member aliased as cm after they last read the conversation.
+const unread = visible + `
+	AND msg.user_id <> cm.user_id AND msg.date_created > COALESCE(cm.date_read, '-infinity')`
+
+// Message manages the set of API's for private messages.
+type Message struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	user   user.User
+	events pubsub.Bus
+}
+
+// New constructs a Message for api access. Sent messages are published to
+// events.
+func New(log *log.Logger, db *sqlx.DB, events pubsub.Bus) Message {
+	return Message{
+		log:    log,
+		db:     db,
+		user:   user.New(log, db),
+		events: events,
+	}
+}
+
+// Start sends the first message to the users named in nc. A conversation
+// with exactly the same members is continued instead of starting another.
+func (m Message) Start(ctx context.Context, claims auth.Claims, nc NewConversation, now time.Time) (Conversation, error) {
+	seen := map[string]bool{strings.ToLower(claims.User.Username): true}
+	var names []string
+	for _, name := range nc.To {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return Conversation{}, ErrNoRecipients
+	}
+	if len(names)+1 > MaxMembers {
+		return Conversation{}, ErrTooManyMembers
+	}
+
+	const qUsers = `SELECT user_id::text FROM users WHERE lower(name) = ANY($1) AND date_deletion IS NULL`
+
+	m.log.Printf("%s: %s", "message.Start", database.Log(qUsers, names))
+
+	var members []string
+	if err := m.db.SelectContext(ctx, &members, qUsers, pq.Array(names)); err != nil {
+		return Conversation{}, errors.Wrap(err, "selecting members")
+	}
+	if len(members) != len(names) {
+		return Conversation{}, ErrUserNotFound
+	}
+	if err := m.checkBlocks(ctx, claims, members); err != nil {
+		return Conversation{}, err
+	}
+
+	members = append(members, claims.User.ID)
+	sort.Strings(members)
+
+	const qExisting = `
+	SELECT
+		conversation_id
+	FROM
+		conversation_members
+	GROUP BY
+		conversation_id
+	HAVING
+		array_agg(user_id::text ORDER BY user_id::text) = $1`
+
+	m.log.Printf("%s: %s", "message.Start", database.Log(qExisting, members))
+
+	var conversationID string
+	err := m.db.GetContext(ctx, &conversationID, qExisting, pq.Array(members))
+	switch {
+	case err == sql.ErrNoRows:
+		if conversationID, err = m.create(ctx, members, now); err != nil {
+			return Conversation{}, err
+		}
+	case err != nil:
+		return Conversation{}, errors.Wrap(err, "selecting conversation")
+	}
+
+	if _, err := m.Send(ctx, claims, conversationID, NewMessage{Body: nc.Body}, now); err != nil {
+		return Conversation{}, err
+	}
+
+	return m.QueryByID(ctx, claims, conversationID)
+}
+
+// create adds a conversation between members and returns its ID.
+func (m Message) create(ctx context.Context, members []string, now time.Time) (string, error) {
+	conversationID := uuid.New().String()
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return "", errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `
+	INSERT INTO conversations
+		(conversation_id, date_created, date_updated)
+	VALUES
+		($1, $2, $2)`
+
+	m.log.Printf("%s: %s", "message.create", database.Log(q, conversationID, now))
+
+	if _, err := tx.ExecContext(ctx, q, conversationID, now); err != nil {
+		return "", errors.Wrap(err, "inserting conversation")
+	}
+
+	const qMember = `
+	INSERT INTO conversation_members
+		(conversation_id, user_id)
+	VALUES
+		($1, $2)`
+
+	for _, id := range members {
+		m.log.Printf("%s: %s", "message.create", database.Log(qMember, conversationID, id))
+
+		if _, err := tx.ExecContext(ctx, qMember, conversationID, id); err != nil {
+			return "", errors.Wrap(err, "inserting member")
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", errors.Wrap(err, "committing conversation")
+	}
+	return conversationID, nil
+}
+
+// Send adds a message to a conversation of the user the claims belong to.
+// Nobody can send messages to a conversation with a member who blocked them
+// or who they blocked.
+func (m Message) Send(ctx context.Context, claims auth.Claims, conversationID string, nm NewMessage, now time.Time) (Info, error) {
+	others, err := m.others(ctx, claims, conversationID)
+	if err != nil {
+		return Info{}, err
+	}
+	if err := m.checkBlocks(ctx, claims, others); err != nil {
+		return Info{}, err
+	}
+
+	msg := Info{
+		ID:             uuid.New().String(),
+		ConversationID: conversationID,
+		Author:         claims.User.Username,
+		Body:           nm.Body,
+		DateCreated:    now,
+	}
+
+	tx, err := m.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `
+	INSERT INTO messages
+		(message_id, conversation_id, user_id, body, date_created)
+	VALUES
+		($1, $2, $3, $4, $5)`
+
+	m.log.Printf("%s: %s", "message.Send", database.Log(q, msg.ID, conversationID, claims.User.ID, msg.Body, now))
+
+	if _, err := tx.ExecContext(ctx, q, msg.ID, conversationID, claims.User.ID, msg.Body, now); err != nil {
+		return Info{}, errors.Wrap(err, "inserting message")
+	}
+
+	const qUpdated = `UPDATE conversations SET date_updated = $2 WHERE conversation_id = $1`
+
+	m.log.Printf("%s: %s", "message.Send", database.Log(qUpdated, conversationID, now))
+
+	if _, err := tx.ExecContext(ctx, qUpdated, conversationID, now); err != nil {
+		return Info{}, errors.Wrap(err, "updating conversation")
+	}
+
+	const qRead = `UPDATE conversation_members SET date_read = $3 WHERE conversation_id = $1 AND user_id = $2`
+
+	m.log.Printf("%s: %s", "message.Send", database.Log(qRead, conversationID, claims.User.ID, now))
+
+	if _, err := tx.ExecContext(ctx, qRead, conversationID, claims.User.ID, now); err != nil {
+		return Info{}, errors.Wrap(err, "marking conversation read")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Info{}, errors.Wrap(err, "committing message")
+	}
+
+	for _, id := range others {
+		m.events.Publish(notification.Topic(id), EventCreated, msg)
+	}
+	return msg, nil
+}
+
+// QueryConversations lists the conversations of the user the claims belong
+// to, most recently active first. Conversations the user deleted show up
+// again once somebody sends a new message. Page counts from 1.
+func (m Message) QueryConversations(ctx context.Context, claims auth.Claims, page int, rows int) ([]Conversation, error) {
+	const q = `
+	SELECT
+		c.conversation_id, c.date_updated,
+		(SELECT COUNT(*) FROM messages AS msg WHERE msg.conversation_id = c.conversation_id AND ` + unread + `) AS unread
+	FROM
+		conversations AS c
+	JOIN
+		conversation_members AS cm ON cm.conversation_id = c.conversation_id
+	WHERE
+		cm.user_id = $1 AND EXISTS (
+			SELECT 1 FROM messages AS msg WHERE msg.conversation_id = c.conversation_id AND ` + visible + `
+		)
+	ORDER BY
+		c.date_updated DESC
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+
+	offset := (page - 1) * rows
+	if offset < 0 {
+		offset = 0
+	}
+
+	m.log.Printf("%s: %s", "message.QueryConversations", database.Log(q, claims.User.ID, offset, rows))
+
+	conversations := []Conversation{}
+	if err := m.db.SelectContext(ctx, &conversations, q, claims.User.ID, offset, rows); err != nil {
+		return nil, errors.Wrap(err, "selecting conversations")
+	}
+
+	for i := range conversations {
+		if err := m.complete(ctx, claims, &conversations[i]); err != nil {
+			return nil, err
+		}
+	}
+	return conversations, nil
+}
+
+// QueryByID gets a conversation of the user the claims belong to.
+func (m Message) QueryByID(ctx context.Context, claims auth.Claims, conversationID string) (Conversation, error) {
+	if _, err := uuid.Parse(conversationID); err != nil {
+		return Conversation{}, ErrInvalidID
+	}
+
+	const q = `
+	SELECT
+		c.conversation_id, c.date_updated,
+		(SELECT COUNT(*) FROM messages AS msg WHERE msg.conversation_id = c.conversation_id AND ` + unread + `) AS unread
+	FROM
+		conversations AS c
+	JOIN
+		conversation_members AS cm ON cm.conversation_id = c.conversation_id
+	WHERE
+		c.conversation_id = $1 AND cm.user_id = $2`
+
+	m.log.Printf("%s: %s", "message.QueryByID", database.Log(q, conversationID, claims.User.ID))
+
+	var c Conversation
+	if err := m.db.GetContext(ctx, &c, q, conversationID, claims.User.ID); err != nil {
+		if err == sql.ErrNoRows {
+			return Conversation{}, ErrNotFound
+		}
+		return Conversation{}, errors.Wrapf(err, "selecting conversation %s", conversationID)
+	}
+
+	if err := m.complete(ctx, claims, &c); err != nil {
+		return Conversation{}, err
+	}
+	return c, nil
+}
+
+// QueryThread lists the messages of a conversation of the user the claims
+// belong to, newest first. Page counts from 1.
+func (m Message) QueryThread(ctx context.Context, claims auth.Claims, conversationID string, page int, rows int) ([]Info, error) {
+	if _, err := m.others(ctx, claims, conversationID); err != nil {
+		return nil, err
+	}
+
+	offset := (page - 1) * rows
+	if offset < 0 {
+		offset = 0
+	}
+
+	return m.selectMessages(ctx, claims, conversationID, offset, rows)
+}
+
+// MarkRead marks every message of a conversation of the user the claims
+// belong to as read.
+func (m Message) MarkRead(ctx context.Context, claims auth.Claims, conversationID string, now time.Time) error {
+	if _, err := uuid.Parse(conversationID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `UPDATE conversation_members SET date_read = $3 WHERE conversation_id = $1 AND user_id = $2`
+
+	m.log.Printf("%s: %s", "message.MarkRead", database.Log(q, conversationID, claims.User.ID, now))
+
+	res, err := m.db.ExecContext(ctx, q, conversationID, claims.User.ID, now)
+	if err != nil {
+		return errors.Wrapf(err, "marking conversation %s read", conversationID)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Delete removes a conversation for the user the claims belong to only. The
+// other members keep it, and the user gets it back with only the messages
+// sent afterwards once somebody writes again.
+func (m Message) Delete(ctx context.Context, claims auth.Claims, conversationID string, now time.Time) error {
+	if _, err := uuid.Parse(conversationID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `
+	UPDATE
+		conversation_members
+	SET
+		date_deleted = $3, date_read = $3
+	WHERE
+		conversation_id = $1 AND user_id = $2`
+
+	m.log.Printf("%s: %s", "message.Delete", database.Log(q, conversationID, claims.User.ID, now))
+
+	res, err := m.db.ExecContext(ctx, q, conversationID, claims.User.ID, now)
+	if err != nil {
+		return errors.Wrapf(err, "deleting conversation %s", conversationID)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CountUnread returns how many messages the user did not read yet.
+func (m Message) CountUnread(ctx context.Context, claims auth.Claims) (int, error) {
+	const q = `
+	SELECT
+		COUNT(*)
+	FROM
+		messages AS msg
+	JOIN
+		conversation_members AS cm ON cm.conversation_id = msg.conversation_id
+	WHERE
+		cm.user_id = $1 AND ` + unread
+
+	m.log.Printf("%s: %s", "message.CountUnread", database.Log(q, claims.User.ID))
+
+	var count int
+	if err := m.db.GetContext(ctx, &count, q, claims.User.ID); err != nil {
+		return 0, errors.Wrap(err, "counting unread messages")
+	}
+	return count, nil
+}
+
+// others returns the IDs of the members of a conversation but the user the
+// claims belong to. It returns ErrNotFound unless the user is a member.
+func (m Message) others(ctx context.Context, claims auth.Claims, conversationID string) ([]string, error) {
+	if _, err := uuid.Parse(conversationID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `SELECT user_id::text FROM conversation_members WHERE conversation_id = $1`
+
+	m.log.Printf("%s: %s", "message.others", database.Log(q, conversationID))
+
+	var members []string
+	if err := m.db.SelectContext(ctx, &members, q, conversationID); err != nil {
+		return nil, errors.Wrapf(err, "selecting members of %s", conversationID)
+	}
+
+	var others []string
+	var member bool
+	for _, id := range members {
+		if id == claims.User.ID {
+			member = true
+			continue
+		}
+		others = append(others, id)
+	}
+	if !member {
+		return nil, ErrNotFound
+	}
+	return others, nil
+}
+
+// checkBlocks returns ErrBlocked if any of the users blocked the user the
+// claims belong to or the other way around.
+func (m Message) checkBlocks(ctx context.Context, claims auth.Claims, userIDs []string) error {
+	for _, id := range userIDs {
+		for _, pair := range [][2]string{{id, claims.User.ID}, {claims.User.ID, id}} {
+			blocked, err := m.user.IsBlocked(ctx, pair[0], pair[1])
+			if err != nil {
+				return err
+			}
+			if blocked {
+				return ErrBlocked
+			}
+		}
+	}
+	return nil
+}
+
+// complete fills the members and the last message of a conversation.
+func (m Message) complete(ctx context.Context, claims auth.Claims, c *Conversation) error {
+	const q = `
+	SELECT
+		CASE WHEN u.date_deletion IS NULL THEN u.name ELSE '` + user.DeletedName + `' END
+	FROM
+		conversation_members AS cm
+	JOIN
+		users AS u ON u.user_id = cm.user_id
+	WHERE
+		cm.conversation_id = $1
+	ORDER BY
+		u.name`
+
+	m.log.Printf("%s: %s", "message.complete", database.Log(q, c.ID))
+
+	if err := m.db.SelectContext(ctx, &c.Members, q, c.ID); err != nil {
+		return errors.Wrapf(err, "selecting members of %s", c.ID)
+	}
+
+	last, err := m.selectMessages(ctx, claims, c.ID, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(last) > 0 {
+		c.LastMessage = &last[0]
+	}
+	return nil
+}
+
+// selectMessages lists the messages of a conversation the user the claims
+// belong to can see, newest first.
+func (m Message) selectMessages(ctx context.Context, claims auth.Claims, conversationID string, offset int, rows int) ([]Info, error) {
+	const q = `
+	SELECT
+		msg.message_id, msg.conversation_id, msg.body, msg.date_created, ` + authorName + `
+	FROM
+		messages AS msg
+	JOIN
+		conversation_members AS cm ON cm.conversation_id = msg.conversation_id AND cm.user_id = $2
+	WHERE
+		msg.conversation_id = $1 AND ` + visible + `
+	ORDER BY
+		msg.date_created DESC
+	OFFSET $3 ROWS FETCH NEXT $4 ROWS ONLY`
+
+	m.log.Printf("%s: %s", "message.selectMessages", database.Log(q, conversationID, claims.User.ID, offset, rows))
+
+	messages := []Info{}
+	if err := m.db.SelectContext(ctx, &messages, q, conversationID, claims.User.ID, offset, rows); err != nil {
+		return nil, errors.Wrapf(err, "selecting messages of %s", conversationID)
+	}
+	return messages, nil
+}
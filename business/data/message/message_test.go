@@ -0,0 +1,169 @@
+package message_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/message"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+)
+
+func TestMessage(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	bus := pubsub.New()
+	m := message.New(log, db, bus)
+	u := user.New(log, db)
+
+	ctx := context.Background()
+	now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	claims := make(map[string]auth.Claims)
+	for _, name := range []string{"alice", "bob", "carol", "troll"} {
+		usr, err := u.Create(ctx, user.NewUser{Name: name, Password: "gophers"}, now)
+		if err != nil {
+			t.Fatalf("creating user %s: %s", name, err)
+		}
+		claims[name] = auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}
+	}
+	alice, bob, carol, troll := claims["alice"], claims["bob"], claims["carol"], claims["troll"]
+
+	unread := func(claims auth.Claims) int {
+		count, err := m.CountUnread(ctx, claims)
+		if err != nil {
+			t.Fatalf("counting unread messages of %s: %s", claims.User.Username, err)
+		}
+		return count
+	}
+
+	t.Log("Given the need to let users talk privately.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen users start conversations.", testID)
+		{
+			first, err := m.Start(ctx, bob, message.NewConversation{To: []string{"alice"}, Body: "Hi Alice."}, now)
+			if err != nil || len(first.Members) != 2 || first.LastMessage == nil || first.LastMessage.Author != "bob" {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start a conversation : %+v %v.", tests.Failed, testID, first, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to start a conversation.", tests.Success, testID)
+
+			again, err := m.Start(ctx, bob, message.NewConversation{To: []string{"Alice", "bob"}, Body: "Are you there?"}, now.Add(time.Minute))
+			if err != nil || again.ID != first.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould continue the conversation with the same members : %+v %v.", tests.Failed, testID, again, err)
+			}
+			group, err := m.Start(ctx, bob, message.NewConversation{To: []string{"alice", "carol"}, Body: "Hi both."}, now.Add(time.Minute))
+			if err != nil || group.ID == first.ID || len(group.Members) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould start another conversation with other members : %+v %v.", tests.Failed, testID, group, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only continue conversations with the same members.", tests.Success, testID)
+
+			if got := unread(alice); got != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the unread messages : got %d.", tests.Failed, testID, got)
+			}
+			if got := unread(bob); got != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not count messages the user sent : got %d.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the unread messages.", tests.Success, testID)
+
+			// The unread count of /api/me/notifications adds both counts, so
+			// messages must not be counted as notifications as well.
+			if count, err := notification.New(log, db, bus).CountUnread(ctx, alice); err != nil || count != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not count messages as notifications : %d %v.", tests.Failed, testID, count, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not count messages as notifications.", tests.Success, testID)
+
+			if err := m.MarkRead(ctx, alice, group.ID, now.Add(time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to mark the conversation read : %s.", tests.Failed, testID, err)
+			}
+			if got := unread(alice); got != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould not count messages of read conversations : got %d.", tests.Failed, testID, got)
+			}
+			if err := m.MarkRead(ctx, troll, group.ID, now); err != message.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not mark conversations of others read : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to mark a conversation read.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen users block each other.", testID)
+		{
+			if err := u.Block(ctx, alice, "troll", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to block the user : %s.", tests.Failed, testID, err)
+			}
+			if _, err := m.Start(ctx, troll, message.NewConversation{To: []string{"alice"}, Body: "Hi."}, now); err != message.ErrBlocked {
+				t.Fatalf("\t%s\tTest %d:\tShould not start a conversation with a user who blocked the sender : %v.", tests.Failed, testID, err)
+			}
+			if _, err := m.Start(ctx, alice, message.NewConversation{To: []string{"troll"}, Body: "Hi."}, now); err != message.ErrBlocked {
+				t.Fatalf("\t%s\tTest %d:\tShould not start a conversation with a blocked user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not start conversations between blocked users.", tests.Success, testID)
+
+			group, err := m.Start(ctx, carol, message.NewConversation{To: []string{"bob", "troll"}, Body: "Hi."}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start a conversation : %s.", tests.Failed, testID, err)
+			}
+			if err := u.Block(ctx, troll, "bob", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to block the user : %s.", tests.Failed, testID, err)
+			}
+			if _, err := m.Send(ctx, bob, group.ID, message.NewMessage{Body: "Hello?"}, now); err != message.ErrBlocked {
+				t.Fatalf("\t%s\tTest %d:\tShould not send to a conversation with a user who blocked the sender : %v.", tests.Failed, testID, err)
+			}
+			if _, err := m.Send(ctx, carol, group.ID, message.NewMessage{Body: "Hello?"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould still let the others send : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not send messages between blocked users.", tests.Success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen a user deletes a conversation.", testID)
+		{
+			first, err := m.Start(ctx, bob, message.NewConversation{To: []string{"alice"}, Body: "Still there?"}, now.Add(2*time.Minute))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to send a message : %s.", tests.Failed, testID, err)
+			}
+			if err := m.Delete(ctx, alice, first.ID, now.Add(3*time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to delete the conversation : %s.", tests.Failed, testID, err)
+			}
+
+			conversations, err := m.QueryConversations(ctx, alice, 1, 10)
+			if err != nil || hasConversation(conversations, first.ID) {
+				t.Fatalf("\t%s\tTest %d:\tShould leave it out for the user : %+v %v.", tests.Failed, testID, conversations, err)
+			}
+			conversations, err = m.QueryConversations(ctx, bob, 1, 10)
+			if err != nil || !hasConversation(conversations, first.ID) {
+				t.Fatalf("\t%s\tTest %d:\tShould keep it for the others : %+v %v.", tests.Failed, testID, conversations, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only delete it for the user.", tests.Success, testID)
+
+			if _, err := m.Send(ctx, bob, first.ID, message.NewMessage{Body: "Hello again."}, now.Add(4*time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to send a message : %s.", tests.Failed, testID, err)
+			}
+			conversations, err = m.QueryConversations(ctx, alice, 1, 10)
+			if err != nil || !hasConversation(conversations, first.ID) {
+				t.Fatalf("\t%s\tTest %d:\tShould bring it back on a new message : %+v %v.", tests.Failed, testID, conversations, err)
+			}
+			thread, err := m.QueryThread(ctx, alice, first.ID, 1, 10)
+			if err != nil || len(thread) != 1 || thread[0].Body != "Hello again." {
+				t.Fatalf("\t%s\tTest %d:\tShould only show messages sent after deleting : %+v %v.", tests.Failed, testID, thread, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould bring it back with only the new messages.", tests.Success, testID)
+		}
+	}
+}
+
+// hasConversation tells if the conversation with given ID is among
+// conversations.
+func hasConversation(conversations []message.Conversation, conversationID string) bool {
+	for _, c := range conversations {
+		if c.ID == conversationID {
+			return true
+		}
+	}
+	return false
+}
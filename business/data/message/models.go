@@ -0,0 +1,36 @@
+package message
+
+import (
+	"time"
+)
+
+// Info represents a private message.
+type Info struct {
+	ID             string    `db:"message_id" json:"id"`
+	ConversationID string    `db:"conversation_id" json:"conversationId"`
+	Author         string    `db:"author" json:"author"`
+	Body           string    `db:"body" json:"body"`
+	DateCreated    time.Time `db:"date_created" json:"created"`
+}
+
+// Conversation represents private messages between two or more users as
+// seen by one of them.
+type Conversation struct {
+	ID          string    `db:"conversation_id" json:"id"`
+	Members     []string  `db:"-" json:"members"`
+	Unread      int       `db:"unread" json:"unread"`
+	LastMessage *Info     `db:"-" json:"lastMessage,omitempty"`
+	DateUpdated time.Time `db:"date_updated" json:"updated"`
+}
+
+// NewConversation is what we require from users when they start a
+// conversation. To holds names of the other members.
+type NewConversation struct {
+	To   []string `json:"to" validate:"required,min=1"`
+	Body string   `json:"body" validate:"required"`
+}
+
+// NewMessage is what we require from users when they send a message.
+type NewMessage struct {
+	Body string `json:"body" validate:"required"`
+}
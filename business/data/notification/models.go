@@ -0,0 +1,37 @@
+package notification
+
+import (
+	"time"
+)
+
+// Kinds of notifications.
+const (
+	KindReply      = "reply"
+	KindMention    = "mention"
+	KindModeration = "moderation"
+)
+
+// Info represents something a user is told about in their inbox.
+type Info struct {
+	ID          string     `db:"notification_id" json:"id"`
+	UserID      string     `db:"user_id" json:"-"`
+	Kind        string     `db:"kind" json:"kind"`
+	Actor       *string    `db:"actor" json:"actor,omitempty"`
+	PostID      string     `db:"post_id" json:"postId"`
+	CommentID   *string    `db:"comment_id" json:"commentId,omitempty"`
+	Body        string     `db:"body" json:"body"`
+	DateCreated time.Time  `db:"date_created" json:"created"`
+	DateRead    *time.Time `db:"date_read" json:"read,omitempty"`
+}
+
+// NewNotification contains information needed to notify a user. ActorID is
+// who caused it and is empty for moderation. CommentID is empty when it is
+// about the post itself.
+type NewNotification struct {
+	UserID    string
+	Kind      string
+	ActorID   string
+	PostID    string
+	CommentID string
+	Body      string
+}
@@ -0,0 +1,176 @@
+// Package notification contains the inbox of users.
+package notification
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a specific notification is requested but does not exist.
+	ErrNotFound = errors.New("notification not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+)
+
+// maxBody is how many characters of the text that caused a notification
+// are kept.
+const maxBody = 200
+
+// Notification manages the set of API's for notification access.
+type Notification struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	events pubsub.Bus
+}
+
+// New constructs a Notification for api access. New notifications are
+// published to events.
+func New(log *log.Logger, db *sqlx.DB, events pubsub.Bus) Notification {
+	return Notification{
+		log:    log,
+		db:     db,
+		events: events,
+	}
+}
+
+// EventCreated is published when a user is notified.
+const EventCreated = "notification"
+
+// Topic is the topic new notifications of the user are published on.
+func Topic(userID string) string {
+	return "user:" + userID
+}
+
+// Create notifies a user. Users are never notified about what they did
+// themselves or what users they blocked did.
+func (n Notification) Create(ctx context.Context, nn NewNotification, now time.Time) error {
+	if nn.UserID == nn.ActorID {
+		return nil
+	}
+
+	body := nn.Body
+	if utf8.RuneCountInString(body) > maxBody {
+		body = string([]rune(body)[:maxBody-1]) + "…"
+	}
+
+	const q = `
+	INSERT INTO notifications
+		(notification_id, user_id, kind, actor_id, post_id, comment_id, body, date_created)
+	SELECT
+		$1::uuid, $2::uuid, $3, NULLIF($4, '')::uuid, $5::uuid, NULLIF($6, '')::uuid, $7, $8::timestamp
+	WHERE NOT EXISTS (
+		SELECT 1 FROM blocks WHERE user_id = $2::uuid AND blocked_id::text = $4
+	)
+	RETURNING
+		notification_id, user_id, kind, post_id, comment_id, body, date_created, date_read,
+		(SELECT name FROM users WHERE user_id = actor_id) AS actor`
+
+	id := uuid.New().String()
+	n.log.Printf("%s: %s", "notification.Create", database.Log(q, id, nn.UserID, nn.Kind, nn.ActorID, nn.PostID, nn.CommentID, body, now))
+
+	var info Info
+	if err := n.db.GetContext(ctx, &info, q, id, nn.UserID, nn.Kind, nn.ActorID, nn.PostID, nn.CommentID, body, now); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return errors.Wrapf(err, "notifying user %s", nn.UserID)
+	}
+
+	n.events.Publish(Topic(info.UserID), EventCreated, info)
+	return nil
+}
+
+// Query lists the notifications of the user the claims belong to, newest
+// first. Page counts from 1.
+func (n Notification) Query(ctx context.Context, claims auth.Claims, unreadOnly bool, page int, rows int) ([]Info, error) {
+	const q = `
+	SELECT
+		n.notification_id, n.user_id, n.kind, n.post_id, n.comment_id, n.body, n.date_created, n.date_read,
+		CASE WHEN u.date_deletion IS NULL THEN u.name ELSE '` + user.DeletedName + `' END AS actor
+	FROM
+		notifications AS n
+	LEFT JOIN
+		users AS u ON u.user_id = n.actor_id
+	WHERE
+		n.user_id = $1 AND (NOT $2 OR n.date_read IS NULL)
+	ORDER BY
+		n.date_created DESC
+	OFFSET $3 ROWS FETCH NEXT $4 ROWS ONLY`
+
+	offset := (page - 1) * rows
+	if offset < 0 {
+		offset = 0
+	}
+
+	n.log.Printf("%s: %s", "notification.Query", database.Log(q, claims.User.ID, unreadOnly, offset, rows))
+
+	notifications := []Info{}
+	if err := n.db.SelectContext(ctx, &notifications, q, claims.User.ID, unreadOnly, offset, rows); err != nil {
+		return nil, errors.Wrap(err, "selecting notifications")
+	}
+	return notifications, nil
+}
+
+// CountUnread returns how many notifications the user did not read yet.
+func (n Notification) CountUnread(ctx context.Context, claims auth.Claims) (int, error) {
+	const q = `SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND date_read IS NULL`
+
+	n.log.Printf("%s: %s", "notification.CountUnread", database.Log(q, claims.User.ID))
+
+	var count int
+	if err := n.db.GetContext(ctx, &count, q, claims.User.ID); err != nil {
+		return 0, errors.Wrap(err, "counting unread notifications")
+	}
+	return count, nil
+}
+
+// MarkRead marks a notification of the user as read.
+func (n Notification) MarkRead(ctx context.Context, claims auth.Claims, notificationID string, now time.Time) error {
+	if _, err := uuid.Parse(notificationID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `
+	UPDATE
+		notifications
+	SET
+		date_read = COALESCE(date_read, $3)
+	WHERE
+		notification_id = $1 AND user_id = $2`
+
+	n.log.Printf("%s: %s", "notification.MarkRead", database.Log(q, notificationID, claims.User.ID, now))
+
+	res, err := n.db.ExecContext(ctx, q, notificationID, claims.User.ID, now)
+	if err != nil {
+		return errors.Wrapf(err, "marking notification %s read", notificationID)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks every notification of the user as read.
+func (n Notification) MarkAllRead(ctx context.Context, claims auth.Claims, now time.Time) error {
+	const q = `UPDATE notifications SET date_read = $2 WHERE user_id = $1 AND date_read IS NULL`
+
+	n.log.Printf("%s: %s", "notification.MarkAllRead", database.Log(q, claims.User.ID, now))
+
+	if _, err := n.db.ExecContext(ctx, q, claims.User.ID, now); err != nil {
+		return errors.Wrap(err, "marking notifications read")
+	}
+	return nil
+}
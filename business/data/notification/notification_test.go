@@ -0,0 +1,99 @@
+package notification_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/google/uuid"
+)
+
+func TestNotification(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	bus := pubsub.New()
+	n := notification.New(log, db, bus)
+
+	t.Log("Given the need to keep an inbox for every user.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user reads their notifications.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			var claims []auth.Claims
+			for _, name := range []string{"reader", "actor"} {
+				usr, err := user.New(log, db).Create(ctx, user.NewUser{Name: name, Password: "gophers"}, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+				}
+				claims = append(claims, auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}})
+			}
+			reader, actor := claims[0], claims[1]
+
+			sub := bus.Subscribe(notification.Topic(reader.User.ID))
+			defer sub.Close()
+
+			for i := 0; i < 3; i++ {
+				nn := notification.NewNotification{
+					UserID:  reader.User.ID,
+					Kind:    notification.KindMention,
+					ActorID: actor.User.ID,
+					PostID:  uuid.New().String(),
+					Body:    "Hello u/reader.",
+				}
+				if err := n.Create(ctx, nn, now.Add(time.Duration(i)*time.Minute)); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to notify the user : %s.", tests.Failed, testID, err)
+				}
+			}
+			select {
+			case ev := <-sub.C:
+				if ev.Type != notification.EventCreated {
+					t.Fatalf("\t%s\tTest %d:\tShould publish new notifications : got %+v.", tests.Failed, testID, ev)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould publish new notifications.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould publish new notifications.", tests.Success, testID)
+
+			if count, err := n.CountUnread(ctx, reader); err != nil || count != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould count the unread notifications : %d %v.", tests.Failed, testID, count, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count the unread notifications.", tests.Success, testID)
+
+			all, err := n.Query(ctx, reader, false, 1, 10)
+			if err != nil || len(all) != 3 || all[0].Actor == nil || *all[0].Actor != "actor" {
+				t.Fatalf("\t%s\tTest %d:\tShould list the notifications with their actor : %+v %v.", tests.Failed, testID, all, err)
+			}
+			if err := n.MarkRead(ctx, actor, all[0].ID, now); err != notification.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not mark notifications of others read : %v.", tests.Failed, testID, err)
+			}
+			if err := n.MarkRead(ctx, reader, all[0].ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to mark a notification read : %s.", tests.Failed, testID, err)
+			}
+			unread, err := n.Query(ctx, reader, true, 1, 10)
+			if err != nil || len(unread) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave read notifications out of the unread ones : %+v %v.", tests.Failed, testID, unread, err)
+			}
+			if count, err := n.CountUnread(ctx, reader); err != nil || count != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould not count read notifications : %d %v.", tests.Failed, testID, count, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to mark a notification read.", tests.Success, testID)
+
+			if err := n.MarkAllRead(ctx, reader, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to mark all notifications read : %s.", tests.Failed, testID, err)
+			}
+			if count, err := n.CountUnread(ctx, reader); err != nil || count != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould have no unread notifications left : %d %v.", tests.Failed, testID, count, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to mark all notifications read.", tests.Success, testID)
+		}
+	}
+}
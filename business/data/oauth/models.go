@@ -0,0 +1,66 @@
+package oauth
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Client represents an application registered to act on behalf of users.
+type Client struct {
+	ID           string         `db:"client_id" json:"id"`
+	SecretHash   string         `db:"secret_hash" json:"-"`
+	Name         string         `db:"name" json:"name"`
+	OwnerID      string         `db:"owner_id" json:"-"`
+	RedirectURIs pq.StringArray `db:"redirect_uris" json:"redirectUris"`
+	Scopes       pq.StringArray `db:"scopes" json:"scopes"`
+	Confidential bool           `db:"confidential" json:"confidential"`
+	DateCreated  time.Time      `db:"date_created" json:"date_created"`
+}
+
+// NewClient contains information needed to register a Client. Confidential
+// clients get a secret, public ones have to use PKCE.
+type NewClient struct {
+	Name         string   `json:"name" validate:"required,max=64"`
+	RedirectURIs []string `json:"redirectUris" validate:"dive,url"`
+	Scopes       []string `json:"scopes" validate:"required,min=1"`
+	Confidential bool     `json:"confidential"`
+}
+
+// Registered is a newly registered Client with its secret. The secret is
+// shown only once.
+type Registered struct {
+	Client
+	Secret string `json:"secret,omitempty"`
+}
+
+// Authorize contains the request of a client to which the user consented.
+type Authorize struct {
+	ClientID            string `json:"clientId" validate:"required"`
+	RedirectURI         string `json:"redirectUri" validate:"required"`
+	Scope               string `json:"scope" validate:"required"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"codeChallenge"`
+	CodeChallengeMethod string `json:"codeChallengeMethod"`
+}
+
+// Grant is what a client was allowed to do as a user.
+type Grant struct {
+	ClientID   string
+	ClientName string
+	UserID     string
+	Scope      string
+}
+
+// code is an authorization code waiting to be exchanged.
+type code struct {
+	CodeHash      string     `db:"code_hash"`
+	ClientID      string     `db:"client_id"`
+	UserID        string     `db:"user_id"`
+	RedirectURI   string     `db:"redirect_uri"`
+	Scope         string     `db:"scope"`
+	CodeChallenge string     `db:"code_challenge"`
+	DateCreated   time.Time  `db:"date_created"`
+	DateExpires   time.Time  `db:"date_expires"`
+	DateUsed      *time.Time `db:"date_used"`
+}
@@ -0,0 +1,424 @@
+// Package oauth contains the authorization server side of OAuth2: client
+// registration and the authorization code and client credentials grants.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Errors are named after the error codes of RFC 6749 they are reported as.
+var (
+	// ErrNotFound is used when a specific Client is requested but does not exist.
+	ErrNotFound = errors.New("not found")
+
+	// ErrForbidden occurs when a user tries to manage a client of somebody else.
+	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrInvalidClient occurs when a client is unknown or fails to authenticate.
+	ErrInvalidClient = errors.New("invalid_client")
+
+	// ErrInvalidGrant occurs when a code is unknown, used, expired or was
+	// issued to another client.
+	ErrInvalidGrant = errors.New("invalid_grant")
+
+	// ErrInvalidScope occurs when a client requests a scope it may not have.
+	ErrInvalidScope = errors.New("invalid_scope")
+
+	// ErrInvalidRequest occurs when a request misses or mismatches a parameter.
+	ErrInvalidRequest = errors.New("invalid_request")
+
+	// ErrUnauthorizedClient occurs when a client uses a grant it may not use.
+	ErrUnauthorizedClient = errors.New("unauthorized_client")
+)
+
+// codeTTL is how long a client has to exchange an authorization code.
+const codeTTL = 5 * time.Minute
+
+// OAuth manages the set of API's for OAuth2 clients and grants.
+type OAuth struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs an OAuth for api access.
+func New(log *log.Logger, db *sqlx.DB) OAuth {
+	return OAuth{
+		log: log,
+		db:  db,
+	}
+}
+
+// Register adds a new client owned by the user.
+func (o OAuth) Register(ctx context.Context, claims auth.Claims, nc NewClient, now time.Time) (Registered, error) {
+	for _, s := range nc.Scopes {
+		if !auth.ValidScope(s) {
+			return Registered{}, errors.Wrapf(ErrInvalidScope, "unknown scope %q", s)
+		}
+	}
+	if !nc.Confidential && len(nc.RedirectURIs) == 0 {
+		return Registered{}, errors.Wrap(ErrInvalidRequest, "public clients need a redirect URI")
+	}
+	for _, u := range nc.RedirectURIs {
+		if err := checkRedirectURI(u); err != nil {
+			return Registered{}, err
+		}
+	}
+	if nc.RedirectURIs == nil {
+		nc.RedirectURIs = []string{}
+	}
+
+	reg := Registered{
+		Client: Client{
+			ID:           uuid.New().String(),
+			Name:         nc.Name,
+			OwnerID:      claims.User.ID,
+			RedirectURIs: nc.RedirectURIs,
+			Scopes:       nc.Scopes,
+			Confidential: nc.Confidential,
+			DateCreated:  now,
+		},
+	}
+	if nc.Confidential {
+		var err error
+		if reg.Secret, reg.SecretHash, err = newToken(); err != nil {
+			return Registered{}, err
+		}
+	}
+
+	const q = `
+	INSERT INTO oauth_clients
+		(client_id, secret_hash, name, owner_id, redirect_uris, scopes, confidential, date_created)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	o.log.Printf("%s: %s", "oauth.Register",
+		database.Log(q, reg.ID, "***", reg.Name, reg.OwnerID, reg.RedirectURIs, reg.Scopes, reg.Confidential, now),
+	)
+
+	if _, err := o.db.ExecContext(ctx, q, reg.ID, reg.SecretHash, reg.Name, reg.OwnerID,
+		reg.RedirectURIs, reg.Scopes, reg.Confidential, now); err != nil {
+		return Registered{}, errors.Wrap(err, "inserting client")
+	}
+
+	return reg, nil
+}
+
+// QueryByOwner retrieves the clients registered by the user.
+func (o OAuth) QueryByOwner(ctx context.Context, claims auth.Claims) ([]Client, error) {
+	const q = `SELECT * FROM oauth_clients WHERE owner_id = $1 ORDER BY date_created`
+
+	o.log.Printf("%s: %s", "oauth.QueryByOwner", database.Log(q, claims.User.ID))
+
+	clients := []Client{}
+	if err := o.db.SelectContext(ctx, &clients, q, claims.User.ID); err != nil {
+		return nil, errors.Wrap(err, "selecting clients")
+	}
+	return clients, nil
+}
+
+// QueryByID gets the specified client from the database.
+func (o OAuth) QueryByID(ctx context.Context, clientID string) (Client, error) {
+	if _, err := uuid.Parse(clientID); err != nil {
+		return Client{}, ErrNotFound
+	}
+
+	const q = `SELECT * FROM oauth_clients WHERE client_id = $1`
+
+	o.log.Printf("%s: %s", "oauth.QueryByID", database.Log(q, clientID))
+
+	var cl Client
+	if err := o.db.GetContext(ctx, &cl, q, clientID); err != nil {
+		if err == sql.ErrNoRows {
+			return Client{}, ErrNotFound
+		}
+		return Client{}, errors.Wrapf(err, "selecting client %q", clientID)
+	}
+	return cl, nil
+}
+
+// Delete removes a client of the user along with its pending codes.
+func (o OAuth) Delete(ctx context.Context, claims auth.Claims, clientID string) error {
+	cl, err := o.QueryByID(ctx, clientID)
+	if err != nil {
+		return err
+	}
+	if cl.OwnerID != claims.User.ID {
+		return ErrForbidden
+	}
+
+	const qCodes = `DELETE FROM oauth_codes WHERE client_id = $1`
+	const qClient = `DELETE FROM oauth_clients WHERE client_id = $1`
+
+	tx, err := o.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	for _, q := range []string{qCodes, qClient} {
+		o.log.Printf("%s: %s", "oauth.Delete", database.Log(q, clientID))
+
+		if _, err := tx.ExecContext(ctx, q, clientID); err != nil {
+			return errors.Wrapf(err, "deleting client %s", clientID)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Authorize issues an authorization code after the user consented to the
+// request of a client.
+func (o OAuth) Authorize(ctx context.Context, claims auth.Claims, az Authorize, now time.Time) (string, error) {
+	cl, err := o.QueryByID(ctx, az.ClientID)
+	if err != nil {
+		if err == ErrNotFound {
+			return "", ErrInvalidClient
+		}
+		return "", err
+	}
+
+	if !contains(cl.RedirectURIs, az.RedirectURI) {
+		return "", errors.Wrap(ErrInvalidRequest, "redirect URI is not registered")
+	}
+	if err := checkRedirectURI(az.RedirectURI); err != nil {
+		return "", err
+	}
+	if err := checkScope(cl, az.Scope); err != nil {
+		return "", err
+	}
+
+	// Public clients can not keep a secret, so the code has to be bound to
+	// the client instance by PKCE.
+	switch {
+	case az.CodeChallenge == "" && !cl.Confidential:
+		return "", errors.Wrap(ErrInvalidRequest, "code challenge required")
+	case az.CodeChallenge != "" && az.CodeChallengeMethod != "S256":
+		return "", errors.Wrap(ErrInvalidRequest, "code challenge method must be S256")
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+
+	c := code{
+		CodeHash:      hash,
+		ClientID:      cl.ID,
+		UserID:        claims.User.ID,
+		RedirectURI:   az.RedirectURI,
+		Scope:         normalizeScope(az.Scope),
+		CodeChallenge: az.CodeChallenge,
+		DateCreated:   now,
+		DateExpires:   now.Add(codeTTL),
+	}
+
+	const q = `
+	INSERT INTO oauth_codes
+		(code_hash, client_id, user_id, redirect_uri, scope, code_challenge, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7, $8)`
+
+	o.log.Printf("%s: %s", "oauth.Authorize",
+		database.Log(q, "***", c.ClientID, c.UserID, c.RedirectURI, c.Scope, c.CodeChallenge, c.DateCreated, c.DateExpires),
+	)
+
+	if _, err := o.db.ExecContext(ctx, q, c.CodeHash, c.ClientID, c.UserID, c.RedirectURI,
+		c.Scope, c.CodeChallenge, c.DateCreated, c.DateExpires); err != nil {
+		return "", errors.Wrap(err, "inserting code")
+	}
+
+	return token, nil
+}
+
+// ExchangeCode redeems an authorization code. Confidential clients must
+// authenticate with their secret, and the verifier must match the challenge
+// if one was given.
+func (o OAuth) ExchangeCode(ctx context.Context, clientID, secret, token, redirectURI, verifier string, now time.Time) (Grant, error) {
+	cl, err := o.authenticate(ctx, clientID, secret)
+	if err != nil {
+		return Grant{}, err
+	}
+
+	// Codes are single use. Marking it used first means a replayed code
+	// fails even when the first exchange is still in flight.
+	const q = `
+	UPDATE
+		oauth_codes
+	SET
+		date_used = $2
+	WHERE
+		code_hash = $1 AND date_used IS NULL AND date_expires > $2
+	RETURNING *`
+
+	o.log.Printf("%s: %s", "oauth.ExchangeCode", database.Log(q, "***", now))
+
+	var c code
+	if err := o.db.GetContext(ctx, &c, q, hashToken(token), now); err != nil {
+		if err == sql.ErrNoRows {
+			return Grant{}, ErrInvalidGrant
+		}
+		return Grant{}, errors.Wrap(err, "redeeming code")
+	}
+
+	if c.ClientID != cl.ID || c.RedirectURI != redirectURI {
+		return Grant{}, ErrInvalidGrant
+	}
+	if c.CodeChallenge != "" {
+		sum := sha256.Sum256([]byte(verifier))
+		if subtle.ConstantTimeCompare([]byte(base64.RawURLEncoding.EncodeToString(sum[:])), []byte(c.CodeChallenge)) != 1 {
+			return Grant{}, ErrInvalidGrant
+		}
+	}
+
+	return Grant{ClientID: cl.ID, ClientName: cl.Name, UserID: c.UserID, Scope: c.Scope}, nil
+}
+
+// ClientCredentials grants a confidential client access as the user who
+// registered it. An empty scope requests every scope of the client.
+func (o OAuth) ClientCredentials(ctx context.Context, clientID, secret, scope string) (Grant, error) {
+	cl, err := o.authenticate(ctx, clientID, secret)
+	if err != nil {
+		return Grant{}, err
+	}
+	if !cl.Confidential {
+		return Grant{}, ErrUnauthorizedClient
+	}
+
+	if scope == "" {
+		scope = strings.Join(cl.Scopes, " ")
+	}
+	if err := checkScope(cl, scope); err != nil {
+		return Grant{}, err
+	}
+
+	return Grant{ClientID: cl.ID, ClientName: cl.Name, UserID: cl.OwnerID, Scope: normalizeScope(scope)}, nil
+}
+
+// authenticate finds the client and checks its secret. Public clients have
+// no secret and must not send one.
+func (o OAuth) authenticate(ctx context.Context, clientID, secret string) (Client, error) {
+	cl, err := o.QueryByID(ctx, clientID)
+	if err != nil {
+		if err == ErrNotFound {
+			return Client{}, ErrInvalidClient
+		}
+		return Client{}, err
+	}
+
+	if !cl.Confidential {
+		if secret != "" {
+			return Client{}, ErrInvalidClient
+		}
+		return cl, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(cl.SecretHash)) != 1 {
+		return Client{}, ErrInvalidClient
+	}
+	return cl, nil
+}
+
+// checkScope verifies every requested scope is allowed for the client.
+func checkScope(cl Client, scope string) error {
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		return ErrInvalidScope
+	}
+	for _, s := range scopes {
+		if !contains(cl.Scopes, s) {
+			return errors.Wrapf(ErrInvalidScope, "scope %q is not allowed", s)
+		}
+	}
+	return nil
+}
+
+// normalizeScope removes duplicate and extra whitespace from a scope.
+func normalizeScope(scope string) string {
+	var out []string
+	for _, s := range strings.Fields(scope) {
+		if !contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, " ")
+}
+
+// RedirectURL appends the authorization response to the redirect URI of the
+// client.
+func RedirectURL(redirectURI, token, state string) (string, error) {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return "", errors.Wrap(ErrInvalidRequest, "malformed redirect URI")
+	}
+	q := u.Query()
+	q.Set("code", token)
+	if state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// checkRedirectURI makes sure users are only sent back to a web page of the
+// client: an absolute https URI, or http on the machine of the user, without
+// a fragment the code could not be added to.
+func checkRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.Fragment != "" || strings.Contains(raw, "#") {
+		return errors.Wrapf(ErrInvalidRequest, "redirect URI %q must be absolute and without fragment", raw)
+	}
+
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+			return nil
+		}
+	}
+	return errors.Wrapf(ErrInvalidRequest, "redirect URI %q must use https, or http on a loopback host", raw)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// newToken returns a random token and its hash.
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "reading random bytes")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a token. Tokens carry
+// enough entropy to not need a slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
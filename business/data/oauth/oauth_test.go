@@ -0,0 +1,204 @@
+package oauth_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/oauth"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+func TestRegister(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	o := oauth.New(log, db)
+
+	t.Log("Given the need to register third-party clients.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen registering redirect URIs.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "owner", now)
+
+			good := []string{
+				"https://client.example.com/callback",
+				"http://localhost:8080/callback",
+				"http://127.0.0.1/callback",
+				"http://[::1]:3000/callback",
+			}
+			nc := oauth.NewClient{Name: "good", RedirectURIs: good, Scopes: []string{auth.ScopeRead}}
+			if _, err := o.Register(ctx, claims, nc, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept https and loopback http : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept https and loopback http.", tests.Success, testID)
+
+			bad := []string{
+				"javascript:alert(document.cookie)",
+				"data:text/html,<script>alert(1)</script>",
+				"http://client.example.com/callback",
+				"https://client.example.com/callback#token",
+				"/callback",
+				"ftp://client.example.com/callback",
+			}
+			for _, u := range bad {
+				nc := oauth.NewClient{Name: "bad", RedirectURIs: []string{u}, Scopes: []string{auth.ScopeRead}}
+				if _, err := o.Register(ctx, claims, nc, now); errors.Cause(err) != oauth.ErrInvalidRequest {
+					t.Fatalf("\t%s\tTest %d:\tShould refuse %q : %v.", tests.Failed, testID, u, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse other schemes, plain http elsewhere and fragments.", tests.Success, testID)
+		}
+	}
+}
+
+func TestAuthorizationCode(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	o := oauth.New(log, db)
+
+	t.Log("Given the need to let users grant clients access.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a public client uses the authorization code grant.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "granter", now)
+
+			const redirect = "https://client.example.com/callback"
+			nc := oauth.NewClient{
+				Name:         "reader",
+				RedirectURIs: []string{redirect},
+				Scopes:       []string{auth.ScopeRead, auth.ScopeVote},
+			}
+			cl, err := o.Register(ctx, claims, nc, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to register the client : %s.", tests.Failed, testID, err)
+			}
+
+			const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+			sum := sha256.Sum256([]byte(verifier))
+			az := oauth.Authorize{
+				ClientID:            cl.ID,
+				RedirectURI:         redirect,
+				Scope:               auth.ScopeRead,
+				CodeChallenge:       base64.RawURLEncoding.EncodeToString(sum[:]),
+				CodeChallengeMethod: "S256",
+			}
+
+			code, err := o.Authorize(ctx, claims, az, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authorize the client : %s.", tests.Failed, testID, err)
+			}
+			grant, err := o.ExchangeCode(ctx, cl.ID, "", code, redirect, verifier, now)
+			if err != nil || grant.UserID != claims.User.ID || grant.Scope != auth.ScopeRead {
+				t.Fatalf("\t%s\tTest %d:\tShould exchange the code for the granted scope : %+v %v.", tests.Failed, testID, grant, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould exchange the code for the granted scope.", tests.Success, testID)
+
+			if _, err := o.ExchangeCode(ctx, cl.ID, "", code, redirect, verifier, now); err != oauth.ErrInvalidGrant {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a used code : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a used code.", tests.Success, testID)
+
+			code, err = o.Authorize(ctx, claims, az, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authorize the client : %s.", tests.Failed, testID, err)
+			}
+			if _, err := o.ExchangeCode(ctx, cl.ID, "", code, redirect, "another verifier", now); err != oauth.ErrInvalidGrant {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a wrong verifier : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a wrong verifier.", tests.Success, testID)
+
+			code, err = o.Authorize(ctx, claims, az, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to authorize the client : %s.", tests.Failed, testID, err)
+			}
+			if _, err := o.ExchangeCode(ctx, cl.ID, "", code, "https://client.example.com/other", verifier, now); err != oauth.ErrInvalidGrant {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse another redirect URI on exchange : %v.", tests.Failed, testID, err)
+			}
+			az.RedirectURI = "https://attacker.example.com/callback"
+			if _, err := o.Authorize(ctx, claims, az, now); errors.Cause(err) != oauth.ErrInvalidRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse an unregistered redirect URI : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse redirect URIs which do not match.", tests.Success, testID)
+
+			az.RedirectURI = redirect
+			az.CodeChallenge = ""
+			if _, err := o.Authorize(ctx, claims, az, now); errors.Cause(err) != oauth.ErrInvalidRequest {
+				t.Fatalf("\t%s\tTest %d:\tShould require PKCE of public clients : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould require PKCE of public clients.", tests.Success, testID)
+		}
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	o := oauth.New(log, db)
+
+	t.Log("Given the need to let bots act as the user who registered them.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a client uses the client credentials grant.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "botmaker", now)
+
+			nc := oauth.NewClient{Name: "bot", Scopes: []string{auth.ScopeRead, auth.ScopeSubmit}, Confidential: true}
+			cl, err := o.Register(ctx, claims, nc, now)
+			if err != nil || cl.Secret == "" {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to register the client with a secret : %v.", tests.Failed, testID, err)
+			}
+
+			grant, err := o.ClientCredentials(ctx, cl.ID, cl.Secret, "")
+			if err != nil || grant.UserID != claims.User.ID || grant.Scope != "read submit" {
+				t.Fatalf("\t%s\tTest %d:\tShould grant every scope of the client : %+v %v.", tests.Failed, testID, grant, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould grant every scope of the client.", tests.Success, testID)
+
+			if _, err := o.ClientCredentials(ctx, cl.ID, cl.Secret, auth.ScopeVote); errors.Cause(err) != oauth.ErrInvalidScope {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse scopes the client may not have : %v.", tests.Failed, testID, err)
+			}
+			if _, err := o.ClientCredentials(ctx, cl.ID, "wrong", ""); err != oauth.ErrInvalidClient {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a wrong secret : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse wrong secrets and scopes.", tests.Success, testID)
+
+			nc = oauth.NewClient{Name: "app", RedirectURIs: []string{"https://app.example.com/cb"}, Scopes: []string{auth.ScopeRead}}
+			pub, err := o.Register(ctx, claims, nc, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to register a public client : %s.", tests.Failed, testID, err)
+			}
+			if _, err := o.ClientCredentials(ctx, pub.ID, "", ""); err != oauth.ErrUnauthorizedClient {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse public clients : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse public clients.", tests.Success, testID)
+		}
+	}
+}
+
+// newClaims creates a user and returns claims like the ones of a token issued
+// to them.
+func newClaims(t *testing.T, log *log.Logger, db *sqlx.DB, name string, now time.Time) auth.Claims {
+	usr, err := user.New(log, db).Create(context.Background(), user.NewUser{Name: name, Password: "gophers"}, now)
+	if err != nil {
+		t.Fatalf("creating user %s: %s", name, err)
+	}
+	return auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}
+}
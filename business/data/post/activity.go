@@ -0,0 +1,380 @@
+package post
+
+import (
+	"context"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/preview"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// Orders listings can be sorted in.
+const (
+	SortNew = "new"
+	SortOld = "old"
+	SortTop = "top"
+)
+
+// Kinds of overview entries.
+const (
+	KindPost    = "post"
+	KindComment = "comment"
+)
+
+// scoreColumn computes the score of the post aliased as p.
+const scoreColumn = `(SELECT COALESCE(SUM(v.vote), 0) FROM votes AS v WHERE v.post_id = p.post_id)`
+
+// orderBy returns the ORDER BY clause for the sort. Only sorts listed in
+// allowed are accepted, so the result is safe to put into a query.
+func orderBy(sort string, allowed ...string) (string, error) {
+	ok := false
+	for _, a := range allowed {
+		if sort == a {
+			ok = true
+		}
+	}
+	if !ok {
+		return "", ErrInvalidSort
+	}
+
+	switch sort {
+	case SortOld:
+		return "ORDER BY date_created ASC", nil
+	case SortTop:
+		return "ORDER BY score DESC, date_created DESC", nil
+	default:
+		return "ORDER BY date_created DESC", nil
+	}
+}
+
+// offset returns the number of rows before the page.
+func (pq PageQuery) offset() int {
+	if pq.Page < 1 {
+		return 0
+	}
+	return (pq.Page - 1) * pq.Rows
+}
+
+// QueryCommentsByUser lists the comments of a user along with the posts they
+// were left on. Comments can be sorted new or old. Comments on posts the user
+// the claims belong to hid, and comments or posts of users they blocked are
+// left out.
+func (p Post) QueryCommentsByUser(ctx context.Context, claims auth.Claims, name string, pq PageQuery) ([]UserComment, error) {
+	order, err := orderBy(pq.Sort, SortNew, SortOld)
+	if err != nil {
+		return nil, err
+	}
+
+	author, err := p.getAuthorByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	SELECT
+		` + userCommentColumns + `
+	FROM
+		comments AS cm
+	JOIN
+		posts AS p USING (post_id)
+	WHERE
+		cm.user_id = $3 AND ` + notBlockedBy + ` AND ` + visibleTo + `
+	` + order + `
+	OFFSET $4 ROWS FETCH NEXT $5 ROWS ONLY`
+
+	p.log.Printf("%s: %s", "post.QueryCommentsByUser", database.Log(q, claims.User.ID, claims.User.ID, author.ID, pq.offset(), pq.Rows))
+
+	var rows []userCommentDB
+	if err := p.db.SelectContext(ctx, &rows, q, claims.User.ID, claims.User.ID, author.ID, pq.offset(), pq.Rows); err != nil {
+		return nil, errors.Wrap(err, "selecting comments of user")
+	}
+
+	comments := make([]UserComment, 0, len(rows))
+	for _, r := range rows {
+		comments = append(comments, r.userComment(author))
+	}
+	return comments, nil
+}
+
+// QueryOverview lists posts and comments of a user interleaved by date. It
+// can be sorted new or old. What the user the claims belong to hid or blocked
+// is left out the way QueryCommentsByUser does.
+func (p Post) QueryOverview(ctx context.Context, claims auth.Claims, name string, pq PageQuery) ([]Activity, error) {
+	order, err := orderBy(pq.Sort, SortNew, SortOld)
+	if err != nil {
+		return nil, err
+	}
+
+	author, err := p.getAuthorByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	SELECT kind, id, date_created FROM (
+		SELECT
+			'post' AS kind, p.post_id AS id, p.date_created
+		FROM
+			posts AS p
+		WHERE
+			p.user_id = $3 AND ` + visibleTo + `
+		UNION ALL
+		SELECT
+			'comment' AS kind, cm.comment_id AS id, cm.date_created
+		FROM
+			comments AS cm
+		JOIN
+			posts AS p ON p.post_id = cm.post_id
+		WHERE
+			cm.user_id = $3 AND ` + notBlockedBy + ` AND ` + visibleTo + `
+	) AS activity
+	` + order + `
+	OFFSET $4 ROWS FETCH NEXT $5 ROWS ONLY`
+
+	p.log.Printf("%s: %s", "post.QueryOverview", database.Log(q, claims.User.ID, claims.User.ID, author.ID, pq.offset(), pq.Rows))
+
+	var rows []struct {
+		Kind        string    `db:"kind"`
+		ID          string    `db:"id"`
+		DateCreated time.Time `db:"date_created"`
+	}
+	if err := p.db.SelectContext(ctx, &rows, q, claims.User.ID, claims.User.ID, author.ID, pq.offset(), pq.Rows); err != nil {
+		return nil, errors.Wrap(err, "selecting activity of user")
+	}
+
+	var postIDs, commentIDs []string
+	for _, r := range rows {
+		switch r.Kind {
+		case KindPost:
+			postIDs = append(postIDs, r.ID)
+		case KindComment:
+			commentIDs = append(commentIDs, r.ID)
+		}
+	}
+
+	posts, err := p.selectPostsByIDs(ctx, postIDs)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := p.selectUserComments(ctx, commentIDs, author)
+	if err != nil {
+		return nil, err
+	}
+
+	activity := make([]Activity, 0, len(rows))
+	for _, r := range rows {
+		a := Activity{
+			Kind:        r.Kind,
+			DateCreated: r.DateCreated,
+		}
+
+		switch r.Kind {
+		case KindPost:
+			if a.Post, err = p.completeInfo(ctx, claims, posts[r.ID], author); err != nil {
+				return nil, err
+			}
+
+		case KindComment:
+			uc := comments[r.ID]
+			a.Comment = &uc
+		}
+
+		activity = append(activity, a)
+	}
+	return activity, nil
+}
+
+// QueryVoted lists the posts the user gave the vote to, which is 1 for
+// upvoted and -1 for downvoted posts. It can be sorted new, old or top.
+func (p Post) QueryVoted(ctx context.Context, claims auth.Claims, vote int, pq PageQuery) ([]Info, error) {
+	order, err := orderBy(pq.Sort, SortNew, SortOld, SortTop)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	SELECT
+		p.*, ` + scoreColumn + ` AS score
+	FROM
+		posts AS p
+	JOIN
+		votes AS vt ON vt.post_id = p.post_id
+	WHERE
+		vt.user_id = $1 AND vt.vote = $2 AND ` + visibleTo + `
+	` + order + `
+	OFFSET $3 ROWS FETCH NEXT $4 ROWS ONLY`
+
+	p.log.Printf("%s: %s", "post.QueryVoted", database.Log(q, claims.User.ID, vote, pq.offset(), pq.Rows))
+
+	var posts []postDB
+	if err := p.db.SelectContext(ctx, &posts, q, claims.User.ID, vote, pq.offset(), pq.Rows); err != nil {
+		return nil, errors.Wrap(err, "selecting voted posts")
+	}
+
+	info := make([]Info, 0, len(posts))
+	for _, post := range posts {
+		author, err := p.getAuthorByID(ctx, post.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		pi, err := p.completeInfo(ctx, claims, post, author)
+		if err != nil {
+			return nil, err
+		}
+		info = append(info, pi)
+	}
+	return info, nil
+}
+
+// completeInfo loads votes, comments and the link preview or image of a post
+// and builds its Info personalized for the user the claims belong to.
+// Comments of users they blocked are left out.
+func (p Post) completeInfo(ctx context.Context, claims auth.Claims, post postDB, author Author) (Info, error) {
+	votes, err := p.selectVotesByPostID(ctx, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := p.selectCommentsByPostID(ctx, claims.User.ID, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	info := infoByPostDB(post, author, votes, comments)
+	if il, ok := info.(InfoLink); ok {
+		pv, err := p.preview.QueryByURL(ctx, il.Payload)
+		switch err {
+		case nil:
+			il.Preview = &pv
+		case preview.ErrNotFound:
+		default:
+			return nil, err
+		}
+		info = il
+	}
+	if ii, ok := info.(InfoImage); ok {
+		mi, err := p.media.QueryByID(ctx, ii.Image.ID)
+		if err != nil {
+			return nil, err
+		}
+		ii.Image = mi
+		info = ii
+	}
+
+	return p.personalize(ctx, claims, info)
+}
+
+// userCommentColumns are selected from comments cm joined with posts p to
+// fill a userCommentDB.
+const userCommentColumns = `cm.comment_id, cm.body, cm.date_created,
+		p.post_id, p.title, p.category, p.type, p.payload AS url`
+
+// userCommentDB is a comment joined with the post it was left on.
+type userCommentDB struct {
+	ID          string    `db:"comment_id"`
+	Body        string    `db:"body"`
+	DateCreated time.Time `db:"date_created"`
+	PostRef
+}
+
+// userComment builds the UserComment. Only link posts keep their URL.
+func (uc userCommentDB) userComment(author Author) UserComment {
+	if uc.Type == "text" || uc.Type == "image" {
+		uc.URL = ""
+	}
+	return UserComment{
+		Comment: Comment{
+			DateCreated: uc.DateCreated,
+			Author:      author,
+			Body:        uc.Body,
+			ID:          uc.ID,
+		},
+		Post: uc.PostRef,
+	}
+}
+
+// getUserComment returns a comment along with the post it was left on.
+func (p Post) getUserComment(ctx context.Context, commentID string, author Author) (UserComment, error) {
+	const q = `
+	SELECT
+		` + userCommentColumns + `
+	FROM
+		comments AS cm
+	JOIN
+		posts AS p USING (post_id)
+	WHERE
+		cm.comment_id = $1`
+
+	p.log.Printf("%s: %s", "post.activity.getUserComment", database.Log(q, commentID))
+
+	var row userCommentDB
+	if err := p.db.GetContext(ctx, &row, q, commentID); err != nil {
+		return UserComment{}, errors.Wrapf(err, "selecting comment %s", commentID)
+	}
+
+	return row.userComment(author), nil
+}
+
+// selectPostsByIDs returns the posts with given IDs along with their scores,
+// keyed by ID.
+func (p Post) selectPostsByIDs(ctx context.Context, postIDs []string) (map[string]postDB, error) {
+	posts := make(map[string]postDB, len(postIDs))
+	if len(postIDs) == 0 {
+		return posts, nil
+	}
+
+	const q = `
+	SELECT
+		p.*, ` + scoreColumn + ` AS score
+	FROM
+		posts AS p
+	WHERE
+		p.post_id = ANY($1::uuid[])`
+
+	p.log.Printf("%s: %s", "post.activity.selectPostsByIDs", database.Log(q, postIDs))
+
+	var rows []postDB
+	if err := p.db.SelectContext(ctx, &rows, q, pq.Array(postIDs)); err != nil {
+		return nil, errors.Wrap(err, "selecting posts")
+	}
+
+	for _, post := range rows {
+		posts[post.ID] = post
+	}
+	return posts, nil
+}
+
+// selectUserComments returns the comments of author with given IDs along with
+// the posts they were left on, keyed by ID.
+func (p Post) selectUserComments(ctx context.Context, commentIDs []string, author Author) (map[string]UserComment, error) {
+	comments := make(map[string]UserComment, len(commentIDs))
+	if len(commentIDs) == 0 {
+		return comments, nil
+	}
+
+	const q = `
+	SELECT
+		` + userCommentColumns + `
+	FROM
+		comments AS cm
+	JOIN
+		posts AS p USING (post_id)
+	WHERE
+		cm.comment_id = ANY($1::uuid[])`
+
+	p.log.Printf("%s: %s", "post.activity.selectUserComments", database.Log(q, commentIDs))
+
+	var rows []userCommentDB
+	if err := p.db.SelectContext(ctx, &rows, q, pq.Array(commentIDs)); err != nil {
+		return nil, errors.Wrap(err, "selecting comments")
+	}
+
+	for _, r := range rows {
+		comments[r.ID] = r.userComment(author)
+	}
+	return comments, nil
+}
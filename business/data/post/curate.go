@@ -0,0 +1,121 @@
+package post
+
+import (
+	"context"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// visibleTo keeps the posts aliased as p which the viewer, whose ID is bound
+// to $1, did not hide and whose authors they did not block. Anonymous
+// viewers pass an empty ID and see everything.
+const visibleTo = `NOT EXISTS (SELECT 1 FROM hidden_posts AS hp WHERE hp.user_id::text = $1 AND hp.post_id = p.post_id)
+	AND NOT EXISTS (SELECT 1 FROM blocks AS b WHERE b.user_id::text = $1 AND b.blocked_id = p.user_id)`
+
+// notBlockedBy keeps the comments aliased as cm whose authors were not
+// blocked by the viewer, whose ID is bound to $2.
+const notBlockedBy = `NOT EXISTS (SELECT 1 FROM blocks AS b WHERE b.user_id::text = $2 AND b.blocked_id = cm.user_id)`
+
+// Hide removes the post from the listings the user sees. Hiding it again
+// does nothing.
+func (p Post) Hide(ctx context.Context, claims auth.Claims, postID string, now time.Time) error {
+	if _, err := uuid.Parse(postID); err != nil {
+		return ErrInvalidID
+	}
+	if err := p.checkPost(ctx, postID); err != nil {
+		return err
+	}
+
+	const q = `
+	INSERT INTO hidden_posts
+		(user_id, post_id, date_created)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+
+	p.log.Printf("%s: %s", "post.Hide", database.Log(q, claims.User.ID, postID, now))
+
+	if _, err := p.db.ExecContext(ctx, q, claims.User.ID, postID, now); err != nil {
+		return errors.Wrapf(err, "hiding post %s", postID)
+	}
+	return nil
+}
+
+// Unhide brings the post back to the listings the user sees.
+func (p Post) Unhide(ctx context.Context, claims auth.Claims, postID string) error {
+	if _, err := uuid.Parse(postID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `DELETE FROM hidden_posts WHERE user_id = $1 AND post_id = $2`
+
+	p.log.Printf("%s: %s", "post.Unhide", database.Log(q, claims.User.ID, postID))
+
+	if _, err := p.db.ExecContext(ctx, q, claims.User.ID, postID); err != nil {
+		return errors.Wrapf(err, "unhiding post %s", postID)
+	}
+	return nil
+}
+
+// QueryHidden lists the posts the user hid, most recently hidden first, so
+// they can be brought back.
+func (p Post) QueryHidden(ctx context.Context, claims auth.Claims, pq PageQuery) ([]Info, error) {
+	const q = `
+	SELECT
+		p.*, ` + scoreColumn + ` AS score
+	FROM
+		posts AS p
+	JOIN
+		hidden_posts AS hp ON hp.post_id = p.post_id
+	WHERE
+		hp.user_id = $1
+	ORDER BY
+		hp.date_created DESC
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+
+	p.log.Printf("%s: %s", "post.QueryHidden", database.Log(q, claims.User.ID, pq.offset(), pq.Rows))
+
+	var posts []postDB
+	if err := p.db.SelectContext(ctx, &posts, q, claims.User.ID, pq.offset(), pq.Rows); err != nil {
+		return nil, errors.Wrap(err, "selecting hidden posts")
+	}
+
+	info := make([]Info, 0, len(posts))
+	for _, post := range posts {
+		author, err := p.getAuthorByID(ctx, post.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		pi, err := p.completeInfo(ctx, claims, post, author)
+		if err != nil {
+			return nil, err
+		}
+		info = append(info, pi)
+	}
+	return info, nil
+}
+
+// checkReply returns ErrBlocked if the author of the post blocked the user.
+func (p Post) checkReply(ctx context.Context, claims auth.Claims, postID string) error {
+	const q = `
+	SELECT EXISTS (
+		SELECT 1 FROM blocks AS b JOIN posts AS p ON p.user_id = b.user_id
+		WHERE p.post_id = $1 AND b.blocked_id = $2
+	)`
+
+	p.log.Printf("%s: %s", "post.curate.checkReply", database.Log(q, postID, claims.User.ID))
+
+	var blocked bool
+	if err := p.db.GetContext(ctx, &blocked, q, postID, claims.User.ID); err != nil {
+		return errors.Wrap(err, "checking block")
+	}
+	if blocked {
+		return ErrBlocked
+	}
+	return nil
+}
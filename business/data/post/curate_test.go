@@ -0,0 +1,132 @@
+package post_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+)
+
+func TestCurate(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := post.New(log, db, pubsub.New(), nil)
+
+	ctx := context.Background()
+	now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	reader := newClaims(t, log, db, "reader", now)
+	writer := newClaims(t, log, db, "writer", now)
+	troll := newClaims(t, log, db, "troll", now)
+
+	create := func(claims auth.Claims, title string) string {
+		np := post.NewPost{
+			Type:     "text",
+			Title:    title,
+			Category: "programming",
+			Text:     "Gophers are great.",
+		}
+		created, err := p.Create(ctx, claims, np, now)
+		if err != nil {
+			t.Fatalf("creating post %s: %s", title, err)
+		}
+		return created.(post.InfoText).ID
+	}
+	comment := func(claims auth.Claims, postID string) {
+		if _, err := p.CreateComment(ctx, claims, post.NewComment{Text: "Not really."}, postID, now); err != nil {
+			t.Fatalf("commenting on %s: %s", postID, err)
+		}
+	}
+
+	hidden := create(writer, "Hidden")
+	shown := create(writer, "Shown")
+	create(troll, "Trolling")
+	comment(troll, hidden)
+	comment(troll, shown)
+
+	all := post.PageQuery{Page: 1, Rows: 10, Sort: post.SortNew}
+
+	t.Log("Given the need to let users curate what they see.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user hides a post.", testID)
+		{
+			if err := p.Hide(ctx, reader, hidden, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to hide the post : %s.", tests.Failed, testID, err)
+			}
+
+			posts, err := p.QueryByCat(ctx, reader, "programming")
+			if err != nil || len(posts) != 2 || hasPost(posts, hidden) {
+				t.Fatalf("\t%s\tTest %d:\tShould leave it out of the community : %v %v.", tests.Failed, testID, posts, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave it out of the community.", tests.Success, testID)
+
+			activity, err := p.QueryOverview(ctx, reader, "writer", all)
+			if err != nil || len(activity) != 1 || activity[0].Post.(post.InfoText).ID != shown {
+				t.Fatalf("\t%s\tTest %d:\tShould leave it out of the overview of its author : %v %v.", tests.Failed, testID, activity, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave it out of the overview of its author.", tests.Success, testID)
+
+			comments, err := p.QueryCommentsByUser(ctx, reader, "troll", all)
+			if err != nil || len(comments) != 1 || comments[0].Post.ID != shown {
+				t.Fatalf("\t%s\tTest %d:\tShould leave out comments on it : %v %v.", tests.Failed, testID, comments, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave out comments on it.", tests.Success, testID)
+
+			posts, err = p.QueryByCat(ctx, auth.Claims{}, "programming")
+			if err != nil || len(posts) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould still show it to everyone else : %v %v.", tests.Failed, testID, posts, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still show it to everyone else.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a user blocks another one.", testID)
+		{
+			if err := user.New(log, db).Block(ctx, reader, "troll", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to block the user : %s.", tests.Failed, testID, err)
+			}
+
+			posts, err := p.QueryByCat(ctx, reader, "programming")
+			if err != nil || len(posts) != 1 || !hasPost(posts, shown) {
+				t.Fatalf("\t%s\tTest %d:\tShould leave their posts out of the community : %v %v.", tests.Failed, testID, posts, err)
+			}
+			if comments := posts[0].(post.InfoText).Comments; len(comments) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave their comments out of posts : %v.", tests.Failed, testID, comments)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave their posts and comments out of the community.", tests.Success, testID)
+
+			comments, err := p.QueryCommentsByUser(ctx, reader, "troll", all)
+			if err != nil || len(comments) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave out their comments : %v %v.", tests.Failed, testID, comments, err)
+			}
+			activity, err := p.QueryOverview(ctx, reader, "troll", all)
+			if err != nil || len(activity) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave out their overview : %v %v.", tests.Failed, testID, activity, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould leave out their activity.", tests.Success, testID)
+
+			activity, err = p.QueryOverview(ctx, auth.Claims{}, "troll", all)
+			if err != nil || len(activity) != 3 {
+				t.Fatalf("\t%s\tTest %d:\tShould still show their activity to everyone else : %v %v.", tests.Failed, testID, activity, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould still show their activity to everyone else.", tests.Success, testID)
+		}
+	}
+}
+
+// hasPost tells if the post with given ID is among posts.
+func hasPost(posts []post.Info, postID string) bool {
+	for _, pi := range posts {
+		if it, ok := pi.(post.InfoText); ok && it.ID == postID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package post
+
+import (
+	"context"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/webhook"
+)
+
+// Events published about posts.
+const (
+	EventPostCreated    = "post.created"
+	EventPostRemoved    = "post.removed"
+	EventScoreChanged   = "post.score"
+	EventCommentCreated = "comment.created"
+	EventCommentDeleted = "comment.deleted"
+)
+
+// TopicPost is the topic events about the post are published on.
+func TopicPost(postID string) string {
+	return "post:" + postID
+}
+
+// TopicCommunity is the topic events about posts of the community are
+// published on.
+func TopicCommunity(category string) string {
+	return "community:" + category
+}
+
+// publish sends an event about a post to the subscribers of the post and of
+// its community, and to the webhooks of the community.
+//
+// Events are published after the change they tell about was stored. Failing
+// to publish one does not undo the change, so the helpers here only log their
+// errors.
+func (p Post) publish(ctx context.Context, postID string, category string, event string, data interface{}, now time.Time) {
+	p.events.Publish(TopicPost(postID), event, data)
+	p.events.Publish(TopicCommunity(category), event, data)
+	p.enqueue(ctx, category, event, data, now)
+}
+
+// enqueue queues deliveries of events webhooks can subscribe to.
+func (p Post) enqueue(ctx context.Context, category string, event string, data interface{}, now time.Time) {
+	if !webhook.Supported(event) {
+		return
+	}
+	if err := p.webhook.Enqueue(ctx, category, event, data, now); err != nil {
+		p.log.Printf("%s: %v", "post.enqueue", err)
+	}
+}
+
+// publishScore tells subscribers the score of the post changed.
+func (p Post) publishScore(ctx context.Context, postID string, now time.Time) {
+	post, err := p.getPostByID(ctx, postID)
+	if err != nil {
+		p.log.Printf("%s: loading post %s : %v", "post.publishScore", postID, err)
+		return
+	}
+	votes, err := p.selectVotesByPostID(ctx, postID)
+	if err != nil {
+		p.log.Printf("%s: loading votes of %s : %v", "post.publishScore", postID, err)
+		return
+	}
+
+	sc := ScoreChanged{
+		ID:               postID,
+		Score:            post.Score,
+		UpvotePercentage: upvotePercentage(votes),
+	}
+	p.publish(ctx, postID, post.Category, EventScoreChanged, sc, now)
+}
+
+// publishComment tells subscribers about a new comment.
+func (p Post) publishComment(ctx context.Context, postID string, commentID string, now time.Time) {
+	post, err := p.getPostByID(ctx, postID)
+	if err != nil {
+		p.log.Printf("%s: loading post %s : %v", "post.publishComment", postID, err)
+		return
+	}
+	comment, err := p.getCommentByID(ctx, commentID)
+	if err != nil {
+		p.log.Printf("%s: loading comment %s : %v", "post.publishComment", commentID, err)
+		return
+	}
+
+	cc := CommentCreated{
+		PostID:  postID,
+		Comment: comment,
+	}
+	p.publish(ctx, postID, post.Category, EventCommentCreated, cc, now)
+}
+
+// publishPost tells the subscribers of the community about a new post.
+func (p Post) publishPost(ctx context.Context, postID string, category string, now time.Time) {
+	info, err := p.QueryByID(ctx, auth.Claims{}, postID)
+	if err != nil {
+		p.log.Printf("%s: loading post %s : %v", "post.publishPost", postID, err)
+		return
+	}
+	p.events.Publish(TopicCommunity(category), EventPostCreated, info)
+	p.enqueue(ctx, category, EventPostCreated, info, now)
+}
+
+// publishCommentDeleted tells subscribers a comment is gone.
+func (p Post) publishCommentDeleted(ctx context.Context, postID string, commentID string, now time.Time) {
+	post, err := p.getPostByID(ctx, postID)
+	if err != nil {
+		p.log.Printf("%s: loading post %s : %v", "post.publishCommentDeleted", postID, err)
+		return
+	}
+
+	rm := Removed{
+		PostID:    postID,
+		CommentID: commentID,
+	}
+	p.publish(ctx, postID, post.Category, EventCommentDeleted, rm, now)
+}
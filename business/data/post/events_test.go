@@ -0,0 +1,62 @@
+package post_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+)
+
+func TestPostgresEvents(t *testing.T) {
+	log, db, cfg, teardown := tests.NewUnitConfig(t)
+	t.Cleanup(teardown)
+
+	t.Log("Given the need to share events between instances of the service.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a post is created on one instance.", testID)
+		{
+			publisher, err := pubsub.NewPostgres(log, db, cfg, "test_events")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start the publishing bus : %s.", tests.Failed, testID, err)
+			}
+			defer publisher.Close()
+
+			receiver, err := pubsub.NewPostgres(log, db, cfg, "test_events")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to start the receiving bus : %s.", tests.Failed, testID, err)
+			}
+			defer receiver.Close()
+
+			sub := receiver.Subscribe(post.TopicCommunity("programming"))
+			defer sub.Close()
+
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "publisher", now)
+
+			np := post.NewPost{
+				Type:     "text",
+				Title:    "Gophers",
+				Category: "programming",
+				Text:     "Gophers are great.",
+			}
+			if _, err := post.New(log, db, publisher, nil).Create(ctx, claims, np, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the post : %s.", tests.Failed, testID, err)
+			}
+
+			select {
+			case ev := <-sub.C:
+				if ev.Type != post.EventPostCreated {
+					t.Fatalf("\t%s\tTest %d:\tShould receive the new post : got %+v.", tests.Failed, testID, ev)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("\t%s\tTest %d:\tShould receive the new post on the other bus.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive the new post on the other bus.", tests.Success, testID)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/media"
+	"github.com/cravtos/asperitas-backend/business/data/user"
 	"github.com/cravtos/asperitas-backend/foundation/database"
 	"github.com/pkg/errors"
 	"time"
@@ -28,7 +30,8 @@ func upvotePercentage(votes []Vote) int {
 // infoByPostAndClaims creates Info using postDB and auth.Claims given by user
 func infoByPostAndClaims(post postDB, claims auth.Claims) Info {
 	var info Info
-	if post.Type == "link" {
+	switch post.Type {
+	case "link":
 		info = InfoLink{
 			Type:        "link",
 			ID:          post.ID,
@@ -47,8 +50,30 @@ func infoByPostAndClaims(post postDB, claims auth.Claims) Info {
 			},
 			Comments:         []Comment{},
 			UpvotePercentage: 100,
+			Personal:         &Personal{MyVote: 1, CanEdit: true, CanDelete: true},
 		}
-	} else {
+	case "image":
+		info = InfoImage{
+			Type:        "image",
+			ID:          post.ID,
+			Score:       post.Score,
+			Views:       post.Views,
+			Title:       post.Title,
+			Image:       media.Info{ID: post.Payload},
+			Category:    post.Category,
+			DateCreated: post.DateCreated,
+			Author: Author{
+				Username: claims.User.Username,
+				ID:       claims.User.ID,
+			},
+			Votes: []Vote{
+				{User: claims.User.ID, Vote: 1},
+			},
+			Comments:         []Comment{},
+			UpvotePercentage: 100,
+			Personal:         &Personal{MyVote: 1, CanEdit: true, CanDelete: true},
+		}
+	default:
 		info = InfoText{
 			Type:        "text",
 			ID:          post.ID,
@@ -67,6 +92,7 @@ func infoByPostAndClaims(post postDB, claims auth.Claims) Info {
 			},
 			Comments:         []Comment{},
 			UpvotePercentage: 100,
+			Personal:         &Personal{MyVote: 1, CanEdit: true, CanDelete: true},
 		}
 	}
 	return info
@@ -75,7 +101,9 @@ func infoByPostAndClaims(post postDB, claims auth.Claims) Info {
 // infoByPostDB creates new Info using data from DB
 func infoByPostDB(post postDB, author Author, votes []Vote, comments []Comment) Info {
 	var info Info
-	if post.Type == "url" {
+	switch post.Type {
+	// Link posts of the seed data have the type url.
+	case "link", "url":
 		info = InfoLink{
 			Type:             "link",
 			ID:               post.ID,
@@ -90,7 +118,22 @@ func infoByPostDB(post postDB, author Author, votes []Vote, comments []Comment)
 			Comments:         comments,
 			UpvotePercentage: upvotePercentage(votes),
 		}
-	} else {
+	case "image":
+		info = InfoImage{
+			Type:             "image",
+			ID:               post.ID,
+			Score:            post.Score,
+			Views:            post.Views,
+			Title:            post.Title,
+			Image:            media.Info{ID: post.Payload},
+			Category:         post.Category,
+			DateCreated:      post.DateCreated,
+			Author:           author,
+			Votes:            votes,
+			Comments:         comments,
+			UpvotePercentage: upvotePercentage(votes),
+		}
+	default:
 		info = InfoText{
 			Type:             "text",
 			ID:               post.ID,
@@ -109,9 +152,12 @@ func infoByPostDB(post postDB, author Author, votes []Vote, comments []Comment)
 	return info
 }
 
+// authorName hides the name of users who are waiting to be deleted.
+const authorName = `CASE WHEN date_deletion IS NULL THEN name ELSE '` + user.DeletedName + `' END AS name`
+
 // getAuthorByID obtains Author using ID from database
 func (p Post) getAuthorByID(ctx context.Context, ID string) (Author, error) {
-	const qAuthor = `SELECT user_id, name FROM users WHERE user_id = $1`
+	const qAuthor = `SELECT user_id, ` + authorName + ` FROM users WHERE user_id = $1`
 
 	p.log.Printf("%s: %s", "post.helpers.getAuthorByID", database.Log(qAuthor))
 
@@ -124,7 +170,7 @@ func (p Post) getAuthorByID(ctx context.Context, ID string) (Author, error) {
 
 // getAuthorByName obtains Author using name in database
 func (p Post) getAuthorByName(ctx context.Context, name string) (Author, error) {
-	const qAuthor = `SELECT user_id, name FROM users WHERE name = $1`
+	const qAuthor = `SELECT user_id, name FROM users WHERE name = $1 AND date_deletion IS NULL`
 
 	p.log.Printf("%s: %s", "post.helpers.getAuthorByID", database.Log(qAuthor))
 
@@ -132,6 +178,9 @@ func (p Post) getAuthorByName(ctx context.Context, name string) (Author, error)
 	if err := p.db.SelectContext(ctx, &author, qAuthor, name); err != nil {
 		return Author{}, errors.Wrap(err, "selecting authors")
 	}
+	if len(author) == 0 {
+		return Author{}, ErrUserNotFound
+	}
 	return author[0], nil
 }
 
@@ -162,16 +211,16 @@ func (p Post) getPostScore(ctx context.Context, ID string) (int, error) {
 }
 
 // selectCommentsByPostID return slice of Comment for a single post
-func (p Post) selectCommentsByPostID(ctx context.Context, ID string) ([]Comment, error) {
+func (p Post) selectCommentsByPostID(ctx context.Context, viewerID string, ID string) ([]Comment, error) {
 	const qComments = `
 		SELECT 
-			name, user_id, cm.date_created, body, comment_id 
+			` + authorName + `, user_id, cm.date_created, body, comment_id 
 		FROM 
 			comments cm join users using(user_id) 
 		WHERE 
-			post_id = $1`
+			post_id = $1 AND ` + notBlockedBy
 
-	p.log.Printf("%s: %s", "post.helpers.selectCommentsByPostID", database.Log(qComments))
+	p.log.Printf("%s: %s", "post.helpers.selectCommentsByPostID", database.Log(qComments, ID, viewerID))
 
 	var rawComments []struct {
 		DateCreated time.Time `db:"date_created"`
@@ -180,7 +229,7 @@ func (p Post) selectCommentsByPostID(ctx context.Context, ID string) ([]Comment,
 		Body        string    `db:"body"`
 		ID          string    `db:"comment_id"`
 	}
-	if err := p.db.SelectContext(ctx, &rawComments, qComments, ID); err != nil {
+	if err := p.db.SelectContext(ctx, &rawComments, qComments, ID, viewerID); err != nil {
 		return nil, errors.Wrap(err, "selecting comments")
 	}
 
@@ -201,13 +250,13 @@ func (p Post) selectCommentsByPostID(ctx context.Context, ID string) ([]Comment,
 }
 
 // selectAllPosts return all posts stored in database
-func (p Post) selectAllPosts(ctx context.Context) ([]postDB, error) {
-	const qPost = `SELECT * FROM posts`
+func (p Post) selectAllPosts(ctx context.Context, viewerID string) ([]postDB, error) {
+	const qPost = `SELECT * FROM posts AS p WHERE ` + visibleTo
 
-	p.log.Printf("%s: %s", "post.helpers.selectAllPosts", database.Log(qPost))
+	p.log.Printf("%s: %s", "post.helpers.selectAllPosts", database.Log(qPost, viewerID))
 
 	var posts []postDB
-	if err := p.db.SelectContext(ctx, &posts, qPost); err != nil {
+	if err := p.db.SelectContext(ctx, &posts, qPost, viewerID); err != nil {
 		return nil, errors.Wrap(err, "selecting all posts")
 	}
 
@@ -222,13 +271,13 @@ func (p Post) selectAllPosts(ctx context.Context) ([]postDB, error) {
 }
 
 // selectPostsByCategory returns all posts with a given category stored in database
-func (p Post) selectPostsByCategory(ctx context.Context, category string) ([]postDB, error) {
-	const qPost = `SELECT * FROM posts WHERE category = $1`
+func (p Post) selectPostsByCategory(ctx context.Context, viewerID string, category string) ([]postDB, error) {
+	const qPost = `SELECT * FROM posts AS p WHERE ` + visibleTo + ` AND category = $2`
 
-	p.log.Printf("%s: %s", "post.helpers.selectPostsByCategory", database.Log(qPost))
+	p.log.Printf("%s: %s", "post.helpers.selectPostsByCategory", database.Log(qPost, viewerID, category))
 
 	var posts []postDB
-	if err := p.db.SelectContext(ctx, &posts, qPost, category); err != nil {
+	if err := p.db.SelectContext(ctx, &posts, qPost, viewerID, category); err != nil {
 		return nil, errors.Wrap(err, "selecting category posts")
 	}
 	for i := range posts {
@@ -242,13 +291,13 @@ func (p Post) selectPostsByCategory(ctx context.Context, category string) ([]pos
 }
 
 // selectPostsByUser returns all posts from user stored in database
-func (p Post) selectPostsByUser(ctx context.Context, userID string) ([]postDB, error) {
-	const qPost = `SELECT * FROM posts WHERE user_id = $1`
+func (p Post) selectPostsByUser(ctx context.Context, viewerID string, userID string) ([]postDB, error) {
+	const qPost = `SELECT * FROM posts AS p WHERE ` + visibleTo + ` AND user_id = $2`
 
-	p.log.Printf("%s: %s", "post.helpers.selectPostsByUser", database.Log(qPost))
+	p.log.Printf("%s: %s", "post.helpers.selectPostsByUser", database.Log(qPost, viewerID, userID))
 
 	var posts []postDB
-	if err := p.db.SelectContext(ctx, &posts, qPost, userID); err != nil {
+	if err := p.db.SelectContext(ctx, &posts, qPost, viewerID, userID); err != nil {
 		return nil, errors.Wrap(err, "selecting users posts")
 	}
 	for i := range posts {
@@ -304,17 +353,17 @@ func (p Post) checkPost(ctx context.Context, postID string) error {
 func (p Post) insertPost(ctx context.Context, post postDB) error {
 	const qPost = `
 	INSERT INTO posts
-		(post_id, views, type, title, category, payload, date_created, user_id)
+		(post_id, views, type, title, category, payload, date_created, user_id, canonical_url)
 	VALUES
-		($1, $2, $3, $4, $5, $6, $7, $8)`
+		($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 
 	p.log.Printf("%s: %s", "post.helpers.insertPost",
 		database.Log(qPost, post.ID, post.Views, post.Type, post.Title, post.Category, post.Payload,
-			post.DateCreated, post.UserID),
+			post.DateCreated, post.UserID, post.CanonicalURL),
 	)
 
 	if _, err := p.db.ExecContext(ctx, qPost, post.ID, post.Views, post.Type, post.Title,
-		post.Category, post.Payload, post.DateCreated, post.UserID); err != nil {
+		post.Category, post.Payload, post.DateCreated, post.UserID, post.CanonicalURL); err != nil {
 		return errors.Wrap(err, "inserting post")
 	}
 	return nil
@@ -338,6 +387,18 @@ func (p Post) insertVote(ctx context.Context, postID string, userID string, vote
 
 // deletePost deletes post with all its votes and comments
 func (p Post) deletePost(ctx context.Context, postID string) error {
+	const qDeleteSaves = `DELETE FROM saves WHERE post_id = $1`
+	p.log.Printf("%s: %s", "post.helpers.deletePost", database.Log(qDeleteSaves, postID))
+	if _, err := p.db.ExecContext(ctx, qDeleteSaves, postID); err != nil {
+		return errors.Wrapf(err, "deleting saves %s", postID)
+	}
+
+	const qDeleteHidden = `DELETE FROM hidden_posts WHERE post_id = $1`
+	p.log.Printf("%s: %s", "post.helpers.deletePost", database.Log(qDeleteHidden, postID))
+	if _, err := p.db.ExecContext(ctx, qDeleteHidden, postID); err != nil {
+		return errors.Wrapf(err, "deleting hidden %s", postID)
+	}
+
 	const qDeleteVotes = `DELETE FROM votes WHERE post_id = $1`
 	p.log.Printf("%s: %s", "post.helpers.deletePost", database.Log(qDeleteVotes, postID))
 	if _, err := p.db.ExecContext(ctx, qDeleteVotes, postID); err != nil {
@@ -422,7 +483,7 @@ func (p Post) createComment(
 // getCommentByID returns comment with ID commentID
 func (p Post) getCommentByID(ctx context.Context, commentID string) (Comment, error) {
 	const qComment = `
-		SELECT name, user_id, cm.date_created, body, comment_id 
+		SELECT ` + authorName + `, user_id, cm.date_created, body, comment_id 
 		FROM comments cm join users using(user_id) 
 		WHERE comment_id = $1`
 
@@ -457,6 +518,14 @@ func (p Post) getCommentByID(ctx context.Context, commentID string) (Comment, er
 
 // deleteComment deletes comment.
 func (p Post) deleteComment(ctx context.Context, commentID string) error {
+	const qDeleteSaves = `DELETE FROM saves WHERE comment_id = $1`
+
+	p.log.Printf("%s: %s", "post.helpers.deleteComment", database.Log(qDeleteSaves, commentID))
+
+	if _, err := p.db.ExecContext(ctx, qDeleteSaves, commentID); err != nil {
+		return errors.Wrapf(err, "deleting saves of comment %s", commentID)
+	}
+
 	const qDeleteComment = `DELETE FROM comments WHERE comment_id = $1`
 
 	p.log.Printf("%s: %s", "post.helpers.deleteComment", database.Log(qDeleteComment, commentID))
@@ -469,3 +538,30 @@ func (p Post) deleteComment(ctx context.Context, commentID string) error {
 	}
 	return nil
 }
+
+// checkVerified returns ErrEmailNotVerified if the community requires a
+// verified email and the user has none. Claims may predate a change of the
+// email, so the database is always asked.
+func (p Post) checkVerified(ctx context.Context, claims auth.Claims, category string) error {
+	com, err := p.community.QueryByName(ctx, category)
+	if err != nil {
+		return err
+	}
+	if !com.RequireVerifiedEmail {
+		return nil
+	}
+
+	const q = `SELECT email <> '' AND email_verified FROM users WHERE user_id = $1`
+
+	p.log.Printf("%s: %s", "post.helpers.checkVerified", database.Log(q, claims.User.ID))
+
+	var verified bool
+	if err := p.db.GetContext(ctx, &verified, q, claims.User.ID); err != nil {
+		return errors.Wrap(err, "checking email verification")
+	}
+
+	if !verified {
+		return ErrEmailNotVerified
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package post
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// MaxURLLength is the longest URL a link post may point to.
+const MaxURLLength = 2048
+
+// DuplicateWindow is how long a link stays a duplicate in the community it
+// was posted to.
+const DuplicateWindow = 30 * 24 * time.Hour
+
+// maxDuplicates is how many other submissions of a link are listed.
+const maxDuplicates = 25
+
+// trackingParams are query parameters which only tell where visitors came
+// from. Parameters ending with * are prefixes.
+var trackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gclsrc", "msclkid", "yclid", "twclid",
+	"igshid", "mc_cid", "mc_eid", "_ga", "_gl", "ref_src", "ref_url", "spm",
+}
+
+// CanonicalURL validates the URL of a link post and returns the form it is
+// compared in to find duplicates. Only http and https URLs with a host are
+// valid. The canonical form has a lowercase scheme and host, no default
+// port, fragment, tracking parameters or trailing slash, and sorted query
+// parameters.
+func CanonicalURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || len(raw) > MaxURLLength {
+		return "", ErrInvalidURL
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrInvalidURL
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" || u.Opaque != "" || u.User != nil {
+		return "", ErrInvalidURL
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return "", ErrInvalidURL
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	switch port := u.Port(); {
+	case port == "", u.Scheme == "http" && port == "80", u.Scheme == "https" && port == "443":
+		u.Host = host
+	default:
+		u.Host = host + ":" + port
+	}
+
+	u.Fragment = ""
+	u.RawFragment = ""
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+
+	query := u.Query()
+	for name := range query {
+		if tracking(strings.ToLower(name)) {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+// tracking tells if the query parameter only tracks visitors.
+func tracking(name string) bool {
+	for _, p := range trackingParams {
+		if strings.HasSuffix(p, "*") && strings.HasPrefix(name, strings.TrimSuffix(p, "*")) || name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDuplicate makes sure the link was not posted to the community within
+// DuplicateWindow.
+func (p Post) checkDuplicate(ctx context.Context, category string, canonical string, now time.Time) error {
+	const q = `
+	SELECT
+		COUNT(*)
+	FROM
+		posts
+	WHERE
+		category = $1 AND canonical_url = $2 AND date_created > $3`
+
+	since := now.Add(-DuplicateWindow)
+	p.log.Printf("%s: %s", "post.checkDuplicate", database.Log(q, category, canonical, since))
+
+	var count int
+	if err := p.db.GetContext(ctx, &count, q, category, canonical, since); err != nil {
+		return errors.Wrap(err, "counting duplicates")
+	}
+	if count > 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// canonicalizeBatch is how many link posts CanonicalizeLinks loads at once.
+const canonicalizeBatch = 500
+
+// CanonicalizeLinks stores the canonical URL of every link post whose stored
+// one is out of date. Migration 3.6 copied the URLs of older posts as they
+// were, so they only match duplicates once this ran. Posts whose URL is not
+// valid get none. It returns how many posts were changed.
+func (p Post) CanonicalizeLinks(ctx context.Context) (int, error) {
+	const q = `
+	SELECT
+		post_id, payload, canonical_url
+	FROM
+		posts
+	WHERE
+		type = 'link' AND post_id > $1
+	ORDER BY
+		post_id
+	LIMIT $2`
+
+	const qUpdate = `UPDATE posts SET canonical_url = $2 WHERE post_id = $1`
+
+	var n int
+	after := "00000000-0000-0000-0000-000000000000"
+	for {
+		p.log.Printf("%s: %s", "post.CanonicalizeLinks", database.Log(q, after, canonicalizeBatch))
+
+		var links []struct {
+			ID           string  `db:"post_id"`
+			Payload      string  `db:"payload"`
+			CanonicalURL *string `db:"canonical_url"`
+		}
+		if err := p.db.SelectContext(ctx, &links, q, after, canonicalizeBatch); err != nil {
+			return n, errors.Wrap(err, "selecting link posts")
+		}
+
+		for _, l := range links {
+			var canonical *string
+			if c, err := CanonicalURL(l.Payload); err == nil {
+				canonical = &c
+			}
+			if canonical == nil && l.CanonicalURL == nil || canonical != nil && l.CanonicalURL != nil && *canonical == *l.CanonicalURL {
+				continue
+			}
+
+			p.log.Printf("%s: %s", "post.CanonicalizeLinks", database.Log(qUpdate, l.ID, canonical))
+
+			if _, err := p.db.ExecContext(ctx, qUpdate, l.ID, canonical); err != nil {
+				return n, errors.Wrapf(err, "updating canonical url of post %s", l.ID)
+			}
+			n++
+		}
+
+		if len(links) < canonicalizeBatch {
+			return n, nil
+		}
+		after = links[len(links)-1].ID
+	}
+}
+
+// QueryDuplicates lists the newest submissions of the link to any community.
+// It leaves out posts the same way Query does.
+func (p Post) QueryDuplicates(ctx context.Context, claims auth.Claims, rawURL string) ([]Info, error) {
+	canonical, err := CanonicalURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		posts AS p
+	WHERE
+		` + visibleTo + ` AND type = 'link' AND canonical_url = $2
+	ORDER BY
+		date_created DESC
+	LIMIT $3`
+
+	p.log.Printf("%s: %s", "post.QueryDuplicates", database.Log(q, claims.User.ID, canonical, maxDuplicates))
+
+	var posts []postDB
+	if err := p.db.SelectContext(ctx, &posts, q, claims.User.ID, canonical, maxDuplicates); err != nil {
+		return nil, errors.Wrap(err, "selecting duplicates")
+	}
+
+	info := []Info{}
+	for _, post := range posts {
+		author, err := p.getAuthorByID(ctx, post.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		pi, err := p.completeInfo(ctx, claims, post, author)
+		if err != nil {
+			return nil, err
+		}
+		info = append(info, pi)
+	}
+
+	return info, nil
+}
@@ -2,19 +2,23 @@ package post
 
 import (
 	"time"
+
+	"github.com/cravtos/asperitas-backend/business/data/media"
+	"github.com/cravtos/asperitas-backend/business/data/preview"
 )
 
 // postDB represents an individual post in database. (with additional field "score" counted using votes table)
 type postDB struct {
-	ID          string    `db:"post_id"`
-	Score       int       `db:"score"`
-	Views       int       `db:"views"`
-	Type        string    `db:"type"`
-	Title       string    `db:"title"`
-	Category    string    `db:"category"`
-	Payload     string    `db:"payload"`
-	DateCreated time.Time `db:"date_created"`
-	UserID      string    `db:"user_id"`
+	ID           string    `db:"post_id"`
+	Score        int       `db:"score"`
+	Views        int       `db:"views"`
+	Type         string    `db:"type"`
+	Title        string    `db:"title"`
+	Category     string    `db:"category"`
+	Payload      string    `db:"payload"`
+	DateCreated  time.Time `db:"date_created"`
+	UserID       string    `db:"user_id"`
+	CanonicalURL *string   `db:"canonical_url"`
 }
 
 // Author represents info about author
@@ -29,7 +33,7 @@ type Vote struct {
 	Vote int    `db:"vote" json:"vote"`
 }
 
-// Info generalizes text and link posts
+// Info generalizes text, link and image posts
 type Info interface {
 	Info()
 }
@@ -48,26 +52,64 @@ type InfoText struct {
 	Votes            []Vote    `json:"votes"`
 	Comments         []Comment `json:"comments"`
 	UpvotePercentage int       `json:"upvotePercentage"`
+	*Personal
 }
 
 // InfoLink represents an individual link post which is sent to user.
 type InfoLink struct {
-	Type             string    `json:"type"`
-	ID               string    `json:"id"`
-	Score            int       `json:"score"`
-	Views            int       `json:"views"`
-	Title            string    `json:"title"`
-	Payload          string    `json:"url"`
-	Category         string    `json:"category"`
-	DateCreated      time.Time `json:"created"`
-	Author           Author    `json:"author"`
-	Votes            []Vote    `json:"votes"`
-	Comments         []Comment `json:"comments"`
-	UpvotePercentage int       `json:"upvotePercentage"`
+	Type             string        `json:"type"`
+	ID               string        `json:"id"`
+	Score            int           `json:"score"`
+	Views            int           `json:"views"`
+	Title            string        `json:"title"`
+	Payload          string        `json:"url"`
+	Category         string        `json:"category"`
+	DateCreated      time.Time     `json:"created"`
+	Author           Author        `json:"author"`
+	Votes            []Vote        `json:"votes"`
+	Comments         []Comment     `json:"comments"`
+	UpvotePercentage int           `json:"upvotePercentage"`
+	Preview          *preview.Info `json:"preview,omitempty"`
+	*Personal
+}
+
+// InfoImage represents an individual image post which is sent to user.
+type InfoImage struct {
+	Type             string     `json:"type"`
+	ID               string     `json:"id"`
+	Score            int        `json:"score"`
+	Views            int        `json:"views"`
+	Title            string     `json:"title"`
+	Category         string     `json:"category"`
+	Image            media.Info `json:"image"`
+	DateCreated      time.Time  `json:"created"`
+	Author           Author     `json:"author"`
+	Votes            []Vote     `json:"votes"`
+	Comments         []Comment  `json:"comments"`
+	UpvotePercentage int        `json:"upvotePercentage"`
+	*Personal
+}
+
+// Personal tells the user who requested a post how they relate to it. It is
+// only set when the user is known.
+type Personal struct {
+	MyVote    int  `json:"myVote"`
+	Saved     bool `json:"saved"`
+	Hidden    bool `json:"hidden"`
+	CanEdit   bool `json:"canEdit"`
+	CanDelete bool `json:"canDelete"`
+}
+
+// PersonalComment tells the user who requested a comment how they relate to
+// it. It is only set when the user is known.
+type PersonalComment struct {
+	Saved     bool `json:"saved"`
+	CanDelete bool `json:"canDelete"`
 }
 
-func (it InfoText) Info() {}
-func (il InfoLink) Info() {}
+func (it InfoText) Info()  {}
+func (il InfoLink) Info()  {}
+func (ii InfoImage) Info() {}
 
 // Comment represents info about comments for the post prepared to be sent to user.
 type Comment struct {
@@ -75,18 +117,83 @@ type Comment struct {
 	Author      Author    `json:"author"`
 	Body        string    `json:"body"`
 	ID          string    `json:"id"`
+	*PersonalComment
 }
 
-// NewPost is what we require from users when adding a Post.
+// NewPost is what we require from users when adding a Post. Links which
+// were posted to the community recently are refused unless Resubmit is set.
+// Image posts name an image the user uploaded before as Media.
 type NewPost struct {
 	Type     string `json:"type" default:"link"`
 	Title    string `json:"title" validate:"required"`
 	Category string `json:"category" validate:"required"`
 	Text     string `json:"text"`
 	URL      string `json:"url"`
+	Media    string `json:"media"`
+	Resubmit bool   `json:"resubmit"`
 }
 
 // NewComment is what we require from users when adding a Comment.
 type NewComment struct {
 	Text string `json:"comment" validate:"required"`
 }
+
+// PostRef identifies the post a comment was left on.
+type PostRef struct {
+	ID       string `db:"post_id" json:"id"`
+	Title    string `db:"title" json:"title"`
+	Category string `db:"category" json:"category"`
+	Type     string `db:"type" json:"type"`
+	URL      string `db:"url" json:"url,omitempty"`
+}
+
+// UserComment is a comment listed in the activity of its author.
+type UserComment struct {
+	Comment
+	Post PostRef `json:"post"`
+}
+
+// Activity is a single entry of the overview of a user. Exactly one of Post
+// and Comment is set, as told by Kind.
+type Activity struct {
+	Kind        string       `json:"kind"`
+	DateCreated time.Time    `json:"created"`
+	Post        Info         `json:"post,omitempty"`
+	Comment     *UserComment `json:"comment,omitempty"`
+}
+
+// SavedItem is a post or comment a user saved for later. Exactly one of Post
+// and Comment is set, as told by Kind.
+type SavedItem struct {
+	Kind      string       `json:"kind"`
+	DateSaved time.Time    `json:"savedAt"`
+	Post      Info         `json:"post,omitempty"`
+	Comment   *UserComment `json:"comment,omitempty"`
+}
+
+// PageQuery selects one page of a listing. Page counts from 1.
+type PageQuery struct {
+	Page int
+	Rows int
+	Sort string
+}
+
+// ScoreChanged is published when users vote on a post.
+type ScoreChanged struct {
+	ID               string `json:"id"`
+	Score            int    `json:"score"`
+	UpvotePercentage int    `json:"upvotePercentage"`
+}
+
+// CommentCreated is published when a comment is left on a post.
+type CommentCreated struct {
+	PostID  string  `json:"postId"`
+	Comment Comment `json:"comment"`
+}
+
+// Removed is published when a post or one of its comments is deleted.
+// CommentID is empty when the post itself is gone.
+type Removed struct {
+	PostID    string `json:"postId"`
+	CommentID string `json:"commentId,omitempty"`
+}
@@ -0,0 +1,165 @@
+package post
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// mentionRE finds u/name mentions which are not part of a longer word or path.
+var mentionRE = regexp.MustCompile(`(?:^|[^\w/])u/([\w-]+)`)
+
+// mentions returns the lowercased names mentioned in text, once each.
+func mentions(text string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, m := range mentionRE.FindAllStringSubmatch(text, -1) {
+		name := strings.ToLower(m[1])
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// notify tells the author of the post about a new comment and everyone
+// mentioned in text about being mentioned. Nobody is notified twice, about
+// what they did themselves or by a user they blocked. Errors are only logged,
+// as they are by the helpers publishing events.
+func (p Post) notify(ctx context.Context, claims auth.Claims, postID string, commentID string, text string, now time.Time) {
+	notified := map[string]bool{claims.User.ID: true}
+
+	if commentID != "" {
+		post, err := p.getPostByID(ctx, postID)
+		if err != nil {
+			p.log.Printf("%s: loading post %s : %v", "post.notify", postID, err)
+			return
+		}
+
+		nn := notification.NewNotification{
+			UserID:    post.UserID,
+			Kind:      notification.KindReply,
+			ActorID:   claims.User.ID,
+			PostID:    postID,
+			CommentID: commentID,
+			Body:      text,
+		}
+		if !notified[post.UserID] {
+			if err := p.notification.Create(ctx, nn, now); err != nil {
+				p.log.Printf("%s: %v", "post.notify", err)
+			}
+			notified[post.UserID] = true
+		}
+	}
+
+	names := mentions(text)
+	if len(names) == 0 {
+		return
+	}
+
+	const q = `
+	SELECT
+		u.user_id
+	FROM
+		users AS u
+	WHERE
+		lower(u.name) = ANY($1) AND u.date_deletion IS NULL
+		AND NOT EXISTS (SELECT 1 FROM blocks AS b WHERE b.user_id = u.user_id AND b.blocked_id::text = $2)`
+
+	p.log.Printf("%s: %s", "post.notify", database.Log(q, names, claims.User.ID))
+
+	var ids []string
+	if err := p.db.SelectContext(ctx, &ids, q, pq.Array(names), claims.User.ID); err != nil {
+		p.log.Printf("%s: %v", "post.notify", errors.Wrap(err, "selecting mentioned users"))
+		return
+	}
+
+	for _, id := range ids {
+		if notified[id] {
+			continue
+		}
+		nn := notification.NewNotification{
+			UserID:    id,
+			Kind:      notification.KindMention,
+			ActorID:   claims.User.ID,
+			PostID:    postID,
+			CommentID: commentID,
+			Body:      text,
+		}
+		if err := p.notification.Create(ctx, nn, now); err != nil {
+			p.log.Printf("%s: %v", "post.notify", err)
+		}
+	}
+}
+
+// Remove deletes the post on behalf of moderators and tells its author why.
+func (p Post) Remove(ctx context.Context, postID string, reason string, now time.Time) error {
+	if _, err := uuid.Parse(postID); err != nil {
+		return ErrInvalidID
+	}
+
+	post, err := p.getPostByID(ctx, postID)
+	if err != nil {
+		return err
+	}
+
+	if err := p.deletePost(ctx, postID); err != nil {
+		return err
+	}
+	p.publish(ctx, postID, post.Category, EventPostRemoved, Removed{PostID: postID}, now)
+
+	nn := notification.NewNotification{
+		UserID: post.UserID,
+		Kind:   notification.KindModeration,
+		PostID: postID,
+		Body:   "Your post \"" + post.Title + "\" was removed by moderators. " + reason,
+	}
+	return p.notification.Create(ctx, nn, now)
+}
+
+// RemoveComment deletes the comment on behalf of moderators and tells its
+// author why.
+func (p Post) RemoveComment(ctx context.Context, commentID string, reason string, now time.Time) error {
+	if _, err := uuid.Parse(commentID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `SELECT post_id, user_id FROM comments WHERE comment_id = $1`
+
+	p.log.Printf("%s: %s", "post.RemoveComment", database.Log(q, commentID))
+
+	var cm struct {
+		PostID string `db:"post_id"`
+		UserID string `db:"user_id"`
+	}
+	if err := p.db.GetContext(ctx, &cm, q, commentID); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrCommentNotFound
+		}
+		return errors.Wrapf(err, "selecting comment %s", commentID)
+	}
+
+	if err := p.deleteComment(ctx, commentID); err != nil {
+		return err
+	}
+	p.publishCommentDeleted(ctx, cm.PostID, commentID, now)
+
+	nn := notification.NewNotification{
+		UserID:    cm.UserID,
+		Kind:      notification.KindModeration,
+		PostID:    cm.PostID,
+		CommentID: commentID,
+		Body:      "Your comment was removed by moderators. " + reason,
+	}
+	return p.notification.Create(ctx, nn, now)
+}
@@ -0,0 +1,115 @@
+package post_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+)
+
+func TestNotify(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	bus := pubsub.New()
+	p := post.New(log, db, bus, nil)
+	n := notification.New(log, db, bus)
+
+	ctx := context.Background()
+	now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+	author := newClaims(t, log, db, "author", now)
+	replier := newClaims(t, log, db, "replier", now)
+	mentioned := newClaims(t, log, db, "mentioned", now)
+	blocker := newClaims(t, log, db, "blocker", now)
+
+	if err := user.New(log, db).Block(ctx, blocker, "replier", now); err != nil {
+		t.Fatalf("blocking replier: %s", err)
+	}
+
+	inbox := func(claims auth.Claims) []notification.Info {
+		notifications, err := n.Query(ctx, claims, false, 1, 10)
+		if err != nil {
+			t.Fatalf("querying notifications of %s: %s", claims.User.Username, err)
+		}
+		return notifications
+	}
+
+	np := post.NewPost{
+		Type:     "text",
+		Title:    "Gophers",
+		Category: "programming",
+		Text:     "Gophers are great.",
+	}
+	created, err := p.Create(ctx, author, np, now)
+	if err != nil {
+		t.Fatalf("creating post: %s", err)
+	}
+	postID := created.(post.InfoText).ID
+
+	t.Log("Given the need to tell users what happened to their content.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user replies to a post mentioning others.", testID)
+		{
+			nc := post.NewComment{Text: "Thanks u/author, also see u/mentioned, u/blocker and u/replier."}
+			if _, err := p.CreateComment(ctx, replier, nc, postID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to comment : %s.", tests.Failed, testID, err)
+			}
+
+			got := inbox(author)
+			if len(got) != 1 || got[0].Kind != notification.KindReply || got[0].Actor == nil || *got[0].Actor != "replier" {
+				t.Fatalf("\t%s\tTest %d:\tShould tell the author about the reply once : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould tell the author about the reply once.", tests.Success, testID)
+
+			got = inbox(mentioned)
+			if len(got) != 1 || got[0].Kind != notification.KindMention || got[0].PostID != postID {
+				t.Fatalf("\t%s\tTest %d:\tShould tell mentioned users : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould tell mentioned users.", tests.Success, testID)
+
+			if got := inbox(blocker); len(got) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not tell users who blocked the replier : %+v.", tests.Failed, testID, got)
+			}
+			if got := inbox(replier); len(got) != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not tell the replier about themselves : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not tell the replier or users who blocked them.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen moderators remove content.", testID)
+		{
+			pst, err := p.QueryByID(ctx, author, postID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get the post : %s.", tests.Failed, testID, err)
+			}
+			commentID := pst.(post.InfoText).Comments[0].ID
+
+			if err := p.RemoveComment(ctx, commentID, "Be nice.", now.Add(time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to remove the comment : %s.", tests.Failed, testID, err)
+			}
+			got := inbox(replier)
+			if len(got) != 1 || got[0].Kind != notification.KindModeration || got[0].CommentID == nil || *got[0].CommentID != commentID {
+				t.Fatalf("\t%s\tTest %d:\tShould tell the author of the comment : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould tell the author of the comment.", tests.Success, testID)
+
+			if err := p.Remove(ctx, postID, "Off topic.", now.Add(time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to remove the post : %s.", tests.Failed, testID, err)
+			}
+			got = inbox(author)
+			if len(got) != 2 || got[0].Kind != notification.KindModeration || got[0].Actor != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould tell the author of the post : %+v.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould tell the author of the post.", tests.Success, testID)
+		}
+	}
+}
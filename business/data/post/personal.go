@@ -0,0 +1,97 @@
+package post
+
+import (
+	"context"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// personalize tells the user the claims belong to how they relate to the
+// post and its comments. Posts requested anonymously are left as they are.
+func (p Post) personalize(ctx context.Context, claims auth.Claims, info Info) (Info, error) {
+	if claims.User.ID == "" {
+		return info, nil
+	}
+
+	switch pi := info.(type) {
+	case InfoText:
+		personal, err := p.personal(ctx, claims, pi.ID, pi.Author, pi.Votes, pi.Comments)
+		if err != nil {
+			return nil, err
+		}
+		pi.Personal = personal
+		return pi, nil
+
+	case InfoLink:
+		personal, err := p.personal(ctx, claims, pi.ID, pi.Author, pi.Votes, pi.Comments)
+		if err != nil {
+			return nil, err
+		}
+		pi.Personal = personal
+		return pi, nil
+
+	case InfoImage:
+		personal, err := p.personal(ctx, claims, pi.ID, pi.Author, pi.Votes, pi.Comments)
+		if err != nil {
+			return nil, err
+		}
+		pi.Personal = personal
+		return pi, nil
+	}
+	return info, nil
+}
+
+// personal builds the Personal of a post and fills the PersonalComment of
+// every one of its comments.
+func (p Post) personal(ctx context.Context, claims auth.Claims, postID string, author Author, votes []Vote, comments []Comment) (*Personal, error) {
+	const q = `
+	SELECT
+		COALESCE(comment_id, post_id)::text
+	FROM
+		saves
+	WHERE
+		user_id = $1 AND post_id = $2
+	UNION ALL
+	SELECT
+		'hidden'
+	FROM
+		hidden_posts
+	WHERE
+		user_id = $1 AND post_id = $2`
+
+	p.log.Printf("%s: %s", "post.personal", database.Log(q, claims.User.ID, postID))
+
+	var ids []string
+	if err := p.db.SelectContext(ctx, &ids, q, claims.User.ID, postID); err != nil {
+		return nil, errors.Wrapf(err, "selecting saves of post %s", postID)
+	}
+
+	marked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		marked[id] = true
+	}
+
+	own := author.ID == claims.User.ID
+	personal := Personal{
+		Saved:     marked[postID],
+		Hidden:    marked["hidden"],
+		CanEdit:   own,
+		CanDelete: own,
+	}
+	for _, v := range votes {
+		if v.User == claims.User.ID {
+			personal.MyVote = v.Vote
+		}
+	}
+
+	for i := range comments {
+		comments[i].PersonalComment = &PersonalComment{
+			Saved:     marked[comments[i].ID],
+			CanDelete: comments[i].Author.ID == claims.User.ID,
+		}
+	}
+
+	return &personal, nil
+}
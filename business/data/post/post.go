@@ -4,10 +4,19 @@ package post
 import (
 	"context"
 	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/community"
+	"github.com/cravtos/asperitas-backend/business/data/media"
+	"github.com/cravtos/asperitas-backend/business/data/notification"
+	"github.com/cravtos/asperitas-backend/business/data/preview"
+	"github.com/cravtos/asperitas-backend/business/data/webhook"
+	"github.com/cravtos/asperitas-backend/foundation/blob"
+	"github.com/cravtos/asperitas-backend/foundation/imaging"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"log"
+	"strings"
 	"time"
 )
 
@@ -25,20 +34,58 @@ var (
 	ErrCommentNotFound = errors.New("comment not found")
 
 	//ErrCommentNotFound is used when user tries to create post with incorrect type.
-	ErrWrongPostType = errors.New("new post should be of type url or text")
+	ErrWrongPostType = errors.New("new post should be of type link, text or image")
+
+	// ErrEmailNotVerified is used when user without verified email posts to a
+	// community which requires one.
+	ErrEmailNotVerified = errors.New("community requires a verified email to post")
+
+	// ErrUserNotFound is used when activity of a user who does not exist is requested.
+	ErrUserNotFound = errors.New("user not found")
+
+	// ErrBlocked is used when a user replies to someone who blocked them.
+	ErrBlocked = errors.New("author of the post blocked you")
+
+	// ErrInvalidSort is used when a listing is requested in an order it does not support.
+	ErrInvalidSort = errors.New("invalid sort")
+
+	// ErrInvalidURL is used when a link post points to something which is
+	// not a web page.
+	ErrInvalidURL = errors.Errorf("url must be an http or https URL of at most %d characters", MaxURLLength)
+
+	// ErrDuplicate is used when a link was posted to the community recently.
+	ErrDuplicate = errors.New("link was already posted to this community recently")
+
+	// ErrInvalidMedia is used when an image post does not name an image the
+	// user uploaded.
+	ErrInvalidMedia = errors.New("media must be an image uploaded by you")
 )
 
 // Post manages the set of API's for product access.
 type Post struct {
-	log *log.Logger
-	db  *sqlx.DB
+	log          *log.Logger
+	db           *sqlx.DB
+	community    community.Community
+	notification notification.Notification
+	preview      preview.Preview
+	media        media.Media
+	webhook      webhook.Webhook
+	events       pubsub.Bus
 }
 
-// New constructs a Post for api access.
-func New(log *log.Logger, db *sqlx.DB) Post {
+// New constructs a Post for api access. Changes to posts are published to
+// events and queued for the webhooks of their community. Images of image
+// posts are kept in store.
+func New(log *log.Logger, db *sqlx.DB, events pubsub.Bus, store blob.BlobStore) Post {
 	return Post{
-		log: log,
-		db:  db,
+		log:          log,
+		db:           db,
+		community:    community.New(log, db),
+		notification: notification.New(log, db, events),
+		preview:      preview.New(log, db),
+		media:        media.New(log, db, store, imaging.Config{}),
+		webhook:      webhook.New(log, db),
+		events:       events,
 	}
 }
 
@@ -55,11 +102,41 @@ func (p Post) Create(ctx context.Context, claims auth.Claims, np NewPost, now ti
 		DateCreated: now,
 		UserID:      claims.User.ID,
 	}
-	if post.Type != "link" && post.Type != "text" {
+	var image media.Info
+	switch post.Type {
+	case "text":
+	case "link":
+		canonical, err := CanonicalURL(np.URL)
+		if err != nil {
+			return nil, err
+		}
+		post.Payload = strings.TrimSpace(np.URL)
+		post.CanonicalURL = &canonical
+	case "image":
+		mi, err := p.media.QueryByID(ctx, np.Media)
+		if err != nil {
+			if err == media.ErrNotFound || err == media.ErrInvalidID {
+				return nil, ErrInvalidMedia
+			}
+			return nil, err
+		}
+		if mi.UserID != claims.User.ID {
+			return nil, ErrInvalidMedia
+		}
+		post.Payload = mi.ID
+		image = mi
+	default:
 		return nil, ErrWrongPostType
 	}
-	if post.Type == "link" {
-		post.Payload = np.URL
+
+	if err := p.checkVerified(ctx, claims, post.Category); err != nil {
+		return nil, err
+	}
+
+	if post.CanonicalURL != nil && !np.Resubmit {
+		if err := p.checkDuplicate(ctx, post.Category, *post.CanonicalURL, now); err != nil {
+			return nil, err
+		}
 	}
 
 	if err := p.insertPost(ctx, post); err != nil {
@@ -70,12 +147,28 @@ func (p Post) Create(ctx context.Context, claims auth.Claims, np NewPost, now ti
 		return nil, err
 	}
 
+	switch post.Type {
+	case "text":
+		p.notify(ctx, claims, post.ID, "", post.Payload, now)
+	case "link":
+		// A post without a preview is still a post, so failing to queue
+		// one is only logged.
+		if err := p.preview.Request(ctx, post.Payload, now); err != nil {
+			p.log.Printf("%s: %v", "post.Create", err)
+		}
+	}
+	p.publishPost(ctx, post.ID, post.Category, now)
+
 	info := infoByPostAndClaims(post, claims)
+	if ii, ok := info.(InfoImage); ok {
+		ii.Image = image
+		info = ii
+	}
 	return info, nil
 }
 
 // Delete removes the product identified by a given ID.
-func (p Post) Delete(ctx context.Context, claims auth.Claims, postID string) error {
+func (p Post) Delete(ctx context.Context, claims auth.Claims, postID string, now time.Time) error {
 
 	if _, err := uuid.Parse(postID); err != nil {
 		return ErrInvalidID
@@ -90,12 +183,18 @@ func (p Post) Delete(ctx context.Context, claims auth.Claims, postID string) err
 		return ErrForbidden
 	}
 
-	return p.deletePost(ctx, postID)
+	if err := p.deletePost(ctx, postID); err != nil {
+		return err
+	}
+
+	p.publish(ctx, postID, post.Category, EventPostRemoved, Removed{PostID: postID}, now)
+	return nil
 }
 
-// Query gets all Posts from the database ready to be send to user.
-func (p Post) Query(ctx context.Context) ([]Info, error) {
-	posts, err := p.selectAllPosts(ctx)
+// Query gets all Posts from the database ready to be send to user. Posts the
+// user the claims belong to hid or got from users they blocked are left out.
+func (p Post) Query(ctx context.Context, claims auth.Claims) ([]Info, error) {
+	posts, err := p.selectAllPosts(ctx, claims.User.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -107,24 +206,19 @@ func (p Post) Query(ctx context.Context) ([]Info, error) {
 			return nil, err
 		}
 
-		votes, err := p.selectVotesByPostID(ctx, post.ID)
+		pi, err := p.completeInfo(ctx, claims, post, author)
 		if err != nil {
 			return nil, err
 		}
-
-		comments, err := p.selectCommentsByPostID(ctx, post.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		info = append(info, infoByPostDB(post, author, votes, comments))
+		info = append(info, pi)
 	}
 
 	return info, nil
 }
 
 // QueryByID finds the post identified by a given ID ready to be send to user.
-func (p Post) QueryByID(ctx context.Context, postID string) (Info, error) {
+// Comments of users blocked by the user the claims belong to are left out.
+func (p Post) QueryByID(ctx context.Context, claims auth.Claims, postID string) (Info, error) {
 	if _, err := uuid.Parse(postID); err != nil {
 		return InfoText{}, ErrInvalidID
 	}
@@ -139,22 +233,13 @@ func (p Post) QueryByID(ctx context.Context, postID string) (Info, error) {
 		return nil, err
 	}
 
-	votes, err := p.selectVotesByPostID(ctx, post.ID)
-	if err != nil {
-		return nil, err
-	}
-
-	comments, err := p.selectCommentsByPostID(ctx, post.ID)
-	if err != nil {
-		return nil, err
-	}
-
-	return infoByPostDB(post, author, votes, comments), nil
+	return p.completeInfo(ctx, claims, post, author)
 }
 
 // QueryByCat finds the post identified by a given Category ready to be send to user.
-func (p Post) QueryByCat(ctx context.Context, category string) ([]Info, error) {
-	posts, err := p.selectPostsByCategory(ctx, category)
+// It leaves out posts the same way Query does.
+func (p Post) QueryByCat(ctx context.Context, claims auth.Claims, category string) ([]Info, error) {
+	posts, err := p.selectPostsByCategory(ctx, claims.User.ID, category)
 	if err != nil {
 		return nil, err
 	}
@@ -166,53 +251,42 @@ func (p Post) QueryByCat(ctx context.Context, category string) ([]Info, error) {
 			return nil, err
 		}
 
-		votes, err := p.selectVotesByPostID(ctx, post.ID)
+		pi, err := p.completeInfo(ctx, claims, post, author)
 		if err != nil {
 			return nil, err
 		}
-
-		comments, err := p.selectCommentsByPostID(ctx, post.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		info = append(info, infoByPostDB(post, author, votes, comments))
+		info = append(info, pi)
 	}
 
 	return info, nil
 }
 
-// QueryByUser finds the posts identified by a given user ID.
-func (p Post) QueryByUser(ctx context.Context, name string) ([]Info, error) {
+// QueryByUser finds the posts identified by a given user ID. It leaves out
+// posts the same way Query does.
+func (p Post) QueryByUser(ctx context.Context, claims auth.Claims, name string) ([]Info, error) {
 	author, err := p.getAuthorByName(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	posts, err := p.selectPostsByUser(ctx, author.ID)
+	posts, err := p.selectPostsByUser(ctx, claims.User.ID, author.ID)
 	if err != nil {
 		return nil, err
 	}
 
 	var info []Info
 	for _, post := range posts {
-		votes, err := p.selectVotesByPostID(ctx, post.ID)
+		pi, err := p.completeInfo(ctx, claims, post, author)
 		if err != nil {
 			return nil, err
 		}
-
-		comments, err := p.selectCommentsByPostID(ctx, post.ID)
-		if err != nil {
-			return nil, err
-		}
-
-		info = append(info, infoByPostDB(post, author, votes, comments))
+		info = append(info, pi)
 	}
 
 	return info, nil
 }
 
 // Vote adds vote to the post with given postID.
-func (p Post) Vote(ctx context.Context, claims auth.Claims, postID string, vote int) (Info, error) {
+func (p Post) Vote(ctx context.Context, claims auth.Claims, postID string, vote int, now time.Time) (Info, error) {
 	if err := p.checkPost(ctx, postID); err != nil {
 		return nil, err
 	}
@@ -229,8 +303,9 @@ func (p Post) Vote(ctx context.Context, claims auth.Claims, postID string, vote
 			return nil, err
 		}
 	}
+	p.publishScore(ctx, postID, now)
 
-	pst, err := p.QueryByID(ctx, postID)
+	pst, err := p.QueryByID(ctx, claims, postID)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting post after voting")
 	}
@@ -239,7 +314,7 @@ func (p Post) Vote(ctx context.Context, claims auth.Claims, postID string, vote
 }
 
 // Unvote erases vote to the post from a single user
-func (p Post) Unvote(ctx context.Context, claims auth.Claims, postID string) (Info, error) {
+func (p Post) Unvote(ctx context.Context, claims auth.Claims, postID string, now time.Time) (Info, error) {
 	if err := p.checkPost(ctx, postID); err != nil {
 		return nil, err
 	}
@@ -254,8 +329,9 @@ func (p Post) Unvote(ctx context.Context, claims auth.Claims, postID string) (In
 	if err := p.deleteVote(ctx, postID, claims.User.ID); err != nil {
 		return nil, err
 	}
+	p.publishScore(ctx, postID, now)
 
-	pst, err := p.QueryByID(ctx, postID)
+	pst, err := p.QueryByID(ctx, claims, postID)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting post after voting")
 	}
@@ -270,11 +346,19 @@ func (p Post) CreateComment(
 		return nil, err
 	}
 
-	if err := p.createComment(ctx, uuid.New().String(), postID, claims.User.ID, nc.Text, now); err != nil {
+	if err := p.checkReply(ctx, claims, postID); err != nil {
+		return nil, err
+	}
+
+	commentID := uuid.New().String()
+	if err := p.createComment(ctx, commentID, postID, claims.User.ID, nc.Text, now); err != nil {
 		return InfoText{}, err
 	}
 
-	pst, err := p.QueryByID(ctx, postID)
+	p.notify(ctx, claims, postID, commentID, nc.Text, now)
+	p.publishComment(ctx, postID, commentID, now)
+
+	pst, err := p.QueryByID(ctx, claims, postID)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting post after creating comment")
 	}
@@ -283,7 +367,8 @@ func (p Post) CreateComment(
 }
 
 // DeleteComment deletes comment
-func (p Post) DeleteComment(ctx context.Context, claims auth.Claims, postID string, commentID string) (Info, error) {
+func (p Post) DeleteComment(
+	ctx context.Context, claims auth.Claims, postID string, commentID string, now time.Time) (Info, error) {
 	if err := p.checkPost(ctx, postID); err != nil {
 		return nil, err
 	}
@@ -298,8 +383,9 @@ func (p Post) DeleteComment(ctx context.Context, claims auth.Claims, postID stri
 	if err := p.deleteComment(ctx, commentID); err != nil {
 		return nil, err
 	}
+	p.publishCommentDeleted(ctx, postID, commentID, now)
 
-	pst, err := p.QueryByID(ctx, postID)
+	pst, err := p.QueryByID(ctx, claims, postID)
 	if err != nil {
 		return nil, errors.Wrap(err, "getting post after voting")
 	}
@@ -0,0 +1,294 @@
+package post_test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/community"
+	"github.com/cravtos/asperitas-backend/business/data/post"
+	"github.com/cravtos/asperitas-backend/business/data/preview"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+	"github.com/cravtos/asperitas-backend/foundation/unfurl"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/go-cmp/cmp"
+	"github.com/jmoiron/sqlx"
+)
+
+func TestLinkPost(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := post.New(log, db, pubsub.New(), nil)
+
+	t.Log("Given the need to share links.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen loading a link post back from the database.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "linker", now)
+
+			np := post.NewPost{
+				Type:     "link",
+				Title:    "Gophers",
+				Category: "programming",
+				URL:      "https://example.com/gophers",
+			}
+			created, err := p.Create(ctx, claims, np, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the post : %s.", tests.Failed, testID, err)
+			}
+			id := created.(post.InfoLink).ID
+
+			pi, err := p.QueryByID(ctx, claims, id)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get the post : %s.", tests.Failed, testID, err)
+			}
+			il, ok := pi.(post.InfoLink)
+			if !ok || il.Type != "link" || il.Payload != np.URL {
+				t.Fatalf("\t%s\tTest %d:\tShould get back a link post : got %#v.", tests.Failed, testID, pi)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back a link post.", tests.Success, testID)
+
+			posts, err := p.QueryByCat(ctx, auth.Claims{}, "programming")
+			if err != nil || len(posts) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to list the community : %v %v.", tests.Failed, testID, posts, err)
+			}
+			if _, ok := posts[0].(post.InfoLink); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould list a link post : got %#v.", tests.Failed, testID, posts[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould list a link post.", tests.Success, testID)
+		}
+	}
+}
+
+func TestLinkPreview(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	page := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><meta property="og:title" content="All about gophers"></head><body></body></html>`))
+	}))
+	defer page.Close()
+
+	p := post.New(log, db, pubsub.New(), nil)
+
+	t.Log("Given the need to show what linked pages are about.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the page of a link post was fetched.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "linker", now)
+
+			np := post.NewPost{
+				Type:     "link",
+				Title:    "Gophers",
+				Category: "programming",
+				URL:      page.URL + "/gophers",
+			}
+			created, err := p.Create(ctx, claims, np, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the post : %s.", tests.Failed, testID, err)
+			}
+
+			fetcher := unfurl.New(unfurl.Config{Timeout: 5 * time.Second, AllowPrivate: true})
+			if n, err := preview.New(log, db).RunPending(ctx, fetcher, now); err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould fetch the page : %d %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould fetch the page.", tests.Success, testID)
+
+			pi, err := p.QueryByID(ctx, claims, created.(post.InfoLink).ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to get the post : %s.", tests.Failed, testID, err)
+			}
+			il, ok := pi.(post.InfoLink)
+			if !ok || il.Preview == nil || il.Preview.Title == nil || *il.Preview.Title != "All about gophers" {
+				t.Fatalf("\t%s\tTest %d:\tShould show the preview with the post : got %#v.", tests.Failed, testID, pi)
+			}
+			t.Logf("\t%s\tTest %d:\tShould show the preview with the post.", tests.Success, testID)
+		}
+	}
+}
+
+func TestCanonicalizeLinks(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := post.New(log, db, pubsub.New(), nil)
+
+	t.Log("Given the need to find duplicates of links posted before URLs were canonicalized.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a post has its URL stored as it was submitted.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "linker", now)
+
+			np := post.NewPost{
+				Type:     "link",
+				Title:    "Gophers",
+				Category: "programming",
+				URL:      "HTTPS://Example.com/gophers/?utm_source=feed",
+			}
+			if _, err := p.Create(ctx, claims, np, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create the post : %s.", tests.Failed, testID, err)
+			}
+			// This is what migration 3.6 left behind.
+			if _, err := db.ExecContext(ctx, `UPDATE posts SET canonical_url = payload`); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to store the raw URL : %s.", tests.Failed, testID, err)
+			}
+
+			n, err := p.CanonicalizeLinks(ctx)
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould canonicalize the post : %d %v.", tests.Failed, testID, n, err)
+			}
+			if n, err := p.CanonicalizeLinks(ctx); err != nil || n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould leave it alone the next time : %d %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould canonicalize the post once.", tests.Success, testID)
+
+			np.URL = "https://example.com/gophers"
+			if _, err := p.Create(ctx, claims, np, now.Add(time.Hour)); err != post.ErrDuplicate {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the same link in another form : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse the same link in another form.", tests.Success, testID)
+		}
+	}
+}
+
+func TestVerifiedEmail(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := post.New(log, db, pubsub.New(), nil)
+
+	t.Log("Given the need to keep users without a verified email out of some communities.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the token was issued before the email changed.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			if err := community.New(log, db).SetRequireVerifiedEmail(ctx, "programming", true, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to require a verified email : %s.", tests.Failed, testID, err)
+			}
+
+			claims := newClaims(t, log, db, "changer", now)
+			if _, err := user.New(log, db).UpdateEmail(ctx, claims, user.UpdateEmail{Email: "changer@example.com"}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to change the email : %s.", tests.Failed, testID, err)
+			}
+			// The token still says the email is verified.
+			claims.User.Verified = true
+
+			np := post.NewPost{
+				Type:     "text",
+				Title:    "Gophers",
+				Category: "programming",
+				Text:     "Gophers are great.",
+			}
+			if _, err := p.Create(ctx, claims, np, now); err != post.ErrEmailNotVerified {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the post : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse the post.", tests.Success, testID)
+		}
+	}
+}
+
+func TestOverview(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	p := post.New(log, db, pubsub.New(), nil)
+
+	t.Log("Given the need to page through everything a user did.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user wrote posts and comments.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			claims := newClaims(t, log, db, "writer", now)
+
+			// Posts are written every hour, comments half an hour after them.
+			var want []string
+			for i, title := range []string{"First", "Second", "Third"} {
+				np := post.NewPost{
+					Type:     "text",
+					Title:    title,
+					Category: "programming",
+					Text:     "Gophers are great.",
+				}
+				created, err := p.Create(ctx, claims, np, now.Add(time.Duration(i)*time.Hour))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to create the post : %s.", tests.Failed, testID, err)
+				}
+				want = append([]string{title}, want...)
+
+				if i == 2 {
+					break
+				}
+				nc := post.NewComment{Text: "About " + title}
+				if _, err := p.CreateComment(ctx, claims, nc, created.(post.InfoText).ID, now.Add(time.Duration(i)*time.Hour+30*time.Minute)); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to comment : %s.", tests.Failed, testID, err)
+				}
+				want = append([]string{nc.Text}, want...)
+			}
+
+			var got []string
+			for page := 1; page <= 3; page++ {
+				activity, err := p.QueryOverview(ctx, auth.Claims{}, "writer", post.PageQuery{Page: page, Rows: 2, Sort: post.SortNew})
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to get page %d : %s.", tests.Failed, testID, page, err)
+				}
+				for _, a := range activity {
+					switch {
+					case a.Kind == post.KindComment && a.Comment != nil:
+						got = append(got, a.Comment.Body)
+					case a.Kind == post.KindPost && a.Post != nil:
+						got = append(got, a.Post.(post.InfoText).Title)
+					default:
+						t.Fatalf("\t%s\tTest %d:\tShould fill in each entry : got %#v.", tests.Failed, testID, a)
+					}
+				}
+			}
+
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould list everything newest first across pages. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list everything newest first across pages.", tests.Success, testID)
+		}
+	}
+}
+
+// newClaims creates a user and returns claims like the ones of a token issued
+// to them.
+func newClaims(t *testing.T, log *log.Logger, db *sqlx.DB, name string, now time.Time) auth.Claims {
+	usr, err := user.New(log, db).Create(context.Background(), user.NewUser{Name: name, Password: "gophers"}, now)
+	if err != nil {
+		t.Fatalf("creating user %s: %s", name, err)
+	}
+
+	return auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: now.Add(time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		User: auth.User{
+			Username: usr.Name,
+			ID:       usr.ID,
+		},
+	}
+}
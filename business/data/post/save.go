@@ -0,0 +1,196 @@
+package post
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// Save keeps the post in the saved items of the user. Saving it again does
+// nothing.
+func (p Post) Save(ctx context.Context, claims auth.Claims, postID string, now time.Time) (Info, error) {
+	if _, err := uuid.Parse(postID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if err := p.checkPost(ctx, postID); err != nil {
+		return nil, err
+	}
+
+	const q = `
+	INSERT INTO saves
+		(user_id, post_id, date_created)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+
+	p.log.Printf("%s: %s", "post.Save", database.Log(q, claims.User.ID, postID, now))
+
+	if _, err := p.db.ExecContext(ctx, q, claims.User.ID, postID, now); err != nil {
+		return nil, errors.Wrapf(err, "saving post %s", postID)
+	}
+
+	return p.QueryByID(ctx, claims, postID)
+}
+
+// Unsave removes the post from the saved items of the user.
+func (p Post) Unsave(ctx context.Context, claims auth.Claims, postID string) (Info, error) {
+	if _, err := uuid.Parse(postID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `DELETE FROM saves WHERE user_id = $1 AND post_id = $2 AND comment_id IS NULL`
+
+	p.log.Printf("%s: %s", "post.Unsave", database.Log(q, claims.User.ID, postID))
+
+	if _, err := p.db.ExecContext(ctx, q, claims.User.ID, postID); err != nil {
+		return nil, errors.Wrapf(err, "unsaving post %s", postID)
+	}
+
+	return p.QueryByID(ctx, claims, postID)
+}
+
+// SaveComment keeps the comment in the saved items of the user. Saving it
+// again does nothing.
+func (p Post) SaveComment(ctx context.Context, claims auth.Claims, postID string, commentID string, now time.Time) (Info, error) {
+	if err := p.checkComment(ctx, postID, commentID); err != nil {
+		return nil, err
+	}
+
+	const q = `
+	INSERT INTO saves
+		(user_id, post_id, comment_id, date_created)
+	VALUES
+		($1, $2, $3, $4)
+	ON CONFLICT DO NOTHING`
+
+	p.log.Printf("%s: %s", "post.SaveComment", database.Log(q, claims.User.ID, postID, commentID, now))
+
+	if _, err := p.db.ExecContext(ctx, q, claims.User.ID, postID, commentID, now); err != nil {
+		return nil, errors.Wrapf(err, "saving comment %s", commentID)
+	}
+
+	return p.QueryByID(ctx, claims, postID)
+}
+
+// UnsaveComment removes the comment from the saved items of the user.
+func (p Post) UnsaveComment(ctx context.Context, claims auth.Claims, postID string, commentID string) (Info, error) {
+	if _, err := uuid.Parse(postID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if _, err := uuid.Parse(commentID); err != nil {
+		return nil, ErrInvalidID
+	}
+
+	const q = `DELETE FROM saves WHERE user_id = $1 AND comment_id = $2`
+
+	p.log.Printf("%s: %s", "post.UnsaveComment", database.Log(q, claims.User.ID, commentID))
+
+	if _, err := p.db.ExecContext(ctx, q, claims.User.ID, commentID); err != nil {
+		return nil, errors.Wrapf(err, "unsaving comment %s", commentID)
+	}
+
+	return p.QueryByID(ctx, claims, postID)
+}
+
+// QuerySaved lists what the user saved, optionally only from one community.
+// It can be sorted by when items were saved, new or old.
+func (p Post) QuerySaved(ctx context.Context, claims auth.Claims, community string, pq PageQuery) ([]SavedItem, error) {
+	order, err := orderBy(pq.Sort, SortNew, SortOld)
+	if err != nil {
+		return nil, err
+	}
+
+	q := `
+	SELECT * FROM (
+		SELECT
+			s.post_id, s.comment_id, s.date_created, COALESCE(cm.user_id, p.user_id) AS user_id
+		FROM
+			saves AS s
+		JOIN
+			posts AS p ON p.post_id = s.post_id
+		LEFT JOIN
+			comments AS cm ON cm.comment_id = s.comment_id
+		WHERE
+			s.user_id = $1 AND ($2 = '' OR p.category = $2)
+	) AS saved
+	` + order + `
+	OFFSET $3 ROWS FETCH NEXT $4 ROWS ONLY`
+
+	p.log.Printf("%s: %s", "post.QuerySaved", database.Log(q, claims.User.ID, community, pq.offset(), pq.Rows))
+
+	var rows []struct {
+		PostID      string         `db:"post_id"`
+		CommentID   sql.NullString `db:"comment_id"`
+		DateCreated time.Time      `db:"date_created"`
+		UserID      string         `db:"user_id"`
+	}
+	if err := p.db.SelectContext(ctx, &rows, q, claims.User.ID, community, pq.offset(), pq.Rows); err != nil {
+		return nil, errors.Wrap(err, "selecting saved items")
+	}
+
+	saved := make([]SavedItem, 0, len(rows))
+	for _, r := range rows {
+		author, err := p.getAuthorByID(ctx, r.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		si := SavedItem{
+			DateSaved: r.DateCreated,
+		}
+
+		if r.CommentID.Valid {
+			uc, err := p.getUserComment(ctx, r.CommentID.String, author)
+			if err != nil {
+				return nil, err
+			}
+			uc.PersonalComment = &PersonalComment{
+				Saved:     true,
+				CanDelete: uc.Author.ID == claims.User.ID,
+			}
+			si.Kind = KindComment
+			si.Comment = &uc
+		} else {
+			post, err := p.getPostByID(ctx, r.PostID)
+			if err != nil {
+				return nil, err
+			}
+			si.Kind = KindPost
+			if si.Post, err = p.completeInfo(ctx, claims, post, author); err != nil {
+				return nil, err
+			}
+		}
+
+		saved = append(saved, si)
+	}
+	return saved, nil
+}
+
+// checkComment returns ErrCommentNotFound unless the comment was left on the
+// post.
+func (p Post) checkComment(ctx context.Context, postID string, commentID string) error {
+	if _, err := uuid.Parse(postID); err != nil {
+		return ErrInvalidID
+	}
+	if _, err := uuid.Parse(commentID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `SELECT COUNT(*) FROM comments WHERE comment_id = $1 AND post_id = $2`
+
+	p.log.Printf("%s: %s", "post.save.checkComment", database.Log(q, commentID, postID))
+
+	var exist int
+	if err := p.db.GetContext(ctx, &exist, q, commentID, postID); err != nil {
+		return errors.Wrap(err, "checking if comment exists")
+	}
+	if exist == 0 {
+		return ErrCommentNotFound
+	}
+	return nil
+}
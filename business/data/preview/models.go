@@ -0,0 +1,20 @@
+package preview
+
+import (
+	"time"
+)
+
+// Info is what the page a link post points to says about itself.
+type Info struct {
+	URL         string     `db:"url" json:"-"`
+	Title       *string    `db:"title" json:"title,omitempty"`
+	Description *string    `db:"description" json:"description,omitempty"`
+	Image       *string    `db:"image" json:"image,omitempty"`
+	SiteName    *string    `db:"site_name" json:"siteName,omitempty"`
+	Status      string     `db:"status" json:"-"`
+	Attempts    int        `db:"attempts" json:"-"`
+	Error       *string    `db:"error" json:"-"`
+	DateCreated time.Time  `db:"date_created" json:"-"`
+	DateNext    *time.Time `db:"date_next" json:"-"`
+	DateFetched *time.Time `db:"date_fetched" json:"fetched,omitempty"`
+}
@@ -0,0 +1,187 @@
+// Package preview keeps what the pages link posts point to say about
+// themselves.
+package preview
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/unfurl"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is used when the preview of a URL is requested but was not
+// fetched.
+var ErrNotFound = errors.New("preview not found")
+
+// Statuses of a preview.
+const (
+	StatusPending = "pending"
+	StatusReady   = "ready"
+	StatusFailed  = "failed"
+)
+
+const (
+	// maxAttempts is how many times a page is fetched before giving up.
+	maxAttempts = 3
+
+	// retryAfter is how long to wait before fetching a page again.
+	retryAfter = 10 * time.Minute
+
+	// lease is how long a page may be fetched before another worker tries
+	// it again, e.g. after the first one crashed.
+	lease = 2 * time.Minute
+)
+
+// Preview manages the set of API's for link preview access.
+type Preview struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Preview for api access.
+func New(log *log.Logger, db *sqlx.DB) Preview {
+	return Preview{
+		log: log,
+		db:  db,
+	}
+}
+
+// Request queues the page at url to be fetched. Pages are fetched once no
+// matter how many posts point to them.
+func (p Preview) Request(ctx context.Context, url string, now time.Time) error {
+	const q = `
+	INSERT INTO link_previews
+		(url, status, date_created, date_next)
+	VALUES
+		($1, $2, $3, $3)
+	ON CONFLICT (url) DO NOTHING`
+
+	p.log.Printf("%s: %s", "preview.Request", database.Log(q, url, StatusPending, now))
+
+	if _, err := p.db.ExecContext(ctx, q, url, StatusPending, now); err != nil {
+		return errors.Wrapf(err, "requesting preview of %s", url)
+	}
+	return nil
+}
+
+// QueryByURL gets the preview of the page at url once it is fetched.
+func (p Preview) QueryByURL(ctx context.Context, url string) (Info, error) {
+	const q = `SELECT * FROM link_previews WHERE url = $1 AND status = $2`
+
+	p.log.Printf("%s: %s", "preview.QueryByURL", database.Log(q, url, StatusReady))
+
+	var info Info
+	if err := p.db.GetContext(ctx, &info, q, url, StatusReady); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting preview of %s", url)
+	}
+	return info, nil
+}
+
+// RunPending fetches every page which is due with f. It returns how many
+// pages were fetched.
+func (p Preview) RunPending(ctx context.Context, f *unfurl.Fetcher, now time.Time) (int, error) {
+	var n int
+	for {
+		info, err := p.claim(ctx, now)
+		if err != nil {
+			if err == ErrNotFound {
+				return n, nil
+			}
+			return n, err
+		}
+
+		pv, err := f.Fetch(ctx, info.URL)
+		if err := p.record(ctx, info, pv, err, now); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// claim takes the page which is due the longest and leases it so no other
+// worker fetches it at the same time.
+func (p Preview) claim(ctx context.Context, now time.Time) (Info, error) {
+	const q = `
+	UPDATE
+		link_previews
+	SET
+		date_next = $2
+	WHERE
+		url = (
+			SELECT url FROM link_previews
+			WHERE status = $1 AND date_next <= $3
+			ORDER BY date_next
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+	RETURNING *`
+
+	leased := now.Add(lease)
+	p.log.Printf("%s: %s", "preview.claim", database.Log(q, StatusPending, leased, now))
+
+	var info Info
+	if err := p.db.GetContext(ctx, &info, q, StatusPending, leased, now); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrap(err, "claiming preview")
+	}
+	return info, nil
+}
+
+// record stores what was fetched. Pages which failed are fetched again
+// later until they run out of attempts. Pages which are not allowed to be
+// fetched at all are not tried again.
+func (p Preview) record(ctx context.Context, info Info, pv unfurl.Preview, fetchErr error, now time.Time) error {
+	attempts := info.Attempts + 1
+
+	if fetchErr == nil {
+		const q = `
+		UPDATE
+			link_previews
+		SET
+			title = NULLIF($2, ''), description = NULLIF($3, ''), image = NULLIF($4, ''), site_name = NULLIF($5, ''),
+			status = $6, attempts = $7, error = NULL, date_next = NULL, date_fetched = $8
+		WHERE
+			url = $1`
+
+		p.log.Printf("%s: %s", "preview.record", database.Log(q, info.URL, pv.Title, pv.Description, pv.Image, pv.SiteName, StatusReady, attempts, now))
+
+		if _, err := p.db.ExecContext(ctx, q, info.URL, pv.Title, pv.Description, pv.Image, pv.SiteName, StatusReady, attempts, now); err != nil {
+			return errors.Wrapf(err, "storing preview of %s", info.URL)
+		}
+		return nil
+	}
+
+	status := StatusPending
+	next := now.Add(retryAfter)
+	nextPtr := &next
+	switch {
+	case fetchErr == unfurl.ErrBlockedAddress, fetchErr == unfurl.ErrUnsupportedURL, attempts >= maxAttempts:
+		status = StatusFailed
+		nextPtr = nil
+	}
+
+	const q = `
+	UPDATE
+		link_previews
+	SET
+		status = $2, attempts = $3, error = $4, date_next = $5
+	WHERE
+		url = $1`
+
+	p.log.Printf("%s: %s", "preview.record", database.Log(q, info.URL, status, attempts, fetchErr.Error(), nextPtr))
+
+	if _, err := p.db.ExecContext(ctx, q, info.URL, status, attempts, fetchErr.Error(), nextPtr); err != nil {
+		return errors.Wrapf(err, "storing preview of %s", info.URL)
+	}
+	return nil
+}
@@ -78,4 +78,453 @@ CREATE TABLE comments (
 );`,
 		Description: "Create table comments",
 	},
+	{
+		Version:     1.4,
+		Description: "Create table two_factor",
+		Script: `
+CREATE TABLE two_factor (
+	user_id          UUID references users(user_id),
+	secret           TEXT,
+	enabled          BOOLEAN,
+	last_step        BIGINT,
+	date_created     TIMESTAMP,
+
+	PRIMARY KEY (user_id)
+);`,
+	},
+	{
+		Version:     1.5,
+		Description: "Create table recovery_codes",
+		Script: `
+CREATE TABLE recovery_codes (
+	code_hash        TEXT,
+	user_id          UUID references users(user_id),
+	date_created     TIMESTAMP,
+	date_used        TIMESTAMP,
+
+	PRIMARY KEY (code_hash)
+);`,
+	},
+	{
+		Version:     1.6,
+		Description: "Create table login_attempts",
+		Script: `
+CREATE TABLE login_attempts (
+	key              TEXT,
+	failures         INT,
+	locked_until     TIMESTAMP,
+	last_failure     TIMESTAMP,
+
+	PRIMARY KEY (key)
+);`,
+	},
+	{
+		Version:     1.7,
+		Description: "Make user names unique ignoring case",
+		Script: `
+UPDATE users SET name = name || '-' || left(user_id::text, 8)
+WHERE user_id IN (
+	SELECT user_id FROM (
+		SELECT user_id, row_number() OVER (PARTITION BY lower(name) ORDER BY date_created) AS n
+		FROM users
+	) AS named
+	WHERE n > 1
+);
+
+CREATE UNIQUE INDEX users_name_lower_idx ON users (lower(name));`,
+	},
+	{
+		Version:     1.8,
+		Description: "Create table sessions",
+		Script: `
+CREATE TABLE sessions (
+	session_id       UUID,
+	user_id          UUID references users(user_id),
+	user_agent       TEXT,
+	ip               TEXT,
+	date_created     TIMESTAMP,
+	date_expires     TIMESTAMP,
+	date_revoked     TIMESTAMP,
+
+	PRIMARY KEY (session_id)
+);
+
+CREATE INDEX sessions_user_id_idx ON sessions (user_id);`,
+	},
+	{
+		Version:     1.9,
+		Description: "Add email to users",
+		Script: `
+ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX users_email_lower_idx ON users (lower(email)) WHERE email <> '';`,
+	},
+	{
+		Version:     2.0,
+		Description: "Create table password_resets",
+		Script: `
+CREATE TABLE password_resets (
+	token_hash       TEXT,
+	user_id          UUID references users(user_id),
+	date_created     TIMESTAMP,
+	date_expires     TIMESTAMP,
+	date_used        TIMESTAMP,
+
+	PRIMARY KEY (token_hash)
+);`,
+	},
+	{
+		Version:     2.1,
+		Description: "Add email verification",
+		Script: `
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE email_verifications (
+	token_hash       TEXT,
+	user_id          UUID references users(user_id),
+	email            TEXT,
+	date_created     TIMESTAMP,
+	date_expires     TIMESTAMP,
+	date_used        TIMESTAMP,
+
+	PRIMARY KEY (token_hash)
+);`,
+	},
+	{
+		Version:     2.2,
+		Description: "Create table communities",
+		Script: `
+CREATE TABLE communities (
+	name                     TEXT,
+	require_verified_email   BOOLEAN NOT NULL DEFAULT false,
+	date_created             TIMESTAMP,
+
+	PRIMARY KEY (name)
+);`,
+	},
+	{
+		Version:     2.3,
+		Description: "Create table identities",
+		Script: `
+CREATE TABLE identities (
+	provider         TEXT,
+	subject          TEXT,
+	user_id          UUID references users(user_id),
+	email            TEXT,
+	date_created     TIMESTAMP,
+
+	PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX identities_user_id_idx ON identities (user_id);`,
+	},
+	{
+		Version:     2.4,
+		Description: "Create table oidc_logins",
+		Script: `
+CREATE TABLE oidc_logins (
+	state            TEXT,
+	provider         TEXT,
+	nonce            TEXT,
+	verifier         TEXT,
+	date_expires     TIMESTAMP,
+
+	PRIMARY KEY (state)
+);`,
+	},
+	{
+		Version:     2.5,
+		Description: "Add OAuth2 clients",
+		Script: `
+CREATE TABLE oauth_clients (
+	client_id        UUID,
+	secret_hash      TEXT NOT NULL DEFAULT '',
+	name             TEXT,
+	owner_id         UUID references users(user_id),
+	redirect_uris    TEXT[] NOT NULL DEFAULT '{}',
+	scopes           TEXT[] NOT NULL DEFAULT '{}',
+	confidential     BOOLEAN NOT NULL DEFAULT false,
+	date_created     TIMESTAMP,
+
+	PRIMARY KEY (client_id)
+);
+
+CREATE TABLE oauth_codes (
+	code_hash        TEXT,
+	client_id        UUID references oauth_clients(client_id),
+	user_id          UUID references users(user_id),
+	redirect_uri     TEXT,
+	scope            TEXT,
+	code_challenge   TEXT NOT NULL DEFAULT '',
+	date_created     TIMESTAMP,
+	date_expires     TIMESTAMP,
+	date_used        TIMESTAMP,
+
+	PRIMARY KEY (code_hash)
+);
+
+ALTER TABLE sessions ADD COLUMN client_id TEXT NOT NULL DEFAULT '';`,
+	},
+	{
+		Version:     2.6,
+		Description: "Create table api_keys",
+		Script: `
+CREATE TABLE api_keys (
+	key_id           UUID,
+	user_id          UUID references users(user_id),
+	name             TEXT,
+	prefix           TEXT,
+	key_hash         TEXT UNIQUE,
+	scopes           TEXT[] NOT NULL DEFAULT '{}',
+	rate_limit       INT,
+	date_created     TIMESTAMP,
+	date_expires     TIMESTAMP,
+	date_last_used   TIMESTAMP,
+	date_revoked     TIMESTAMP,
+
+	PRIMARY KEY (key_id)
+);
+
+CREATE INDEX api_keys_user_id_idx ON api_keys (user_id);`,
+	},
+	{
+		Version:     2.7,
+		Description: "Add user profiles and karma",
+		Script: `
+ALTER TABLE users
+	ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+	ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+	ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE karma (
+	user_id          UUID references users(user_id),
+	post_karma       INT NOT NULL DEFAULT 0,
+	comment_karma    INT NOT NULL DEFAULT 0,
+	date_updated     TIMESTAMP,
+
+	PRIMARY KEY (user_id)
+);`,
+	},
+	{
+		Version:     2.8,
+		Description: "Add scheduled deletion of users",
+		Script: `
+ALTER TABLE users ADD COLUMN date_deletion TIMESTAMP;`,
+	},
+	{
+		Version:     2.9,
+		Description: "Create table exports",
+		Script: `
+CREATE TABLE exports (
+	export_id        UUID,
+	user_id          UUID references users(user_id),
+	status           TEXT,
+	archive          BYTEA,
+	date_created     TIMESTAMP,
+	date_started     TIMESTAMP,
+	date_ready       TIMESTAMP,
+	date_expires     TIMESTAMP,
+
+	PRIMARY KEY (export_id)
+);
+
+CREATE UNIQUE INDEX exports_user_pending_idx ON exports (user_id) WHERE status IN ('pending', 'running');`,
+	},
+	{
+		Version:     3.0,
+		Description: "Create table saves",
+		Script: `
+CREATE TABLE saves (
+	user_id          UUID references users(user_id),
+	post_id          UUID references posts(post_id),
+	comment_id       UUID references comments(comment_id),
+	date_created     TIMESTAMP
+);
+
+CREATE UNIQUE INDEX saves_user_item_idx ON saves (user_id, COALESCE(comment_id, post_id));`,
+	},
+	{
+		Version:     3.1,
+		Description: "Add hidden posts and blocked users",
+		Script: `
+CREATE TABLE hidden_posts (
+	user_id          UUID references users(user_id),
+	post_id          UUID references posts(post_id),
+	date_created     TIMESTAMP,
+
+	PRIMARY KEY (user_id, post_id)
+);
+
+CREATE TABLE blocks (
+	user_id          UUID references users(user_id),
+	blocked_id       UUID references users(user_id),
+	date_created     TIMESTAMP,
+
+	PRIMARY KEY (user_id, blocked_id)
+);
+
+CREATE INDEX blocks_blocked_id_idx ON blocks (blocked_id);`,
+	},
+	{
+		Version:     3.2,
+		Description: "Add notifications",
+		Script: `
+CREATE TABLE notifications (
+	notification_id  UUID,
+	user_id          UUID references users(user_id),
+	kind             TEXT,
+	actor_id         UUID references users(user_id),
+	post_id          UUID,
+	comment_id       UUID,
+	body             TEXT,
+	date_created     TIMESTAMP,
+	date_read        TIMESTAMP,
+
+	PRIMARY KEY (notification_id)
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, date_created);`,
+	},
+	{
+		Version:     3.3,
+		Description: "Add private messages",
+		Script: `
+CREATE TABLE conversations (
+	conversation_id  UUID,
+	date_created     TIMESTAMP,
+	date_updated     TIMESTAMP,
+
+	PRIMARY KEY (conversation_id)
+);
+
+CREATE TABLE conversation_members (
+	conversation_id  UUID references conversations(conversation_id),
+	user_id          UUID references users(user_id),
+	date_read        TIMESTAMP,
+	date_deleted     TIMESTAMP,
+
+	PRIMARY KEY (conversation_id, user_id)
+);
+
+CREATE INDEX conversation_members_user_id_idx ON conversation_members (user_id);
+
+CREATE TABLE messages (
+	message_id       UUID,
+	conversation_id  UUID references conversations(conversation_id),
+	user_id          UUID references users(user_id),
+	body             TEXT,
+	date_created     TIMESTAMP,
+
+	PRIMARY KEY (message_id)
+);
+
+CREATE INDEX messages_conversation_id_idx ON messages (conversation_id, date_created);`,
+	},
+	{
+		Version:     3.4,
+		Description: "Add community owners and webhooks",
+		Script: `
+ALTER TABLE communities ADD COLUMN owner_id UUID references users(user_id);
+
+CREATE TABLE webhooks (
+	webhook_id       UUID,
+	community        TEXT,
+	url              TEXT,
+	secret           TEXT,
+	events           TEXT[],
+	failures         INT NOT NULL DEFAULT 0,
+	date_created     TIMESTAMP,
+	date_disabled    TIMESTAMP,
+
+	PRIMARY KEY (webhook_id)
+);
+
+CREATE INDEX webhooks_community_idx ON webhooks (community);
+
+CREATE TABLE webhook_deliveries (
+	delivery_id      UUID,
+	webhook_id       UUID references webhooks(webhook_id),
+	event            TEXT,
+	payload          JSONB,
+	status           TEXT,
+	attempts         INT NOT NULL DEFAULT 0,
+	response_code    INT,
+	error            TEXT,
+	date_created     TIMESTAMP,
+	date_next        TIMESTAMP,
+	date_delivered   TIMESTAMP,
+
+	PRIMARY KEY (delivery_id)
+);
+
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, date_created);
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (date_next) WHERE status = 'pending';`,
+	},
+	{
+		Version:     3.5,
+		Description: "Create table link_previews",
+		Script: `
+CREATE TABLE link_previews (
+	url              TEXT,
+	title            TEXT,
+	description      TEXT,
+	image            TEXT,
+	site_name        TEXT,
+	status           TEXT,
+	attempts         INT NOT NULL DEFAULT 0,
+	error            TEXT,
+	date_created     TIMESTAMP,
+	date_next        TIMESTAMP,
+	date_fetched     TIMESTAMP,
+
+	PRIMARY KEY (url)
+);
+
+CREATE INDEX link_previews_due_idx ON link_previews (date_next) WHERE status = 'pending';
+
+INSERT INTO link_previews
+	(url, status, date_created, date_next)
+SELECT DISTINCT
+	payload, 'pending', now() AT TIME ZONE 'utc', now() AT TIME ZONE 'utc'
+FROM
+	posts
+WHERE
+	type = 'link';`,
+	},
+	{
+		Version:     3.6,
+		Description: "Add canonical URLs of link posts",
+		Script: `
+ALTER TABLE posts ADD COLUMN canonical_url TEXT;
+
+UPDATE posts SET canonical_url = payload WHERE type = 'link';
+
+CREATE INDEX posts_canonical_url_idx ON posts (canonical_url, date_created) WHERE canonical_url IS NOT NULL;`,
+	},
+	{
+		Version:     3.7,
+		Description: "Create table media",
+		Script: `
+CREATE TABLE media (
+	media_id         UUID,
+	user_id          UUID references users(user_id),
+	key              TEXT,
+	thumbnail_key    TEXT,
+	content_type     TEXT,
+	width            INT,
+	height           INT,
+	size             INT,
+	date_created     TIMESTAMP,
+
+	PRIMARY KEY (media_id)
+);
+
+CREATE INDEX media_user_id_idx ON media (user_id, date_created);`,
+	},
+	{
+		Version:     3.8,
+		Description: "Add two-factor challenges",
+		Script: `
+ALTER TABLE two_factor ADD COLUMN challenge_id TEXT;`,
+	},
 }
@@ -71,5 +71,30 @@ func DeleteAll(db *sqlx.DB) error {
 
 // deleteAll is used to clean the database between tests.
 const deleteAll = `
+DELETE FROM media;
+DELETE FROM link_previews;
+DELETE FROM webhook_deliveries;
+DELETE FROM webhooks;
+DELETE FROM messages;
+DELETE FROM conversation_members;
+DELETE FROM conversations;
+DELETE FROM notifications;
+DELETE FROM blocks;
+DELETE FROM hidden_posts;
+DELETE FROM saves;
+DELETE FROM exports;
+DELETE FROM karma;
+DELETE FROM api_keys;
+DELETE FROM oauth_codes;
+DELETE FROM oauth_clients;
+DELETE FROM oidc_logins;
+DELETE FROM identities;
+DELETE FROM communities;
+DELETE FROM email_verifications;
+DELETE FROM password_resets;
+DELETE FROM sessions;
+DELETE FROM login_attempts;
+DELETE FROM recovery_codes;
+DELETE FROM two_factor;
 DELETE FROM posts;
 DELETE FROM users;`
@@ -0,0 +1,29 @@
+package session
+
+import (
+	"time"
+)
+
+// Info represents a single login of a user. Every token we issue belongs to
+// a session so it can be revoked before it expires.
+type Info struct {
+	ID          string     `db:"session_id" json:"id"`
+	UserID      string     `db:"user_id" json:"-"`
+	UserAgent   string     `db:"user_agent" json:"userAgent"`
+	IP          string     `db:"ip" json:"ip"`
+	DateCreated time.Time  `db:"date_created" json:"created"`
+	DateExpires time.Time  `db:"date_expires" json:"expires"`
+	DateRevoked *time.Time `db:"date_revoked" json:"revoked,omitempty"`
+	ClientID    string     `db:"client_id" json:"clientId,omitempty"`
+}
+
+// NewSession contains information needed to start a new session.
+type NewSession struct {
+	UserID      string
+	UserAgent   string
+	IP          string
+	DateExpires time.Time
+
+	// ClientID is set when the session was granted to an OAuth client.
+	ClientID string
+}
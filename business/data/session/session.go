@@ -0,0 +1,210 @@
+// Package session contains functionality to track and revoke issued tokens.
+package session
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a specific Session is requested but does not exist.
+	ErrNotFound = errors.New("session not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrRevoked occurs when a token of a revoked or expired session is used.
+	ErrRevoked = errors.New("session is no longer active")
+)
+
+// maxUserAgent limits how much of the User-Agent header is stored.
+const maxUserAgent = 256
+
+// Session manages the set of API's for session access.
+type Session struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Session for api access.
+func New(log *log.Logger, db *sqlx.DB) Session {
+	return Session{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create starts a new session for a user.
+func (s Session) Create(ctx context.Context, ns NewSession, now time.Time) (Info, error) {
+	if len(ns.UserAgent) > maxUserAgent {
+		ns.UserAgent = ns.UserAgent[:maxUserAgent]
+	}
+
+	ses := Info{
+		ID:          uuid.New().String(),
+		UserID:      ns.UserID,
+		UserAgent:   ns.UserAgent,
+		IP:          ns.IP,
+		DateCreated: now,
+		DateExpires: ns.DateExpires,
+		ClientID:    ns.ClientID,
+	}
+
+	const q = `
+	INSERT INTO sessions
+		(session_id, user_id, user_agent, ip, date_created, date_expires, client_id)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $7)`
+
+	s.log.Printf("%s: %s", "session.Create",
+		database.Log(q, ses.ID, ses.UserID, ses.UserAgent, ses.IP, ses.DateCreated, ses.DateExpires, ses.ClientID),
+	)
+
+	if _, err := s.db.ExecContext(ctx, q, ses.ID, ses.UserID, ses.UserAgent, ses.IP,
+		ses.DateCreated, ses.DateExpires, ses.ClientID); err != nil {
+		return Info{}, errors.Wrap(err, "inserting session")
+	}
+
+	return ses, nil
+}
+
+// Check returns ErrRevoked unless the session is known, not revoked and not
+// expired.
+func (s Session) Check(ctx context.Context, sessionID string, now time.Time) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrRevoked
+	}
+
+	const q = `
+	SELECT
+		COUNT(*)
+	FROM
+		sessions
+	WHERE
+		session_id = $1 AND date_revoked IS NULL AND date_expires > $2`
+
+	s.log.Printf("%s: %s", "session.Check", database.Log(q, sessionID, now))
+
+	var active int
+	if err := s.db.GetContext(ctx, &active, q, sessionID, now); err != nil {
+		return errors.Wrap(err, "checking session")
+	}
+
+	if active == 0 {
+		return ErrRevoked
+	}
+	return nil
+}
+
+// Query retrieves the active sessions of the user.
+func (s Session) Query(ctx context.Context, claims auth.Claims, now time.Time) ([]Info, error) {
+	const q = `
+	SELECT
+		*
+	FROM
+		sessions
+	WHERE
+		user_id = $1 AND date_revoked IS NULL AND date_expires > $2
+	ORDER BY
+		date_created DESC`
+
+	s.log.Printf("%s: %s", "session.Query", database.Log(q, claims.User.ID, now))
+
+	sessions := []Info{}
+	if err := s.db.SelectContext(ctx, &sessions, q, claims.User.ID, now); err != nil {
+		return nil, errors.Wrap(err, "selecting sessions")
+	}
+
+	return sessions, nil
+}
+
+// Revoke ends a single session of the user.
+func (s Session) Revoke(ctx context.Context, claims auth.Claims, sessionID string, now time.Time) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return ErrInvalidID
+	}
+
+	const q = `
+	UPDATE
+		sessions
+	SET
+		date_revoked = $3
+	WHERE
+		session_id = $1 AND user_id = $2 AND date_revoked IS NULL`
+
+	s.log.Printf("%s: %s", "session.Revoke", database.Log(q, sessionID, claims.User.ID, now))
+
+	res, err := s.db.ExecContext(ctx, q, sessionID, claims.User.ID, now)
+	if err != nil {
+		return errors.Wrapf(err, "revoking session %s", sessionID)
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every session of the user except the one with ID keep. Pass
+// an empty keep to end all of them.
+func (s Session) RevokeAll(ctx context.Context, userID string, keep string, now time.Time) error {
+	const q = `
+	UPDATE
+		sessions
+	SET
+		date_revoked = $3
+	WHERE
+		user_id = $1 AND session_id::text <> $2 AND date_revoked IS NULL`
+
+	s.log.Printf("%s: %s", "session.RevokeAll", database.Log(q, userID, keep, now))
+
+	if _, err := s.db.ExecContext(ctx, q, userID, keep, now); err != nil {
+		return errors.Wrapf(err, "revoking sessions of %s", userID)
+	}
+	return nil
+}
+
+// RevokeClient ends every session granted to the OAuth client.
+func (s Session) RevokeClient(ctx context.Context, clientID string, now time.Time) error {
+	const q = `
+	UPDATE
+		sessions
+	SET
+		date_revoked = $2
+	WHERE
+		client_id = $1 AND date_revoked IS NULL`
+
+	s.log.Printf("%s: %s", "session.RevokeClient", database.Log(q, clientID, now))
+
+	if _, err := s.db.ExecContext(ctx, q, clientID, now); err != nil {
+		return errors.Wrapf(err, "revoking sessions of client %s", clientID)
+	}
+	return nil
+}
+
+// QueryByID gets the specified session from the database.
+func (s Session) QueryByID(ctx context.Context, sessionID string) (Info, error) {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+
+	const q = `SELECT * FROM sessions WHERE session_id = $1`
+
+	s.log.Printf("%s: %s", "session.QueryByID", database.Log(q, sessionID))
+
+	var ses Info
+	if err := s.db.GetContext(ctx, &ses, q, sessionID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting session %q", sessionID)
+	}
+	return ses, nil
+}
@@ -0,0 +1,34 @@
+package twofactor
+
+import (
+	"time"
+)
+
+// info represents the two-factor settings of a single user in database.
+type info struct {
+	UserID      string    `db:"user_id"`
+	Secret      string    `db:"secret"`
+	Enabled     bool      `db:"enabled"`
+	LastStep    int64     `db:"last_step"`
+	DateCreated time.Time `db:"date_created"`
+	ChallengeID *string   `db:"challenge_id"`
+}
+
+// Enrollment is sent to user when they start setting up two-factor
+// authentication. The URI is meant to be rendered as a QR code.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes is sent to user once two-factor authentication is enabled.
+// The codes are never shown again.
+type RecoveryCodes struct {
+	Codes []string `json:"recoveryCodes"`
+}
+
+// Code is what we require from users when verifying a second factor. It
+// holds either a TOTP code or one of the recovery codes.
+type Code struct {
+	Code string `json:"code" validate:"required"`
+}
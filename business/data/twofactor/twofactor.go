@@ -0,0 +1,355 @@
+// Package twofactor contains TOTP based two-factor authentication
+// functionality.
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/totp"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotEnrolled occurs when user verifies a code before starting enrollment.
+	ErrNotEnrolled = errors.New("two-factor authentication is not set up")
+
+	// ErrAlreadyEnabled occurs when user tries to enroll a second time.
+	ErrAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+	// ErrInvalidCode occurs when the given code is wrong, expired or already used.
+	ErrInvalidCode = errors.New("invalid two-factor code")
+
+	// ErrInvalidChallenge occurs when a challenge was already used or replaced
+	// by a newer one.
+	ErrInvalidChallenge = errors.New("two-factor challenge was already used")
+)
+
+const (
+	// issuer is shown by authenticator apps next to the account name.
+	issuer = "Asperitas"
+
+	// skew is the number of time steps a code may be off by.
+	skew = 1
+
+	// recoveryCount is the number of recovery codes generated on enabling.
+	recoveryCount = 10
+
+	// recoveryAlphabet excludes characters which are easily confused.
+	recoveryAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+)
+
+// TwoFactor manages the set of API's for two-factor authentication.
+type TwoFactor struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a TwoFactor for api access.
+func New(log *log.Logger, db *sqlx.DB) TwoFactor {
+	return TwoFactor{
+		log: log,
+		db:  db,
+	}
+}
+
+// Enroll generates a new secret for the user. Two-factor authentication is
+// not enabled until the first code is confirmed.
+func (tf TwoFactor) Enroll(ctx context.Context, claims auth.Claims, now time.Time) (Enrollment, error) {
+	enabled, err := tf.Enabled(ctx, claims.User.ID)
+	if err != nil {
+		return Enrollment{}, err
+	}
+	if enabled {
+		return Enrollment{}, ErrAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return Enrollment{}, err
+	}
+
+	const q = `
+	INSERT INTO two_factor
+		(user_id, secret, enabled, last_step, date_created)
+	VALUES
+		($1, $2, false, 0, $3)
+	ON CONFLICT (user_id) DO UPDATE SET
+		secret = EXCLUDED.secret, last_step = 0, date_created = EXCLUDED.date_created`
+
+	tf.log.Printf("%s: %s", "twofactor.Enroll", database.Log(q, claims.User.ID, "***", now))
+
+	if _, err := tf.db.ExecContext(ctx, q, claims.User.ID, secret, now); err != nil {
+		return Enrollment{}, errors.Wrap(err, "inserting two-factor secret")
+	}
+
+	enr := Enrollment{
+		Secret: secret,
+		URI:    totp.URI(issuer, claims.User.Username, secret),
+	}
+	return enr, nil
+}
+
+// Confirm enables two-factor authentication once the user proves they have
+// set up their authenticator. It returns freshly generated recovery codes.
+func (tf TwoFactor) Confirm(ctx context.Context, claims auth.Claims, code string, now time.Time) (RecoveryCodes, error) {
+	tfa, err := tf.get(ctx, claims.User.ID)
+	if err != nil {
+		return RecoveryCodes{}, err
+	}
+	if tfa.Enabled {
+		return RecoveryCodes{}, ErrAlreadyEnabled
+	}
+
+	step, ok := totp.Validate(tfa.Secret, code, now, skew)
+	if !ok {
+		return RecoveryCodes{}, ErrInvalidCode
+	}
+
+	tx, err := tf.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return RecoveryCodes{}, errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const q = `UPDATE two_factor SET enabled = true, last_step = $2 WHERE user_id = $1 AND NOT enabled`
+
+	tf.log.Printf("%s: %s", "twofactor.Confirm", database.Log(q, claims.User.ID, step))
+
+	res, err := tx.ExecContext(ctx, q, claims.User.ID, step)
+	if err != nil {
+		return RecoveryCodes{}, errors.Wrap(err, "enabling two-factor")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return RecoveryCodes{}, ErrAlreadyEnabled
+	}
+
+	codes, err := tf.generateRecoveryCodes(ctx, tx, claims.User.ID, now)
+	if err != nil {
+		return RecoveryCodes{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return RecoveryCodes{}, errors.Wrap(err, "committing two-factor")
+	}
+	return RecoveryCodes{Codes: codes}, nil
+}
+
+// Disable turns two-factor authentication off after verifying a code.
+func (tf TwoFactor) Disable(ctx context.Context, claims auth.Claims, code string, now time.Time) error {
+	if err := tf.Verify(ctx, claims.User.ID, code, now); err != nil {
+		return err
+	}
+	return tf.Reset(ctx, claims.User.ID)
+}
+
+// Enabled shows whether user has two-factor authentication turned on.
+func (tf TwoFactor) Enabled(ctx context.Context, userID string) (bool, error) {
+	tfa, err := tf.get(ctx, userID)
+	if err != nil {
+		if err == ErrNotEnrolled {
+			return false, nil
+		}
+		return false, err
+	}
+	return tfa.Enabled, nil
+}
+
+// Verify checks the second factor of a user. The code may be a TOTP code
+// which was not used before or an unused recovery code.
+func (tf TwoFactor) Verify(ctx context.Context, userID string, code string, now time.Time) error {
+	tfa, err := tf.get(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !tfa.Enabled {
+		return ErrNotEnrolled
+	}
+
+	if step, ok := totp.Validate(tfa.Secret, code, now, skew); ok {
+		return tf.useStep(ctx, userID, step)
+	}
+
+	return tf.useRecoveryCode(ctx, userID, code, now)
+}
+
+// NewChallenge returns the ID of a challenge which lets the user enter their
+// second factor once. Issuing a challenge replaces the previous one.
+func (tf TwoFactor) NewChallenge(ctx context.Context, userID string) (string, error) {
+	challengeID := uuid.New().String()
+
+	const q = `UPDATE two_factor SET challenge_id = $2 WHERE user_id = $1`
+
+	tf.log.Printf("%s: %s", "twofactor.NewChallenge", database.Log(q, userID, challengeID))
+
+	if _, err := tf.db.ExecContext(ctx, q, userID, challengeID); err != nil {
+		return "", errors.Wrap(err, "storing challenge")
+	}
+	return challengeID, nil
+}
+
+// UseChallenge redeems a challenge issued by NewChallenge. It fails if the
+// challenge was used before, whether the code entered with it was right or
+// not.
+func (tf TwoFactor) UseChallenge(ctx context.Context, userID string, challengeID string) error {
+	const q = `UPDATE two_factor SET challenge_id = NULL WHERE user_id = $1 AND challenge_id = $2`
+
+	tf.log.Printf("%s: %s", "twofactor.UseChallenge", database.Log(q, userID, challengeID))
+
+	res, err := tf.db.ExecContext(ctx, q, userID, challengeID)
+	if err != nil {
+		return errors.Wrap(err, "using challenge")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+// Reset removes the two-factor settings and recovery codes of a user.
+func (tf TwoFactor) Reset(ctx context.Context, userID string) error {
+	const qCodes = `DELETE FROM recovery_codes WHERE user_id = $1`
+	tf.log.Printf("%s: %s", "twofactor.Reset", database.Log(qCodes, userID))
+	if _, err := tf.db.ExecContext(ctx, qCodes, userID); err != nil {
+		return errors.Wrapf(err, "deleting recovery codes of %s", userID)
+	}
+
+	const q = `DELETE FROM two_factor WHERE user_id = $1`
+	tf.log.Printf("%s: %s", "twofactor.Reset", database.Log(q, userID))
+	if _, err := tf.db.ExecContext(ctx, q, userID); err != nil {
+		return errors.Wrapf(err, "deleting two-factor settings of %s", userID)
+	}
+
+	return nil
+}
+
+// get obtains two-factor settings of a user from database.
+func (tf TwoFactor) get(ctx context.Context, userID string) (info, error) {
+	const q = `SELECT * FROM two_factor WHERE user_id = $1`
+
+	tf.log.Printf("%s: %s", "twofactor.get", database.Log(q, userID))
+
+	var tfa info
+	if err := tf.db.GetContext(ctx, &tfa, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return info{}, ErrNotEnrolled
+		}
+		return info{}, errors.Wrap(err, "selecting two-factor settings")
+	}
+	return tfa, nil
+}
+
+// useStep records the time step of an accepted code. It fails if the same or
+// a later step was used before so a code can not be replayed.
+func (tf TwoFactor) useStep(ctx context.Context, userID string, step int64) error {
+	const q = `UPDATE two_factor SET last_step = $2 WHERE user_id = $1 AND last_step < $2`
+
+	tf.log.Printf("%s: %s", "twofactor.useStep", database.Log(q, userID, step))
+
+	res, err := tf.db.ExecContext(ctx, q, userID, step)
+	if err != nil {
+		return errors.Wrap(err, "updating last used step")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// useRecoveryCode marks a recovery code as used. It fails if the code does
+// not exist or was already used.
+func (tf TwoFactor) useRecoveryCode(ctx context.Context, userID string, code string, now time.Time) error {
+	const q = `
+	UPDATE recovery_codes SET date_used = $3
+	WHERE user_id = $1 AND code_hash = $2 AND date_used IS NULL`
+
+	hash := hashRecoveryCode(code)
+	tf.log.Printf("%s: %s", "twofactor.useRecoveryCode", database.Log(q, userID, hash, now))
+
+	res, err := tf.db.ExecContext(ctx, q, userID, hash, now)
+	if err != nil {
+		return errors.Wrap(err, "updating recovery code")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// generateRecoveryCodes replaces recovery codes of a user with new ones
+// within tx. Only hashes of the codes are stored.
+func (tf TwoFactor) generateRecoveryCodes(ctx context.Context, tx *sqlx.Tx, userID string, now time.Time) ([]string, error) {
+	const qDelete = `DELETE FROM recovery_codes WHERE user_id = $1`
+	tf.log.Printf("%s: %s", "twofactor.generateRecoveryCodes", database.Log(qDelete, userID))
+	if _, err := tx.ExecContext(ctx, qDelete, userID); err != nil {
+		return nil, errors.Wrap(err, "deleting old recovery codes")
+	}
+
+	const qInsert = `
+	INSERT INTO recovery_codes
+		(code_hash, user_id, date_created)
+	VALUES
+		($1, $2, $3)`
+
+	codes := make([]string, 0, recoveryCount)
+	for i := 0; i < recoveryCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+
+		hash := hashRecoveryCode(code)
+		tf.log.Printf("%s: %s", "twofactor.generateRecoveryCodes", database.Log(qInsert, hash, userID, now))
+		if _, err := tx.ExecContext(ctx, qInsert, hash, userID, now); err != nil {
+			return nil, errors.Wrap(err, "inserting recovery code")
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a random code in the form xxxxx-xxxxx. Bytes which
+// would make some characters more likely than others are thrown away.
+func newRecoveryCode() (string, error) {
+	const length = 10
+	limit := 256 - 256%len(recoveryAlphabet)
+
+	var sb strings.Builder
+	b := make([]byte, length)
+	for n := 0; n < length; {
+		if _, err := rand.Read(b); err != nil {
+			return "", errors.Wrap(err, "reading random bytes")
+		}
+		for _, c := range b {
+			if int(c) >= limit || n == length {
+				continue
+			}
+			if n == length/2 {
+				sb.WriteByte('-')
+			}
+			sb.WriteByte(recoveryAlphabet[int(c)%len(recoveryAlphabet)])
+			n++
+		}
+	}
+	return sb.String(), nil
+}
+
+// hashRecoveryCode normalizes a recovery code the way users might type it and
+// returns its hex encoded SHA-256 hash. Codes carry enough entropy to not
+// need a slow hash.
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.Replace(code, "-", "", -1)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
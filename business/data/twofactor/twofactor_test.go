@@ -0,0 +1,99 @@
+package twofactor_test
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/twofactor"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/totp"
+)
+
+func TestTwoFactor(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	tf := twofactor.New(log, db)
+
+	t.Log("Given the need to protect accounts with a second factor.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen enabling two-factor authentication.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			usr, err := user.New(log, db).Create(ctx, user.NewUser{Name: "careful", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			claims := auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}
+
+			enr, err := tf.Enroll(ctx, claims, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enroll : %s.", tests.Failed, testID, err)
+			}
+			code, err := totp.Code(enr.Secret, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to compute a code : %s.", tests.Failed, testID, err)
+			}
+
+			rc, err := tf.Confirm(ctx, claims, code, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to confirm : %s.", tests.Failed, testID, err)
+			}
+			form := regexp.MustCompile(`^[a-z2-9]{5}-[a-z2-9]{5}$`)
+			for _, c := range rc.Codes {
+				if !form.MatchString(c) {
+					t.Fatalf("\t%s\tTest %d:\tShould get recovery codes in the form xxxxx-xxxxx : got %q.", tests.Failed, testID, c)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould get recovery codes.", tests.Success, testID)
+
+			if _, err := tf.Confirm(ctx, claims, code, now); err != twofactor.ErrAlreadyEnabled {
+				t.Fatalf("\t%s\tTest %d:\tShould not confirm twice : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not confirm twice.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen exchanging a challenge.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			usr, err := user.New(log, db).Create(ctx, user.NewUser{Name: "challenged", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			if _, err := tf.Enroll(ctx, auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enroll : %s.", tests.Failed, testID, err)
+			}
+
+			first, err := tf.NewChallenge(ctx, usr.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a challenge : %s.", tests.Failed, testID, err)
+			}
+			second, err := tf.NewChallenge(ctx, usr.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a challenge : %s.", tests.Failed, testID, err)
+			}
+			if err := tf.UseChallenge(ctx, usr.ID, first); err != twofactor.ErrInvalidChallenge {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a replaced challenge : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a replaced challenge.", tests.Success, testID)
+
+			if err := tf.UseChallenge(ctx, usr.ID, second); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the challenge : %v.", tests.Failed, testID, err)
+			}
+			if err := tf.UseChallenge(ctx, usr.ID, second); err != twofactor.ErrInvalidChallenge {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the challenge only once : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the challenge only once.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// ErrBlockSelf occurs when a user tries to block themselves.
+var ErrBlockSelf = errors.New("users cannot block themselves")
+
+// Block stops the user with given name from reaching the user the claims
+// belong to, and hides their content from them. Blocking again does nothing.
+func (u User) Block(ctx context.Context, claims auth.Claims, name string, now time.Time) error {
+	usr, err := u.Lookup(ctx, name)
+	if err != nil {
+		return err
+	}
+	if usr.ID == claims.User.ID {
+		return ErrBlockSelf
+	}
+
+	const q = `
+	INSERT INTO blocks
+		(user_id, blocked_id, date_created)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT DO NOTHING`
+
+	u.log.Printf("%s: %s", "user.Block", database.Log(q, claims.User.ID, usr.ID, now))
+
+	if _, err := u.db.ExecContext(ctx, q, claims.User.ID, usr.ID, now); err != nil {
+		return errors.Wrapf(err, "blocking user %s", usr.ID)
+	}
+	return nil
+}
+
+// Unblock lifts the block of the user with given name.
+func (u User) Unblock(ctx context.Context, claims auth.Claims, name string) error {
+	usr, err := u.Lookup(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	const q = `DELETE FROM blocks WHERE user_id = $1 AND blocked_id = $2`
+
+	u.log.Printf("%s: %s", "user.Unblock", database.Log(q, claims.User.ID, usr.ID))
+
+	if _, err := u.db.ExecContext(ctx, q, claims.User.ID, usr.ID); err != nil {
+		return errors.Wrapf(err, "unblocking user %s", usr.ID)
+	}
+	return nil
+}
+
+// QueryBlocked lists the users blocked by the user the claims belong to.
+func (u User) QueryBlocked(ctx context.Context, claims auth.Claims) ([]Blocked, error) {
+	const q = `
+	SELECT
+		u.name, b.date_created
+	FROM
+		blocks AS b
+	JOIN
+		users AS u ON u.user_id = b.blocked_id
+	WHERE
+		b.user_id = $1
+	ORDER BY
+		b.date_created DESC`
+
+	u.log.Printf("%s: %s", "user.QueryBlocked", database.Log(q, claims.User.ID))
+
+	blocked := []Blocked{}
+	if err := u.db.SelectContext(ctx, &blocked, q, claims.User.ID); err != nil {
+		return nil, errors.Wrap(err, "selecting blocked users")
+	}
+	return blocked, nil
+}
+
+// IsBlocked tells whether the user with ID blockerID blocked the user with ID
+// userID.
+func (u User) IsBlocked(ctx context.Context, blockerID string, userID string) (bool, error) {
+	const q = `SELECT EXISTS (SELECT 1 FROM blocks WHERE user_id = $1 AND blocked_id = $2)`
+
+	u.log.Printf("%s: %s", "user.IsBlocked", database.Log(q, blockerID, userID))
+
+	var blocked bool
+	if err := u.db.GetContext(ctx, &blocked, q, blockerID, userID); err != nil {
+		return false, errors.Wrap(err, "checking block")
+	}
+	return blocked, nil
+}
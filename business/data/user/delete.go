@@ -0,0 +1,148 @@
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// DeletedID is the user content of deleted users is moved to.
+	DeletedID = "00000000-0000-0000-0000-000000000000"
+
+	// DeletedName is shown as the author of content of deleted users.
+	DeletedName = "[deleted]"
+)
+
+// purgeStatements remove everything of the user $1 but their posts, comments,
+// messages and images, which are moved to the DeletedID user. Tables
+// referencing users have to be listed here.
+var purgeStatements = []string{
+	`UPDATE posts SET user_id = '` + DeletedID + `' WHERE user_id = $1`,
+	`UPDATE comments SET user_id = '` + DeletedID + `' WHERE user_id = $1`,
+	`DELETE FROM votes WHERE user_id = $1`,
+	`DELETE FROM saves WHERE user_id = $1`,
+	`DELETE FROM hidden_posts WHERE user_id = $1`,
+	`DELETE FROM blocks WHERE user_id = $1 OR blocked_id = $1`,
+	`DELETE FROM sessions WHERE user_id = $1`,
+	`DELETE FROM recovery_codes WHERE user_id = $1`,
+	`DELETE FROM two_factor WHERE user_id = $1`,
+	`DELETE FROM password_resets WHERE user_id = $1`,
+	`DELETE FROM email_verifications WHERE user_id = $1`,
+	`DELETE FROM identities WHERE user_id = $1`,
+	`DELETE FROM api_keys WHERE user_id = $1`,
+	`DELETE FROM sessions WHERE client_id IN (SELECT client_id::text FROM oauth_clients WHERE owner_id = $1)`,
+	`DELETE FROM oauth_codes WHERE user_id = $1 OR client_id IN (SELECT client_id FROM oauth_clients WHERE owner_id = $1)`,
+	`DELETE FROM oauth_clients WHERE owner_id = $1`,
+	`DELETE FROM karma WHERE user_id = $1`,
+	`DELETE FROM exports WHERE user_id = $1`,
+	`DELETE FROM login_attempts WHERE key = (SELECT 'user:' || lower(name) FROM users WHERE user_id = $1)`,
+	`UPDATE messages SET user_id = '` + DeletedID + `' WHERE user_id = $1`,
+	`DELETE FROM conversation_members WHERE user_id = $1`,
+	`UPDATE communities SET owner_id = NULL WHERE owner_id = $1`,
+	`UPDATE media SET user_id = '` + DeletedID + `' WHERE user_id = $1`,
+	`DELETE FROM notifications WHERE user_id = $1`,
+	`UPDATE notifications SET actor_id = '` + DeletedID + `' WHERE actor_id = $1`,
+	`DELETE FROM users WHERE user_id = $1`,
+}
+
+// ScheduleDeletion marks the user the claims belong to for deletion once the
+// grace period is over. The password has to be confirmed. Logging in before
+// that cancels the deletion.
+func (u User) ScheduleDeletion(ctx context.Context, claims auth.Claims, da DeleteAccount, grace time.Duration, now time.Time) (time.Time, error) {
+	usr, err := u.QueryByID(ctx, claims, claims.User.ID)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(da.Password)); err != nil {
+		return time.Time{}, ErrAuthenticationFailure
+	}
+
+	deletion := now.Add(grace)
+
+	const q = `UPDATE users SET date_deletion = $2 WHERE user_id = $1`
+
+	u.log.Printf("%s: %s", "user.ScheduleDeletion", database.Log(q, usr.ID, deletion))
+
+	if _, err := u.db.ExecContext(ctx, q, usr.ID, deletion); err != nil {
+		return time.Time{}, errors.Wrapf(err, "scheduling deletion of user %s", usr.ID)
+	}
+
+	return deletion, nil
+}
+
+// CancelDeletion keeps the user if their deletion is scheduled but did not
+// happen yet. It reports whether there was a deletion to cancel.
+func (u User) CancelDeletion(ctx context.Context, userID string, now time.Time) (bool, error) {
+	const q = `UPDATE users SET date_deletion = NULL WHERE user_id = $1 AND date_deletion > $2`
+
+	u.log.Printf("%s: %s", "user.CancelDeletion", database.Log(q, userID, now))
+
+	res, err := u.db.ExecContext(ctx, q, userID, now)
+	if err != nil {
+		return false, errors.Wrapf(err, "cancelling deletion of user %s", userID)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "counting cancelled deletions")
+	}
+	return n > 0, nil
+}
+
+// Purge deletes every user whose grace period is over. It returns how many
+// users were deleted.
+func (u User) Purge(ctx context.Context, now time.Time) (int, error) {
+	const q = `SELECT user_id FROM users WHERE date_deletion <= $1`
+
+	u.log.Printf("%s: %s", "user.Purge", database.Log(q, now))
+
+	var ids []string
+	if err := u.db.SelectContext(ctx, &ids, q, now); err != nil {
+		return 0, errors.Wrap(err, "selecting users to delete")
+	}
+
+	for i, id := range ids {
+		if err := u.purge(ctx, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+// purge removes the user and their personal data in one transaction.
+func (u User) purge(ctx context.Context, userID string) error {
+	tx, err := u.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "starting transaction")
+	}
+	defer tx.Rollback()
+
+	// Content needs an author to be moved to.
+	const qDeleted = `
+	INSERT INTO users
+		(user_id, name, password_hash, date_created)
+	VALUES
+		($1, $2, '', $3)
+	ON CONFLICT DO NOTHING`
+
+	u.log.Printf("%s: %s", "user.purge", database.Log(qDeleted, DeletedID, DeletedName, time.Time{}))
+
+	if _, err := tx.ExecContext(ctx, qDeleted, DeletedID, DeletedName, time.Time{}); err != nil {
+		return errors.Wrap(err, "creating deleted user")
+	}
+
+	for _, q := range purgeStatements {
+		u.log.Printf("%s: %s", "user.purge", database.Log(q, userID))
+
+		if _, err := tx.ExecContext(ctx, q, userID); err != nil {
+			return errors.Wrapf(err, "purging user %s", userID)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,133 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNoEmail occurs when verification is requested by a user without email.
+	ErrNoEmail = errors.New("no email address set")
+
+	// ErrAlreadyVerified occurs when verification is requested for an email
+	// which is verified already.
+	ErrAlreadyVerified = errors.New("email address is already verified")
+)
+
+// verificationTTL is how long an email verification token stays valid.
+const verificationTTL = 48 * time.Hour
+
+// UpdateEmail sets a new email of the user. The email has to be verified
+// again afterwards.
+func (u User) UpdateEmail(ctx context.Context, claims auth.Claims, ue UpdateEmail) (Info, error) {
+	email := strings.TrimSpace(ue.Email)
+
+	const q = `
+	UPDATE
+		users
+	SET
+		email = $2, email_verified = false
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s", "user.UpdateEmail", database.Log(q, claims.User.ID, email))
+
+	if _, err := u.db.ExecContext(ctx, q, claims.User.ID, email); err != nil {
+		if _, ok := database.UniqueViolation(err); ok {
+			return Info{}, ErrDuplicateEmail
+		}
+		return Info{}, errors.Wrapf(err, "updating email of %s", claims.User.ID)
+	}
+
+	return u.QueryByID(ctx, claims, claims.User.ID)
+}
+
+// RequestVerification creates a token which proves the user owns their
+// current email once it is sent back. It returns the token together with the
+// user it should be delivered to.
+func (u User) RequestVerification(ctx context.Context, userID string, now time.Time) (string, Info, error) {
+	const qUser = `SELECT * FROM users WHERE user_id = $1`
+
+	u.log.Printf("%s: %s", "user.RequestVerification", database.Log(qUser, userID))
+
+	var usr Info
+	if err := u.db.GetContext(ctx, &usr, qUser, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", Info{}, ErrNotFound
+		}
+		return "", Info{}, errors.Wrapf(err, "selecting user %q", userID)
+	}
+
+	switch {
+	case usr.Email == "":
+		return "", Info{}, ErrNoEmail
+	case usr.Verified:
+		return "", Info{}, ErrAlreadyVerified
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return "", Info{}, err
+	}
+
+	const q = `
+	INSERT INTO email_verifications
+		(token_hash, user_id, email, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4, $5)`
+
+	expires := now.Add(verificationTTL)
+	u.log.Printf("%s: %s", "user.RequestVerification", database.Log(q, hash, usr.ID, usr.Email, now, expires))
+
+	if _, err := u.db.ExecContext(ctx, q, hash, usr.ID, usr.Email, now, expires); err != nil {
+		return "", Info{}, errors.Wrap(err, "inserting verification token")
+	}
+
+	return token, usr, nil
+}
+
+// VerifyEmail marks the email of a user as verified using a token created by
+// RequestVerification. Tokens issued for a previous email of the user do not
+// work.
+func (u User) VerifyEmail(ctx context.Context, ve VerifyEmail, now time.Time) (Info, error) {
+	hash := hashToken(ve.Token)
+
+	const qUse = `
+	UPDATE
+		email_verifications ev
+	SET
+		date_used = $2
+	FROM
+		users u
+	WHERE
+		ev.token_hash = $1 AND ev.date_used IS NULL AND ev.date_expires > $2
+		AND u.user_id = ev.user_id AND lower(u.email) = lower(ev.email)
+	RETURNING
+		ev.user_id`
+
+	u.log.Printf("%s: %s", "user.VerifyEmail", database.Log(qUse, hash, now))
+
+	var userID string
+	if err := u.db.GetContext(ctx, &userID, qUse, hash, now); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrInvalidToken
+		}
+		return Info{}, errors.Wrap(err, "using verification token")
+	}
+
+	const q = `UPDATE users SET email_verified = true WHERE user_id = $1 RETURNING *`
+
+	u.log.Printf("%s: %s", "user.VerifyEmail", database.Log(q, userID))
+
+	var usr Info
+	if err := u.db.GetContext(ctx, &usr, q, userID); err != nil {
+		return Info{}, errors.Wrapf(err, "verifying email of %s", userID)
+	}
+	return usr, nil
+}
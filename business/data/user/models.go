@@ -10,10 +10,86 @@ type Info struct {
 	Name         string    `db:"name" json:"name"`
 	PasswordHash []byte    `db:"password_hash" json:"-"`
 	DateCreated  time.Time `db:"date_created" json:"date_created"`
+	Email        string    `db:"email" json:"email,omitempty"`
+	Verified     bool      `db:"email_verified" json:"emailVerified"`
+	DisplayName  string    `db:"display_name" json:"displayName"`
+	Bio          string    `db:"bio" json:"bio"`
+	AvatarURL    string    `db:"avatar_url" json:"avatarUrl"`
+
+	// DateDeletion is set while the user waits to be deleted.
+	DateDeletion *time.Time `db:"date_deletion" json:"deletion,omitempty"`
 }
 
 // NewUser contains information needed to create a new User.
 type NewUser struct {
 	Name     string `json:"username" validate:"required"`
 	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"omitempty,email"`
+
+	// Verified marks the email as already verified, e.g. by an identity
+	// provider. Clients can never set it.
+	Verified bool `json:"-"`
+}
+
+// UpdateEmail contains information needed to change email of a User.
+type UpdateEmail struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// VerifyEmail contains the token sent to a User to verify their email.
+type VerifyEmail struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// ChangePassword contains information needed to change password of a User.
+type ChangePassword struct {
+	Current string `json:"currentPassword" validate:"required"`
+	New     string `json:"newPassword" validate:"required"`
+}
+
+// DeleteAccount contains the password a User confirms deletion with.
+type DeleteAccount struct {
+	Password string `json:"password" validate:"required"`
+}
+
+// ForgotPassword contains information needed to request a password reset.
+type ForgotPassword struct {
+	Name string `json:"username" validate:"required"`
+}
+
+// ResetPassword contains information needed to set a new password using a
+// reset token.
+type ResetPassword struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// Karma is the sum of votes other users gave to the content of a user.
+type Karma struct {
+	Post    int `db:"post_karma" json:"post"`
+	Comment int `db:"comment_karma" json:"comment"`
+}
+
+// Profile is what everyone can see about a User.
+type Profile struct {
+	Name        string    `json:"username"`
+	DisplayName string    `json:"displayName"`
+	Bio         string    `json:"bio"`
+	AvatarURL   string    `json:"avatarUrl"`
+	DateCreated time.Time `json:"created"`
+	Karma       Karma     `json:"karma"`
+}
+
+// Blocked is a user blocked by another one.
+type Blocked struct {
+	Name        string    `db:"name" json:"username"`
+	DateCreated time.Time `db:"date_created" json:"blocked"`
+}
+
+// UpdateProfile contains the profile fields a User changes. Fields left out
+// stay as they are, empty strings clear them.
+type UpdateProfile struct {
+	DisplayName *string `json:"displayName" validate:"omitempty,max=50"`
+	Bio         *string `json:"bio" validate:"omitempty,max=500"`
+	AvatarURL   *string `json:"avatarUrl" validate:"omitempty,max=2048"`
 }
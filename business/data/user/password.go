@@ -0,0 +1,158 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// resetTTL is how long a password reset token stays valid.
+const resetTTL = time.Hour
+
+// ChangePassword replaces the password of the user after verifying their
+// current one. The new password is checked against the policy.
+func (u User) ChangePassword(ctx context.Context, claims auth.Claims, policy Policy, cp ChangePassword, now time.Time) error {
+	usr, err := u.QueryByID(ctx, claims, claims.User.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := bcrypt.CompareHashAndPassword(usr.PasswordHash, []byte(cp.Current)); err != nil {
+		return ErrAuthenticationFailure
+	}
+
+	if err := policy.ValidatePassword(usr.Name, cp.New); err != nil {
+		return err
+	}
+
+	return u.setPassword(ctx, usr.ID, cp.New)
+}
+
+// RequestReset creates a single-use token which allows to set a new password
+// for the user with the given name. It returns the token together with the
+// user it should be delivered to. Only a hash of the token is stored.
+func (u User) RequestReset(ctx context.Context, name string, now time.Time) (string, Info, error) {
+	usr, err := u.Lookup(ctx, name)
+	if err != nil {
+		return "", Info{}, err
+	}
+	// Only a verified email proves the account belongs to its owner.
+	if usr.Email == "" || !usr.Verified {
+		return "", Info{}, ErrNotFound
+	}
+
+	token, hash, err := newToken()
+	if err != nil {
+		return "", Info{}, err
+	}
+
+	const q = `
+	INSERT INTO password_resets
+		(token_hash, user_id, date_created, date_expires)
+	VALUES
+		($1, $2, $3, $4)`
+
+	u.log.Printf("%s: %s", "user.RequestReset", database.Log(q, hash, usr.ID, now, now.Add(resetTTL)))
+
+	if _, err := u.db.ExecContext(ctx, q, hash, usr.ID, now, now.Add(resetTTL)); err != nil {
+		return "", Info{}, errors.Wrap(err, "inserting reset token")
+	}
+
+	return token, usr, nil
+}
+
+// ResetPassword sets a new password using a token created by RequestReset.
+// The token can only be used once and all other tokens of the user stop
+// working. It returns the user whose password was changed.
+func (u User) ResetPassword(ctx context.Context, policy Policy, rp ResetPassword, now time.Time) (Info, error) {
+	hash := hashToken(rp.Token)
+
+	const qUser = `
+	SELECT
+		u.*
+	FROM
+		password_resets pr JOIN users u USING (user_id)
+	WHERE
+		pr.token_hash = $1 AND pr.date_used IS NULL AND pr.date_expires > $2`
+
+	u.log.Printf("%s: %s", "user.ResetPassword", database.Log(qUser, hash, now))
+
+	var usr Info
+	if err := u.db.GetContext(ctx, &usr, qUser, hash, now); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrInvalidToken
+		}
+		return Info{}, errors.Wrap(err, "selecting reset token")
+	}
+
+	if err := policy.ValidatePassword(usr.Name, rp.Password); err != nil {
+		return Info{}, err
+	}
+
+	const qUse = `
+	UPDATE
+		password_resets
+	SET
+		date_used = $2
+	WHERE
+		user_id = $1 AND date_used IS NULL`
+
+	u.log.Printf("%s: %s", "user.ResetPassword", database.Log(qUse, usr.ID, now))
+
+	res, err := u.db.ExecContext(ctx, qUse, usr.ID, now)
+	if err != nil {
+		return Info{}, errors.Wrap(err, "using reset token")
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return Info{}, ErrInvalidToken
+	}
+
+	if err := u.setPassword(ctx, usr.ID, rp.Password); err != nil {
+		return Info{}, err
+	}
+	return usr, nil
+}
+
+// setPassword stores a hash of the new password of a user.
+func (u User) setPassword(ctx context.Context, userID string, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return errors.Wrap(err, "generating password hash")
+	}
+
+	const q = `UPDATE users SET password_hash = $2 WHERE user_id = $1`
+
+	u.log.Printf("%s: %s", "user.setPassword", database.Log(q, userID, "***"))
+
+	if _, err := u.db.ExecContext(ctx, q, userID, hash); err != nil {
+		return errors.Wrapf(err, "updating password of %s", userID)
+	}
+	return nil
+}
+
+// newToken returns a random URL safe token and the hash under which it
+// should be stored.
+func newToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", errors.Wrap(err, "reading random bytes")
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, hashToken(token), nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a token. Tokens carry
+// enough entropy to not need a slow hash.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
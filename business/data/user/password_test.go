@@ -0,0 +1,141 @@
+package user_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+)
+
+func TestChangePassword(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	u := user.New(log, db)
+	s := session.New(log, db)
+	policy := user.DefaultPolicy()
+
+	t.Log("Given the need to let users change their password.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user changes their password.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			usr, err := u.Create(ctx, user.NewUser{Name: "changer", Password: "gophers1"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+
+			var sessions []session.Info
+			for i := 0; i < 2; i++ {
+				ses, err := s.Create(ctx, session.NewSession{UserID: usr.ID, DateExpires: now.Add(time.Hour)}, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to start a session : %s.", tests.Failed, testID, err)
+				}
+				sessions = append(sessions, ses)
+			}
+			claims := auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}
+			claims.Id = sessions[0].ID
+
+			cp := user.ChangePassword{Current: "wrong password", New: "goroutines"}
+			if err := u.ChangePassword(ctx, claims, policy, cp, now); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a wrong current password : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a wrong current password.", tests.Success, testID)
+
+			cp.Current = "gophers1"
+			if err := u.ChangePassword(ctx, claims, policy, cp, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to change the password : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, "changer", "goroutines", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould log in with the new password : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, "changer", "gophers1", now); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould not log in with the old password : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould only log in with the new password.", tests.Success, testID)
+
+			// The handler keeps only the session which changed the password.
+			if err := s.RevokeAll(ctx, usr.ID, claims.Id, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the other sessions : %s.", tests.Failed, testID, err)
+			}
+			if err := s.Check(ctx, sessions[0].ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the current session : %v.", tests.Failed, testID, err)
+			}
+			if err := s.Check(ctx, sessions[1].ID, now); err != session.ErrRevoked {
+				t.Fatalf("\t%s\tTest %d:\tShould revoke the other sessions : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould revoke the other sessions.", tests.Success, testID)
+		}
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	u := user.New(log, db)
+	policy := user.DefaultPolicy()
+
+	t.Log("Given the need to let users who forgot their password choose a new one.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user resets their password.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			nu := user.NewUser{Name: "forgetful", Password: "gophers1", Email: "forgetful@example.com", Verified: true}
+			if _, err := u.Create(ctx, nu, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			nu = user.NewUser{Name: "unverified", Password: "gophers1", Email: "unverified@example.com"}
+			if _, err := u.Create(ctx, nu, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+
+			if _, _, err := u.RequestReset(ctx, "unverified", now); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not send resets to unverified emails : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not send resets to unverified emails.", tests.Success, testID)
+
+			first, _, err := u.RequestReset(ctx, "forgetful", now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to request a reset : %s.", tests.Failed, testID, err)
+			}
+			second, usr, err := u.RequestReset(ctx, "forgetful", now)
+			if err != nil || usr.Email != "forgetful@example.com" {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to request a reset : %v.", tests.Failed, testID, err)
+			}
+
+			rp := user.ResetPassword{Token: second, Password: "goroutines"}
+			if _, err := u.ResetPassword(ctx, policy, rp, now.Add(time.Hour)); err != user.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse an expired token : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse an expired token.", tests.Success, testID)
+
+			if _, err := u.ResetPassword(ctx, policy, rp, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset the password : %s.", tests.Failed, testID, err)
+			}
+			if _, err := u.Authenticate(ctx, "forgetful", "goroutines", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould log in with the new password : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to reset the password.", tests.Success, testID)
+
+			if _, err := u.ResetPassword(ctx, policy, rp, now); err != user.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a used token : %v.", tests.Failed, testID, err)
+			}
+			rp.Token = first
+			if _, err := u.ResetPassword(ctx, policy, rp, now); err != user.ErrInvalidToken {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the other tokens of the user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a token only once.", tests.Success, testID)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package user
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/cravtos/asperitas-backend/foundation/bloom"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/pkg/errors"
+)
+
+// nameChars lists characters allowed in usernames. Keeping names to ASCII
+// avoids whitespace tricks and unicode look-alikes of existing names.
+var nameChars = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Policy describes which usernames and passwords are accepted when users
+// register.
+type Policy struct {
+	MinNameLength     int
+	MaxNameLength     int
+	MinPasswordLength int
+	MaxPasswordLength int
+
+	// Reserved are names nobody can register, compared ignoring case.
+	Reserved []string
+
+	// Breached holds passwords known from breaches. It may be nil.
+	Breached *bloom.Filter
+}
+
+// DefaultPolicy returns the policy used when nothing else is configured.
+func DefaultPolicy() Policy {
+	return Policy{
+		MinNameLength:     3,
+		MaxNameLength:     20,
+		MinPasswordLength: 8,
+
+		// bcrypt ignores everything after 72 bytes.
+		MaxPasswordLength: 72,
+
+		Reserved: []string{
+			"admin", "administrator", "root", "system", "moderator",
+			"mod", "deleted", "me", "null", "undefined",
+		},
+	}
+}
+
+// PolicyError is returned when a NewUser violates the Policy. It lists every
+// violated field.
+type PolicyError struct {
+	Fields []web.FieldError
+}
+
+// Error implements the error interface.
+func (pe *PolicyError) Error() string {
+	return "field validation error"
+}
+
+// Validate checks nu against the policy. It returns a *PolicyError if any of
+// the fields is not acceptable.
+func (p Policy) Validate(nu NewUser) error {
+	var fields []web.FieldError
+
+	name := nu.Name
+	switch {
+	case utf8.RuneCountInString(name) < p.MinNameLength:
+		fields = append(fields, web.FieldError{
+			Field: "username",
+			Error: fmt.Sprintf("username must be at least %d characters long", p.MinNameLength),
+		})
+	case utf8.RuneCountInString(name) > p.MaxNameLength:
+		fields = append(fields, web.FieldError{
+			Field: "username",
+			Error: fmt.Sprintf("username must be at most %d characters long", p.MaxNameLength),
+		})
+	case !nameChars.MatchString(name):
+		fields = append(fields, web.FieldError{
+			Field: "username",
+			Error: "username may only contain latin letters, digits, '-' and '_'",
+		})
+	case p.reserved(name):
+		fields = append(fields, web.FieldError{
+			Field: "username",
+			Error: "username is reserved",
+		})
+	}
+
+	fields = append(fields, p.passwordFields(nu.Name, nu.Password)...)
+
+	if len(fields) > 0 {
+		return &PolicyError{Fields: fields}
+	}
+	return nil
+}
+
+// ValidatePassword checks a new password of the user with the given name
+// against the policy. It returns a *PolicyError if it is not acceptable.
+func (p Policy) ValidatePassword(name string, password string) error {
+	if fields := p.passwordFields(name, password); len(fields) > 0 {
+		return &PolicyError{Fields: fields}
+	}
+	return nil
+}
+
+// passwordFields lists violations of the password policy.
+func (p Policy) passwordFields(name string, password string) []web.FieldError {
+	switch {
+	case utf8.RuneCountInString(password) < p.MinPasswordLength:
+		return []web.FieldError{{
+			Field: "password",
+			Error: fmt.Sprintf("password must be at least %d characters long", p.MinPasswordLength),
+		}}
+	case p.MaxPasswordLength > 0 && len(password) > p.MaxPasswordLength:
+		return []web.FieldError{{
+			Field: "password",
+			Error: fmt.Sprintf("password must be at most %d bytes long", p.MaxPasswordLength),
+		}}
+	case strings.EqualFold(password, name):
+		return []web.FieldError{{
+			Field: "password",
+			Error: "password must not be the same as username",
+		}}
+	case p.Breached.Test([]byte(password)):
+		return []web.FieldError{{
+			Field: "password",
+			Error: "password is known from a data breach, choose another one",
+		}}
+	}
+	return nil
+}
+
+// reserved shows whether name is one of the reserved names.
+func (p Policy) reserved(name string) bool {
+	for _, r := range p.Reserved {
+		if strings.EqualFold(r, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadBreached reads a file with one breached password per line into a bloom
+// filter. The filter keeps memory usage low even for large lists at the cost
+// of rare false positives.
+func LoadBreached(path string) (*bloom.Filter, error) {
+	count := 0
+	if err := readLines(path, func(string) { count++ }); err != nil {
+		return nil, err
+	}
+
+	f := bloom.New(count, 0.001)
+	if err := readLines(path, func(line string) { f.Add([]byte(line)) }); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// readLines calls fn for every non-empty line in the file at path.
+func readLines(path string, fn func(string)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "opening breached passwords")
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line != "" {
+			fn(line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrap(err, "reading breached passwords")
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package user_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/bloom"
+)
+
+func TestPolicy(t *testing.T) {
+	breached := bloom.New(1, 0.01)
+	breached.Add([]byte("password123"))
+
+	policy := user.DefaultPolicy()
+	policy.Breached = breached
+
+	table := []struct {
+		name   string
+		nu     user.NewUser
+		fields []string
+	}{
+		{"valid", user.NewUser{Name: "gopher_42", Password: "correct horse"}, nil},
+		{"short name", user.NewUser{Name: "go", Password: "correct horse"}, []string{"username"}},
+		{"long name", user.NewUser{Name: strings.Repeat("a", 10000), Password: "correct horse"}, []string{"username"}},
+		{"whitespace", user.NewUser{Name: "Admin Gopher", Password: "correct horse"}, []string{"username"}},
+		{"confusable", user.NewUser{Name: "\u0430dmin", Password: "correct horse"}, []string{"username"}},
+		{"reserved", user.NewUser{Name: "Deleted", Password: "correct horse"}, []string{"username"}},
+		{"short password", user.NewUser{Name: "gopher", Password: "x"}, []string{"password"}},
+		{"breached password", user.NewUser{Name: "gopher", Password: "password123"}, []string{"password"}},
+		{"both", user.NewUser{Name: "a b", Password: "x"}, []string{"username", "password"}},
+	}
+
+	t.Log("Given the need to validate new users against a policy.")
+	{
+		for testID, tt := range table {
+			t.Logf("\tTest %d:\tWhen validating %s.", testID, tt.name)
+			{
+				err := policy.Validate(tt.nu)
+				if tt.fields == nil {
+					if err != nil {
+						t.Fatalf("\t%s\tTest %d:\tShould accept the user : %v", tests.Failed, testID, err)
+					}
+					t.Logf("\t%s\tTest %d:\tShould accept the user.", tests.Success, testID)
+					continue
+				}
+
+				pe, ok := err.(*user.PolicyError)
+				if !ok {
+					t.Fatalf("\t%s\tTest %d:\tShould get a policy error : %v", tests.Failed, testID, err)
+				}
+
+				var got []string
+				for _, f := range pe.Fields {
+					got = append(got, f.Field)
+				}
+				if strings.Join(got, ",") != strings.Join(tt.fields, ",") {
+					t.Logf("\t\tTest %d:\texp: %v", testID, tt.fields)
+					t.Logf("\t\tTest %d:\tgot: %v", testID, got)
+					t.Fatalf("\t%s\tTest %d:\tShould reject the expected fields.", tests.Failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould reject the expected fields.", tests.Success, testID)
+			}
+		}
+	}
+}
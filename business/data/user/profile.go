@@ -0,0 +1,151 @@
+package user
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidAvatar occurs when an avatar URL is not an absolute http(s) URL.
+var ErrInvalidAvatar = errors.New("avatar must be an http or https URL")
+
+// karmaTTL is how long computed karma is served from the cache.
+const karmaTTL = 10 * time.Minute
+
+// QueryProfile gets the public profile of the user with given name.
+func (u User) QueryProfile(ctx context.Context, name string, now time.Time) (Profile, error) {
+	usr, err := u.Lookup(ctx, name)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	// Users waiting to be deleted are already gone for everyone else.
+	if usr.DateDeletion != nil || usr.ID == DeletedID {
+		return Profile{}, ErrNotFound
+	}
+
+	karma, err := u.karma(ctx, usr.ID, now)
+	if err != nil {
+		return Profile{}, err
+	}
+
+	pr := Profile{
+		Name:        usr.Name,
+		DisplayName: usr.DisplayName,
+		Bio:         usr.Bio,
+		AvatarURL:   usr.AvatarURL,
+		DateCreated: usr.DateCreated,
+		Karma:       karma,
+	}
+	return pr, nil
+}
+
+// UpdateProfile changes the profile of the user the claims belong to.
+func (u User) UpdateProfile(ctx context.Context, claims auth.Claims, up UpdateProfile) (Info, error) {
+	if up.AvatarURL != nil && *up.AvatarURL != "" {
+		au, err := url.Parse(*up.AvatarURL)
+		if err != nil || (au.Scheme != "http" && au.Scheme != "https") || au.Host == "" {
+			return Info{}, ErrInvalidAvatar
+		}
+	}
+
+	usr, err := u.QueryByID(ctx, claims, claims.User.ID)
+	if err != nil {
+		return Info{}, err
+	}
+
+	if up.DisplayName != nil {
+		usr.DisplayName = *up.DisplayName
+	}
+	if up.Bio != nil {
+		usr.Bio = *up.Bio
+	}
+	if up.AvatarURL != nil {
+		usr.AvatarURL = *up.AvatarURL
+	}
+
+	const q = `
+	UPDATE
+		users
+	SET
+		display_name = $2,
+		bio = $3,
+		avatar_url = $4
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s", "user.UpdateProfile",
+		database.Log(q, usr.ID, usr.DisplayName, usr.Bio, usr.AvatarURL),
+	)
+
+	if _, err := u.db.ExecContext(ctx, q, usr.ID, usr.DisplayName, usr.Bio, usr.AvatarURL); err != nil {
+		return Info{}, errors.Wrapf(err, "updating profile of user %s", usr.ID)
+	}
+
+	return usr, nil
+}
+
+// karma returns the karma of a user, computing it again once the cached
+// value is older than karmaTTL. Votes users give to their own content do not
+// count. Comments can not be voted on yet, so their karma stays zero.
+func (u User) karma(ctx context.Context, userID string, now time.Time) (Karma, error) {
+	const qCached = `
+	SELECT
+		post_karma, comment_karma
+	FROM
+		karma
+	WHERE
+		user_id = $1 AND date_updated > $2`
+
+	u.log.Printf("%s: %s", "user.karma", database.Log(qCached, userID, now.Add(-karmaTTL)))
+
+	var k Karma
+	err := u.db.GetContext(ctx, &k, qCached, userID, now.Add(-karmaTTL))
+	switch err {
+	case nil:
+		return k, nil
+	case sql.ErrNoRows:
+	default:
+		return Karma{}, errors.Wrapf(err, "selecting karma of user %s", userID)
+	}
+
+	const qCompute = `
+	SELECT
+		COALESCE(SUM(v.vote), 0) AS post_karma,
+		0 AS comment_karma
+	FROM
+		posts AS p
+	JOIN
+		votes AS v ON v.post_id = p.post_id AND v.user_id <> p.user_id
+	WHERE
+		p.user_id = $1`
+
+	u.log.Printf("%s: %s", "user.karma", database.Log(qCompute, userID))
+
+	if err := u.db.GetContext(ctx, &k, qCompute, userID); err != nil {
+		return Karma{}, errors.Wrapf(err, "computing karma of user %s", userID)
+	}
+
+	const qStore = `
+	INSERT INTO karma
+		(user_id, post_karma, comment_karma, date_updated)
+	VALUES
+		($1, $2, $3, $4)
+	ON CONFLICT (user_id) DO UPDATE SET
+		post_karma = EXCLUDED.post_karma,
+		comment_karma = EXCLUDED.comment_karma,
+		date_updated = EXCLUDED.date_updated`
+
+	u.log.Printf("%s: %s", "user.karma", database.Log(qStore, userID, k.Post, k.Comment, now))
+
+	if _, err := u.db.ExecContext(ctx, qStore, userID, k.Post, k.Comment, now); err != nil {
+		return Karma{}, errors.Wrapf(err, "caching karma of user %s", userID)
+	}
+
+	return k, nil
+}
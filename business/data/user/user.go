@@ -29,8 +29,21 @@ var (
 
 	// ErrForbidden occurs when a user tries to do something that is forbidden to them according to our access control policies.
 	ErrForbidden = errors.New("attempted action is not allowed")
+
+	// ErrDuplicateName occurs when a user registers with a name which is
+	// already taken, ignoring case.
+	ErrDuplicateName = errors.New("username is already taken")
+
+	// ErrDuplicateEmail occurs when an email is already used by another user.
+	ErrDuplicateEmail = errors.New("email is already in use")
+
+	// ErrInvalidToken occurs when a reset token is unknown, used or expired.
+	ErrInvalidToken = errors.New("token is invalid or expired")
 )
 
+// emailIndex is the unique index which keeps emails distinct.
+const emailIndex = "users_email_lower_idx"
+
 // User manages the set of API's for user access.
 type User struct {
 	log *log.Logger
@@ -57,26 +70,35 @@ func (u User) Create(ctx context.Context, nu NewUser, now time.Time) (Info, erro
 		Name:         nu.Name,
 		PasswordHash: hash,
 		DateCreated:  now,
+		Email:        nu.Email,
+		Verified:     nu.Email != "" && nu.Verified,
 	}
 
 	const q = `
 	INSERT INTO users
-		(user_id, name, password_hash, date_created)
+		(user_id, name, password_hash, date_created, email, email_verified)
 	VALUES
-		($1, $2, $3, $4)`
+		($1, $2, $3, $4, $5, $6)`
 
 	u.log.Printf("%s: %s", "user.Create",
-		database.Log(q, usr.ID, usr.Name, usr.PasswordHash, usr.DateCreated),
+		database.Log(q, usr.ID, usr.Name, usr.PasswordHash, usr.DateCreated, usr.Email, usr.Verified),
 	)
 
-	if _, err = u.db.ExecContext(ctx, q, usr.ID, usr.Name, usr.PasswordHash, usr.DateCreated); err != nil {
+	if _, err = u.db.ExecContext(ctx, q, usr.ID, usr.Name, usr.PasswordHash, usr.DateCreated, usr.Email, usr.Verified); err != nil {
+		if constraint, ok := database.UniqueViolation(err); ok {
+			if constraint == emailIndex {
+				return Info{}, ErrDuplicateEmail
+			}
+			return Info{}, ErrDuplicateName
+		}
 		return Info{}, errors.Wrap(err, "inserting user")
 	}
 
 	return usr, nil
 }
 
-// Delete removes a user from the database.
+// Delete removes a user from the database right away. Their posts and
+// comments are kept and shown as written by DeletedName.
 func (u User) Delete(ctx context.Context, claims auth.Claims, userID string) error {
 
 	if _, err := uuid.Parse(userID); err != nil {
@@ -88,21 +110,7 @@ func (u User) Delete(ctx context.Context, claims auth.Claims, userID string) err
 		return ErrForbidden
 	}
 
-	const q = `
-	DELETE FROM
-		users
-	WHERE
-		user_id = $1`
-
-	u.log.Printf("%s: %s", "user.Delete",
-		database.Log(q, userID),
-	)
-
-	if _, err := u.db.ExecContext(ctx, q, userID); err != nil {
-		return errors.Wrapf(err, "deleting user %s", userID)
-	}
-
-	return nil
+	return u.purge(ctx, userID)
 }
 
 // Query retrieves a list of existing users from the database.
@@ -197,6 +205,60 @@ func (u User) QueryByName(ctx context.Context, claims auth.Claims, name string)
 	return usr, nil
 }
 
+// Lookup gets the specified user from the database by username without any
+// access checks. It is meant to be used by administrative tooling.
+func (u User) Lookup(ctx context.Context, name string) (Info, error) {
+
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		name = $1`
+
+	u.log.Printf("%s: %s", "user.Lookup",
+		database.Log(q, name),
+	)
+
+	var usr Info
+	if err := u.db.GetContext(ctx, &usr, q, name); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting user %q", name)
+	}
+
+	return usr, nil
+}
+
+// LookupID gets the specified user by ID without any access checks. It is
+// meant for logins which were already verified by other means.
+func (u User) LookupID(ctx context.Context, userID string) (Info, error) {
+
+	const q = `
+	SELECT
+		*
+	FROM
+		users
+	WHERE
+		user_id = $1`
+
+	u.log.Printf("%s: %s", "user.LookupID",
+		database.Log(q, userID),
+	)
+
+	var usr Info
+	if err := u.db.GetContext(ctx, &usr, q, userID); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting user %q", userID)
+	}
+
+	return usr, nil
+}
+
 // Authenticate finds a user by their name and verifies their password. On
 // success it returns a Claims Info representing this user. The claims can be
 // used to generate a token for future authentication.
@@ -208,7 +270,7 @@ func (u User) Authenticate(ctx context.Context, name, password string, now time.
 	FROM
 		users
 	WHERE
-		name = $1`
+		lower(name) = lower($1)`
 
 	u.log.Printf("%s: %s", "user.Authenticate",
 		database.Log(q, name),
@@ -232,9 +294,19 @@ func (u User) Authenticate(ctx context.Context, name, password string, now time.
 		return auth.Claims{}, ErrAuthenticationFailure
 	}
 
+	// Users past their grace period are as good as deleted.
+	if usr.DateDeletion != nil && !now.Before(*usr.DateDeletion) {
+		return auth.Claims{}, ErrAuthenticationFailure
+	}
+
 	// If we are this far the request is valid. Create some claims for the user
 	// and generate their token.
-	claims := auth.Claims{
+	return NewClaims(usr, now), nil
+}
+
+// NewClaims creates the claims of a token issued to usr.
+func NewClaims(usr Info, now time.Time) auth.Claims {
+	return auth.Claims{
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: now.Add(time.Hour).Unix(),
 			IssuedAt:  now.Unix(),
@@ -242,8 +314,7 @@ func (u User) Authenticate(ctx context.Context, name, password string, now time.
 		User: auth.User{
 			Username: usr.Name,
 			ID:       usr.ID,
+			Verified: usr.Email != "" && usr.Verified,
 		},
 	}
-
-	return claims, nil
 }
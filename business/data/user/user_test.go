@@ -175,6 +175,133 @@ func TestAuthenticate(t *testing.T) {
 				t.Fatalf("\t%s\tTest %d:\tShould get back the expected claims. Diff:\n%s", tests.Failed, testID, diff)
 			}
 			t.Logf("\t%s\tTest %d:\tShould get back the expected claims.", tests.Success, testID)
+
+			if _, err := u.Authenticate(ctx, "anna WALKER", "goroutines", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould match the name regardless of case : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould match the name regardless of case.", tests.Success, testID)
+		}
+	}
+}
+
+func TestProfile(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	u := user.New(log, db)
+
+	t.Log("Given the need to show public profiles of users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user edits their profile.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			usr, err := u.Create(ctx, user.NewUser{Name: "Jacob_Walker", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
+
+			claims := user.NewClaims(usr, now)
+
+			bad := "javascript:alert(1)"
+			if _, err := u.UpdateProfile(ctx, claims, user.UpdateProfile{AvatarURL: &bad}); err != user.ErrInvalidAvatar {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse an avatar which is not a web URL : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse an avatar which is not a web URL.", tests.Success, testID)
+
+			name, bio := "Jacob", "Writes Go."
+			if _, err := u.UpdateProfile(ctx, claims, user.UpdateProfile{DisplayName: &name, Bio: &bio}); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to update profile : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to update profile.", tests.Success, testID)
+
+			pr, err := u.QueryProfile(ctx, usr.Name, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to retrieve profile : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to retrieve profile.", tests.Success, testID)
+
+			want := user.Profile{
+				Name:        usr.Name,
+				DisplayName: name,
+				Bio:         bio,
+				DateCreated: now,
+			}
+			if diff := cmp.Diff(want, pr); diff != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould get back the edited profile. Diff:\n%s", tests.Failed, testID, diff)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get back the edited profile.", tests.Success, testID)
+		}
+	}
+}
+
+func TestDeletion(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	u := user.New(log, db)
+
+	t.Log("Given the need to let users delete their account.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a user deletes their account.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+			grace := 24 * time.Hour
+
+			usr, err := u.Create(ctx, user.NewUser{Name: "Jacob_Walker", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to create user.", tests.Success, testID)
+
+			claims := user.NewClaims(usr, now)
+
+			if _, err := u.ScheduleDeletion(ctx, claims, user.DeleteAccount{Password: "wrong"}, grace, now); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould require the password : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould require the password.", tests.Success, testID)
+
+			if _, err := u.ScheduleDeletion(ctx, claims, user.DeleteAccount{Password: "gophers"}, grace, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to schedule deletion : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to schedule deletion.", tests.Success, testID)
+
+			if _, err := u.QueryProfile(ctx, usr.Name, now); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould hide the profile : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould hide the profile.", tests.Success, testID)
+
+			cancelled, err := u.CancelDeletion(ctx, usr.ID, now.Add(time.Hour))
+			if err != nil || !cancelled {
+				t.Fatalf("\t%s\tTest %d:\tShould cancel deletion on login : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould cancel deletion on login.", tests.Success, testID)
+
+			if _, err := u.ScheduleDeletion(ctx, claims, user.DeleteAccount{Password: "gophers"}, grace, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to schedule deletion again : %s.", tests.Failed, testID, err)
+			}
+
+			later := now.Add(grace)
+			if _, err := u.Authenticate(ctx, usr.Name, "gophers", later); err != user.ErrAuthenticationFailure {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse login after the grace period : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse login after the grace period.", tests.Success, testID)
+
+			n, err := u.Purge(ctx, later)
+			if err != nil || n != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould purge the user : %d, %v.", tests.Failed, testID, n, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould purge the user.", tests.Success, testID)
+
+			if _, err := u.LookupID(ctx, usr.ID); err != user.ErrNotFound {
+				t.Fatalf("\t%s\tTest %d:\tShould not find the purged user : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not find the purged user.", tests.Success, testID)
 		}
 	}
 }
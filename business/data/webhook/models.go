@@ -0,0 +1,53 @@
+package webhook
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Info represents a webhook subscription of a community. The secret is
+// never sent back, it only signs deliveries.
+type Info struct {
+	ID           string         `db:"webhook_id" json:"id"`
+	Community    string         `db:"community" json:"community"`
+	URL          string         `db:"url" json:"url"`
+	Secret       string         `db:"secret" json:"-"`
+	Events       pq.StringArray `db:"events" json:"events"`
+	Failures     int            `db:"failures" json:"failures"`
+	DateCreated  time.Time      `db:"date_created" json:"created"`
+	DateDisabled *time.Time     `db:"date_disabled" json:"disabled,omitempty"`
+}
+
+// NewWebhook contains information needed to subscribe a URL to events of a
+// community.
+type NewWebhook struct {
+	URL    string   `json:"url" validate:"required,url"`
+	Secret string   `json:"secret" validate:"required,min=16,max=256"`
+	Events []string `json:"events" validate:"required,min=1"`
+}
+
+// Delivery is a single attempt to tell a webhook about an event, retried
+// until it succeeds or runs out of attempts.
+type Delivery struct {
+	ID            string          `db:"delivery_id" json:"id"`
+	WebhookID     string          `db:"webhook_id" json:"webhookId"`
+	Event         string          `db:"event" json:"event"`
+	Payload       json.RawMessage `db:"payload" json:"payload"`
+	Status        string          `db:"status" json:"status"`
+	Attempts      int             `db:"attempts" json:"attempts"`
+	ResponseCode  *int            `db:"response_code" json:"responseCode,omitempty"`
+	Error         *string         `db:"error" json:"error,omitempty"`
+	DateCreated   time.Time       `db:"date_created" json:"created"`
+	DateNext      *time.Time      `db:"date_next" json:"next,omitempty"`
+	DateDelivered *time.Time      `db:"date_delivered" json:"delivered,omitempty"`
+}
+
+// payload is the body of every delivery.
+type payload struct {
+	Event     string      `json:"event"`
+	Community string      `json:"community"`
+	Created   time.Time   `json:"created"`
+	Data      interface{} `json:"data"`
+}
@@ -0,0 +1,568 @@
+// Package webhook tells services outside of asperitas about what happens in
+// communities by sending them signed HTTP requests.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/community"
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/cravtos/asperitas-backend/foundation/unfurl"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a specific webhook is requested but does not exist.
+	ErrNotFound = errors.New("webhook not found")
+
+	// ErrInvalidID occurs when an ID is not in a valid form.
+	ErrInvalidID = errors.New("ID is not in its proper form")
+
+	// ErrForbidden occurs when someone but the owner of a community manages
+	// its webhooks.
+	ErrForbidden = errors.New("only the owner of the community can manage its webhooks")
+
+	// ErrInvalidEvent occurs when a webhook subscribes to an unknown event.
+	ErrInvalidEvent = errors.New("unknown event")
+)
+
+// Events webhooks can subscribe to. They match the events published about
+// posts.
+const (
+	EventPostCreated    = "post.created"
+	EventCommentCreated = "comment.created"
+	EventPostRemoved    = "post.removed"
+)
+
+// Supported tells if webhooks can subscribe to the event.
+func Supported(event string) bool {
+	switch event {
+	case EventPostCreated, EventCommentCreated, EventPostRemoved:
+		return true
+	}
+	return false
+}
+
+// Statuses of a delivery.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+const (
+	// maxAttempts is how many times a delivery is tried before giving up.
+	maxAttempts = 8
+
+	// backoffBase is how long to wait before the first retry. The wait
+	// doubles with every failed attempt up to backoffMax.
+	backoffBase = 30 * time.Second
+	backoffMax  = 6 * time.Hour
+
+	// disableAfter is how many attempts in a row may fail before the
+	// webhook is disabled.
+	disableAfter = 20
+
+	// lease is how long a delivery may be in flight before another worker
+	// tries it again, e.g. after the first one crashed.
+	lease = 5 * time.Minute
+
+	// maxResponse is how much of a response is read before the connection
+	// is closed.
+	maxResponse = 64 << 10
+)
+
+// Webhook manages the set of API's for webhook access.
+type Webhook struct {
+	log *log.Logger
+	db  *sqlx.DB
+}
+
+// New constructs a Webhook for api access.
+func New(log *log.Logger, db *sqlx.DB) Webhook {
+	return Webhook{
+		log: log,
+		db:  db,
+	}
+}
+
+// Create subscribes a URL to events of the community. Only the owner of the
+// community can do that.
+func (w Webhook) Create(ctx context.Context, claims auth.Claims, name string, nw NewWebhook, now time.Time) (Info, error) {
+	for _, e := range nw.Events {
+		if !Supported(e) {
+			return Info{}, errors.Wrapf(ErrInvalidEvent, "%q", e)
+		}
+	}
+	if err := w.checkOwner(ctx, claims, name); err != nil {
+		return Info{}, err
+	}
+
+	wh := Info{
+		ID:          uuid.New().String(),
+		Community:   name,
+		URL:         nw.URL,
+		Secret:      nw.Secret,
+		Events:      nw.Events,
+		DateCreated: now,
+	}
+
+	const q = `
+	INSERT INTO webhooks
+		(webhook_id, community, url, secret, events, date_created)
+	VALUES
+		($1, $2, $3, $4, $5, $6)`
+
+	w.log.Printf("%s: %s", "webhook.Create", database.Log(q, wh.ID, wh.Community, wh.URL, "***", wh.Events, wh.DateCreated))
+
+	if _, err := w.db.ExecContext(ctx, q, wh.ID, wh.Community, wh.URL, wh.Secret, wh.Events, wh.DateCreated); err != nil {
+		return Info{}, errors.Wrap(err, "inserting webhook")
+	}
+	return wh, nil
+}
+
+// Query lists the webhooks of the community.
+func (w Webhook) Query(ctx context.Context, claims auth.Claims, name string) ([]Info, error) {
+	if err := w.checkOwner(ctx, claims, name); err != nil {
+		return nil, err
+	}
+
+	const q = `SELECT * FROM webhooks WHERE community = $1 ORDER BY date_created`
+
+	w.log.Printf("%s: %s", "webhook.Query", database.Log(q, name))
+
+	webhooks := []Info{}
+	if err := w.db.SelectContext(ctx, &webhooks, q, name); err != nil {
+		return nil, errors.Wrapf(err, "selecting webhooks of community %q", name)
+	}
+	return webhooks, nil
+}
+
+// Delete removes the webhook together with its delivery history.
+func (w Webhook) Delete(ctx context.Context, claims auth.Claims, name string, webhookID string) error {
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return ErrInvalidID
+	}
+	if err := w.checkOwner(ctx, claims, name); err != nil {
+		return err
+	}
+
+	tx, err := w.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "beginning transaction")
+	}
+	defer tx.Rollback()
+
+	const qDeliveries = `DELETE FROM webhook_deliveries WHERE webhook_id = $1`
+
+	w.log.Printf("%s: %s", "webhook.Delete", database.Log(qDeliveries, webhookID))
+
+	if _, err := tx.ExecContext(ctx, qDeliveries, webhookID); err != nil {
+		return errors.Wrapf(err, "deleting deliveries of webhook %s", webhookID)
+	}
+
+	const q = `DELETE FROM webhooks WHERE webhook_id = $1 AND community = $2`
+
+	w.log.Printf("%s: %s", "webhook.Delete", database.Log(q, webhookID, name))
+
+	res, err := tx.ExecContext(ctx, q, webhookID, name)
+	if err != nil {
+		return errors.Wrapf(err, "deleting webhook %s", webhookID)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+
+	return tx.Commit()
+}
+
+// Enable turns a disabled webhook back on and forgets its failures. Events
+// which happened while it was disabled are not delivered.
+func (w Webhook) Enable(ctx context.Context, claims auth.Claims, name string, webhookID string) (Info, error) {
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return Info{}, ErrInvalidID
+	}
+	if err := w.checkOwner(ctx, claims, name); err != nil {
+		return Info{}, err
+	}
+
+	const q = `
+	UPDATE
+		webhooks
+	SET
+		failures = 0, date_disabled = NULL
+	WHERE
+		webhook_id = $1 AND community = $2
+	RETURNING *`
+
+	w.log.Printf("%s: %s", "webhook.Enable", database.Log(q, webhookID, name))
+
+	var wh Info
+	if err := w.db.GetContext(ctx, &wh, q, webhookID, name); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "enabling webhook %s", webhookID)
+	}
+	return wh, nil
+}
+
+// QueryDeliveries lists the deliveries of the webhook, newest first. Page
+// counts from 1.
+func (w Webhook) QueryDeliveries(ctx context.Context, claims auth.Claims, name string, webhookID string, page int, rows int) ([]Delivery, error) {
+	if _, err := uuid.Parse(webhookID); err != nil {
+		return nil, ErrInvalidID
+	}
+	if err := w.checkOwner(ctx, claims, name); err != nil {
+		return nil, err
+	}
+	if _, err := w.getWebhook(ctx, webhookID, name); err != nil {
+		return nil, err
+	}
+
+	const q = `
+	SELECT
+		*
+	FROM
+		webhook_deliveries
+	WHERE
+		webhook_id = $1
+	ORDER BY
+		date_created DESC
+	OFFSET $2 ROWS FETCH NEXT $3 ROWS ONLY`
+
+	offset := (page - 1) * rows
+	if offset < 0 {
+		offset = 0
+	}
+
+	w.log.Printf("%s: %s", "webhook.QueryDeliveries", database.Log(q, webhookID, offset, rows))
+
+	deliveries := []Delivery{}
+	if err := w.db.SelectContext(ctx, &deliveries, q, webhookID, offset, rows); err != nil {
+		return nil, errors.Wrapf(err, "selecting deliveries of webhook %s", webhookID)
+	}
+	return deliveries, nil
+}
+
+// Enqueue queues a delivery of the event to every enabled webhook of the
+// community which subscribed to it.
+func (w Webhook) Enqueue(ctx context.Context, name string, event string, data interface{}, now time.Time) error {
+	const qWebhooks = `
+	SELECT
+		webhook_id
+	FROM
+		webhooks
+	WHERE
+		community = $1 AND $2 = ANY(events) AND date_disabled IS NULL`
+
+	w.log.Printf("%s: %s", "webhook.Enqueue", database.Log(qWebhooks, name, event))
+
+	var ids []string
+	if err := w.db.SelectContext(ctx, &ids, qWebhooks, name, event); err != nil {
+		return errors.Wrapf(err, "selecting webhooks of community %q", name)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(payload{
+		Event:     event,
+		Community: name,
+		Created:   now,
+		Data:      data,
+	})
+	if err != nil {
+		return errors.Wrap(err, "encoding payload")
+	}
+
+	const q = `
+	INSERT INTO webhook_deliveries
+		(delivery_id, webhook_id, event, payload, status, date_created, date_next)
+	VALUES
+		($1, $2, $3, $4, $5, $6, $6)`
+
+	for _, id := range ids {
+		deliveryID := uuid.New().String()
+		w.log.Printf("%s: %s", "webhook.Enqueue", database.Log(q, deliveryID, id, event, "<payload>", StatusPending, now))
+
+		if _, err := w.db.ExecContext(ctx, q, deliveryID, id, event, string(body), StatusPending, now); err != nil {
+			return errors.Wrapf(err, "queueing delivery to webhook %s", id)
+		}
+	}
+	return nil
+}
+
+// NewClient returns the client deliveries are sent with. Receivers are only
+// reached on public addresses, so webhooks cannot be pointed at loopback,
+// private networks or cloud metadata services. allowPrivate lifts that for
+// tests.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	return &http.Client{
+		Transport: unfurl.Transport(allowPrivate),
+		Timeout:   timeout,
+	}
+}
+
+// RunPending sends every delivery which is due using client. It returns how
+// many deliveries were attempted.
+func (w Webhook) RunPending(ctx context.Context, client *http.Client, now time.Time) (int, error) {
+	var n int
+	for {
+		d, err := w.claim(ctx, now)
+		if err != nil {
+			if err == ErrNotFound {
+				return n, nil
+			}
+			return n, err
+		}
+
+		wh, err := w.getWebhook(ctx, d.WebhookID, "")
+		if err != nil {
+			if err == ErrNotFound {
+				continue
+			}
+			return n, err
+		}
+
+		if wh.DateDisabled != nil {
+			if err := w.fail(ctx, d.ID, "webhook disabled"); err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		code, err := send(ctx, client, wh, d)
+		if err := w.record(ctx, wh, d, code, err, now); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Sign returns the signature of a delivery body which receivers compare
+// with the X-Asperitas-Signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns how long to wait before trying a delivery again after it
+// failed attempts times.
+func backoff(attempts int) time.Duration {
+	d := backoffBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= backoffMax {
+			return backoffMax
+		}
+	}
+	return d
+}
+
+// send posts the delivery to the webhook. Any response but 2xx is an error.
+func send(ctx context.Context, client *http.Client, wh Info, d Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, errors.Wrap(err, "building request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "asperitas-webhook")
+	req.Header.Set("X-Asperitas-Event", d.Event)
+	req.Header.Set("X-Asperitas-Delivery", d.ID)
+	req.Header.Set("X-Asperitas-Signature", Sign(wh.Secret, d.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxResponse))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// claim takes the delivery which is due the longest and leases it so no
+// other worker sends it at the same time.
+func (w Webhook) claim(ctx context.Context, now time.Time) (Delivery, error) {
+	const q = `
+	UPDATE
+		webhook_deliveries
+	SET
+		date_next = $2
+	WHERE
+		delivery_id = (
+			SELECT delivery_id FROM webhook_deliveries
+			WHERE status = $1 AND date_next <= $3
+			ORDER BY date_next
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+	RETURNING *`
+
+	leased := now.Add(lease)
+	w.log.Printf("%s: %s", "webhook.claim", database.Log(q, StatusPending, leased, now))
+
+	var d Delivery
+	if err := w.db.GetContext(ctx, &d, q, StatusPending, leased, now); err != nil {
+		if err == sql.ErrNoRows {
+			return Delivery{}, ErrNotFound
+		}
+		return Delivery{}, errors.Wrap(err, "claiming delivery")
+	}
+	return d, nil
+}
+
+// record stores the outcome of an attempt. Failed deliveries are scheduled
+// again with a growing delay, and webhooks which fail too often in a row are
+// disabled.
+func (w Webhook) record(ctx context.Context, wh Info, d Delivery, code int, sendErr error, now time.Time) error {
+	attempts := d.Attempts + 1
+	var response *int
+	if code != 0 {
+		response = &code
+	}
+
+	if sendErr == nil {
+		const q = `
+		UPDATE
+			webhook_deliveries
+		SET
+			status = $2, attempts = $3, response_code = $4, error = NULL, date_next = NULL, date_delivered = $5
+		WHERE
+			delivery_id = $1`
+
+		w.log.Printf("%s: %s", "webhook.record", database.Log(q, d.ID, StatusDelivered, attempts, code, now))
+
+		if _, err := w.db.ExecContext(ctx, q, d.ID, StatusDelivered, attempts, response, now); err != nil {
+			return errors.Wrapf(err, "storing delivery %s", d.ID)
+		}
+
+		const qReset = `UPDATE webhooks SET failures = 0 WHERE webhook_id = $1`
+
+		w.log.Printf("%s: %s", "webhook.record", database.Log(qReset, wh.ID))
+
+		if _, err := w.db.ExecContext(ctx, qReset, wh.ID); err != nil {
+			return errors.Wrapf(err, "resetting failures of webhook %s", wh.ID)
+		}
+		return nil
+	}
+
+	status := StatusPending
+	next := now.Add(backoff(attempts))
+	nextPtr := &next
+	if attempts >= maxAttempts {
+		status = StatusFailed
+		nextPtr = nil
+	}
+
+	const q = `
+	UPDATE
+		webhook_deliveries
+	SET
+		status = $2, attempts = $3, response_code = $4, error = $5, date_next = $6
+	WHERE
+		delivery_id = $1`
+
+	w.log.Printf("%s: %s", "webhook.record", database.Log(q, d.ID, status, attempts, code, sendErr.Error(), nextPtr))
+
+	if _, err := w.db.ExecContext(ctx, q, d.ID, status, attempts, response, sendErr.Error(), nextPtr); err != nil {
+		return errors.Wrapf(err, "storing delivery %s", d.ID)
+	}
+
+	const qFailures = `
+	UPDATE
+		webhooks
+	SET
+		failures = failures + 1,
+		date_disabled = CASE WHEN failures + 1 >= $2 THEN COALESCE(date_disabled, $3) ELSE date_disabled END
+	WHERE
+		webhook_id = $1
+	RETURNING
+		date_disabled`
+
+	w.log.Printf("%s: %s", "webhook.record", database.Log(qFailures, wh.ID, disableAfter, now))
+
+	var disabled *time.Time
+	if err := w.db.GetContext(ctx, &disabled, qFailures, wh.ID, disableAfter, now); err != nil {
+		return errors.Wrapf(err, "counting failures of webhook %s", wh.ID)
+	}
+	if disabled == nil {
+		return nil
+	}
+
+	const qPending = `
+	UPDATE
+		webhook_deliveries
+	SET
+		status = $2, error = $3, date_next = NULL
+	WHERE
+		webhook_id = $1 AND status = $4`
+
+	w.log.Printf("%s: %s", "webhook.record", database.Log(qPending, wh.ID, StatusFailed, "webhook disabled", StatusPending))
+
+	if _, err := w.db.ExecContext(ctx, qPending, wh.ID, StatusFailed, "webhook disabled", StatusPending); err != nil {
+		return errors.Wrapf(err, "failing deliveries of webhook %s", wh.ID)
+	}
+	return nil
+}
+
+// fail gives up on a delivery without sending it.
+func (w Webhook) fail(ctx context.Context, deliveryID string, reason string) error {
+	const q = `UPDATE webhook_deliveries SET status = $2, error = $3, date_next = NULL WHERE delivery_id = $1`
+
+	w.log.Printf("%s: %s", "webhook.fail", database.Log(q, deliveryID, StatusFailed, reason))
+
+	if _, err := w.db.ExecContext(ctx, q, deliveryID, StatusFailed, reason); err != nil {
+		return errors.Wrapf(err, "failing delivery %s", deliveryID)
+	}
+	return nil
+}
+
+// getWebhook gets a webhook by its ID. A non empty name makes sure it
+// belongs to that community.
+func (w Webhook) getWebhook(ctx context.Context, webhookID string, name string) (Info, error) {
+	const q = `SELECT * FROM webhooks WHERE webhook_id = $1 AND ($2 = '' OR community = $2)`
+
+	w.log.Printf("%s: %s", "webhook.getWebhook", database.Log(q, webhookID, name))
+
+	var wh Info
+	if err := w.db.GetContext(ctx, &wh, q, webhookID, name); err != nil {
+		if err == sql.ErrNoRows {
+			return Info{}, ErrNotFound
+		}
+		return Info{}, errors.Wrapf(err, "selecting webhook %s", webhookID)
+	}
+	return wh, nil
+}
+
+// checkOwner makes sure the user the claims belong to owns the community.
+func (w Webhook) checkOwner(ctx context.Context, claims auth.Claims, name string) error {
+	com, err := community.New(w.log, w.db).QueryByName(ctx, name)
+	if err != nil {
+		return err
+	}
+	if com.OwnerID == nil || *com.OwnerID != claims.User.ID {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/community"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/data/webhook"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/unfurl"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+const secret = "a very secret secret"
+
+// receiver records the deliveries it gets and answers with status.
+type receiver struct {
+	mu     sync.Mutex
+	status int
+	bodies []map[string]interface{}
+	signed bool
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	body, _ := ioutil.ReadAll(r.Body)
+	rc.signed = r.Header.Get("X-Asperitas-Signature") == webhook.Sign(secret, body)
+
+	var m map[string]interface{}
+	json.Unmarshal(body, &m)
+	rc.bodies = append(rc.bodies, m)
+
+	w.WriteHeader(rc.status)
+}
+
+func TestWebhook(t *testing.T) {
+	log, db, teardown := tests.NewUnit(t)
+	t.Cleanup(teardown)
+
+	w := webhook.New(log, db)
+	client := webhook.NewClient(5*time.Second, true)
+
+	rc := receiver{status: http.StatusOK}
+	srv := httptest.NewServer(&rc)
+	defer srv.Close()
+
+	t.Log("Given the need to tell other services about events of a community.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen delivering to a webhook.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 1, 0, 0, 0, 0, time.UTC)
+
+			usr, err := user.New(log, db).Create(ctx, user.NewUser{Name: "owner", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			claims := auth.Claims{
+				StandardClaims: jwt.StandardClaims{
+					ExpiresAt: now.Add(time.Hour).Unix(),
+					IssuedAt:  now.Unix(),
+				},
+				User: auth.User{
+					Username: usr.Name,
+					ID:       usr.ID,
+				},
+			}
+
+			nw := webhook.NewWebhook{
+				URL:    srv.URL,
+				Secret: secret,
+				Events: []string{webhook.EventPostCreated},
+			}
+			if _, err := w.Create(ctx, claims, "music", nw, now); err != webhook.ErrForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould not be able to add a webhook to a community of someone else : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be able to add a webhook to a community of someone else.", tests.Success, testID)
+
+			if err := community.New(log, db).SetOwner(ctx, "music", usr.ID, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to set the owner of the community : %s.", tests.Failed, testID, err)
+			}
+
+			wh, err := w.Create(ctx, claims, "music", nw, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to add a webhook : %s.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to add a webhook.", tests.Success, testID)
+
+			if err := w.Enqueue(ctx, "music", webhook.EventPostRemoved, nil, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enqueue an event : %s.", tests.Failed, testID, err)
+			}
+			if err := w.Enqueue(ctx, "music", webhook.EventPostCreated, map[string]string{"id": "1"}, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enqueue an event : %s.", tests.Failed, testID, err)
+			}
+
+			n, err := w.RunPending(ctx, client, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to run deliveries : %s.", tests.Failed, testID, err)
+			}
+			if n != 1 || len(rc.bodies) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould deliver only subscribed events : got %d.", tests.Failed, testID, len(rc.bodies))
+			}
+			t.Logf("\t%s\tTest %d:\tShould deliver only subscribed events.", tests.Success, testID)
+
+			if !rc.signed {
+				t.Fatalf("\t%s\tTest %d:\tShould sign deliveries with the secret.", tests.Failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould sign deliveries with the secret.", tests.Success, testID)
+
+			if rc.bodies[0]["event"] != webhook.EventPostCreated || rc.bodies[0]["community"] != "music" {
+				t.Fatalf("\t%s\tTest %d:\tShould describe the event : got %v.", tests.Failed, testID, rc.bodies[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould describe the event.", tests.Success, testID)
+
+			deliveries, err := w.QueryDeliveries(ctx, claims, "music", wh.ID, 1, 10)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query deliveries : %s.", tests.Failed, testID, err)
+			}
+			if len(deliveries) != 1 || deliveries[0].Status != webhook.StatusDelivered {
+				t.Fatalf("\t%s\tTest %d:\tShould record the delivery as delivered : got %+v.", tests.Failed, testID, deliveries)
+			}
+			t.Logf("\t%s\tTest %d:\tShould record the delivery as delivered.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the receiver fails.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2018, time.October, 2, 0, 0, 0, 0, time.UTC)
+
+			usr, err := user.New(log, db).Lookup(ctx, "owner")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to look up user : %s.", tests.Failed, testID, err)
+			}
+			claims := auth.Claims{
+				User: auth.User{
+					Username: usr.Name,
+					ID:       usr.ID,
+				},
+			}
+
+			whs, err := w.Query(ctx, claims, "music")
+			if err != nil || len(whs) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query webhooks : %v.", tests.Failed, testID, err)
+			}
+			wh := whs[0]
+
+			rc.status = http.StatusInternalServerError
+			if err := w.Enqueue(ctx, "music", webhook.EventPostCreated, nil, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enqueue an event : %s.", tests.Failed, testID, err)
+			}
+			if _, err := w.RunPending(ctx, client, now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to run deliveries : %s.", tests.Failed, testID, err)
+			}
+
+			deliveries, err := w.QueryDeliveries(ctx, claims, "music", wh.ID, 1, 1)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to query deliveries : %s.", tests.Failed, testID, err)
+			}
+			d := deliveries[0]
+			if d.Status != webhook.StatusPending || d.Attempts != 1 || d.DateNext == nil || !d.DateNext.Equal(now.Add(30*time.Second)) {
+				t.Fatalf("\t%s\tTest %d:\tShould retry a failed delivery later : got %+v.", tests.Failed, testID, d)
+			}
+			t.Logf("\t%s\tTest %d:\tShould retry a failed delivery later.", tests.Success, testID)
+
+			if n, _ := w.RunPending(ctx, client, now.Add(10*time.Second)); n != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not retry before the backoff is over.", tests.Failed, testID)
+			}
+			if _, err := w.RunPending(ctx, client, now.Add(30*time.Second)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to run deliveries : %s.", tests.Failed, testID, err)
+			}
+			deliveries, _ = w.QueryDeliveries(ctx, claims, "music", wh.ID, 1, 1)
+			d = deliveries[0]
+			if d.Attempts != 2 || !d.DateNext.Equal(now.Add(90*time.Second)) {
+				t.Fatalf("\t%s\tTest %d:\tShould double the backoff : got %+v.", tests.Failed, testID, d)
+			}
+			t.Logf("\t%s\tTest %d:\tShould double the backoff.", tests.Success, testID)
+
+			for i := 0; i < 20; i++ {
+				if err := w.Enqueue(ctx, "music", webhook.EventPostCreated, nil, now); err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to enqueue an event : %s.", tests.Failed, testID, err)
+				}
+			}
+			if _, err := w.RunPending(ctx, client, now.Add(time.Minute)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to run deliveries : %s.", tests.Failed, testID, err)
+			}
+
+			whs, _ = w.Query(ctx, claims, "music")
+			if whs[0].DateDisabled == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould disable a webhook which keeps failing : got %+v.", tests.Failed, testID, whs[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould disable a webhook which keeps failing.", tests.Success, testID)
+
+			deliveries, _ = w.QueryDeliveries(ctx, claims, "music", wh.ID, 1, 100)
+			for _, d := range deliveries {
+				if d.Status == webhook.StatusPending {
+					t.Fatalf("\t%s\tTest %d:\tShould give up deliveries of a disabled webhook : got %+v.", tests.Failed, testID, d)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould give up deliveries of a disabled webhook.", tests.Success, testID)
+
+			wh, err = w.Enable(ctx, claims, "music", wh.ID)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to enable the webhook : %s.", tests.Failed, testID, err)
+			}
+			if wh.DateDisabled != nil || wh.Failures != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould forget failures when enabled : got %+v.", tests.Failed, testID, wh)
+			}
+			t.Logf("\t%s\tTest %d:\tShould forget failures when enabled.", tests.Success, testID)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	t.Log("Given the need to keep webhooks away from internal services.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen delivering to addresses which are not public.", testID)
+		{
+			client := webhook.NewClient(time.Second, false)
+			for _, target := range []string{srv.URL, "http://169.254.169.254/latest/meta-data/", "http://10.0.0.1/", "http://[::1]:80/"} {
+				resp, err := client.Post(target, "application/json", nil)
+				if err == nil {
+					resp.Body.Close()
+				}
+				if !errors.Is(err, unfurl.ErrBlockedAddress) {
+					t.Fatalf("\t%s\tTest %d:\tShould refuse %s : %v.", tests.Failed, testID, target, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse them.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen private addresses are allowed.", testID)
+		{
+			resp, err := webhook.NewClient(time.Second, true).Post(srv.URL, "application/json", nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould reach the receiver : %v.", tests.Failed, testID, err)
+			}
+			resp.Body.Close()
+			t.Logf("\t%s\tTest %d:\tShould reach the receiver.", tests.Success, testID)
+		}
+	}
+}
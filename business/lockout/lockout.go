@@ -0,0 +1,93 @@
+// Package lockout tracks failed login attempts and temporarily locks out
+// usernames and client addresses which keep failing.
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrLocked occurs when a login is attempted while the username or client
+// address is locked out.
+var ErrLocked = errors.New("too many failed login attempts")
+
+// Lock represents a key which has failed attempts recorded.
+type Lock struct {
+	Key         string    `db:"key" json:"key"`
+	Failures    int       `db:"failures" json:"failures"`
+	LockedUntil time.Time `db:"locked_until" json:"lockedUntil"`
+	LastFailure time.Time `db:"last_failure" json:"lastFailure"`
+}
+
+// Tracker records failed attempts per key. Implementations must be safe for
+// concurrent use.
+type Tracker interface {
+
+	// Check returns for how long key is still locked. Zero means that an
+	// attempt is allowed.
+	Check(ctx context.Context, key string, now time.Time) (time.Duration, error)
+
+	// Fail records a failed attempt for key and returns for how long key is
+	// locked as a result.
+	Fail(ctx context.Context, key string, now time.Time) (time.Duration, error)
+
+	// Reset forgets all failed attempts of key.
+	Reset(ctx context.Context, key string) error
+
+	// Locked lists all keys which are locked at now.
+	Locked(ctx context.Context, now time.Time) ([]Lock, error)
+}
+
+// Policy describes how failed attempts turn into lockouts. Once a key has
+// reached its threshold every further failure doubles the lockout, starting
+// at BaseDelay and capped at MaxDelay. Failures older than Window are
+// forgotten.
+type Policy struct {
+	UserThreshold int
+	IPThreshold   int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	Window        time.Duration
+}
+
+const (
+	userPrefix = "user:"
+	ipPrefix   = "ip:"
+)
+
+// UserKey returns the tracking key for a username.
+func UserKey(name string) string {
+	return userPrefix + strings.ToLower(name)
+}
+
+// IPKey returns the tracking key for a client address.
+func IPKey(addr string) string {
+	return ipPrefix + addr
+}
+
+// Delay returns the lockout caused by failures consecutive failed attempts
+// for key.
+func (p Policy) Delay(key string, failures int) time.Duration {
+	threshold := p.UserThreshold
+	if strings.HasPrefix(key, ipPrefix) {
+		threshold = p.IPThreshold
+	}
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := threshold; i < failures; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	if delay > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return delay
+}
@@ -0,0 +1,90 @@
+package lockout_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/lockout"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestMemory(t *testing.T) {
+	policy := lockout.Policy{
+		UserThreshold: 3,
+		IPThreshold:   10,
+		BaseDelay:     time.Second,
+		MaxDelay:      5 * time.Second,
+		Window:        time.Hour,
+	}
+	tr := lockout.NewMemory(policy)
+
+	t.Log("Given the need to lock out keys which keep failing.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a username keeps failing.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)
+			key := lockout.UserKey("Gopher")
+
+			exp := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+			for i, want := range exp {
+				got, err := tr.Fail(ctx, key, now)
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to record a failure : %v", failed, testID, err)
+				}
+				if got != want {
+					t.Logf("\t\tTest %d:\texp: %v", testID, want)
+					t.Logf("\t\tTest %d:\tgot: %v", testID, got)
+					t.Fatalf("\t%s\tTest %d:\tShould back off exponentially on failure %d.", failed, testID, i+1)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould back off exponentially.", success, testID)
+
+			wait, err := tr.Check(ctx, lockout.UserKey("gopher"), now.Add(time.Second))
+			if err != nil || wait != 4*time.Second {
+				t.Fatalf("\t%s\tTest %d:\tShould report remaining lockout ignoring case : %v %v", failed, testID, wait, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould report remaining lockout ignoring case.", success, testID)
+
+			locks, err := tr.Locked(ctx, now)
+			if err != nil || len(locks) != 1 || locks[0].Key != key {
+				t.Fatalf("\t%s\tTest %d:\tShould list the locked key : %v %v", failed, testID, locks, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould list the locked key.", success, testID)
+
+			if got, _ := tr.Fail(ctx, key, now.Add(2*time.Hour)); got != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould forget failures outside the window : %v", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould forget failures outside the window.", success, testID)
+
+			if err := tr.Reset(ctx, key); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to reset : %v", failed, testID, err)
+			}
+			if wait, _ := tr.Check(ctx, key, now); wait != 0 {
+				t.Fatalf("\t%s\tTest %d:\tShould not be locked after reset : %v", failed, testID, wait)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not be locked after reset.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a client address fails.", testID)
+		{
+			ctx := context.Background()
+			now := time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+			for i := 0; i < 5; i++ {
+				if got, _ := tr.Fail(ctx, lockout.IPKey("10.0.0.1"), now); got != 0 {
+					t.Fatalf("\t%s\tTest %d:\tShould use the higher address threshold : %v", failed, testID, got)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould use the higher address threshold.", success, testID)
+		}
+	}
+}
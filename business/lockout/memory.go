@@ -0,0 +1,96 @@
+package lockout
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pruneSize is the number of tracked keys after which expired entries are
+// dropped from memory.
+const pruneSize = 10000
+
+// Memory is a Tracker which keeps attempts in process memory. It is suitable
+// when a single instance of the service is running.
+type Memory struct {
+	mu      sync.Mutex
+	policy  Policy
+	entries map[string]*Lock
+}
+
+// NewMemory constructs a Memory tracker using the given policy.
+func NewMemory(policy Policy) *Memory {
+	return &Memory{
+		policy:  policy,
+		entries: make(map[string]*Lock),
+	}
+}
+
+// Check implements Tracker.
+func (m *Memory) Check(_ context.Context, key string, now time.Time) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.entries[key]
+	if !ok || !l.LockedUntil.After(now) {
+		return 0, nil
+	}
+	return l.LockedUntil.Sub(now), nil
+}
+
+// Fail implements Tracker.
+func (m *Memory) Fail(_ context.Context, key string, now time.Time) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.entries) >= pruneSize {
+		m.prune(now)
+	}
+
+	l, ok := m.entries[key]
+	if !ok || now.Sub(l.LastFailure) > m.policy.Window {
+		l = &Lock{Key: key}
+		m.entries[key] = l
+	}
+
+	l.Failures++
+	l.LastFailure = now
+
+	delay := m.policy.Delay(key, l.Failures)
+	l.LockedUntil = now.Add(delay)
+	return delay, nil
+}
+
+// Reset implements Tracker.
+func (m *Memory) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// Locked implements Tracker.
+func (m *Memory) Locked(_ context.Context, now time.Time) ([]Lock, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var locks []Lock
+	for _, l := range m.entries {
+		if l.LockedUntil.After(now) {
+			locks = append(locks, *l)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Key < locks[j].Key })
+	return locks, nil
+}
+
+// prune drops entries which are neither locked nor within the window.
+func (m *Memory) prune(now time.Time) {
+	for key, l := range m.entries {
+		if !l.LockedUntil.After(now) && now.Sub(l.LastFailure) > m.policy.Window {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// Postgres is a Tracker which keeps attempts in the database so they are
+// shared between all running instances of the service.
+type Postgres struct {
+	log    *log.Logger
+	db     *sqlx.DB
+	policy Policy
+}
+
+// NewPostgres constructs a Postgres tracker using the given policy.
+func NewPostgres(log *log.Logger, db *sqlx.DB, policy Policy) Postgres {
+	return Postgres{
+		log:    log,
+		db:     db,
+		policy: policy,
+	}
+}
+
+// Check implements Tracker.
+func (p Postgres) Check(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	const q = `SELECT locked_until FROM login_attempts WHERE key = $1`
+
+	p.log.Printf("%s: %s", "lockout.Check", database.Log(q, key))
+
+	var until time.Time
+	if err := p.db.GetContext(ctx, &until, q, key); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, errors.Wrap(err, "selecting login attempts")
+	}
+
+	if !until.After(now) {
+		return 0, nil
+	}
+	return until.Sub(now), nil
+}
+
+// Fail implements Tracker.
+func (p Postgres) Fail(ctx context.Context, key string, now time.Time) (time.Duration, error) {
+	const qFail = `
+	INSERT INTO login_attempts
+		(key, failures, locked_until, last_failure)
+	VALUES
+		($1, 1, $2, $2)
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_attempts.last_failure < $3 THEN 1
+			ELSE login_attempts.failures + 1
+		END,
+		last_failure = EXCLUDED.last_failure
+	RETURNING failures`
+
+	windowStart := now.Add(-p.policy.Window)
+	p.log.Printf("%s: %s", "lockout.Fail", database.Log(qFail, key, now, windowStart))
+
+	var failures int
+	if err := p.db.GetContext(ctx, &failures, qFail, key, now, windowStart); err != nil {
+		return 0, errors.Wrap(err, "recording failed attempt")
+	}
+
+	delay := p.policy.Delay(key, failures)
+	if delay == 0 {
+		return 0, nil
+	}
+
+	const qLock = `UPDATE login_attempts SET locked_until = $2 WHERE key = $1`
+
+	p.log.Printf("%s: %s", "lockout.Fail", database.Log(qLock, key, now.Add(delay)))
+
+	if _, err := p.db.ExecContext(ctx, qLock, key, now.Add(delay)); err != nil {
+		return 0, errors.Wrap(err, "locking key")
+	}
+	return delay, nil
+}
+
+// Reset implements Tracker.
+func (p Postgres) Reset(ctx context.Context, key string) error {
+	const q = `DELETE FROM login_attempts WHERE key = $1`
+
+	p.log.Printf("%s: %s", "lockout.Reset", database.Log(q, key))
+
+	if _, err := p.db.ExecContext(ctx, q, key); err != nil {
+		return errors.Wrapf(err, "deleting login attempts of %s", key)
+	}
+	return nil
+}
+
+// Locked implements Tracker.
+func (p Postgres) Locked(ctx context.Context, now time.Time) ([]Lock, error) {
+	const q = `SELECT * FROM login_attempts WHERE locked_until > $1 ORDER BY key`
+
+	p.log.Printf("%s: %s", "lockout.Locked", database.Log(q, now))
+
+	var locks []Lock
+	if err := p.db.SelectContext(ctx, &locks, q, now); err != nil {
+		return nil, errors.Wrap(err, "selecting locked keys")
+	}
+	return locks, nil
+}
@@ -2,37 +2,88 @@ package mid
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/business/data/session"
 	"github.com/cravtos/asperitas-backend/foundation/web"
 	"github.com/pkg/errors"
 )
 
-// Authenticate validates a JWT from the `Authorization` header.
-func Authenticate(a *auth.Auth) web.Middleware {
+// Authenticate validates a JWT or personal API key from the `Authorization`
+// header. The session a JWT belongs to must not be revoked. Tokens issued to
+// third-party clients and API keys must grant all of the scopes, and are
+// refused when none are given.
+func Authenticate(a *auth.Auth, s session.Session, k apikey.APIKey, scopes ...string) web.Middleware {
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
 
 		// Create the handler that will be attached in the middleware chain.
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
+
+			claims, err := authenticate(ctx, w, r, a, s, k, v.Now)
+			if err != nil {
+				return err
+			}
+
+			// Routes without scopes are only for users themselves.
+			if claims.Delegated() && (len(scopes) == 0 || !claims.HasScopes(scopes...)) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope=%q`, strings.Join(scopes, " ")))
+				return web.NewRequestError(auth.ErrInsufficientScope, http.StatusForbidden)
+			}
+
+			// Add claims to the context so they can be retrieved later.
+			ctx = context.WithValue(ctx, auth.Key, claims)
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// OptionalAuthenticate works like Authenticate on routes anybody can call.
+// Requests without credentials go on as if they were anonymous, and so do
+// clients whose credentials do not grant the scopes. Credentials which are
+// malformed, revoked or over their rate limit are refused like Authenticate
+// does, so clients learn they have to sign in again.
+func OptionalAuthenticate(a *auth.Auth, s session.Session, k apikey.APIKey, scopes ...string) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
 
-			// Expecting: bearer <token>
-			authStr := r.Header.Get("authorization")
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			v, ok := ctx.Value(web.KeyValues).(*web.Values)
+			if !ok {
+				return web.NewShutdownError("web value missing from context")
+			}
 
-			// Parse the authorization header.
-			parts := strings.Split(authStr, " ")
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				err := errors.New("expected authorization header format: bearer <token>")
-				return web.NewRequestError(err, http.StatusUnauthorized)
+			if r.Header.Get("authorization") == "" {
+				return handler(ctx, w, r)
 			}
 
-			// Validate the token is signed by us.
-			claims, err := a.ValidateToken(parts[1])
+			claims, err := authenticate(ctx, w, r, a, s, k, v.Now)
 			if err != nil {
-				return web.NewRequestError(err, http.StatusUnauthorized)
+				return err
+			}
+
+			if claims.Delegated() && (len(scopes) == 0 || !claims.HasScopes(scopes...)) {
+				return handler(ctx, w, r)
 			}
 
 			// Add claims to the context so they can be retrieved later.
@@ -46,4 +97,58 @@ func Authenticate(a *auth.Auth) web.Middleware {
 	}
 
 	return m
-}
\ No newline at end of file
+}
+
+// authenticate returns the claims of the credentials in the `Authorization`
+// header. Bad credentials are reported as *web.Error.
+func authenticate(ctx context.Context, w http.ResponseWriter, r *http.Request, a *auth.Auth, s session.Session, k apikey.APIKey, now time.Time) (auth.Claims, error) {
+
+	// Expecting: bearer <token> or token <key>
+	authStr := r.Header.Get("authorization")
+
+	// Parse the authorization header.
+	parts := strings.Split(authStr, " ")
+	if len(parts) != 2 {
+		err := errors.New("expected authorization header format: bearer <token>")
+		return auth.Claims{}, web.NewRequestError(err, http.StatusUnauthorized)
+	}
+
+	switch strings.ToLower(parts[0]) {
+	case "bearer":
+
+		// Validate the token is signed by us.
+		claims, err := a.ValidateToken(parts[1])
+		if err != nil {
+			return auth.Claims{}, web.NewRequestError(err, http.StatusUnauthorized)
+		}
+
+		// Validate the session was not revoked since the token was issued.
+		if err := s.Check(ctx, claims.Id, now); err != nil {
+			if err == session.ErrRevoked {
+				return auth.Claims{}, web.NewRequestError(err, http.StatusUnauthorized)
+			}
+			return auth.Claims{}, errors.Wrap(err, "checking session")
+		}
+		return claims, nil
+
+	case "token":
+		claims, err := k.Authenticate(ctx, parts[1], now)
+		if err != nil {
+			var le *apikey.LimitError
+			switch {
+			case err == apikey.ErrInvalidKey:
+				return auth.Claims{}, web.NewRequestError(err, http.StatusUnauthorized)
+			case errors.As(err, &le):
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(le.RetryAfter.Seconds()))))
+				return auth.Claims{}, web.NewRequestError(err, http.StatusTooManyRequests)
+			default:
+				return auth.Claims{}, errors.Wrap(err, "checking API key")
+			}
+		}
+		return claims, nil
+
+	default:
+		err := errors.New("expected authorization header format: bearer <token>")
+		return auth.Claims{}, web.NewRequestError(err, http.StatusUnauthorized)
+	}
+}
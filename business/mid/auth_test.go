@@ -0,0 +1,229 @@
+package mid_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/auth"
+	"github.com/cravtos/asperitas-backend/business/data/apikey"
+	"github.com/cravtos/asperitas-backend/business/data/session"
+	"github.com/cravtos/asperitas-backend/business/data/user"
+	"github.com/cravtos/asperitas-backend/business/mid"
+	"github.com/cravtos/asperitas-backend/business/tests"
+	"github.com/cravtos/asperitas-backend/foundation/ratelimit"
+	"github.com/cravtos/asperitas-backend/foundation/web"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+func TestAuthenticate(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	ses := session.New(test.Log, test.DB)
+	keys := apikey.New(test.Log, test.DB, ratelimit.New(time.Minute))
+
+	t.Log("Given the need to limit what third-party clients can do.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a client calls a route with a token.", testID)
+		{
+			now := time.Now()
+			token := newToken(t, test, "delegator", uuid.New().String(), auth.ScopeRead, now)
+
+			m := mid.Authenticate(test.Auth, ses, keys, auth.ScopeRead)
+			if _, claims, err := call(m, "Bearer "+token, now); err != nil || claims.User.Username != "delegator" {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a token granting the scope : %+v %v.", tests.Failed, testID, claims, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a token granting the scope.", tests.Success, testID)
+
+			m = mid.Authenticate(test.Auth, ses, keys, auth.ScopeVote)
+			w, _, err := call(m, "Bearer "+token, now)
+			if status(err) != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a token without the scope with 403 : %v.", tests.Failed, testID, err)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != `Bearer error="insufficient_scope", scope="vote"` {
+				t.Fatalf("\t%s\tTest %d:\tShould tell the client which scope is missing : got %q.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a token without the scope with 403.", tests.Success, testID)
+
+			m = mid.Authenticate(test.Auth, ses, keys)
+			if _, _, err := call(m, "Bearer "+token, now); status(err) != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse clients on routes without scopes : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse clients on routes without scopes.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen a script calls a route with a personal API key.", testID)
+		{
+			ctx := context.Background()
+			now := time.Now()
+
+			usr, err := user.New(test.Log, test.DB).Create(ctx, user.NewUser{Name: "scripter", Password: "gophers"}, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create user : %s.", tests.Failed, testID, err)
+			}
+			limit := 2
+			nk := apikey.NewKey{Name: "bot", Scopes: []string{auth.ScopeRead}, RateLimit: &limit}
+			key, err := keys.Create(ctx, auth.Claims{User: auth.User{Username: usr.Name, ID: usr.ID}}, nk, now)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a key : %s.", tests.Failed, testID, err)
+			}
+
+			m := mid.Authenticate(test.Auth, ses, keys, auth.ScopeRead)
+			if _, claims, err := call(m, "Token "+key.Key, now); err != nil || claims.User.ID != usr.ID {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a key granting the scope : %+v %v.", tests.Failed, testID, claims, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a key granting the scope.", tests.Success, testID)
+
+			if _, _, err := call(mid.Authenticate(test.Auth, ses, keys, auth.ScopeVote), "Token "+key.Key, now); status(err) != http.StatusForbidden {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a key without the scope with 403 : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a key without the scope with 403.", tests.Success, testID)
+
+			w, _, err := call(m, "Token "+key.Key, now)
+			if status(err) != http.StatusTooManyRequests {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a key over its rate limit with 429 : %v.", tests.Failed, testID, err)
+			}
+			if got := w.Header().Get("Retry-After"); got != "60" {
+				t.Fatalf("\t%s\tTest %d:\tShould tell when the key may be used again : got %q.", tests.Failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a key over its rate limit with 429 and Retry-After.", tests.Success, testID)
+		}
+	}
+}
+
+func TestOptionalAuthenticate(t *testing.T) {
+	test := tests.NewIntegration(t)
+	t.Cleanup(test.Teardown)
+
+	ses := session.New(test.Log, test.DB)
+	keys := apikey.New(test.Log, test.DB, ratelimit.New(time.Minute))
+	m := mid.OptionalAuthenticate(test.Auth, ses, keys, auth.ScopeRead)
+
+	t.Log("Given the need to personalize routes anybody can call.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the request carries no or valid credentials.", testID)
+		{
+			now := time.Now()
+
+			if _, claims, err := call(m, "", now); err != nil || claims.User.ID != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould go on anonymously without credentials : %+v %v.", tests.Failed, testID, claims, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould go on anonymously without credentials.", tests.Success, testID)
+
+			token := newToken(t, test, "reader", "", "", now)
+			if _, claims, err := call(m, "Bearer "+token, now); err != nil || claims.User.Username != "reader" {
+				t.Fatalf("\t%s\tTest %d:\tShould add the claims of a valid token : %+v %v.", tests.Failed, testID, claims, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould add the claims of a valid token.", tests.Success, testID)
+
+			token = newToken(t, test, "voter", uuid.New().String(), auth.ScopeVote, now)
+			if _, claims, err := call(m, "Bearer "+token, now); err != nil || claims.User.ID != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould go on anonymously for a client without the scope : %+v %v.", tests.Failed, testID, claims, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould go on anonymously for a client without the scope.", tests.Success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen the request carries bad credentials.", testID)
+		{
+			ctx := context.Background()
+			now := time.Now()
+
+			for _, authorization := range []string{"Bearer", "Basic Z29waGVyOg==", "Bearer not.a.token", "Token asp_unknown"} {
+				if _, _, err := call(m, authorization, now); status(err) != http.StatusUnauthorized {
+					t.Fatalf("\t%s\tTest %d:\tShould refuse the header %q with 401 : %v.", tests.Failed, testID, authorization, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse malformed credentials with 401.", tests.Success, testID)
+
+			token := newToken(t, test, "revoked", "", "", now)
+			claims, err := test.Auth.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to validate the token : %s.", tests.Failed, testID, err)
+			}
+			if err := ses.RevokeAll(ctx, claims.User.ID, "", now); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to revoke the session : %s.", tests.Failed, testID, err)
+			}
+			if _, _, err := call(m, "Bearer "+token, now); status(err) != http.StatusUnauthorized {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse a token of a revoked session with 401 : %v.", tests.Failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse a token of a revoked session with 401.", tests.Success, testID)
+		}
+	}
+}
+
+// newToken creates a user with a session and returns a token for it. The
+// token is issued to the client with the scope unless clientID is empty.
+func newToken(t *testing.T, test *tests.Test, name, clientID, scope string, now time.Time) string {
+	ctx := context.Background()
+
+	usr, err := user.New(test.Log, test.DB).Create(ctx, user.NewUser{Name: name, Password: "gophers"}, now)
+	if err != nil {
+		t.Fatalf("creating user %s: %s", name, err)
+	}
+
+	ns := session.NewSession{
+		UserID:      usr.ID,
+		DateExpires: now.Add(time.Hour),
+		ClientID:    clientID,
+	}
+	s, err := session.New(test.Log, test.DB).Create(ctx, ns, now)
+	if err != nil {
+		t.Fatalf("creating session for %s: %s", name, err)
+	}
+
+	claims := auth.Claims{
+		StandardClaims: jwt.StandardClaims{
+			Id:        s.ID,
+			ExpiresAt: now.Add(time.Hour).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+		User: auth.User{Username: usr.Name, ID: usr.ID},
+	}
+	if clientID != "" {
+		claims.Scope = scope
+		claims.ClientID = clientID
+	}
+
+	token, err := test.Auth.GenerateToken(test.KID, claims)
+	if err != nil {
+		t.Fatalf("generating token for %s: %s", name, err)
+	}
+	return token
+}
+
+// call runs the middleware with the authorization header and returns the
+// claims the next handler was called with.
+func call(m web.Middleware, authorization string, now time.Time) (*httptest.ResponseRecorder, auth.Claims, error) {
+	var claims auth.Claims
+	h := m(func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+		claims, _ = ctx.Value(auth.Key).(auth.Claims)
+		return nil
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	ctx := context.WithValue(r.Context(), web.KeyValues, &web.Values{Now: now})
+
+	err := h(ctx, w, r)
+	return w, claims, err
+}
+
+// status returns the status of a request error, or 0 for other errors.
+func status(err error) int {
+	if webErr, ok := errors.Cause(err).(*web.Error); ok {
+		return webErr.Status
+	}
+	return 0
+}
@@ -0,0 +1,370 @@
+// Package oidc implements the relying party side of OpenID Connect: the
+// authorization code flow with PKCE against external identity providers.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidIDToken occurs when the id token returned by a provider can not
+// be trusted.
+var ErrInvalidIDToken = errors.New("invalid id token")
+
+// leeway is the clock difference tolerated when checking token times.
+const leeway = time.Minute
+
+// Config describes a single identity provider.
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Identity is what a provider asserts about the user who logged in.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// metadata is the part of the discovery document we rely on.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider talks to a single identity provider.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	meta   metadata
+
+	mu   sync.RWMutex
+	keys map[string]*rsa.PublicKey
+}
+
+// NewProvider fetches the discovery document of the issuer and constructs a
+// Provider for it. A nil client means http.DefaultClient.
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	p := Provider{
+		cfg:    cfg,
+		client: client,
+	}
+
+	discovery := strings.TrimSuffix(cfg.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.get(ctx, discovery, &p.meta); err != nil {
+		return nil, errors.Wrapf(err, "discovering provider %s", cfg.Name)
+	}
+
+	// The spec requires the issuer in the document to match exactly the one
+	// used for discovery, otherwise tokens from an impostor could be accepted.
+	if p.meta.Issuer != cfg.Issuer {
+		return nil, errors.Errorf("provider %s: issuer mismatch: expected %q, got %q", cfg.Name, cfg.Issuer, p.meta.Issuer)
+	}
+	if p.meta.AuthorizationEndpoint == "" || p.meta.TokenEndpoint == "" || p.meta.JWKSURI == "" {
+		return nil, errors.Errorf("provider %s: discovery document is incomplete", cfg.Name)
+	}
+
+	return &p, nil
+}
+
+// Name returns the name the provider was configured with.
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the URL of the provider's login page. The state and
+// nonce are echoed back and the verifier proves the code was requested by us.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.cfg.ClientID)
+	v.Set("redirect_uri", p.cfg.RedirectURL)
+	v.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.meta.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange trades an authorization code for tokens and returns the identity
+// from the verified id token.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string, now time.Time) (Identity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "creating token request")
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "requesting token")
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return Identity{}, errors.Wrap(err, "reading token response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Identity{}, errors.Errorf("token endpoint: %s: %s", resp.Status, body)
+	}
+
+	var tkn struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tkn); err != nil {
+		return Identity{}, errors.Wrap(err, "decoding token response")
+	}
+	if tkn.IDToken == "" {
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "token response has no id token")
+	}
+
+	return p.Verify(ctx, tkn.IDToken, nonce, now)
+}
+
+// idClaims are the claims of an id token we care about.
+type idClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// Valid is checked by Verify itself since it needs the provider config.
+func (idClaims) Valid() error {
+	return nil
+}
+
+// audience is either a single string or a list of them.
+type audience []string
+
+// UnmarshalJSON accepts both forms of the aud claim.
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var one string
+	if err := json.Unmarshal(b, &one); err == nil {
+		*a = audience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify checks the signature and claims of an id token.
+func (p *Provider) Verify(ctx context.Context, raw, nonce string, now time.Time) (Identity, error) {
+	var claims idClaims
+	parser := jwt.Parser{ValidMethods: []string{"RS256", "RS384", "RS512"}}
+	keyFunc := func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	}
+	if _, err := parser.ParseWithClaims(raw, &claims, keyFunc); err != nil {
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, err.Error())
+	}
+
+	switch {
+	case claims.Issuer != p.meta.Issuer:
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "wrong issuer")
+	case !claims.Audience.contains(p.cfg.ClientID):
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "wrong audience")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "wrong authorized party")
+	case claims.Subject == "":
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "missing subject")
+	case now.After(time.Unix(claims.ExpiresAt, 0).Add(leeway)):
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "token expired")
+	case now.Add(leeway).Before(time.Unix(claims.IssuedAt, 0)):
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "token issued in the future")
+	case claims.Nonce != nonce:
+		return Identity{}, errors.Wrap(ErrInvalidIDToken, "wrong nonce")
+	}
+
+	id := Identity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}
+	return id, nil
+}
+
+// key returns the public key with given id. The key set is refetched once
+// when the id is unknown, which is how providers roll their keys.
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.RLock()
+	k, ok := p.lookup(kid)
+	p.mu.RUnlock()
+	if ok {
+		return k, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, errors.Errorf("unknown key id %q", kid)
+}
+
+// lookup finds a key in the cached set. An empty kid is accepted if the set
+// holds only one key. Caller must hold the lock.
+func (p *Provider) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+// fetchKeys downloads the RSA signing keys of the provider.
+func (p *Provider) fetchKeys(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			KID string `json:"kid"`
+			KTY string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.get(ctx, p.meta.JWKSURI, &set); err != nil {
+		return nil, errors.Wrap(err, "fetching key set")
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range set.Keys {
+		if k.KTY != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding modulus of key %q", k.KID)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, errors.Wrapf(err, "decoding exponent of key %q", k.KID)
+		}
+		keys[k.KID] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	return keys, nil
+}
+
+// get fetches a JSON document.
+func (p *Provider) get(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// RandomString returns a URL safe string made from n random bytes. It is
+// used for states, nonces and PKCE verifiers.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "reading random bytes")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge derives the S256 PKCE challenge from a verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,255 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/business/oidc"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+const (
+	clientID     = "asperitas"
+	clientSecret = "s3cret"
+	redirectURL  = "https://asperitas.example/oidc/callback"
+)
+
+// fakeProvider is an in-process OpenID provider which issues a code for
+// whatever was last requested through the authorization endpoint.
+type fakeProvider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+	kid string
+
+	mu        sync.Mutex
+	codes     map[string]authRequest
+	issuedAt  time.Time
+	overrides jwt.MapClaims
+}
+
+type authRequest struct {
+	nonce     string
+	challenge string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	fp := fakeProvider{
+		key:   key,
+		kid:   "key-1",
+		codes: make(map[string]authRequest),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 fp.URL,
+			"authorization_endpoint": fp.URL + "/authorize",
+			"token_endpoint":         fp.URL + "/token",
+			"jwks_uri":               fp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		fp.mu.Lock()
+		defer fp.mu.Unlock()
+		pub := fp.key.PublicKey
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kid": fp.kid,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", fp.token)
+
+	fp.Server = httptest.NewServer(mux)
+	t.Cleanup(fp.Close)
+	return &fp
+}
+
+// authorize plays the part of the user logging in at the provider and
+// returns the code the browser would be redirected back with.
+func (fp *fakeProvider) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("parsing auth url: %v", err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != clientID || q.Get("redirect_uri") != redirectURL || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected auth request: %s", authURL)
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	code := "code-" + q.Get("state")
+	fp.codes[code] = authRequest{nonce: q.Get("nonce"), challenge: q.Get("code_challenge")}
+	return code
+}
+
+func (fp *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	id, secret, _ := r.BasicAuth()
+	if id != clientID || secret != clientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+
+	req, ok := fp.codes[r.PostFormValue("code")]
+	delete(fp.codes, r.PostFormValue("code"))
+	if !ok || oidc.Challenge(r.PostFormValue("code_verifier")) != req.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            fp.URL,
+		"sub":            "248289761001",
+		"aud":            []string{clientID},
+		"exp":            fp.issuedAt.Add(time.Hour).Unix(),
+		"iat":            fp.issuedAt.Unix(),
+		"nonce":          req.nonce,
+		"email":          "gopher@example.com",
+		"email_verified": true,
+		"name":           "Gopher",
+	}
+	for k, v := range fp.overrides {
+		claims[k] = v
+	}
+
+	tkn := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tkn.Header["kid"] = fp.kid
+	signed, err := tkn.SignedString(fp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "at",
+		"token_type":   "Bearer",
+		"id_token":     signed,
+	})
+}
+
+// login runs the whole code flow and returns what Exchange returned.
+func login(t *testing.T, fp *fakeProvider, p *oidc.Provider, now time.Time, tamper func(verifier, nonce *string)) (oidc.Identity, error) {
+	state, _ := oidc.RandomString(16)
+	nonce, _ := oidc.RandomString(16)
+	verifier, _ := oidc.RandomString(32)
+
+	code := fp.authorize(t, p.AuthCodeURL(state, nonce, verifier))
+	if tamper != nil {
+		tamper(&verifier, &nonce)
+	}
+	return p.Exchange(context.Background(), code, verifier, nonce, now)
+}
+
+func TestProvider(t *testing.T) {
+	fp := newFakeProvider(t)
+	now := time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)
+	fp.issuedAt = now
+
+	cfg := oidc.Config{
+		Name:         "fake",
+		Issuer:       fp.URL,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+	}
+	p, err := oidc.NewProvider(context.Background(), cfg, fp.Client())
+	if err != nil {
+		t.Fatalf("\t%s\tShould be able to discover the provider : %v", failed, err)
+	}
+
+	t.Log("Given the need to log users in with an external provider.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen the user completes the flow.", testID)
+		{
+			id, err := login(t, fp, p, now, nil)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to exchange the code : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to exchange the code.", success, testID)
+
+			exp := oidc.Identity{Subject: "248289761001", Email: "gopher@example.com", EmailVerified: true, Name: "Gopher"}
+			if id != exp {
+				t.Fatalf("\t%s\tTest %d:\tShould get the identity back : got %+v", failed, testID, id)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the identity back.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the flow is tampered with.", testID)
+		{
+			_, err := login(t, fp, p, now, func(verifier, _ *string) { *verifier = "guessed" })
+			if err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould not exchange a code with the wrong verifier.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not exchange a code with the wrong verifier.", success, testID)
+
+			_, err = login(t, fp, p, now, func(_, nonce *string) { *nonce = "replayed" })
+			if errors.Cause(err) != oidc.ErrInvalidIDToken {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a token with the wrong nonce : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a token with the wrong nonce.", success, testID)
+
+			_, err = login(t, fp, p, now.Add(2*time.Hour), nil)
+			if errors.Cause(err) != oidc.ErrInvalidIDToken {
+				t.Fatalf("\t%s\tTest %d:\tShould reject an expired token : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject an expired token.", success, testID)
+
+			fp.overrides = jwt.MapClaims{"aud": "someone-else"}
+			_, err = login(t, fp, p, now, nil)
+			fp.overrides = nil
+			if errors.Cause(err) != oidc.ErrInvalidIDToken {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a token for another client : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a token for another client.", success, testID)
+		}
+
+		testID++
+		t.Logf("\tTest %d:\tWhen the provider rotates its key.", testID)
+		{
+			key, err := rsa.GenerateKey(rand.Reader, 2048)
+			if err != nil {
+				t.Fatalf("generating key: %v", err)
+			}
+			fp.mu.Lock()
+			fp.key, fp.kid = key, "key-2"
+			fp.mu.Unlock()
+
+			if _, err := login(t, fp, p, now, nil); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould refetch the key set : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refetch the key set.", success, testID)
+		}
+	}
+}
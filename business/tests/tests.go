@@ -13,6 +13,7 @@ import (
 
 	"github.com/cravtos/asperitas-backend/business/auth"
 	"github.com/cravtos/asperitas-backend/business/data/schema"
+	"github.com/cravtos/asperitas-backend/business/data/session"
 	"github.com/cravtos/asperitas-backend/business/data/user"
 	"github.com/cravtos/asperitas-backend/foundation/database"
 	"github.com/jmoiron/sqlx"
@@ -35,15 +36,23 @@ var (
 // required table structure but the database is otherwise empty. It returns
 // the database to use as well as a function to call at the end of the test.
 func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
+	log, db, _, teardown := NewUnitConfig(t)
+	return log, db, teardown
+}
+
+// NewUnitConfig is like NewUnit but also returns the configuration of the
+// database, for code which opens connections of its own.
+func NewUnitConfig(t *testing.T) (*log.Logger, *sqlx.DB, database.Config, func()) {
 	c := startContainer(t, dbImage, dbPort, dbArgs...)
 
-	db, err := database.Open(database.Config{
+	cfg := database.Config{
 		User:       "postgres",
 		Password:   "postgres",
 		Host:       c.Host,
 		Name:       "postgres",
 		DisableTLS: true,
-	})
+	}
+	db, err := database.Open(cfg)
 	if err != nil {
 		t.Fatalf("Opening database connection: %v", err)
 	}
@@ -83,7 +92,7 @@ func NewUnit(t *testing.T) (*log.Logger, *sqlx.DB, func()) {
 
 	log := log.New(os.Stdout, "TEST : ", log.LstdFlags|log.Lmicroseconds|log.Lshortfile)
 
-	return log, db, teardown
+	return log, db, cfg, teardown
 }
 
 // Test owns state for running and shutting down tests.
@@ -151,6 +160,16 @@ func (test *Test) Token(email, pass string) string {
 		test.t.Fatal(err)
 	}
 
+	ns := session.NewSession{
+		UserID:      claims.User.ID,
+		DateExpires: time.Unix(claims.ExpiresAt, 0),
+	}
+	ses, err := session.New(test.Log, test.DB).Create(context.Background(), ns, time.Now())
+	if err != nil {
+		test.t.Fatal(err)
+	}
+	claims.Id = ses.ID
+
 	token, err := test.Auth.GenerateToken(test.KID, claims)
 	if err != nil {
 		test.t.Fatal(err)
@@ -0,0 +1,151 @@
+// Package blob stores files like uploaded images behind a common interface,
+// so they can be kept on the local filesystem or in S3-compatible storage.
+package blob
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrNotFound is used when a blob is requested but does not exist.
+	ErrNotFound = errors.New("blob not found")
+
+	// ErrInvalidKey is used when a key is not made of the characters keys
+	// may contain.
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// keyRE is what keys look like. Keys are paths of one or more segments which
+// must not start with a dot, so they cannot escape where blobs are kept.
+var keyRE = regexp.MustCompile(`^[a-zA-Z0-9_-][a-zA-Z0-9_.-]*(/[a-zA-Z0-9_-][a-zA-Z0-9_.-]*)*$`)
+
+// ValidKey tells if key can name a blob.
+func ValidKey(key string) bool {
+	return len(key) <= 512 && keyRE.MatchString(key)
+}
+
+// BlobStore keeps blobs by their keys. Implementations must be safe for
+// concurrent use.
+type BlobStore interface {
+	// Put stores data under key, replacing what was stored there.
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+
+	// Get returns the blob stored under key and its content type. Callers
+	// have to close it.
+	Get(ctx context.Context, key string) (io.ReadCloser, string, error)
+
+	// Delete removes the blob stored under key. Deleting a blob which does
+	// not exist is not an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns where clients download the blob stored under key.
+	URL(key string) string
+}
+
+// =============================================================================
+
+// Local is a BlobStore which keeps blobs as files in a directory. The content
+// type is told by the extension of the key.
+type Local struct {
+	dir     string
+	baseURL string
+}
+
+// NewLocal constructs a Local store keeping blobs in dir, which is created
+// when missing. Blobs are downloaded from baseURL followed by their key.
+func NewLocal(dir string, baseURL string) (Local, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Local{}, errors.Wrapf(err, "creating blob directory %s", dir)
+	}
+	return Local{dir: dir, baseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// Put writes data to a temporary file first and renames it, so readers never
+// see half written blobs.
+func (l Local) Put(_ context.Context, key string, data []byte, _ string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "creating directory of %s", key)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return errors.Wrapf(err, "creating %s", key)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := io.Copy(f, bytes.NewReader(data)); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "writing %s", key)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "writing %s", key)
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return errors.Wrapf(err, "writing %s", key)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errors.Wrapf(err, "storing %s", key)
+	}
+	return nil
+}
+
+// Get opens the file of the blob.
+func (l Local) Get(_ context.Context, key string) (io.ReadCloser, string, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", ErrNotFound
+		}
+		return nil, "", errors.Wrapf(err, "opening %s", key)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return f, contentType, nil
+}
+
+// Delete removes the file of the blob.
+func (l Local) Delete(_ context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "deleting %s", key)
+	}
+	return nil
+}
+
+// URL returns the base URL followed by the key.
+func (l Local) URL(key string) string {
+	return l.baseURL + "/" + key
+}
+
+// path returns the file a valid key is kept in.
+func (l Local) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.dir, filepath.FromSlash(key)), nil
+}
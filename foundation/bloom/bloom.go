@@ -0,0 +1,77 @@
+// Package bloom provides a bloom filter: a compact set which may report false
+// positives but never false negatives.
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// Filter is a bloom filter. It is safe for concurrent reads once no more
+// values are added.
+type Filter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+// New constructs a Filter sized to hold n values with a false positive rate
+// of about p.
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+
+	// Optimal size and number of hash functions, see
+	// https://en.wikipedia.org/wiki/Bloom_filter#Optimal_number_of_hash_functions
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Ceil(math.Ln2 * float64(m) / float64(n)))
+	if k < 1 {
+		k = 1
+	}
+
+	return &Filter{
+		bits: make([]uint64, (m+63)/64),
+		m:    m,
+		k:    k,
+	}
+}
+
+// Add inserts value into the filter.
+func (f *Filter) Add(value []byte) {
+	h1, h2 := hashes(value)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+// Test reports whether value may be in the filter. A nil filter is empty.
+func (f *Filter) Test(value []byte) bool {
+	if f == nil {
+		return false
+	}
+
+	h1, h2 := hashes(value)
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hashes derives the two base hashes used for double hashing as described by
+// Kirsch and Mitzenmacher.
+func hashes(value []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(value)
+	sum := h.Sum64()
+
+	h2 := sum>>32 | 1
+	return sum, h2
+}
@@ -0,0 +1,53 @@
+package bloom_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/cravtos/asperitas-backend/foundation/bloom"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestFilter(t *testing.T) {
+	t.Log("Given the need to test values for membership.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen handling a thousand values.", testID)
+		{
+			const n = 1000
+			f := bloom.New(n, 0.01)
+			for i := 0; i < n; i++ {
+				f.Add([]byte(fmt.Sprintf("password%d", i)))
+			}
+
+			for i := 0; i < n; i++ {
+				if !f.Test([]byte(fmt.Sprintf("password%d", i))) {
+					t.Fatalf("\t%s\tTest %d:\tShould find every added value : password%d", failed, testID, i)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould find every added value.", success, testID)
+
+			var fp int
+			for i := 0; i < n; i++ {
+				if f.Test([]byte(fmt.Sprintf("other%d", i))) {
+					fp++
+				}
+			}
+			if fp > n/20 {
+				t.Fatalf("\t%s\tTest %d:\tShould have few false positives : %d", failed, testID, fp)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have few false positives.", success, testID)
+
+			var empty *bloom.Filter
+			if empty.Test([]byte("password0")) {
+				t.Fatalf("\t%s\tTest %d:\tShould treat a nil filter as empty.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould treat a nil filter as empty.", success, testID)
+		}
+	}
+}
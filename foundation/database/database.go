@@ -6,11 +6,17 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq" // The database driver in use.
+	"github.com/lib/pq" // The database driver in use.
+	"github.com/pkg/errors"
 )
 
+// uniqueViolation is the postgres error code reported when a unique
+// constraint is violated.
+const uniqueViolation = "23505"
+
 // Config is the required properties to use the database.
 type Config struct {
 	User       string
@@ -22,6 +28,17 @@ type Config struct {
 
 // Open knows how to open a database connection based on the configuration.
 func Open(cfg Config) (*sqlx.DB, error) {
+	return sqlx.Open("postgres", connString(cfg))
+}
+
+// NewListener opens a dedicated connection which receives notifications
+// sent with NOTIFY. It reconnects on its own and tells report about it.
+func NewListener(cfg Config, report pq.EventCallbackType) *pq.Listener {
+	return pq.NewListener(connString(cfg), 10*time.Second, time.Minute, report)
+}
+
+// connString builds the connection string of the configuration.
+func connString(cfg Config) string {
 	sslMode := "require"
 	if cfg.DisableTLS {
 		sslMode = "disable"
@@ -39,7 +56,7 @@ func Open(cfg Config) (*sqlx.DB, error) {
 		RawQuery: q.Encode(),
 	}
 
-	return sqlx.Open("postgres", u.String())
+	return u.String()
 }
 
 // StatusCheck returns nil if it can successfully talk to the database. It
@@ -55,6 +72,16 @@ func StatusCheck(ctx context.Context, db *sqlx.DB) error {
 	return db.QueryRowContext(ctx, q).Scan(&tmp)
 }
 
+// UniqueViolation shows whether err was caused by a unique constraint
+// violation, for example when inserting a duplicate key. It also returns the
+// name of the violated constraint or index.
+func UniqueViolation(err error) (string, bool) {
+	if pqErr, ok := errors.Cause(err).(*pq.Error); ok && pqErr.Code == uniqueViolation {
+		return pqErr.Constraint, true
+	}
+	return "", false
+}
+
 // Log provides a pretty print version of the query and parameters.
 func Log(query string, args ...interface{}) string {
 	for i, arg := range args {
@@ -68,6 +95,16 @@ func Log(query string, args ...interface{}) string {
 			a = string(v)
 		case []string:
 			a = strings.Join(v, ",")
+		case *string:
+			a = "NULL"
+			if v != nil {
+				a = fmt.Sprintf("%q", *v)
+			}
+		case *time.Time:
+			a = "NULL"
+			if v != nil {
+				a = v.String()
+			}
 		default:
 			a = fmt.Sprintf("%v", v)
 		}
@@ -0,0 +1,280 @@
+// Package feed renders lists of entries as RSS 2.0, Atom and JSON Feed
+// documents for feed readers.
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"time"
+)
+
+// Content types of the formats.
+const (
+	ContentTypeRSS  = "application/rss+xml; charset=utf-8"
+	ContentTypeAtom = "application/atom+xml; charset=utf-8"
+	ContentTypeJSON = "application/feed+json; charset=utf-8"
+)
+
+// Feed is a list of entries. Link is the page the feed is about and Self is
+// where the feed itself is served.
+type Feed struct {
+	Title       string
+	Description string
+	Link        string
+	Self        string
+	Updated     time.Time
+	Items       []Item
+}
+
+// Item is a single entry of a feed. ID never changes for the same entry.
+// Link is where the entry points to and Comments, when set, is where it is
+// discussed. Updated is set when the entry changed after it was published.
+type Item struct {
+	ID        string
+	Title     string
+	Link      string
+	Comments  string
+	Author    string
+	Content   string
+	Published time.Time
+	Updated   time.Time
+}
+
+// updated returns when the item changed last.
+func (it Item) updated() time.Time {
+	if it.Updated.After(it.Published) {
+		return it.Updated
+	}
+	return it.Published
+}
+
+// LastModified returns when the feed changed last. Feeds which do not say
+// that themselves changed when their latest item changed, and empty ones
+// never did.
+func (f Feed) LastModified() time.Time {
+	if !f.Updated.IsZero() {
+		return f.Updated
+	}
+	var t time.Time
+	for _, it := range f.Items {
+		if u := it.updated(); u.After(t) {
+			t = u
+		}
+	}
+	return t
+}
+
+// =============================================================================
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Self          *rssSelf  `xml:"atom:link,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssSelf struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	Comments    string  `xml:"comments,omitempty"`
+	Creator     string  `xml:"dc:creator,omitempty"`
+	Description string  `xml:"description,omitempty"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// RSS renders the feed as an RSS 2.0 document.
+func RSS(f Feed) ([]byte, error) {
+	doc := rss{
+		Version: "2.0",
+		Atom:    "http://www.w3.org/2005/Atom",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       f.Title,
+			Link:        f.Link,
+			Description: f.Description,
+		},
+	}
+	if f.Self != "" {
+		doc.Channel.Self = &rssSelf{Href: f.Self, Rel: "self", Type: "application/rss+xml"}
+	}
+	if t := f.LastModified(); !t.IsZero() {
+		doc.Channel.LastBuildDate = t.UTC().Format(time.RFC1123Z)
+	}
+	for _, it := range f.Items {
+		doc.Channel.Items = append(doc.Channel.Items, rssItem{
+			Title:       it.Title,
+			Link:        it.Link,
+			GUID:        rssGUID{Value: it.ID},
+			Comments:    it.Comments,
+			Creator:     it.Author,
+			Description: it.Content,
+			PubDate:     it.Published.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return marshalXML(doc)
+}
+
+// =============================================================================
+
+type atom struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published"`
+	Links     []atomLink  `xml:"link"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Content   *atomText   `xml:"content,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Atom renders the feed as an Atom document.
+func Atom(f Feed) ([]byte, error) {
+	updated := f.LastModified()
+	if updated.IsZero() {
+		updated = time.Unix(0, 0)
+	}
+
+	doc := atom{
+		Title:    f.Title,
+		Subtitle: f.Description,
+		ID:       f.Link,
+		Updated:  updated.UTC().Format(time.RFC3339),
+		Links:    []atomLink{{Href: f.Link, Rel: "alternate", Type: "text/html"}},
+	}
+	if f.Self != "" {
+		doc.Links = append(doc.Links, atomLink{Href: f.Self, Rel: "self", Type: "application/atom+xml"})
+	}
+	for _, it := range f.Items {
+		e := atomEntry{
+			Title:     it.Title,
+			ID:        it.ID,
+			Updated:   it.updated().UTC().Format(time.RFC3339),
+			Published: it.Published.UTC().Format(time.RFC3339),
+			Links:     []atomLink{{Href: it.Link, Rel: "alternate"}},
+		}
+		if it.Comments != "" {
+			e.Links = append(e.Links, atomLink{Href: it.Comments, Rel: "related", Type: "text/html"})
+		}
+		if it.Author != "" {
+			e.Author = &atomAuthor{Name: it.Author}
+		}
+		if it.Content != "" {
+			e.Content = &atomText{Type: "text", Value: it.Content}
+		}
+		doc.Entries = append(doc.Entries, e)
+	}
+	return marshalXML(doc)
+}
+
+// marshalXML renders doc as a standalone XML document.
+func marshalXML(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// =============================================================================
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url,omitempty"`
+	FeedURL     string         `json:"feed_url,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	ExternalURL   string           `json:"external_url,omitempty"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// JSON renders the feed as a JSON Feed 1.1 document. Items which are
+// discussed elsewhere point there and link to what they are about.
+func JSON(f Feed) ([]byte, error) {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.Self,
+		Description: f.Description,
+		Items:       []jsonFeedItem{},
+	}
+	for _, it := range f.Items {
+		item := jsonFeedItem{
+			ID:            it.ID,
+			URL:           it.Link,
+			Title:         it.Title,
+			ContentText:   it.Content,
+			DatePublished: it.Published.UTC().Format(time.RFC3339),
+		}
+		if it.Comments != "" {
+			item.URL = it.Comments
+			item.ExternalURL = it.Link
+		}
+		if it.Author != "" {
+			item.Authors = []jsonFeedAuthor{{Name: it.Author}}
+		}
+		doc.Items = append(doc.Items, item)
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,155 @@
+package feed_test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/feed"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+var f = feed.Feed{
+	Title: "a/music",
+	Link:  "https://example.com/a/music",
+	Self:  "https://api.example.com/api/posts/music.rss",
+	Items: []feed.Item{
+		{
+			ID:        "urn:uuid:1",
+			Title:     "Fresh <album>",
+			Link:      "https://bandcamp.com/album?a=1&b=2",
+			Comments:  "https://example.com/a/music/1",
+			Author:    "bill",
+			Published: time.Date(2020, time.May, 2, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:        "urn:uuid:2",
+			Title:     "What are you listening to?",
+			Link:      "https://example.com/a/music/2",
+			Content:   "Tell us & share",
+			Author:    "ann",
+			Published: time.Date(2020, time.May, 1, 10, 0, 0, 0, time.UTC),
+		},
+	},
+}
+
+func TestFeed(t *testing.T) {
+	t.Log("Given the need to render posts for feed readers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen rendering RSS.", testID)
+		{
+			data, err := feed.RSS(f)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to render RSS : %v", failed, testID, err)
+			}
+
+			var doc struct {
+				Channel struct {
+					LastBuildDate string `xml:"lastBuildDate"`
+					Items         []struct {
+						Title    string `xml:"title"`
+						Link     string `xml:"link"`
+						GUID     string `xml:"guid"`
+						Comments string `xml:"comments"`
+					} `xml:"item"`
+				} `xml:"channel"`
+			}
+			if err := xml.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould render valid XML : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould render valid XML.", success, testID)
+
+			items := doc.Channel.Items
+			if len(items) != 2 || items[0].Title != "Fresh <album>" || items[0].Link != "https://bandcamp.com/album?a=1&b=2" {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the items : %+v", failed, testID, items)
+			}
+			if items[0].GUID != "urn:uuid:1" || items[0].Comments != "https://example.com/a/music/1" {
+				t.Fatalf("\t%s\tTest %d:\tShould identify items and link their discussion : %+v", failed, testID, items[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the items.", success, testID)
+
+			if doc.Channel.LastBuildDate != "Sat, 02 May 2020 10:00:00 +0000" {
+				t.Fatalf("\t%s\tTest %d:\tShould date the feed by its newest item : %s", failed, testID, doc.Channel.LastBuildDate)
+			}
+			t.Logf("\t%s\tTest %d:\tShould date the feed by its newest item.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen rendering Atom.", testID)
+		{
+			data, err := feed.Atom(f)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to render Atom : %v", failed, testID, err)
+			}
+
+			var doc struct {
+				XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+				Updated string   `xml:"updated"`
+				Entries []struct {
+					ID    string `xml:"id"`
+					Links []struct {
+						Href string `xml:"href,attr"`
+						Rel  string `xml:"rel,attr"`
+					} `xml:"link"`
+					Author struct {
+						Name string `xml:"name"`
+					} `xml:"author"`
+				} `xml:"entry"`
+			}
+			if err := xml.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould render valid Atom : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould render valid Atom.", success, testID)
+
+			if doc.Updated != "2020-05-02T10:00:00Z" || len(doc.Entries) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the entries : %+v", failed, testID, doc)
+			}
+			e := doc.Entries[0]
+			if e.ID != "urn:uuid:1" || e.Author.Name != "bill" || len(e.Links) != 2 || e.Links[0].Rel != "alternate" || e.Links[1].Rel != "related" {
+				t.Fatalf("\t%s\tTest %d:\tShould link entries to what they share and their discussion : %+v", failed, testID, e)
+			}
+			t.Logf("\t%s\tTest %d:\tShould link entries to what they share and their discussion.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen rendering JSON Feed.", testID)
+		{
+			data, err := feed.JSON(f)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to render JSON Feed : %v", failed, testID, err)
+			}
+
+			var doc struct {
+				Version string `json:"version"`
+				Items   []struct {
+					URL         string `json:"url"`
+					ExternalURL string `json:"external_url"`
+				} `json:"items"`
+			}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould render valid JSON : %v", failed, testID, err)
+			}
+			if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") || len(doc.Items) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould render a JSON Feed : %s", failed, testID, data)
+			}
+			if doc.Items[0].URL != "https://example.com/a/music/1" || doc.Items[0].ExternalURL != "https://bandcamp.com/album?a=1&b=2" {
+				t.Fatalf("\t%s\tTest %d:\tShould point link posts at what they share : %+v", failed, testID, doc.Items[0])
+			}
+			t.Logf("\t%s\tTest %d:\tShould point link posts at what they share.", success, testID)
+
+			empty, err := feed.JSON(feed.Feed{Title: "empty"})
+			if err != nil || !strings.Contains(string(empty), `"items":[]`) {
+				t.Fatalf("\t%s\tTest %d:\tShould render empty feeds with no items : %s", failed, testID, empty)
+			}
+			t.Logf("\t%s\tTest %d:\tShould render empty feeds with no items.", success, testID)
+		}
+	}
+}
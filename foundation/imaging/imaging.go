@@ -0,0 +1,276 @@
+// Package imaging checks uploaded images, strips what they say about where
+// and how they were taken, and makes thumbnails of them. Everything is done
+// in pure Go with the image packages of the standard library.
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	_ "image/png" // registers the PNG decoder
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrUnsupportedType occurs when data is not a JPEG, PNG or GIF image.
+	ErrUnsupportedType = errors.New("only jpeg, png and gif images are supported")
+
+	// ErrTooLarge occurs when an image has more pixels than allowed.
+	ErrTooLarge = errors.New("image has too many pixels")
+
+	// ErrInvalidImage occurs when data claims to be an image but cannot be
+	// decoded.
+	ErrInvalidImage = errors.New("image cannot be decoded")
+)
+
+// Content types of the supported images.
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	GIF  = "image/gif"
+)
+
+// Extensions maps the content types of supported images to the extension
+// their files get.
+var Extensions = map[string]string{
+	JPEG: ".jpg",
+	PNG:  ".png",
+	GIF:  ".gif",
+}
+
+// Config limits the images which are accepted and sets how big thumbnails
+// are.
+type Config struct {
+	MaxPixels     int
+	ThumbnailSize int
+}
+
+// Image is an uploaded image ready to be stored. Data is the image without
+// metadata, Thumbnail a JPEG whose longer side is at most ThumbnailSize.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	Thumbnail   []byte
+}
+
+// Sniff tells the content type of data by looking at its first bytes. The
+// name and content type clients send are not trusted.
+func Sniff(data []byte) (string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := Extensions[contentType]; !ok {
+		return "", ErrUnsupportedType
+	}
+	return contentType, nil
+}
+
+// Process checks that data is a supported image within the limits of cfg
+// and strips its metadata. JPEG images which are stored rotated are turned
+// upright, since the orientation goes along with the rest of the EXIF data.
+func Process(data []byte, cfg Config) (Image, error) {
+	if cfg.MaxPixels <= 0 {
+		cfg.MaxPixels = 40000000
+	}
+	if cfg.ThumbnailSize <= 0 {
+		cfg.ThumbnailSize = 320
+	}
+
+	contentType, err := Sniff(data)
+	if err != nil {
+		return Image{}, err
+	}
+
+	ic, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+	if ic.Width <= 0 || ic.Height <= 0 {
+		return Image{}, ErrInvalidImage
+	}
+	if ic.Width > cfg.MaxPixels/ic.Height {
+		return Image{}, ErrTooLarge
+	}
+
+	var stripped []byte
+	var orientation int
+	switch contentType {
+	case JPEG:
+		stripped, orientation, err = stripJPEG(data)
+	case PNG:
+		stripped, err = stripPNG(data)
+	case GIF:
+		stripped, err = stripGIF(data, cfg.MaxPixels)
+	}
+	if err != nil {
+		return Image{}, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(stripped))
+	if err != nil {
+		return Image{}, ErrInvalidImage
+	}
+
+	if orientation > 1 && orientation <= 8 {
+		img = orient(img, orientation)
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, img, &jpeg.Options{Quality: 90}); err != nil {
+			return Image{}, errors.Wrap(err, "encoding upright image")
+		}
+		stripped = b.Bytes()
+	}
+
+	thumb, err := Thumbnail(img, cfg.ThumbnailSize)
+	if err != nil {
+		return Image{}, err
+	}
+
+	bounds := img.Bounds()
+	ni := Image{
+		Data:        stripped,
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Thumbnail:   thumb,
+	}
+	return ni, nil
+}
+
+// Thumbnail scales img down so its longer side is at most size and encodes
+// it as a JPEG. Transparent parts become white. Images which are small
+// enough keep their size.
+func Thumbnail(img image.Image, size int) ([]byte, error) {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, h*size/w
+		} else {
+			tw, th = w*size/h, size
+		}
+	}
+	if tw < 1 {
+		tw = 1
+	}
+	if th < 1 {
+		th = 1
+	}
+
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Over)
+
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, scale(src, tw, th), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, errors.Wrap(err, "encoding thumbnail")
+	}
+	return b.Bytes(), nil
+}
+
+// scale shrinks src to w by h pixels. Every pixel is the average of the
+// pixels of src it covers.
+func scale(src *image.RGBA, w int, h int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		y0, y1 := y*sh/h, (y+1)*sh/h
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := x*sw/w, (x+1)*sw/w
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride+x0*4 : sy*src.Stride+x1*4]
+				for i := 0; i < len(row); i += 4 {
+					sum[0] += int(row[i])
+					sum[1] += int(row[i+1])
+					sum[2] += int(row[i+2])
+					sum[3] += int(row[i+3])
+				}
+			}
+
+			n := (x1 - x0) * (y1 - y0)
+			i := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8((sum[c] + n/2) / n)
+			}
+		}
+	}
+	return dst
+}
+
+// orient turns an image stored with the EXIF orientation o upright.
+func orient(src image.Image, o int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+// =============================================================================
+
+// stripGIF encodes the frames of a GIF again, which leaves out comments and
+// application data other than how often it loops. Animations with more
+// pixels in all of their frames than maxPixels are refused.
+func stripGIF(data []byte, maxPixels int) ([]byte, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	var pixels int
+	for _, frame := range g.Image {
+		b := frame.Bounds()
+		pixels += b.Dx() * b.Dy()
+		if pixels > maxPixels {
+			return nil, ErrTooLarge
+		}
+	}
+
+	var b bytes.Buffer
+	if err := gif.EncodeAll(&b, g); err != nil {
+		return nil, errors.Wrap(err, "encoding gif")
+	}
+	return b.Bytes(), nil
+}
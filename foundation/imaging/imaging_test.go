@@ -0,0 +1,213 @@
+package imaging_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/cravtos/asperitas-backend/foundation/imaging"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestProcess(t *testing.T) {
+	cfg := imaging.Config{MaxPixels: 1000000, ThumbnailSize: 32}
+
+	t.Log("Given the need to accept uploaded images.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen uploading a rotated JPEG with EXIF data and a comment.", testID)
+		{
+			data := withJPEGSegments(encodeJPEG(t, corner(80, 40)), exifSegment(6), comSegment("taken at 52.5200N 13.4050E"))
+
+			img, err := imaging.Process(data, cfg)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to process it : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to process it.", success, testID)
+
+			if bytes.Contains(img.Data, []byte("Exif")) || bytes.Contains(img.Data, []byte("52.5200N")) {
+				t.Fatalf("\t%s\tTest %d:\tShould strip the metadata.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould strip the metadata.", success, testID)
+
+			if img.ContentType != imaging.JPEG || img.Width != 40 || img.Height != 80 {
+				t.Logf("\t\tTest %d:\tgot : %s %dx%d", testID, img.ContentType, img.Width, img.Height)
+				t.Fatalf("\t%s\tTest %d:\tShould be turned upright.", failed, testID)
+			}
+			upright, err := jpeg.Decode(bytes.NewReader(img.Data))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to decode the result : %v", failed, testID, err)
+			}
+			// The red top left corner ends up top right when turned clockwise.
+			if !reddish(upright.At(35, 5)) || reddish(upright.At(5, 5)) {
+				t.Fatalf("\t%s\tTest %d:\tShould be turned clockwise.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be turned upright.", success, testID)
+
+			thumb, err := jpeg.DecodeConfig(bytes.NewReader(img.Thumbnail))
+			if err != nil || thumb.Width != 16 || thumb.Height != 32 {
+				t.Logf("\t\tTest %d:\tgot : %dx%d %v", testID, thumb.Width, thumb.Height, err)
+				t.Fatalf("\t%s\tTest %d:\tShould make a thumbnail of at most 32 pixels.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould make a thumbnail of at most 32 pixels.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen uploading a PNG with text chunks.", testID)
+		{
+			var b bytes.Buffer
+			if err := png.Encode(&b, corner(20, 10)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to encode the PNG : %v", failed, testID, err)
+			}
+			data := b.Bytes()
+			// The text goes right after the IHDR chunk.
+			data = append(append(append([]byte{}, data[:33]...), pngChunk("tEXt", "Author\x00Jane Doe")...), data[33:]...)
+
+			img, err := imaging.Process(data, cfg)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to process it : %v", failed, testID, err)
+			}
+			if bytes.Contains(img.Data, []byte("Jane Doe")) {
+				t.Fatalf("\t%s\tTest %d:\tShould strip the text.", failed, testID)
+			}
+			if _, err := png.Decode(bytes.NewReader(img.Data)); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould still be a valid PNG : %v", failed, testID, err)
+			}
+			if img.ContentType != imaging.PNG || img.Width != 20 || img.Height != 10 {
+				t.Logf("\t\tTest %d:\tgot : %s %dx%d", testID, img.ContentType, img.Width, img.Height)
+				t.Fatalf("\t%s\tTest %d:\tShould keep its size.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould strip the text and keep the image.", success, testID)
+		}
+
+		testID = 2
+		t.Logf("\tTest %d:\tWhen uploading an animated GIF.", testID)
+		{
+			pal := color.Palette{color.White, color.Black}
+			g := gif.GIF{
+				Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 8, 8), pal), image.NewPaletted(image.Rect(0, 0, 8, 8), pal)},
+				Delay: []int{10, 10},
+			}
+			var b bytes.Buffer
+			if err := gif.EncodeAll(&b, &g); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to encode the GIF : %v", failed, testID, err)
+			}
+
+			img, err := imaging.Process(b.Bytes(), cfg)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to process it : %v", failed, testID, err)
+			}
+			got, err := gif.DecodeAll(bytes.NewReader(img.Data))
+			if err != nil || len(got.Image) != 2 {
+				t.Fatalf("\t%s\tTest %d:\tShould keep the frames : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould keep the frames.", success, testID)
+		}
+
+		testID = 3
+		t.Logf("\tTest %d:\tWhen uploading something else.", testID)
+		{
+			tests := []struct {
+				name string
+				data []byte
+				cfg  imaging.Config
+				err  error
+			}{
+				{"html", []byte("<html><body>hi</body></html>"), cfg, imaging.ErrUnsupportedType},
+				{"empty", nil, cfg, imaging.ErrUnsupportedType},
+				{"truncated", encodeJPEG(t, corner(80, 40))[:20], cfg, imaging.ErrInvalidImage},
+				{"too many pixels", encodeJPEG(t, corner(80, 40)), imaging.Config{MaxPixels: 1000}, imaging.ErrTooLarge},
+			}
+			for _, tt := range tests {
+				if _, err := imaging.Process(tt.data, tt.cfg); err != tt.err {
+					t.Fatalf("\t%s\tTest %d:\tShould refuse %s with %v : %v", failed, testID, tt.name, tt.err, err)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse it.", success, testID)
+		}
+	}
+}
+
+// corner returns a blue image with a red top left corner.
+func corner(w int, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{B: 255, A: 255}
+			if x < 10 && y < 10 {
+				c = color.RGBA{R: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// reddish tells if c is more red than blue.
+func reddish(c color.Color) bool {
+	r, _, b, _ := c.RGBA()
+	return r > b
+}
+
+func encodeJPEG(t *testing.T, img image.Image) []byte {
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, img, nil); err != nil {
+		t.Fatalf("encoding jpeg: %v", err)
+	}
+	return b.Bytes()
+}
+
+// withJPEGSegments inserts segments right after the start of the image.
+func withJPEGSegments(data []byte, segments ...[]byte) []byte {
+	out := append([]byte{}, data[:2]...)
+	for _, s := range segments {
+		out = append(out, s...)
+	}
+	return append(out, data[2:]...)
+}
+
+// exifSegment returns an APP1 segment with a big endian EXIF directory
+// holding only the orientation.
+func exifSegment(orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	return segment(0xE1, append([]byte("Exif\x00\x00"), tiff.Bytes()...))
+}
+
+// comSegment returns a comment segment.
+func comSegment(text string) []byte {
+	return segment(0xFE, []byte(text))
+}
+
+func segment(marker byte, payload []byte) []byte {
+	s := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(s[2:], uint16(len(payload)+2))
+	return append(s, payload...)
+}
+
+// pngChunk returns a PNG chunk with its checksum.
+func pngChunk(kind string, data string) []byte {
+	c := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(c, uint32(len(data)))
+	c = append(c, kind+data...)
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(c[4:]))
+	return append(c, sum...)
+}
@@ -0,0 +1,168 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// JPEG markers which matter when walking the segments of a file.
+const (
+	markerSOI  = 0xD8 // start of image
+	markerSOS  = 0xDA // start of scan, entropy coded data follows
+	markerAPP0 = 0xE0 // JFIF
+	markerAPP1 = 0xE1 // EXIF and XMP
+	markerAPP2 = 0xE2 // ICC profile
+	markerAPPE = 0xEE // Adobe, tells how colors are transformed
+	markerAPPF = 0xEF
+	markerCOM  = 0xFE // comment
+)
+
+// stripJPEG removes application segments and comments from a JPEG without
+// decoding it, so the image itself stays as it was. Only the segments which
+// are needed to show the colors right are kept. The orientation found in the
+// EXIF data is returned, 0 when there is none.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, 0, ErrInvalidImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	orientation := 0
+
+	i := 2
+	for {
+		// Markers may be padded with any number of 0xFF.
+		if i >= len(data) || data[i] != 0xFF {
+			return nil, 0, ErrInvalidImage
+		}
+		for i < len(data) && data[i] == 0xFF {
+			i++
+		}
+		if i+2 >= len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		marker := data[i]
+		length := int(binary.BigEndian.Uint16(data[i+1:]))
+		end := i + 1 + length
+		if length < 2 || end > len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		segment := data[i+3 : end]
+
+		switch {
+		case marker == markerSOS:
+			// The rest is image data, which keeps no metadata.
+			out = append(out, 0xFF)
+			out = append(out, data[i:]...)
+			return out, orientation, nil
+		case marker == markerAPP1:
+			if o := exifOrientation(segment); o != 0 {
+				orientation = o
+			}
+		case marker == markerCOM, marker >= markerAPP0 && marker <= markerAPPF && !keepAPP(marker):
+		default:
+			out = append(out, 0xFF)
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// keepAPP tells if an application segment is needed to decode the image.
+func keepAPP(marker byte) bool {
+	return marker == markerAPP0 || marker == markerAPP2 || marker == markerAPPE
+}
+
+// exifOrientation reads the orientation tag from the first directory of an
+// EXIF segment. It returns 0 when there is none.
+func exifOrientation(segment []byte) int {
+	const tagOrientation = 0x0112
+
+	if !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+		return 0
+	}
+	tiff := segment[6:]
+	if len(tiff) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == tagOrientation {
+			o := int(order.Uint16(tiff[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
+
+// =============================================================================
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadata are the chunks which only describe an image: EXIF data, text
+// and when it was last changed.
+var pngMetadata = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+// stripPNG removes the chunks listed in pngMetadata from a PNG without
+// decoding it. Chunk checksums are checked by the decoder later.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidImage
+	}
+
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+
+	i := len(pngSignature)
+	for i < len(data) {
+		if i+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		kind := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) || end < i {
+			return nil, ErrInvalidImage
+		}
+
+		if !pngMetadata[kind] {
+			out = append(out, data[i:end]...)
+		}
+		i = end
+
+		if kind == "IEND" {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,178 @@
+// Package mail provides support for sending emails to users.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Bytes renders msg in the Internet Message Format as sent from "from".
+func (msg Message) Bytes(from string, now time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(msg.Body, "\n", "\r\n", -1))
+	return b.Bytes()
+}
+
+// =============================================================================
+
+// SMTPConfig is the required properties to send mail using an SMTP server.
+type SMTPConfig struct {
+	Host     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+// SMTP is a Mailer which delivers messages to an SMTP server.
+type SMTP struct {
+	cfg SMTPConfig
+}
+
+// NewSMTP constructs an SMTP mailer.
+func NewSMTP(cfg SMTPConfig) SMTP {
+	return SMTP{cfg: cfg}
+}
+
+// Send implements Mailer.
+func (s SMTP) Send(ctx context.Context, msg Message) error {
+	host, _, err := net.SplitHostPort(s.cfg.Host)
+	if err != nil {
+		return errors.Wrap(err, "parsing smtp host")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.cfg.Host)
+	if err != nil {
+		return errors.Wrap(err, "dialing smtp server")
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return errors.Wrap(err, "starting smtp session")
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(nil); err != nil {
+			return errors.Wrap(err, "starting tls")
+		}
+	}
+
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, host)
+		if err := c.Auth(auth); err != nil {
+			return errors.Wrap(err, "authenticating")
+		}
+	}
+
+	from, err := netmail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return errors.Wrap(err, "parsing sender")
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return errors.Wrap(err, "setting sender")
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return errors.Wrap(err, "setting recipient")
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return errors.Wrap(err, "starting data")
+	}
+	if _, err := w.Write(msg.Bytes(s.cfg.From, time.Now())); err != nil {
+		return errors.Wrap(err, "writing message")
+	}
+	if err := w.Close(); err != nil {
+		return errors.Wrap(err, "finishing message")
+	}
+
+	return c.Quit()
+}
+
+// =============================================================================
+
+// Log is a Mailer which writes messages to a logger instead of sending them.
+// It is meant for local development.
+type Log struct {
+	log *log.Logger
+}
+
+// NewLog constructs a Log mailer.
+func NewLog(log *log.Logger) Log {
+	return Log{log: log}
+}
+
+// Send implements Mailer.
+func (l Log) Send(_ context.Context, msg Message) error {
+	l.log.Printf("mail: to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// =============================================================================
+
+// File is a Mailer which stores every message as an .eml file in a
+// directory. It is meant for local development and tests.
+type File struct {
+	dir  string
+	from string
+	seq  *uint64
+}
+
+// NewFile constructs a File mailer writing into dir. The directory is
+// created if it does not exist.
+func NewFile(dir string, from string) (File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return File{}, errors.Wrap(err, "creating mail directory")
+	}
+	return File{dir: dir, from: from, seq: new(uint64)}, nil
+}
+
+// Send implements Mailer.
+func (f File) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+	name := fmt.Sprintf("%s-%06d.eml", now.UTC().Format("20060102T150405"), atomic.AddUint64(f.seq, 1))
+
+	if err := ioutil.WriteFile(filepath.Join(f.dir, name), msg.Bytes(f.from, now), 0o644); err != nil {
+		return errors.Wrap(err, "writing message")
+	}
+	return nil
+}
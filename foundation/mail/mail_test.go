@@ -0,0 +1,68 @@
+package mail_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cravtos/asperitas-backend/foundation/mail"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestFile(t *testing.T) {
+	t.Log("Given the need to store mail locally.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen sending a single message.", testID)
+		{
+			dir, err := ioutil.TempDir("", "mail")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to create a directory : %v", failed, testID, err)
+			}
+			defer os.RemoveAll(dir)
+
+			m, err := mail.NewFile(filepath.Join(dir, "out"), "Asperitas <noreply@example.com>")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to construct the mailer : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to construct the mailer.", success, testID)
+
+			msg := mail.Message{
+				To:      "gopher@example.com",
+				Subject: "Reset your password",
+				Body:    "line one\nline two",
+			}
+			if err := m.Send(context.Background(), msg); err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to send : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to send.", success, testID)
+
+			files, err := filepath.Glob(filepath.Join(dir, "out", "*.eml"))
+			if err != nil || len(files) != 1 {
+				t.Fatalf("\t%s\tTest %d:\tShould have written one file : %v %v", failed, testID, files, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould have written one file.", success, testID)
+
+			b, err := ioutil.ReadFile(files[0])
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to read the file : %v", failed, testID, err)
+			}
+			got := string(b)
+			for _, want := range []string{"To: gopher@example.com\r\n", "Subject: Reset your password\r\n", "\r\n\r\nline one\r\nline two"} {
+				if !strings.Contains(got, want) {
+					t.Logf("\t\tTest %d:\tgot: %q", testID, got)
+					t.Fatalf("\t%s\tTest %d:\tShould contain %q.", failed, testID, want)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould contain the message.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/database"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// maxPayload is the biggest payload NOTIFY accepts.
+const maxPayload = 7999
+
+// publishTimeout is how long sending an event to the database may take.
+const publishTimeout = 5 * time.Second
+
+// outboxSize is how many events wait to be sent to the database before new
+// ones are dropped.
+const outboxSize = 256
+
+// message is how events travel through the database.
+type message struct {
+	Topic string          `json:"topic"`
+	Type  string          `json:"type"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// outgoing is an event waiting to be sent to the database.
+type outgoing struct {
+	topic   string
+	typ     string
+	payload string
+}
+
+// Postgres is a Bus which sends events through a channel of the database
+// with NOTIFY, so they reach the subscribers of every running instance of the
+// service. Data is sent as JSON, subscribers get it as json.RawMessage.
+// Events are sent by a goroutine of their own, so publishers do not wait for
+// the database.
+type Postgres struct {
+	log      *log.Logger
+	db       *sqlx.DB
+	channel  string
+	listener *pq.Listener
+	local    *Broker
+	outbox   chan outgoing
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+}
+
+// NewPostgres constructs a Postgres bus and starts listening on the channel.
+// Publishing goes through db, listening needs a connection of its own.
+func NewPostgres(log *log.Logger, db *sqlx.DB, cfg database.Config, channel string) (*Postgres, error) {
+	report := func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventDisconnected:
+			log.Printf("pubsub: disconnected from %s : %v", channel, err)
+		case pq.ListenerEventReconnected:
+			log.Printf("pubsub: reconnected to %s, events sent meanwhile were missed", channel)
+		case pq.ListenerEventConnectionAttemptFailed:
+			log.Printf("pubsub: connecting to %s : %v", channel, err)
+		}
+	}
+
+	listener := database.NewListener(cfg, report)
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	p := Postgres{
+		log:      log,
+		db:       db,
+		channel:  channel,
+		listener: listener,
+		local:    New(),
+		outbox:   make(chan outgoing, outboxSize),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go p.relay()
+	go p.send()
+
+	return &p, nil
+}
+
+// relay hands the events coming from the database to local subscribers.
+func (p *Postgres) relay() {
+	for n := range p.listener.Notify {
+
+		// A nil notification follows a reconnect.
+		if n == nil {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal([]byte(n.Extra), &msg); err != nil {
+			p.log.Printf("pubsub: decoding event : %v", err)
+			continue
+		}
+		p.local.Publish(msg.Topic, msg.Type, msg.Data)
+	}
+}
+
+// Publish implements Bus. Events too big for NOTIFY only reach the
+// subscribers of this instance.
+func (p *Postgres) Publish(topic string, typ string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		p.log.Printf("pubsub: encoding %s event : %v", typ, err)
+		return
+	}
+	payload, err := json.Marshal(message{Topic: topic, Type: typ, Data: raw})
+	if err != nil {
+		p.log.Printf("pubsub: encoding %s event : %v", typ, err)
+		return
+	}
+
+	if len(payload) > maxPayload {
+		p.log.Printf("pubsub: %s event on %s is too big to share, %d bytes", typ, topic, len(payload))
+		p.local.Publish(topic, typ, json.RawMessage(raw))
+		return
+	}
+
+	select {
+	case p.outbox <- outgoing{topic: topic, typ: typ, payload: string(payload)}:
+	default:
+		p.log.Printf("pubsub: dropping %s event on %s, too many are waiting to be sent", typ, topic)
+	}
+}
+
+// send hands queued events to the database until the bus is closed. Events
+// still waiting by then are sent before it returns.
+func (p *Postgres) send() {
+	defer close(p.stopped)
+
+	for {
+		select {
+		case out := <-p.outbox:
+			p.notify(out)
+		case <-p.done:
+			for {
+				select {
+				case out := <-p.outbox:
+					p.notify(out)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// notify sends a single event through the channel of the database.
+func (p *Postgres) notify(out outgoing) {
+	const q = `SELECT pg_notify($1, $2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	if _, err := p.db.ExecContext(ctx, q, p.channel, out.payload); err != nil {
+		p.log.Printf("pubsub: publishing %s event on %s : %v", out.typ, out.topic, err)
+	}
+}
+
+// Subscribe implements Bus.
+func (p *Postgres) Subscribe(topics ...string) *Subscription {
+	return p.local.Subscribe(topics...)
+}
+
+// Close implements Bus. It sends the events which are still waiting and
+// stops listening on the channel.
+func (p *Postgres) Close() {
+	p.once.Do(func() {
+		close(p.done)
+		<-p.stopped
+		p.listener.Close()
+		p.local.Close()
+	})
+}
@@ -0,0 +1,155 @@
+// Package pubsub provides an in-process publish/subscribe broker.
+package pubsub
+
+import (
+	"sync"
+)
+
+// buffer is how many events a subscription holds before it starts missing
+// new ones.
+const buffer = 32
+
+// Event is something which happened on a topic.
+type Event struct {
+	Topic string
+	Type  string
+	Data  interface{}
+}
+
+// Bus carries events from publishers to subscribers. Implementations must be
+// safe for concurrent use.
+type Bus interface {
+
+	// Publish sends an event to every subscriber of the topic without
+	// blocking. Subscribers which fall behind miss it.
+	Publish(topic string, typ string, data interface{})
+
+	// Subscribe starts receiving the events published on topics.
+	Subscribe(topics ...string) *Subscription
+
+	// Close stops every subscription.
+	Close()
+}
+
+// Broker is a Bus which fans events out to subscribers in the same process.
+// A nil Broker drops everything published to it.
+type Broker struct {
+	mu     sync.Mutex
+	topics map[string]map[*Subscription]struct{}
+	closed bool
+}
+
+// New constructs a Broker with no subscribers.
+func New() *Broker {
+	return &Broker{
+		topics: make(map[string]map[*Subscription]struct{}),
+	}
+}
+
+// Subscription receives the events of the topics it was made for on C. C is
+// closed when the subscription or the broker is closed.
+type Subscription struct {
+	C <-chan Event
+
+	c      chan Event
+	broker *Broker
+	topics []string
+}
+
+// Subscribe starts receiving the events published on topics.
+func (b *Broker) Subscribe(topics ...string) *Subscription {
+	c := make(chan Event, buffer)
+	s := Subscription{
+		C:      c,
+		c:      c,
+		broker: b,
+		topics: topics,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(c)
+		return &s
+	}
+	for _, t := range topics {
+		if b.topics[t] == nil {
+			b.topics[t] = make(map[*Subscription]struct{})
+		}
+		b.topics[t][&s] = struct{}{}
+	}
+	return &s
+}
+
+// Publish sends an event to every subscriber of the topic. It never blocks:
+// subscribers which fall behind miss the event.
+func (b *Broker) Publish(topic string, typ string, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ev := Event{
+		Topic: topic,
+		Type:  typ,
+		Data:  data,
+	}
+	for s := range b.topics[topic] {
+		select {
+		case s.c <- ev:
+		default:
+		}
+	}
+}
+
+// Close stops every subscription. Subscribing afterwards gives a closed
+// subscription.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	closed := make(map[*Subscription]bool)
+	for _, subs := range b.topics {
+		for s := range subs {
+			if !closed[s] {
+				closed[s] = true
+				close(s.c)
+			}
+		}
+	}
+	b.topics = nil
+}
+
+// Close stops receiving events. Closing it again does nothing.
+func (s *Subscription) Close() {
+	b := s.broker
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+
+	var found bool
+	for _, t := range s.topics {
+		if _, ok := b.topics[t][s]; ok {
+			found = true
+			delete(b.topics[t], s)
+			if len(b.topics[t]) == 0 {
+				delete(b.topics, t)
+			}
+		}
+	}
+	if found {
+		close(s.c)
+	}
+}
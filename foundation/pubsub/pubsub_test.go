@@ -0,0 +1,72 @@
+package pubsub_test
+
+import (
+	"testing"
+
+	"github.com/cravtos/asperitas-backend/foundation/pubsub"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestBroker(t *testing.T) {
+	b := pubsub.New()
+
+	t.Log("Given the need to fan events out to subscribers.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen events are published on topics.", testID)
+		{
+			s := b.Subscribe("post:1", "community:go")
+			other := b.Subscribe("post:2")
+
+			b.Publish("post:1", "comment.created", "hello")
+			b.Publish("community:go", "post.created", "world")
+
+			ev := <-s.C
+			if ev.Topic != "post:1" || ev.Type != "comment.created" || ev.Data != "hello" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive the first event : %+v", failed, testID, ev)
+			}
+			ev = <-s.C
+			if ev.Topic != "community:go" || ev.Type != "post.created" {
+				t.Fatalf("\t%s\tTest %d:\tShould receive events of every topic : %+v", failed, testID, ev)
+			}
+			t.Logf("\t%s\tTest %d:\tShould receive events of the subscribed topics in order.", success, testID)
+
+			select {
+			case ev := <-other.C:
+				t.Fatalf("\t%s\tTest %d:\tShould not receive events of other topics : %+v", failed, testID, ev)
+			default:
+			}
+			t.Logf("\t%s\tTest %d:\tShould not receive events of other topics.", success, testID)
+
+			s.Close()
+			s.Close()
+			b.Publish("post:1", "comment.created", "again")
+			if _, ok := <-s.C; ok {
+				t.Fatalf("\t%s\tTest %d:\tShould stop receiving once closed.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop receiving once closed.", success, testID)
+
+			for i := 0; i < 100; i++ {
+				b.Publish("post:2", "post.score", i)
+			}
+			t.Logf("\t%s\tTest %d:\tShould not block on subscribers which fall behind.", success, testID)
+
+			b.Close()
+			for range other.C {
+			}
+			if _, ok := <-b.Subscribe("post:3").C; ok {
+				t.Fatalf("\t%s\tTest %d:\tShould give closed subscriptions after closing.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould close subscriptions with the broker.", success, testID)
+
+			var nilBroker *pubsub.Broker
+			nilBroker.Publish("post:1", "post.removed", nil)
+			t.Logf("\t%s\tTest %d:\tShould drop events published on a nil broker.", success, testID)
+		}
+	}
+}
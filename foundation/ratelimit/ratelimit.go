@@ -0,0 +1,64 @@
+// Package ratelimit provides a fixed window request limiter kept in memory.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// pruneSize is the number of tracked keys after which finished windows are
+// dropped from memory.
+const pruneSize = 10000
+
+// window counts the requests of a key since start.
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter allows every key a number of requests per period.
+type Limiter struct {
+	mu      sync.Mutex
+	period  time.Duration
+	windows map[string]*window
+}
+
+// New constructs a Limiter counting requests over the given period.
+func New(period time.Duration) *Limiter {
+	return &Limiter{
+		period:  period,
+		windows: make(map[string]*window),
+	}
+}
+
+// Allow records a request for key and reports whether it is within limit.
+// When it is not, the returned duration tells when the next window opens.
+func (l *Limiter) Allow(key string, limit int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.windows) >= pruneSize {
+		l.prune(now)
+	}
+
+	w, ok := l.windows[key]
+	if !ok || !now.Before(w.start.Add(l.period)) {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= limit {
+		return false, w.start.Add(l.period).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// prune drops windows which are over. Caller must hold the lock.
+func (l *Limiter) prune(now time.Time) {
+	for key, w := range l.windows {
+		if !now.Before(w.start.Add(l.period)) {
+			delete(l.windows, key)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/ratelimit"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestLimiter(t *testing.T) {
+	l := ratelimit.New(time.Minute)
+	now := time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Log("Given the need to limit the number of requests.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a key makes too many requests.", testID)
+		{
+			for i := 0; i < 3; i++ {
+				if ok, _ := l.Allow("key", 3, now.Add(time.Duration(i)*time.Second)); !ok {
+					t.Fatalf("\t%s\tTest %d:\tShould allow request %d.", failed, testID, i)
+				}
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow requests within the limit.", success, testID)
+
+			ok, retry := l.Allow("key", 3, now.Add(20*time.Second))
+			if ok || retry != 40*time.Second {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse the request until the window ends : %v %v", failed, testID, ok, retry)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse the request until the window ends.", success, testID)
+
+			if ok, _ := l.Allow("other", 3, now.Add(20*time.Second)); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould count keys separately.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould count keys separately.", success, testID)
+
+			if ok, _ := l.Allow("key", 3, now.Add(time.Minute)); !ok {
+				t.Fatalf("\t%s\tTest %d:\tShould allow requests in the next window.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould allow requests in the next window.", success, testID)
+		}
+	}
+}
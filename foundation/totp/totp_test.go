@@ -0,0 +1,91 @@
+package totp_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/totp"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// secret is the RFC 6238 SHA1 test key "12345678901234567890" in base32.
+const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCode(t *testing.T) {
+	// Expected values are the last six digits of the RFC 6238 appendix B
+	// test vectors.
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	t.Log("Given the need to generate RFC 6238 codes.")
+	{
+		for testID, v := range vectors {
+			t.Logf("\tTest %d:\tWhen generating a code at %d.", testID, v.unix)
+			{
+				got, err := totp.Code(secret, time.Unix(v.unix, 0))
+				if err != nil {
+					t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code : %v", failed, testID, err)
+				}
+				if got != v.code {
+					t.Logf("\t\tTest %d:\texp: %s", testID, v.code)
+					t.Logf("\t\tTest %d:\tgot: %s", testID, got)
+					t.Fatalf("\t%s\tTest %d:\tShould get the expected code.", failed, testID)
+				}
+				t.Logf("\t%s\tTest %d:\tShould get the expected code.", success, testID)
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Log("Given the need to validate codes entered by users.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen validating codes around the current step.", testID)
+		{
+			s, err := totp.GenerateSecret()
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a secret : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould be able to generate a secret.", success, testID)
+
+			now := time.Date(2020, time.December, 1, 12, 0, 0, 0, time.UTC)
+			prev, err := totp.Code(s, now.Add(-totp.Period))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to generate a code : %v", failed, testID, err)
+			}
+
+			step, ok := totp.Validate(s, prev, now, 1)
+			if !ok || step != totp.Step(now)-1 {
+				t.Fatalf("\t%s\tTest %d:\tShould accept a code from the previous step.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept a code from the previous step.", success, testID)
+
+			if _, ok := totp.Validate(s, prev, now.Add(2*totp.Period), 1); ok {
+				t.Fatalf("\t%s\tTest %d:\tShould reject a code outside the skew window.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould reject a code outside the skew window.", success, testID)
+
+			uri := totp.URI("Asperitas", "gopher", s)
+			if !strings.HasPrefix(uri, "otpauth://totp/Asperitas:gopher?") || !strings.Contains(uri, "secret="+s) {
+				t.Fatalf("\t%s\tTest %d:\tShould build an otpauth URI : %s", failed, testID, uri)
+			}
+			t.Logf("\t%s\tTest %d:\tShould build an otpauth URI.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package unfurl
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits on how much of what a page says about itself is kept.
+const (
+	maxTitle       = 300
+	maxDescription = 1000
+)
+
+var (
+	// metaRE finds meta tags, titleRE the title of the page and headEndRE
+	// where the head ends, after which pages say nothing about themselves.
+	metaRE    = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	titleRE   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	headEndRE = regexp.MustCompile(`(?i)</head\s*>|<body[\s>]`)
+
+	// attrRE finds the attributes of a tag.
+	attrRE = regexp.MustCompile(`(?s)([a-zA-Z_:-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+)
+
+// Parse extracts the preview from the head of an HTML page found at base.
+// OpenGraph tags win over Twitter card tags, which win over the title and
+// description of the page.
+func Parse(page []byte, base *url.URL) Preview {
+	doc := strings.ToValidUTF8(string(page), "")
+	if loc := headEndRE.FindStringIndex(doc); loc != nil {
+		doc = doc[:loc[0]]
+	}
+
+	meta := make(map[string]string)
+	for _, tag := range metaRE.FindAllString(doc, -1) {
+		attrs := attributes(tag)
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		key = strings.ToLower(key)
+		if key == "" || attrs["content"] == "" {
+			continue
+		}
+		if _, ok := meta[key]; !ok {
+			meta[key] = attrs["content"]
+		}
+	}
+
+	var title string
+	if m := titleRE.FindStringSubmatch(doc); m != nil {
+		title = html.UnescapeString(m[1])
+	}
+
+	return Preview{
+		Title:       clean(first(meta["og:title"], meta["twitter:title"], title), maxTitle),
+		Description: clean(first(meta["og:description"], meta["twitter:description"], meta["description"]), maxDescription),
+		Image:       resolve(base, first(meta["og:image:secure_url"], meta["og:image"], meta["twitter:image"], meta["twitter:image:src"])),
+		SiteName:    clean(meta["og:site_name"], maxTitle),
+	}
+}
+
+// attributes returns the unescaped attributes of a tag by their lowercased
+// names.
+func attributes(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrRE.FindAllStringSubmatch(tag, -1) {
+		v := m[2]
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') {
+			v = v[1 : len(v)-1]
+		}
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(v)
+	}
+	return attrs
+}
+
+// first returns the first of values which is not empty.
+func first(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean collapses whitespace and cuts text to max characters.
+func clean(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) > max {
+		text = string([]rune(text)[:max-1]) + "…"
+	}
+	return text
+}
+
+// resolve makes ref absolute against base. Anything but http and https
+// URLs is dropped.
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if !supported(u) {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,233 @@
+// Package unfurl fetches web pages and extracts what they say about
+// themselves in OpenGraph, Twitter card and title tags. Only public
+// addresses are fetched so users cannot make us reach internal services.
+package unfurl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// ErrBlockedAddress occurs when a URL leads to an address which is not
+	// public, like loopback or private networks.
+	ErrBlockedAddress = errors.New("address is not public")
+
+	// ErrUnsupportedURL occurs when a URL is not an absolute http or https URL.
+	ErrUnsupportedURL = errors.New("only http and https URLs can be fetched")
+
+	// ErrTooManyRedirects occurs when a page redirects more than maxRedirects times.
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// maxRedirects is how many redirects are followed.
+const maxRedirects = 5
+
+// Config controls how pages are fetched. AllowPrivate lets the fetcher reach
+// any address and is meant for tests only.
+type Config struct {
+	Timeout      time.Duration
+	MaxBytes     int64
+	UserAgent    string
+	AllowPrivate bool
+}
+
+// Preview is what a page says about itself. Image is an absolute URL.
+type Preview struct {
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+}
+
+// Fetcher fetches pages within the limits of its Config.
+type Fetcher struct {
+	client    *http.Client
+	maxBytes  int64
+	userAgent string
+}
+
+// New constructs a Fetcher.
+func New(cfg Config) *Fetcher {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = 512 << 10
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = "asperitas-unfurl"
+	}
+
+	return &Fetcher{
+		client: &http.Client{
+			Transport:     Transport(cfg.AllowPrivate),
+			Timeout:       cfg.Timeout,
+			CheckRedirect: checkRedirect,
+		},
+		maxBytes:  cfg.MaxBytes,
+		userAgent: cfg.UserAgent,
+	}
+}
+
+// Transport returns an http.Transport which refuses to connect to addresses
+// which are not public unless allowPrivate is set. The check is done on the
+// address actually dialed, so names which resolve to internal addresses are
+// refused too. Proxies from the environment are not used since they would
+// dial on our behalf.
+func Transport(allowPrivate bool) *http.Transport {
+	dialer := net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = control
+	}
+
+	return &http.Transport{
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// Fetch gets the page at rawURL and extracts its preview. Pages which are
+// images preview as themselves.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || !supported(u) {
+		return Preview{}, ErrUnsupportedURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, errors.Wrap(err, "building request")
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,image/*;q=0.8")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, unwrap(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return Preview{}, fmt.Errorf("page responded with %s", resp.Status)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch {
+	case strings.HasPrefix(mediaType, "image/"):
+		return Preview{Image: resp.Request.URL.String()}, nil
+	case mediaType != "" && mediaType != "text/html" && mediaType != "application/xhtml+xml":
+		return Preview{}, fmt.Errorf("cannot preview %s", mediaType)
+	}
+
+	page, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return Preview{}, errors.Wrap(err, "reading page")
+	}
+
+	return Parse(page, resp.Request.URL), nil
+}
+
+// supported tells if the URL can be fetched.
+func supported(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && u.User == nil
+}
+
+// checkRedirect stops at maxRedirects and makes sure redirects stay on the
+// web. Addresses are checked when the redirect is dialed.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return ErrTooManyRedirects
+	}
+	if !supported(req.URL) {
+		return ErrUnsupportedURL
+	}
+	return nil
+}
+
+// unwrap returns our own errors from inside of the errors of the client so
+// callers can tell them apart.
+func unwrap(err error) error {
+	for _, e := range []error{ErrBlockedAddress, ErrUnsupportedURL, ErrTooManyRedirects} {
+		if errors.Is(err, e) {
+			return e
+		}
+	}
+	return err
+}
+
+// =============================================================================
+
+// blocked are the networks which must not be reached from the outside.
+var blocked = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",      // "this" network
+		"10.0.0.0/8",     // private
+		"100.64.0.0/10",  // carrier-grade NAT
+		"127.0.0.0/8",    // loopback
+		"169.254.0.0/16", // link local, cloud metadata
+		"172.16.0.0/12",  // private
+		"192.0.0.0/24",   // protocol assignments
+		"192.168.0.0/16", // private
+		"198.18.0.0/15",  // benchmarking
+		"224.0.0.0/4",    // multicast
+		"240.0.0.0/4",    // reserved, broadcast
+		"::/128",         // unspecified
+		"::1/128",        // loopback
+		"64:ff9b::/96",   // IPv4 translation
+		"fc00::/7",       // unique local
+		"fe80::/10",      // link local
+		"ff00::/8",       // multicast
+	}
+
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}()
+
+// Public tells if the IP is reachable from the internet.
+func Public(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range blocked {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// control refuses connections to addresses which are not public. It runs
+// after names are resolved, right before connecting.
+func control(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !Public(ip) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package unfurl_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/unfurl"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+const page = `<!DOCTYPE html>
+<html>
+<head>
+	<title>Plain &amp; simple</title>
+	<meta name="description" content="Fallback description">
+	<meta property="og:title" content="The   real
+		title">
+	<meta name="twitter:title" content="Twitter title">
+	<meta content='/images/cover.png' property='og:image'>
+	<meta property="og:site_name" content="Example">
+</head>
+<body>
+	<meta property="og:description" content="Not in the head">
+</body>
+</html>`
+
+func TestFetch(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("\x89PNG"))
+	})
+	mux.HandleFunc("/huge", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><title>" + strings.Repeat("a", 4096) + "</title></head></html>"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	t.Log("Given the need to preview links.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen fetching pages on the local network.", testID)
+		{
+			f := unfurl.New(unfurl.Config{Timeout: time.Second})
+
+			if _, err := f.Fetch(ctx, srv.URL+"/page"); err != unfurl.ErrBlockedAddress {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to fetch private addresses : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to fetch private addresses.", success, testID)
+
+			if _, err := f.Fetch(ctx, "file:///etc/passwd"); err != unfurl.ErrUnsupportedURL {
+				t.Fatalf("\t%s\tTest %d:\tShould refuse to fetch anything but http : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould refuse to fetch anything but http.", success, testID)
+
+			for _, ip := range []string{"127.0.0.1", "10.1.2.3", "169.254.169.254", "::1", "::ffff:192.168.0.1", "fd00::1"} {
+				if unfurl.Public(net.ParseIP(ip)) {
+					t.Fatalf("\t%s\tTest %d:\tShould tell %s is not public.", failed, testID, ip)
+				}
+			}
+			if !unfurl.Public(net.ParseIP("93.184.216.34")) {
+				t.Fatalf("\t%s\tTest %d:\tShould tell public addresses are public.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould tell public addresses apart.", success, testID)
+		}
+
+		testID = 1
+		t.Logf("\tTest %d:\tWhen fetching pages.", testID)
+		{
+			f := unfurl.New(unfurl.Config{Timeout: 100 * time.Millisecond, MaxBytes: 1024, AllowPrivate: true})
+
+			p, err := f.Fetch(ctx, srv.URL+"/page")
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to fetch a page : %v", failed, testID, err)
+			}
+			want := unfurl.Preview{
+				Title:       "The real title",
+				Description: "Fallback description",
+				Image:       srv.URL + "/images/cover.png",
+				SiteName:    "Example",
+			}
+			if p != want {
+				t.Fatalf("\t%s\tTest %d:\tShould extract the preview of the page : got %+v", failed, testID, p)
+			}
+			t.Logf("\t%s\tTest %d:\tShould extract the preview of the page.", success, testID)
+
+			p, err = f.Fetch(ctx, srv.URL+"/image")
+			if err != nil || p.Image != srv.URL+"/image" {
+				t.Fatalf("\t%s\tTest %d:\tShould preview images as themselves : %+v %v", failed, testID, p, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould preview images as themselves.", success, testID)
+
+			p, err = f.Fetch(ctx, srv.URL+"/huge")
+			if err != nil || p.Title != "" {
+				t.Fatalf("\t%s\tTest %d:\tShould stop reading at the size limit : %+v %v", failed, testID, p, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop reading at the size limit.", success, testID)
+
+			if _, err := f.Fetch(ctx, srv.URL+"/slow"); err == nil {
+				t.Fatalf("\t%s\tTest %d:\tShould give up on slow pages.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould give up on slow pages.", success, testID)
+
+			if _, err := f.Fetch(ctx, srv.URL+"/loop"); err != unfurl.ErrTooManyRedirects {
+				t.Fatalf("\t%s\tTest %d:\tShould stop following redirects : %v", failed, testID, err)
+			}
+			t.Logf("\t%s\tTest %d:\tShould stop following redirects.", success, testID)
+		}
+	}
+}
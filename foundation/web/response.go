@@ -50,6 +50,37 @@ func Respond(ctx context.Context, w http.ResponseWriter, data interface{}, statu
 	return nil
 }
 
+// RespondRaw sends data to the client as it is, with given content type.
+func RespondRaw(ctx context.Context, w http.ResponseWriter, data []byte, contentType string, statusCode int) error {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+	v.StatusCode = statusCode
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(statusCode)
+
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Redirect sends the client to url with given redirect status code.
+func Redirect(ctx context.Context, w http.ResponseWriter, r *http.Request, url string, statusCode int) error {
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return NewShutdownError("web value missing from context")
+	}
+	v.StatusCode = statusCode
+
+	http.Redirect(w, r, url, statusCode)
+	return nil
+}
+
 // RespondError sends an error reponse back to the client.
 func RespondError(ctx context.Context, w http.ResponseWriter, err error) error {
 
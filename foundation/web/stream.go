@@ -0,0 +1,83 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// keyConn is how the connection of a request is stored/retrieved.
+const keyConn ctxKey = 2
+
+// ConnContext keeps the connection in the context of its requests, so
+// streams can lift the timeouts of the server. Use it as the ConnContext of
+// http.Server.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, keyConn, c)
+}
+
+// Stream sends Server-Sent Events to the client.
+type Stream struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+// NewStream starts a Server-Sent Events response. The read and write
+// timeouts of the server no longer apply to the connection, so the stream
+// lasts until the client goes away or the handler returns.
+func NewStream(ctx context.Context, w http.ResponseWriter) (*Stream, error) {
+	v, ok := ctx.Value(KeyValues).(*Values)
+	if !ok {
+		return nil, NewShutdownError("web value missing from context")
+	}
+
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("streaming is not supported")
+	}
+
+	if c, ok := ctx.Value(keyConn).(net.Conn); ok {
+		if err := c.SetDeadline(time.Time{}); err != nil {
+			return nil, errors.Wrap(err, "lifting deadline")
+		}
+	}
+
+	v.StatusCode = http.StatusOK
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	f.Flush()
+
+	return &Stream{w: w, f: f}, nil
+}
+
+// Send writes an event with data converted to JSON.
+func (s *Stream) Send(event string, data interface{}) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, jsonData); err != nil {
+		return err
+	}
+	s.f.Flush()
+	return nil
+}
+
+// Ping writes a comment, which keeps proxies from closing an idle stream.
+func (s *Stream) Ping() error {
+	if _, err := fmt.Fprint(s.w, ":\n\n"); err != nil {
+		return err
+	}
+	s.f.Flush()
+	return nil
+}
@@ -0,0 +1,84 @@
+package web_test
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/web"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+func TestStream(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+
+	status := make(chan int, 1)
+	h := func(w http.ResponseWriter, r *http.Request) {
+		v := web.Values{Now: time.Now()}
+		ctx := context.WithValue(r.Context(), web.KeyValues, &v)
+
+		s, err := web.NewStream(ctx, w)
+		if err != nil {
+			t.Errorf("starting stream: %s", err)
+			return
+		}
+		status <- v.StatusCode
+
+		// Outlive the timeouts of the server before writing.
+		time.Sleep(3 * timeout)
+		s.Ping()
+		s.Send("greeting", struct {
+			Text string `json:"text"`
+		}{"hello"})
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(h))
+	srv.Config.ReadTimeout = timeout
+	srv.Config.WriteTimeout = timeout
+	srv.Config.ConnContext = web.ConnContext
+	srv.Start()
+	defer srv.Close()
+
+	t.Log("Given the need to stream events to clients.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a stream lasts longer than the server timeouts.", testID)
+		{
+			resp, err := http.Get(srv.URL)
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould be able to open the stream : %s", failed, testID, err)
+			}
+			defer resp.Body.Close()
+
+			if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+				t.Fatalf("\t%s\tTest %d:\tShould respond with an event stream : got %q", failed, testID, got)
+			}
+			if got := <-status; got != http.StatusOK {
+				t.Fatalf("\t%s\tTest %d:\tShould record the status for logging : got %d", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould respond with an event stream.", success, testID)
+
+			var lines []string
+			sc := bufio.NewScanner(resp.Body)
+			for sc.Scan() {
+				lines = append(lines, sc.Text())
+			}
+			want := ":\n\nevent: greeting\ndata: {\"text\":\"hello\"}\n"
+			if got := strings.Join(lines, "\n"); got != want {
+				t.Logf("\t\tTest %d:\texp: %q", testID, want)
+				t.Logf("\t\tTest %d:\tgot: %q", testID, got)
+				t.Fatalf("\t%s\tTest %d:\tShould get the ping and the event after the timeouts.", failed, testID)
+			}
+			t.Logf("\t%s\tTest %d:\tShould get the ping and the event after the timeouts.", success, testID)
+		}
+	}
+}
@@ -0,0 +1,362 @@
+// Package websocket implements the server side of the WebSocket protocol
+// as described in RFC 6455.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// Message types.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// Close codes.
+const (
+	CloseNormal          = 1000
+	CloseGoingAway       = 1001
+	CloseProtocolError   = 1002
+	CloseInvalidPayload  = 1007
+	ClosePolicyViolation = 1008
+	CloseTooBig          = 1009
+	CloseTryAgainLater   = 1013
+)
+
+// guid is appended to the key of the client to compute the accept key.
+const guid = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// defaultReadLimit is how big messages may be unless SetReadLimit says
+// otherwise.
+const defaultReadLimit = 64 << 10
+
+var (
+	// ErrBadHandshake is returned when the request is not a WebSocket
+	// handshake.
+	ErrBadHandshake = errors.New("not a websocket handshake")
+
+	// ErrTooBig is returned when a message is bigger than the read limit.
+	ErrTooBig = errors.New("message too big")
+
+	// ErrClosed is returned when writing after the connection was closed.
+	ErrClosed = errors.New("websocket closed")
+)
+
+// CloseError is returned when the peer closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+// Error implements the error interface.
+func (ce *CloseError) Error() string {
+	return "websocket closed: " + ce.Reason
+}
+
+// Conn is a WebSocket connection. One goroutine may read while another one
+// writes.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	readLimit int64
+	onPong    func()
+
+	wmu    sync.Mutex
+	closed bool
+}
+
+// Upgrade takes over the connection of the request and completes the
+// handshake. The timeouts of the server no longer apply to the connection.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, ErrBadHandshake
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, ErrBadHandshake
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, ErrBadHandshake
+	}
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection cannot be taken over")
+	}
+	conn, brw, err := h.Hijack()
+	if err != nil {
+		return nil, errors.Wrap(err, "taking over connection")
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "lifting deadline")
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "writing handshake")
+	}
+
+	c := Conn{
+		conn:      conn,
+		br:        brw.Reader,
+		readLimit: defaultReadLimit,
+	}
+	return &c, nil
+}
+
+// SetReadLimit sets how big messages from the peer may be. Bigger messages
+// close the connection.
+func (c *Conn) SetReadLimit(n int64) {
+	c.readLimit = n
+}
+
+// SetReadDeadline sets when a pending read fails.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetPongHandler sets what is called when the peer answers a ping. It runs
+// on the goroutine reading messages.
+func (c *Conn) SetPongHandler(f func()) {
+	c.onPong = f
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and pongs handed to the pong handler while waiting for it. A close from the
+// peer is answered and returned as *CloseError.
+func (c *Conn) ReadMessage() (int, []byte, error) {
+	var (
+		typ int
+		msg []byte
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case PingMessage:
+			if err := c.WriteControl(PongMessage, payload, time.Now().Add(time.Second)); err != nil {
+				return 0, nil, err
+			}
+			continue
+
+		case PongMessage:
+			if c.onPong != nil {
+				c.onPong()
+			}
+			continue
+
+		case CloseMessage:
+			ce := CloseError{Code: CloseNormal}
+			if len(payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(payload))
+				ce.Reason = string(payload[2:])
+			}
+			c.WriteClose(CloseNormal, "", time.Now().Add(time.Second))
+			return 0, nil, &ce
+
+		case 0:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+
+		case TextMessage, BinaryMessage:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			typ = op
+
+		default:
+			return 0, nil, c.fail(CloseProtocolError, "unknown opcode")
+		}
+
+		if int64(len(msg)+len(payload)) > c.readLimit {
+			return 0, nil, c.fail(CloseTooBig, ErrTooBig.Error())
+		}
+		msg = append(msg, payload...)
+
+		if fin {
+			if typ == TextMessage && !utf8.Valid(msg) {
+				return 0, nil, c.fail(CloseInvalidPayload, "invalid utf-8")
+			}
+			return typ, msg, nil
+		}
+	}
+}
+
+// readFrame reads one frame from the peer and unmasks its payload.
+func (c *Conn) readFrame() (bool, int, []byte, error) {
+	var hdr [2]byte
+	if _, err := io.ReadFull(c.br, hdr[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := hdr[0]&0x80 != 0
+	op := int(hdr[0] & 0x0f)
+	if hdr[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	if hdr[1]&0x80 == 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "frame is not masked")
+	}
+
+	size := int64(hdr[1] & 0x7f)
+	switch size {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		size = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if op >= CloseMessage && (size > 125 || !fin) {
+		return false, 0, nil, c.fail(CloseProtocolError, "invalid control frame")
+	}
+	if size < 0 || size > c.readLimit {
+		return false, 0, nil, c.fail(CloseTooBig, ErrTooBig.Error())
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, op, payload, nil
+}
+
+// fail closes the connection because the peer broke the protocol.
+func (c *Conn) fail(code int, reason string) error {
+	c.WriteClose(code, reason, time.Now().Add(time.Second))
+	c.conn.Close()
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// WriteMessage sends a text or binary message. It fails if it cannot be
+// written before deadline, so slow peers do not hold the writer forever.
+func (c *Conn) WriteMessage(typ int, data []byte, deadline time.Time) error {
+	return c.writeFrame(typ, data, deadline)
+}
+
+// WriteControl sends a ping or a pong.
+func (c *Conn) WriteControl(typ int, data []byte, deadline time.Time) error {
+	if len(data) > 125 {
+		return errors.New("control frame too big")
+	}
+	return c.writeFrame(typ, data, deadline)
+}
+
+// WriteClose tells the peer the connection is being closed and why. Nothing
+// can be written afterwards.
+func (c *Conn) WriteClose(code int, reason string, deadline time.Time) error {
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	payload := make([]byte, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	copy(payload[2:], reason)
+
+	if err := c.writeFrame(CloseMessage, payload, deadline); err != nil {
+		return err
+	}
+
+	c.wmu.Lock()
+	c.closed = true
+	c.wmu.Unlock()
+	return nil
+}
+
+// writeFrame sends data as a single unmasked frame.
+func (c *Conn) writeFrame(op int, data []byte, deadline time.Time) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if c.closed {
+		return ErrClosed
+	}
+
+	frame := make([]byte, 0, 10+len(data))
+	frame = append(frame, 0x80|byte(op))
+	switch n := len(data); {
+	case n <= 125:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126, byte(n>>8), byte(n))
+	default:
+		frame = append(frame, 127)
+		frame = append(frame, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(frame[len(frame)-8:], uint64(n))
+	}
+	frame = append(frame, data...)
+
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close closes the underlying connection without telling the peer. Use
+// WriteClose first to close it cleanly.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// acceptKey computes the Sec-WebSocket-Accept header for the key of the client.
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + guid))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains reports whether the comma separated header has the token.
+func headerContains(h http.Header, name string, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
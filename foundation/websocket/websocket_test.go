@@ -0,0 +1,141 @@
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cravtos/asperitas-backend/foundation/websocket"
+)
+
+// Success and failure markers.
+const (
+	success = "\u2713"
+	failed  = "\u2717"
+)
+
+// frame builds a masked frame the way clients send them.
+func frame(op byte, fin bool, payload []byte) []byte {
+	b := []byte{op, 0x80 | byte(len(payload))}
+	if fin {
+		b[0] |= 0x80
+	}
+	mask := []byte{1, 2, 3, 4}
+	b = append(b, mask...)
+	for i, c := range payload {
+		b = append(b, c^mask[i%4])
+	}
+	return b
+}
+
+// readFrame reads an unmasked frame the way servers send them.
+func readFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	var hdr [2]byte
+	if _, err := r.Read(hdr[:1]); err != nil {
+		t.Fatalf("reading frame : %v", err)
+	}
+	if _, err := r.Read(hdr[1:]); err != nil {
+		t.Fatalf("reading frame : %v", err)
+	}
+	payload := make([]byte, hdr[1]&0x7f)
+	for i := range payload {
+		c, err := r.ReadByte()
+		if err != nil {
+			t.Fatalf("reading frame : %v", err)
+		}
+		payload[i] = c
+	}
+	return hdr[0] & 0x0f, payload
+}
+
+func TestConn(t *testing.T) {
+	received := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := websocket.Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer c.Close()
+
+		_, msg, err := c.ReadMessage()
+		if err != nil {
+			received <- err.Error()
+			return
+		}
+		received <- string(msg)
+		c.WriteMessage(websocket.TextMessage, msg, time.Now().Add(time.Second))
+
+		_, _, err = c.ReadMessage()
+		if ce, ok := err.(*websocket.CloseError); ok {
+			received <- ce.Reason
+		}
+	}))
+	defer srv.Close()
+
+	t.Log("Given the need to talk to clients over WebSocket.")
+	{
+		testID := 0
+		t.Logf("\tTest %d:\tWhen a client completes the handshake.", testID)
+		{
+			conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+			if err != nil {
+				t.Fatalf("\t%s\tTest %d:\tShould connect : %v", failed, testID, err)
+			}
+			defer conn.Close()
+
+			req := "GET / HTTP/1.1\r\nHost: test\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n" +
+				"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n\r\n"
+			conn.Write([]byte(req))
+
+			r := bufio.NewReader(conn)
+			resp, err := http.ReadResponse(r, nil)
+			if err != nil || resp.StatusCode != http.StatusSwitchingProtocols {
+				t.Fatalf("\t%s\tTest %d:\tShould switch protocols : %v", failed, testID, err)
+			}
+			if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+				t.Fatalf("\t%s\tTest %d:\tShould accept the key : %s", failed, testID, got)
+			}
+			t.Logf("\t%s\tTest %d:\tShould accept the key.", success, testID)
+
+			conn.Write(frame(websocket.TextMessage, false, []byte("hel")))
+			conn.Write(frame(websocket.PingMessage, true, []byte("p")))
+			conn.Write(frame(0, true, []byte("lo")))
+
+			op, payload := readFrame(t, r)
+			if op != websocket.PongMessage || string(payload) != "p" {
+				t.Fatalf("\t%s\tTest %d:\tShould answer pings between fragments : %d %q", failed, testID, op, payload)
+			}
+			t.Logf("\t%s\tTest %d:\tShould answer pings between fragments.", success, testID)
+
+			if msg := <-received; msg != "hello" {
+				t.Fatalf("\t%s\tTest %d:\tShould join fragments : %q", failed, testID, msg)
+			}
+			t.Logf("\t%s\tTest %d:\tShould join fragments.", success, testID)
+
+			op, payload = readFrame(t, r)
+			if op != websocket.TextMessage || string(payload) != "hello" {
+				t.Fatalf("\t%s\tTest %d:\tShould send messages : %d %q", failed, testID, op, payload)
+			}
+			t.Logf("\t%s\tTest %d:\tShould send messages.", success, testID)
+
+			closing := make([]byte, 2, 6)
+			binary.BigEndian.PutUint16(closing, websocket.CloseNormal)
+			conn.Write(frame(websocket.CloseMessage, true, append(closing, "bye"...)))
+
+			if reason := <-received; reason != "bye" {
+				t.Fatalf("\t%s\tTest %d:\tShould report the close : %q", failed, testID, reason)
+			}
+			op, _ = readFrame(t, r)
+			if op != websocket.CloseMessage {
+				t.Fatalf("\t%s\tTest %d:\tShould answer the close : %d", failed, testID, op)
+			}
+			t.Logf("\t%s\tTest %d:\tShould answer the close.", success, testID)
+		}
+	}
+}